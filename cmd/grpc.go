@@ -9,13 +9,14 @@ import (
 )
 
 var naming string
+var transcoding bool
 
 var grpcCmd = &cobra.Command{
 	Use:   "grpc",
 	Short: "generate grpc service",
 	Long:  ``,
 	Run: func(cmd *cobra.Command, args []string) {
-		s := svc.NewSvc("")
+		s := svc.NewSvc("", svc.WithTranscoding(transcoding))
 		fn := strcase.ToLowerCamel
 		switch naming {
 		case "snake":
@@ -28,4 +29,5 @@ var grpcCmd = &cobra.Command{
 func init() {
 	svcCmd.AddCommand(grpcCmd)
 	grpcCmd.Flags().StringVarP(&naming, "naming", "n", "lowerCamel", `protobuf message field naming strategy, only support "lowerCamel" and "snake"`)
+	grpcCmd.Flags().BoolVarP(&transcoding, "http", "", false, `whether generate grpc-json transcoding routes and openapi 3.0 json document, so that unary rpcs are served as REST apis as well`)
 }
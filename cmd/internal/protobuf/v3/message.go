@@ -214,7 +214,7 @@ func (receiver ProtoGenerator) MessageOf(ft string) ProtobufType {
 		return Bool
 	case "string", "error", "[]rune", "decimal.Decimal":
 		return String
-	case "[]byte", "v3.FileModel", "os.File":
+	case "[]byte", "v3.FileModel", "v3.Stream", "os.File":
 		return Bytes
 	case "float32":
 		return Float
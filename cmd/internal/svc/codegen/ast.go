@@ -15,7 +15,7 @@ import (
 // Not support alias type (all alias type fields of a struct will be outputted as v3.Any in openapi 3.0 json document)
 // Support anonymous struct type
 // as struct field type in vo and dto package
-// or as parameter type in method signature in svc.go file besides context.Context, multipart.FileHeader, v3.FileModel, os.File
+// or as parameter type in method signature in svc.go file besides context.Context, multipart.FileHeader, v3.FileModel, v3.Stream, os.File
 // when odin command line flag doc is true
 func ExprStringP(expr ast.Expr) string {
 	switch _expr := expr.(type) {
@@ -64,6 +64,7 @@ func parseSelectorExpr(expr *ast.SelectorExpr) string {
 		result != "context.Context" &&
 		result != "time.Time" &&
 		result != "v3.FileModel" &&
+		result != "v3.Stream" &&
 		result != "multipart.FileHeader" &&
 		result != "decimal.Decimal" &&
 		result != "os.File" {
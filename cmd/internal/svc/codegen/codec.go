@@ -0,0 +1,57 @@
+package codegen
+
+import (
+	"fmt"
+	"github.com/iancoleman/strcase"
+	"github.com/youminxue/odin/toolkit/astutils"
+	"strings"
+)
+
+// protoMessageOf returns name of the protobuf message odin svc grpc generates for struct type t of vo or dto package
+func protoMessageOf(t string) (string, bool) {
+	t = strings.TrimPrefix(t, "*")
+	if !strings.HasPrefix(t, "vo.") && !strings.HasPrefix(t, "dto.") {
+		return "", false
+	}
+	return strcase.ToCamel(t[strings.Index(t, ".")+1:]), true
+}
+
+// protoRequestOptions returns rest.BodyOption arguments to send body parameter p of method as protobuf.
+// Like the gRPC request message, a single struct parameter is the message itself,
+// otherwise it is a field of the request message of the rpc.
+func protoRequestOptions(method astutils.MethodMeta, p astutils.FieldMeta, caseconvertor func(string) string) string {
+	var params []astutils.FieldMeta
+	for _, item := range method.Params {
+		if item.Type != "context.Context" {
+			params = append(params, item)
+		}
+	}
+	if len(params) == 1 {
+		if message, ok := protoMessageOf(p.Type); ok {
+			return fmt.Sprintf(`, rest.WithProtoMessage("%s")`, message)
+		}
+	}
+	return fmt.Sprintf(`, rest.WithProtoMessage("%sRpcRequest"), rest.WithProtoField("%s")`,
+		strcase.ToCamel(method.Name), caseconvertor(p.Name))
+}
+
+// protoResponseOptions returns rest.BodyOption arguments to send results of method as protobuf.
+// Like the gRPC response message, a single struct result is the message itself, whose variable is named by valueOf,
+// otherwise the results are fields of the response message of the rpc. Methods without result have no protobuf response.
+func protoResponseOptions(method astutils.MethodMeta, valueOf func(result string) string) string {
+	var results []astutils.FieldMeta
+	for _, item := range method.Results {
+		if item.Type != "error" {
+			results = append(results, item)
+		}
+	}
+	if len(results) == 0 {
+		return ""
+	}
+	if len(results) == 1 {
+		if message, ok := protoMessageOf(results[0].Type); ok {
+			return fmt.Sprintf(`, rest.WithProtoMessage("%s"), rest.WithProtoValue(%s)`, message, valueOf(results[0].Name))
+		}
+	}
+	return fmt.Sprintf(`, rest.WithProtoMessage("%sRpcResponse")`, strcase.ToCamel(method.Name))
+}
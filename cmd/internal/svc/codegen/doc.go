@@ -108,8 +108,12 @@ func operationOf(method astutils.MethodMeta, httpMethod string) v3.Operation {
 					pschema := v3.CopySchema(item)
 					v3.RefAddDoc(&pschema, strings.Join(item.Comments, "\n"))
 					required := !v3.IsOptional(item.Type)
+					name := strcase.ToLowerCamel(item.Name)
+					if stringutils.IsEmpty(method.Path) {
+						name = strings.ToLower(name)
+					}
 					param := v3.Parameter{
-						Name:        strings.ToLower(strcase.ToLowerCamel(item.Name)),
+						Name:        name,
 						In:          v3.InPath,
 						Schema:      &pschema,
 						Description: pschema.Description,
@@ -135,16 +139,32 @@ func operationOf(method astutils.MethodMeta, httpMethod string) v3.Operation {
 						Required:    required,
 					}
 					if item.IsPathVariable {
-						param.Name = strings.ToLower(param.Name)
+						if stringutils.IsEmpty(method.Path) {
+							param.Name = strings.ToLower(param.Name)
+						}
 						param.In = v3.InPath
 					}
 					params = append(params, param)
+				} else if v3.IsStream(item.Type) {
+					// stream is sent as NDJSON items unless the client sets other content type
+					ret.RequestBody = &v3.RequestBody{
+						Content: &v3.Content{
+							NDJSON: &v3.MediaType{
+								Schema: &pschema,
+							},
+						},
+						Required: required,
+					}
 				} else {
 					var content v3.Content
 					mt := &v3.MediaType{
 						Schema: &pschema,
 					}
 					reflect.ValueOf(&content).Elem().FieldByName("JSON").Set(reflect.ValueOf(mt))
+					// generated handlers decode request body by Content-Type, see rest.DecodeBody
+					content.MsgPack = mt
+					content.Protobuf = mt
+					content.FormURL = mt
 					ret.RequestBody = &v3.RequestBody{
 						Content:  &content,
 						Required: required,
@@ -161,7 +181,7 @@ func operationOf(method astutils.MethodMeta, httpMethod string) v3.Operation {
 
 func response(method astutils.MethodMeta) *v3.Responses {
 	var respContent v3.Content
-	var hasFile bool
+	var hasFile, hasStream bool
 	var fileDoc string
 	for _, item := range method.Results {
 		if item.Type == "*os.File" {
@@ -169,8 +189,23 @@ func response(method astutils.MethodMeta) *v3.Responses {
 			fileDoc = strings.Join(item.Comments, "\n")
 			break
 		}
+		if v3.IsStream(item.Type) {
+			hasStream = true
+			fileDoc = strings.Join(item.Comments, "\n")
+			break
+		}
 	}
-	if hasFile {
+	if hasStream {
+		// items are written as NDJSON, or as server-sent events if the client accepts text/event-stream
+		mt := &v3.MediaType{
+			Schema: &v3.Schema{
+				Type:        v3.ObjectT,
+				Description: fileDoc,
+			},
+		}
+		respContent.NDJSON = mt
+		respContent.EventStream = mt
+	} else if hasFile {
 		respContent.Stream = &v3.MediaType{
 			Schema: &v3.Schema{
 				Type:        v3.StringT,
@@ -207,6 +242,11 @@ func response(method astutils.MethodMeta) *v3.Responses {
 				Ref: "#/components/schemas/" + title,
 			},
 		}
+		// generated handlers encode response body by Accept header, see rest.WriteBody
+		respContent.MsgPack = respContent.JSON
+		if len(respSchema.Properties) > 0 {
+			respContent.Protobuf = respContent.JSON
+		}
 	}
 	return &v3.Responses{
 		Resp200: &v3.Response{
@@ -287,11 +327,11 @@ func postFormUrl(method astutils.MethodMeta) *v3.RequestBody {
 	}
 }
 
-// GetShelves_ShelfBooks_Book
-// shelves/:shelf/books/:book
-func apiPattern(method string) string {
-	ret := astutils.Pattern(method)
-	splits := strings.Split(ret, "/")
+// openAPIPattern converts path variables such as :shelf in pattern to {shelf}
+// /shelves/:shelf/books/:book
+// /shelves/{shelf}/books/{book}
+func openAPIPattern(pattern string) string {
+	splits := strings.Split(pattern, "/")
 	var partials []string
 	for _, v := range splits {
 		if strings.HasPrefix(v, ":") {
@@ -310,11 +350,8 @@ func pathsOf(ic astutils.InterfaceCollector, routePatternStrategy int) map[strin
 	pathmap := make(map[string]v3.Path)
 	inter := ic.Interfaces[0]
 	for _, method := range inter.Methods {
-		endpoint := fmt.Sprintf("/%s", apiPattern(method.Name))
-		if routePatternStrategy == 1 {
-			endpoint = fmt.Sprintf("/%s/%s", strings.ToLower(inter.Name), noSplitPattern(method.Name))
-		}
-		hm := httpMethod(method.Name)
+		endpoint := openAPIPattern(routePattern(method, inter.Name, routePatternStrategy))
+		hm := routeMethod(method)
 		op := operationOf(method, hm)
 		if val, ok := pathmap[endpoint]; ok {
 			reflect.ValueOf(&val).Elem().FieldByName(strings.Title(strings.ToLower(hm))).Set(reflect.ValueOf(&op))
@@ -340,6 +377,16 @@ func init() {
 // GenDoc generates OpenAPI 3.0 description json file.
 // Not support alias type in vo or dto file.
 func GenDoc(dir string, ic astutils.InterfaceCollector, routePatternStrategy int) {
+	writeDoc(dir, ic, pathsOf(ic, routePatternStrategy), v3.Schemas)
+}
+
+// docFileOf returns path of OpenAPI 3.0 description json file of the service
+func docFileOf(dir string, ic astutils.InterfaceCollector) string {
+	return filepath.Join(dir, strings.ToLower(ic.Interfaces[0].Name)+"_openapi3.json")
+}
+
+// writeDoc writes OpenAPI 3.0 description json file of paths and schemas, and the go file serving it
+func writeDoc(dir string, ic astutils.InterfaceCollector, paths map[string]v3.Path, schemas map[string]v3.Schema) {
 	var (
 		err     error
 		svcname string
@@ -348,13 +395,12 @@ func GenDoc(dir string, ic astutils.InterfaceCollector, routePatternStrategy int
 		fi      os.FileInfo
 		api     v3.API
 		data    []byte
-		paths   map[string]v3.Path
 		tpl     *template.Template
 		sqlBuf  bytes.Buffer
 		source  string
 	)
 	svcname = ic.Interfaces[0].Name
-	docfile = filepath.Join(dir, strings.ToLower(svcname)+"_openapi3.json")
+	docfile = docFileOf(dir, ic)
 	fi, err = os.Stat(docfile)
 	if err != nil && !os.IsNotExist(err) {
 		panic(err)
@@ -370,7 +416,6 @@ func GenDoc(dir string, ic astutils.InterfaceCollector, routePatternStrategy int
 	if fi != nil {
 		logrus.Warningln("file " + gofile + " will be overwritten")
 	}
-	paths = pathsOf(ic, routePatternStrategy)
 	api = v3.API{
 		Openapi: "3.0.2",
 		Info: &v3.Info{
@@ -385,7 +430,7 @@ func GenDoc(dir string, ic astutils.InterfaceCollector, routePatternStrategy int
 		},
 		Paths: paths,
 		Components: &v3.Components{
-			Schemas: v3.Schemas,
+			Schemas: schemas,
 		},
 	}
 	data, err = json.Marshal(api)
@@ -1,11 +1,14 @@
 package codegen
 
 import (
+	"encoding/json"
 	"fmt"
 	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
 	"github.com/youminxue/odin/toolkit/astutils"
 	v3helper "github.com/youminxue/odin/toolkit/openapi/v3"
 	"github.com/youminxue/odin/toolkit/pathutils"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
@@ -154,3 +157,30 @@ func Test_pathsOf(t *testing.T) {
 		})
 	}
 }
+
+func TestGenDoc_stream(t *testing.T) {
+	dir := filepath.Join(testDir, "streamsvc")
+	docfile := filepath.Join(dir, "streamsvc_openapi3.json")
+	defer os.Remove(docfile)
+	defer os.Remove(filepath.Join(dir, "streamsvc_openapi3.go"))
+	ic := astutils.BuildInterfaceCollector(filepath.Join(dir, "svc.go"), ExprStringP)
+	GenDoc(dir, ic, 1)
+
+	data, err := ioutil.ReadFile(docfile)
+	assert.NoError(t, err)
+	var api v3helper.API
+	assert.NoError(t, json.Unmarshal(data, &api))
+	listEvents := api.Paths["/streamsvc/listevents"].Post
+	if assert.NotNil(t, listEvents) {
+		content := listEvents.Responses.Resp200.Content
+		assert.NotNil(t, content.NDJSON)
+		assert.NotNil(t, content.EventStream)
+		assert.Nil(t, content.JSON)
+		assert.Equal(t, "events are written as NDJSON or server-sent events", content.NDJSON.Schema.Description)
+	}
+	importEvents := api.Paths["/streamsvc/importevents"].Post
+	if assert.NotNil(t, importEvents) {
+		assert.NotNil(t, importEvents.RequestBody.Content.NDJSON)
+		assert.Nil(t, importEvents.RequestBody.Content.JSON)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	v3 "github.com/youminxue/odin/cmd/internal/protobuf/v3"
 	"github.com/youminxue/odin/toolkit/astutils"
 	"github.com/youminxue/odin/version"
+	"golang.org/x/tools/imports"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
@@ -62,7 +64,92 @@ func main() {
 }
 `
 
-// GenMainGrpc generates main function for grpc service
+var mainTmplGrpcHttp = `/**
+* Generated by odin {{.Version}}.
+* You can edit it as your need.
+*/
+package main
+
+import (
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	grpczerolog "github.com/grpc-ecosystem/go-grpc-middleware/providers/zerolog/v2"
+	grpc_recovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	grpc_opentracing "github.com/grpc-ecosystem/go-grpc-middleware/tracing/opentracing"
+	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
+	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/tags"
+	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
+	"github.com/youminxue/odin/framework/auth"
+	"github.com/youminxue/odin/framework/grpcx"
+	"github.com/youminxue/odin/framework/rest"
+	"github.com/youminxue/odin/toolkit/zlogger"
+	"google.golang.org/grpc"
+	{{.ServiceAlias}} "{{.ServicePackage}}"
+	"{{.ConfigPackage}}"
+	{{- if .WithTranscoding }}
+	"{{.TranscodingPackage}}"
+	{{- else }}
+	"{{.HttpPackage}}"
+	{{- end }}
+	pb "{{.PbPackage}}"
+)
+
+func main() {
+	conf := config.LoadFromEnv()
+	svc := {{.ServiceAlias}}.New{{.SvcName}}(conf)
+	grpcServer := grpcx.NewGrpcServer(
+		grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(
+			grpc_ctxtags.StreamServerInterceptor(),
+			grpc_opentracing.StreamServerInterceptor(),
+			grpc_prometheus.StreamServerInterceptor,
+			tags.StreamServerInterceptor(tags.WithFieldExtractor(tags.CodeGenRequestFieldExtractor)),
+			logging.StreamServerInterceptor(grpczerolog.InterceptorLogger(zlogger.Logger)),
+			grpc_recovery.StreamServerInterceptor(),
+		)),
+		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(
+			grpc_ctxtags.UnaryServerInterceptor(),
+			grpc_opentracing.UnaryServerInterceptor(),
+			grpc_prometheus.UnaryServerInterceptor,
+			tags.UnaryServerInterceptor(tags.WithFieldExtractor(tags.CodeGenRequestFieldExtractor)),
+			logging.UnaryServerInterceptor(grpczerolog.InterceptorLogger(zlogger.Logger)),
+			grpc_recovery.UnaryServerInterceptor(),
+		)),
+	)
+	pb.Register{{.GrpcSvcName}}Server(grpcServer, svc)
+
+	{{- if .WithTranscoding }}
+	srv := rest.NewRestServer()
+	// unary rpcs are served as REST apis as well, authorized by annotations of rpcs if GDD_AUTH_ENABLE is true
+	srv.AddMiddleware(rest.AuthByMethod(auth.NewAuthorizerFromConfig(pb.MethodAnnotationStore), transcoding.FullMethods))
+	srv.AddRoute(transcoding.Routes(svc)...)
+	{{- else }}
+	handler := httpsrv.New{{.SvcName}}Handler(svc)
+	srv := rest.NewRestServer()
+	// set GDD_AUTH_ENABLE=true to enforce @auth and @role annotations
+	srv.AddMiddleware(rest.Auth(auth.NewAuthorizerFromConfig(httpsrv.RouteAnnotationStore)))
+	srv.AddRoute(httpsrv.Routes(handler)...)
+	{{- end }}
+	// set GDD_SINGLE_PORT_ENABLE=true to serve both http and grpc requests on GDD_PORT
+	srv.RunWithGrpc(grpcServer)
+}
+`
+
+type grpcMainData struct {
+	ServicePackage     string
+	ConfigPackage      string
+	HttpPackage        string
+	TranscodingPackage string
+	PbPackage          string
+	SvcName            string
+	ServiceAlias       string
+	Version            string
+	GrpcSvcName        string
+	WithTranscoding    bool
+}
+
+// GenMainGrpc generates main function for grpc service. If the service has http transport or grpc-json transcoding
+// routes as well, the generated main function runs both http and grpc servers. An existing main.go is replaced only
+// if it is still the same as generated by odin.
 func GenMainGrpc(dir string, ic astutils.InterfaceCollector, grpcSvc v3.Service) {
 	var (
 		err       error
@@ -73,58 +160,105 @@ func GenMainGrpc(dir string, ic astutils.InterfaceCollector, grpcSvc v3.Service)
 		f         *os.File
 		tpl       *template.Template
 		cmdDir    string
-		svcName   string
-		alias     string
 		sqlBuf    bytes.Buffer
 		source    string
+		withHttp  bool
+		data      grpcMainData
 	)
 	cmdDir = filepath.Join(dir, "cmd")
 	if err = MkdirAll(cmdDir, os.ModePerm); err != nil {
 		panic(err)
 	}
 
-	svcName = ic.Interfaces[0].Name
-	alias = ic.Package.Name
 	mainfile = filepath.Join(cmdDir, "main.go")
-	if _, err = Stat(mainfile); os.IsNotExist(err) {
-		modfile = filepath.Join(dir, "go.mod")
-		if f, err = Open(modfile); err != nil {
-			panic(err)
-		}
-		reader := bufio.NewReader(f)
-		firstLine, _ = reader.ReadString('\n')
-		modName = strings.TrimSpace(strings.TrimPrefix(firstLine, "module"))
+	modfile = filepath.Join(dir, "go.mod")
+	if f, err = Open(modfile); err != nil {
+		panic(err)
+	}
+	reader := bufio.NewReader(f)
+	firstLine, _ = reader.ReadString('\n')
+	f.Close()
+	modName = strings.TrimSpace(strings.TrimPrefix(firstLine, "module"))
 
-		if f, err = Create(mainfile); err != nil {
-			panic(err)
+	data = grpcMainData{
+		ServicePackage:     modName,
+		ConfigPackage:      modName + "/config",
+		HttpPackage:        modName + "/transport/httpsrv",
+		TranscodingPackage: modName + "/transport/transcoding",
+		PbPackage:          modName + "/transport/grpc",
+		SvcName:            ic.Interfaces[0].Name,
+		ServiceAlias:       ic.Package.Name,
+		Version:            version.Release,
+		GrpcSvcName:        grpcSvc.Name,
+	}
+	if _, err = Stat(filepath.Join(dir, "transport", "transcoding", "routes.go")); err == nil {
+		data.WithTranscoding = true
+	}
+	if _, err = Stat(filepath.Join(dir, "transport", "httpsrv", "handler.go")); err == nil {
+		withHttp = true
+	}
+	if _, err = Stat(mainfile); os.IsNotExist(err) || isUntouchedMain(mainfile, data) {
+		tmpl := mainTmplGrpc
+		if withHttp || data.WithTranscoding {
+			tmpl = mainTmplGrpcHttp
 		}
-		defer f.Close()
-
-		if tpl, err = template.New("main.go.tmpl").Parse(mainTmplGrpc); err != nil {
+		if withHttp && data.WithTranscoding {
+			logrus.Warnf("routes of transport/httpsrv are not served in favor of grpc-json transcoding routes")
+		}
+		if tpl, err = template.New("main.go.tmpl").Parse(tmpl); err != nil {
 			panic(err)
 		}
-		if err = tpl.Execute(&sqlBuf, struct {
-			ServicePackage string
-			ConfigPackage  string
-			PbPackage      string
-			SvcName        string
-			ServiceAlias   string
-			Version        string
-			GrpcSvcName    string
-		}{
-			ServicePackage: modName,
-			ConfigPackage:  modName + "/config",
-			PbPackage:      modName + "/transport/grpc",
-			SvcName:        svcName,
-			ServiceAlias:   alias,
-			Version:        version.Release,
-			GrpcSvcName:    grpcSvc.Name,
-		}); err != nil {
+		if err = tpl.Execute(&sqlBuf, data); err != nil {
 			panic(err)
 		}
 		source = strings.TrimSpace(sqlBuf.String())
 		astutils.FixImport([]byte(source), mainfile)
 	} else {
 		logrus.Warnf("file %s already exists", mainfile)
+		if withHttp || data.WithTranscoding {
+			logrus.Warnf("call srv.RunWithGrpc(grpcServer) in file %s to run http and grpc servers together", mainfile)
+		}
+	}
+}
+
+// isUntouchedMain checks whether mainfile is the same as generated by GenMain or GenMainGrpc before,
+// so that it can be replaced safely
+func isUntouchedMain(mainfile string, data grpcMainData) bool {
+	existing, err := ioutil.ReadFile(mainfile)
+	if err != nil {
+		return false
+	}
+	if rendered, err := renderMain(mainTmpl, data); err == nil && bytes.Equal(existing, rendered) {
+		return true
+	}
+	for _, tmpl := range []string{mainTmplGrpc, mainTmplGrpcHttp} {
+		for _, withTranscoding := range []bool{false, true} {
+			data.WithTranscoding = withTranscoding
+			rendered, err := renderMain(tmpl, data)
+			if err != nil {
+				continue
+			}
+			if formatted, err := imports.Process(mainfile, bytes.TrimSpace(rendered), &imports.Options{
+				TabWidth:  8,
+				TabIndent: true,
+				Comments:  true,
+				Fragment:  true,
+			}); err == nil && bytes.Equal(existing, formatted) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func renderMain(tmpl string, data grpcMainData) ([]byte, error) {
+	var buf bytes.Buffer
+	tpl, err := template.New("main.go.tmpl").Parse(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	if err = tpl.Execute(&buf, data); err != nil {
+		return nil, err
 	}
+	return buf.Bytes(), nil
 }
@@ -0,0 +1,88 @@
+package codegen
+
+import (
+	"bytes"
+	"github.com/youminxue/odin/version"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/sirupsen/logrus"
+	v3 "github.com/youminxue/odin/cmd/internal/protobuf/v3"
+	"github.com/youminxue/odin/toolkit/astutils"
+)
+
+var protoMessageTmpl = `/**
+* Generated by odin {{.Version}}.
+* Don't edit!
+*/
+package grpc
+
+import (
+	"github.com/youminxue/odin/framework/rest"
+	"google.golang.org/protobuf/proto"
+)
+
+// init registers messages of {{.GrpcSvc.Name}}, so that http handlers and clients can send request and response bodies
+// as application/x-protobuf
+func init() {
+	{{- range $m := .Messages }}
+	rest.RegisterProtoMessage("{{$m.Name}}", func() proto.Message { return new({{$m.Name}}) })
+	{{- end }}
+}
+`
+
+// GenProtoMessageStore generates transport/grpc/message.go registering protobuf messages of grpcSvc with rest package
+func GenProtoMessageStore(dir string, grpcSvc v3.Service) {
+	var (
+		err         error
+		messageFile string
+		f           *os.File
+		tpl         *template.Template
+		grpcDir     string
+		source      string
+		buf         bytes.Buffer
+		fi          os.FileInfo
+		messages    []v3.Message
+	)
+	grpcDir = filepath.Join(dir, "transport/grpc")
+	if err = os.MkdirAll(grpcDir, os.ModePerm); err != nil {
+		panic(err)
+	}
+	messageFile = filepath.Join(grpcDir, "message.go")
+	fi, err = os.Stat(messageFile)
+	if err != nil && !os.IsNotExist(err) {
+		panic(err)
+	}
+	if fi != nil {
+		logrus.Warningln("file message.go will be overwritten")
+	}
+	if f, err = os.Create(messageFile); err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	for _, item := range grpcSvc.Messages {
+		if item.IsImported || strings.Contains(item.Name, ".") || strings.Contains(item.Name, " ") {
+			continue
+		}
+		messages = append(messages, item)
+	}
+	if tpl, err = template.New("message.go.tmpl").Parse(protoMessageTmpl); err != nil {
+		panic(err)
+	}
+	if err = tpl.Execute(&buf, struct {
+		GrpcSvc  v3.Service
+		Messages []v3.Message
+		Version  string
+	}{
+		GrpcSvc:  grpcSvc,
+		Messages: messages,
+		Version:  version.Release,
+	}); err != nil {
+		panic(err)
+	}
+	source = strings.TrimSpace(buf.String())
+	astutils.FixImport([]byte(source), messageFile)
+}
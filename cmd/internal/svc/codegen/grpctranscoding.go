@@ -0,0 +1,431 @@
+package codegen
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/iancoleman/strcase"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	v3 "github.com/youminxue/odin/cmd/internal/protobuf/v3"
+	"github.com/youminxue/odin/toolkit/astutils"
+	v3Helper "github.com/youminxue/odin/toolkit/openapi/v3"
+	"github.com/youminxue/odin/toolkit/sliceutils"
+	"github.com/youminxue/odin/version"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"text/template"
+)
+
+var transcodingTmpl = `/**
+* Generated by odin {{.Version}}.
+* Don't edit!
+*/
+package transcoding
+
+import (
+	"context"
+	"github.com/youminxue/odin/framework/rest"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	pb "{{.PbPackage}}"
+)
+
+// FullMethods maps names of REST routes to full methods of rpcs serving them, for authorizing transcoded requests
+// with annotations of rpcs by rest.AuthByMethod
+var FullMethods = map[string]string{
+	{{- range $r := .Rules }}
+	"{{$r.Name}}": "/{{$.GrpcSvcPackage}}.{{$.GrpcSvcName}}/{{$r.Rpc.Name}}",
+	{{- end }}
+}
+
+// Routes returns REST routes of unary rpcs of {{.GrpcSvcName}}, requests are transcoded to rpc requests and
+// served by server directly
+func Routes(server pb.{{.GrpcSvcName}}Server) []rest.Route {
+	return []rest.Route{
+		{{- range $r := .Rules }}
+		{
+			Name:    "{{$r.Name}}",
+			Method:  "{{$r.Method}}",
+			Pattern: "{{$r.Pattern}}",
+			HandlerFunc: rest.Transcode({{ if eq $r.Body "*" }}rest.TranscodeBodyAll{{ else }}""{{ end }}, func() proto.Message {
+				return new({{$r.Rpc.Request | convert}})
+			}, func(ctx context.Context, req proto.Message) (proto.Message, error) {
+				return server.{{$r.Rpc.Name}}(ctx, req.(*{{$r.Rpc.Request | convert}}))
+			}),
+		},
+		{{- end }}
+	}
+}
+`
+
+// httpRule maps a unary rpc onto a REST api, in the way of google.api.http option
+type httpRule struct {
+	// Name is the method name of service interface
+	Name string
+	// Method is http method
+	Method string
+	// Pattern is url pattern with path variables such as :id
+	Pattern string
+	// Body is "*" if request message is decoded from request body, or empty if it is from query parameters
+	Body string
+	Rpc  v3.Rpc
+}
+
+// httpRulesOf derives http rules of unary rpcs of grpcSvc from methods of the service interface. Http method and
+// url pattern follow the same conventions as http handlers generated by odin svc http, such as GetBooks_Id for
+// GET /books/:id, and @route annotation overrides them. Streaming rpcs are not transcoded.
+func httpRulesOf(ic astutils.InterfaceCollector, grpcSvc v3.Service) []httpRule {
+	var rules []httpRule
+	inter := ic.Interfaces[0]
+	for _, method := range inter.Methods {
+		rpcName := strcase.ToCamel(method.Name) + "Rpc"
+		for _, rpc := range grpcSvc.Rpcs {
+			if rpc.Name != rpcName {
+				continue
+			}
+			if rpc.StreamType != 0 {
+				logrus.Warnf("streaming rpc %s is not transcoded", rpc.Name)
+				break
+			}
+			rule := httpRule{
+				Name:    method.Name,
+				Method:  routeMethod(method),
+				Pattern: routePattern(method, inter.Name, 0),
+				Rpc:     rpc,
+			}
+			if !sliceutils.StringContains([]string{"GET", "DELETE", "HEAD", "OPTIONS"}, rule.Method) {
+				rule.Body = "*"
+			}
+			rules = append(rules, rule)
+			break
+		}
+	}
+	return rules
+}
+
+// GenGrpcTranscoding generates grpc-json transcoding routes in transport/transcoding package, which serve unary rpcs
+// of grpcSvc as REST apis by RestServer
+func GenGrpcTranscoding(dir string, ic astutils.InterfaceCollector, grpcSvc v3.Service) {
+	var (
+		err            error
+		modfile        string
+		modName        string
+		firstLine      string
+		f              *os.File
+		tpl            *template.Template
+		transcodingDir string
+		routesfile     string
+		sqlBuf         bytes.Buffer
+		source         string
+	)
+	transcodingDir = filepath.Join(dir, "transport", "transcoding")
+	if err = MkdirAll(transcodingDir, os.ModePerm); err != nil {
+		panic(err)
+	}
+	routesfile = filepath.Join(transcodingDir, "routes.go")
+	if _, err = Stat(routesfile); err == nil {
+		logrus.Warningln("file " + routesfile + " will be overwritten")
+	}
+	modfile = filepath.Join(dir, "go.mod")
+	if f, err = Open(modfile); err != nil {
+		panic(err)
+	}
+	reader := bufio.NewReader(f)
+	firstLine, _ = reader.ReadString('\n')
+	f.Close()
+	modName = strings.TrimSpace(strings.TrimPrefix(firstLine, "module"))
+
+	funcMap := make(map[string]interface{})
+	funcMap["convert"] = convert
+	if tpl, err = template.New("transcoding.go.tmpl").Funcs(funcMap).Parse(transcodingTmpl); err != nil {
+		panic(err)
+	}
+	if err = tpl.Execute(&sqlBuf, struct {
+		PbPackage      string
+		GrpcSvcName    string
+		GrpcSvcPackage string
+		Version        string
+		Rules          []httpRule
+	}{
+		PbPackage:      modName + "/transport/grpc",
+		GrpcSvcName:    grpcSvc.Name,
+		GrpcSvcPackage: grpcSvc.Package,
+		Version:        version.Release,
+		Rules:          httpRulesOf(ic, grpcSvc),
+	}); err != nil {
+		panic(err)
+	}
+	source = strings.TrimSpace(sqlBuf.String())
+	astutils.FixImport([]byte(source), routesfile)
+}
+
+// GenGrpcTranscodingDoc adds grpc-json transcoding routes to OpenAPI 3.0 description json file generated by GenDoc,
+// so that the http service and the transcoded grpc service share one document. Schemas are derived from protobuf
+// messages, so property names are json names of message fields. Operations and schemas of the http service win
+// on conflicts.
+func GenGrpcTranscodingDoc(dir string, ic astutils.InterfaceCollector, grpcSvc v3.Service) {
+	paths, schemas := loadDoc(docFileOf(dir, ic))
+	for _, rule := range httpRulesOf(ic, grpcSvc) {
+		endpoint := openAPIPattern(rule.Pattern)
+		op := transcodingOperationOf(rule)
+		path := paths[endpoint]
+		field := reflect.ValueOf(&path).Elem().FieldByName(strings.Title(strings.ToLower(rule.Method)))
+		if !field.IsNil() {
+			// main serves transcoding routes instead of routes of transport/httpsrv, see GenMainGrpc
+			logrus.Warningf("%s %s is served by grpc-json transcoding instead of http service, replace the former in doc", rule.Method, endpoint)
+		}
+		field.Set(reflect.ValueOf(&op))
+		paths[endpoint] = path
+	}
+	for _, message := range grpcSvc.Messages {
+		if message.IsInner {
+			continue
+		}
+		if _, ok := schemas[message.Name]; ok {
+			continue
+		}
+		schemas[message.Name] = *protoMessageSchema(message)
+	}
+	writeDoc(dir, ic, paths, schemas)
+}
+
+// loadDoc returns paths and schemas of OpenAPI 3.0 description json file, empty ones if the file doesn't exist
+func loadDoc(docfile string) (map[string]v3Helper.Path, map[string]v3Helper.Schema) {
+	paths := make(map[string]v3Helper.Path)
+	schemas := make(map[string]v3Helper.Schema)
+	data, err := ioutil.ReadFile(docfile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			panic(err)
+		}
+		return paths, schemas
+	}
+	var api v3Helper.API
+	if err = json.Unmarshal(data, &api); err != nil {
+		panic(errors.Wrapf(err, "failed to parse %s", docfile))
+	}
+	for k, v := range api.Paths {
+		paths[k] = v
+	}
+	if api.Components != nil {
+		for k, v := range api.Components.Schemas {
+			schemas[k] = v
+		}
+	}
+	return paths, schemas
+}
+
+func transcodingOperationOf(rule httpRule) v3Helper.Operation {
+	op := v3Helper.Operation{
+		OperationID: rule.Name,
+		Description: strings.Join(rule.Rpc.Comments, "\n"),
+	}
+	request := rule.Rpc.Request
+	pathVars := make(map[string]bool)
+	for _, name := range pathVariablesOf(rule.Pattern) {
+		pathVars[normalizeFieldName(name)] = true
+		schema := v3Helper.String
+		if field, ok := protoFieldByName(request, name); ok {
+			schema = protoTypeSchema(field.Type)
+		}
+		op.Parameters = append(op.Parameters, v3Helper.Parameter{
+			Name:     name,
+			In:       v3Helper.InPath,
+			Schema:   schema,
+			Required: true,
+		})
+	}
+	if rule.Body == "*" {
+		if !reflect.DeepEqual(request, v3.Empty) {
+			mt := &v3Helper.MediaType{
+				Schema: protoTypeSchema(request),
+			}
+			op.RequestBody = &v3Helper.RequestBody{
+				Content: &v3Helper.Content{
+					JSON:     mt,
+					Protobuf: mt,
+					FormURL:  mt,
+				},
+				Required: true,
+			}
+		}
+	} else {
+		for _, field := range storedMessageOf(request).Fields {
+			if pathVars[normalizeFieldName(field.JsonName)] {
+				continue
+			}
+			schema := protoTypeSchema(field.Type)
+			if schema.Type == v3Helper.ObjectT || schema.Ref != "" {
+				continue
+			}
+			op.Parameters = append(op.Parameters, v3Helper.Parameter{
+				Name:        field.JsonName,
+				In:          v3Helper.InQuery,
+				Schema:      schema,
+				Description: strings.Join(field.Comments, "\n"),
+			})
+		}
+	}
+	mt := &v3Helper.MediaType{
+		Schema: protoTypeSchema(rule.Rpc.Response),
+	}
+	op.Responses = &v3Helper.Responses{
+		Resp200: &v3Helper.Response{
+			Description: "OK",
+			Content: &v3Helper.Content{
+				JSON:     mt,
+				Protobuf: mt,
+			},
+		},
+	}
+	return op
+}
+
+func pathVariablesOf(pattern string) []string {
+	var ret []string
+	for _, part := range strings.Split(pattern, "/") {
+		if strings.HasPrefix(part, ":") {
+			ret = append(ret, strings.TrimPrefix(part, ":"))
+		}
+	}
+	return ret
+}
+
+// normalizeFieldName makes field names comparable with path variables derived from method names,
+// which are lower case, the same as rest.Transcode matches them
+func normalizeFieldName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
+
+// storedMessageOf returns the definition of m, which is looked up from v3.MessageStore if m is only a reference
+func storedMessageOf(m v3.Message) v3.Message {
+	if len(m.Fields) > 0 {
+		return m
+	}
+	if stored, ok := v3.MessageStore[m.Name]; ok {
+		return stored
+	}
+	return m
+}
+
+func protoFieldByName(m v3.Message, name string) (v3.Field, bool) {
+	for _, field := range storedMessageOf(m).Fields {
+		if normalizeFieldName(field.Name) == normalizeFieldName(name) {
+			return field, true
+		}
+	}
+	return v3.Field{}, false
+}
+
+func protoMessageSchema(m v3.Message) *v3Helper.Schema {
+	schema := &v3Helper.Schema{
+		Type:        v3Helper.ObjectT,
+		Properties:  make(map[string]*v3Helper.Schema),
+		Description: strings.Join(m.Comments, "\n"),
+	}
+	for _, field := range storedMessageOf(m).Fields {
+		property := protoTypeSchema(field.Type)
+		if len(field.Comments) > 0 && property.Ref == "" {
+			copied := *property
+			copied.Description = strings.Join(field.Comments, "\n")
+			property = &copied
+		}
+		schema.Properties[field.JsonName] = property
+	}
+	return schema
+}
+
+// protoTypeSchema converts protobuf type to OpenAPI 3.0 schema following protobuf json mapping, e.g. 64-bit integers
+// are strings
+func protoTypeSchema(t v3.ProtobufType) *v3Helper.Schema {
+	switch t := t.(type) {
+	case v3.Enum:
+		return protoEnumSchema(t)
+	case v3.Message:
+		switch {
+		case reflect.DeepEqual(t, v3.Empty), reflect.DeepEqual(t, v3.Any):
+			return v3Helper.Any
+		case t.IsScalar:
+			return protoScalarSchema(t.Name)
+		case t.IsRepeated:
+			return &v3Helper.Schema{
+				Type:  v3Helper.ArrayT,
+				Items: protoSchemaOfName(strings.TrimPrefix(t.Name, "repeated ")),
+			}
+		case t.IsMap:
+			value := t.Name[strings.Index(t.Name, ",")+1 : len(t.Name)-1]
+			return &v3Helper.Schema{
+				Type:                 v3Helper.ObjectT,
+				AdditionalProperties: protoSchemaOfName(strings.TrimSpace(value)),
+			}
+		case t.IsInner:
+			return protoMessageSchema(t)
+		default:
+			return &v3Helper.Schema{
+				Ref: fmt.Sprintf("#/components/schemas/%s", t.Name),
+			}
+		}
+	}
+	return v3Helper.Any
+}
+
+func protoSchemaOfName(name string) *v3Helper.Schema {
+	if e, ok := v3.EnumStore[name]; ok {
+		return protoEnumSchema(e)
+	}
+	if m, ok := v3.MessageStore[name]; ok {
+		return protoTypeSchema(m)
+	}
+	switch name {
+	case v3.Any.Name, v3.Empty.Name:
+		return v3Helper.Any
+	}
+	return protoScalarSchema(name)
+}
+
+func protoEnumSchema(e v3.Enum) *v3Helper.Schema {
+	schema := &v3Helper.Schema{
+		Type: v3Helper.StringT,
+	}
+	for _, field := range e.Fields {
+		schema.Enum = append(schema.Enum, field.Name)
+	}
+	return schema
+}
+
+func protoScalarSchema(name string) *v3Helper.Schema {
+	switch name {
+	case v3.Double.Name:
+		return v3Helper.Float64
+	case v3.Float.Name:
+		return v3Helper.Float32
+	case v3.Int32.Name, v3.Uint32.Name:
+		return v3Helper.Int
+	case v3.Int64.Name, v3.Uint64.Name:
+		return &v3Helper.Schema{
+			Type:   v3Helper.StringT,
+			Format: v3Helper.Int64F,
+		}
+	case v3.Bool.Name:
+		return v3Helper.Bool
+	case v3.Bytes.Name:
+		return &v3Helper.Schema{
+			Type:   v3Helper.StringT,
+			Format: "byte",
+		}
+	case v3.Time.Name:
+		return v3Helper.Time
+	case v3.String.Name:
+		return v3Helper.String
+	}
+	// top level messages such as Book in repeated Book
+	return &v3Helper.Schema{
+		Ref: fmt.Sprintf("#/components/schemas/%s", name),
+	}
+}
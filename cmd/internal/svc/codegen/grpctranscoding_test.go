@@ -0,0 +1,99 @@
+package codegen
+
+import (
+	"encoding/json"
+	"github.com/iancoleman/strcase"
+	"github.com/stretchr/testify/assert"
+	v3 "github.com/youminxue/odin/cmd/internal/protobuf/v3"
+	"github.com/youminxue/odin/toolkit/astutils"
+	v3Helper "github.com/youminxue/odin/toolkit/openapi/v3"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGenGrpcTranscoding(t *testing.T) {
+	svcfile := filepath.Join(testDir, "svc.go")
+	ic := astutils.BuildInterfaceCollector(svcfile, astutils.ExprString)
+	p := v3.NewProtoGenerator(v3.WithFieldNamingFunc(strcase.ToLowerCamel))
+	ParseDtoGrpc(testDir, p, "dto")
+	grpcSvc, _ := GenGrpcProto(testDir, ic, p)
+	GenGrpcTranscoding(testDir, ic, grpcSvc)
+	GenGrpcTranscodingDoc(testDir, ic, grpcSvc)
+
+	source, err := ioutil.ReadFile(filepath.Join(testDir, "transport", "transcoding", "routes.go"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(source), `Pattern: "/shelves/:shelf/books/:book"`)
+	assert.Contains(t, string(source), `return server.GetUserRpc(ctx, req.(*pb.GetUserRpcRequest))`)
+	assert.Contains(t, string(source), `rest.Transcode(rest.TranscodeBodyAll, func() proto.Message {`)
+	assert.Contains(t, string(source), `"/`+grpcSvc.Package+`.`+grpcSvc.Name+`/GetUserRpc",`)
+
+	data, err := ioutil.ReadFile(filepath.Join(testDir, "usersvc_openapi3.json"))
+	assert.NoError(t, err)
+	var api v3Helper.API
+	assert.NoError(t, json.Unmarshal(data, &api))
+	getUser := api.Paths["/user"].Get
+	if assert.NotNil(t, getUser) {
+		assert.Nil(t, getUser.RequestBody)
+		assert.Len(t, getUser.Parameters, 2)
+		assert.Equal(t, v3Helper.InQuery, getUser.Parameters[0].In)
+	}
+	signUp := api.Paths["/sign/up"].Post
+	if assert.NotNil(t, signUp) {
+		assert.Equal(t, "#/components/schemas/SignUpRpcRequest", signUp.RequestBody.Content.JSON.Schema.Ref)
+	}
+	book := api.Paths["/shelves/{shelf}/books/{book}"].Get
+	if assert.NotNil(t, book) {
+		assert.Len(t, book.Parameters, 2)
+		assert.Equal(t, v3Helper.InPath, book.Parameters[0].In)
+	}
+	assert.Equal(t, v3Helper.ArrayT, api.Components.Schemas["SignUpRpcRequest"].Properties["score"].Type)
+	// paths and schemas of the http service are kept
+	assert.NotNil(t, api.Paths["/usersvc/user"].Get)
+	assert.Contains(t, api.Components.Schemas, "UserVo")
+}
+
+func TestGenGrpcTranscodingDoc_conflict(t *testing.T) {
+	svcfile := filepath.Join(testDir, "svc.go")
+	ic := astutils.BuildInterfaceCollector(svcfile, astutils.ExprString)
+	p := v3.NewProtoGenerator(v3.WithFieldNamingFunc(strcase.ToLowerCamel))
+	ParseDtoGrpc(testDir, p, "dto")
+	grpcSvc, _ := GenGrpcProto(testDir, ic, p)
+
+	dir, err := ioutil.TempDir("", "transcoding")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	// GET /user is served by http service as well
+	writeDoc(dir, ic, map[string]v3Helper.Path{
+		"/user": {
+			Get: &v3Helper.Operation{
+				OperationID: "httpsrvGetUser",
+				RequestBody: &v3Helper.RequestBody{},
+			},
+		},
+	}, map[string]v3Helper.Schema{})
+	GenGrpcTranscodingDoc(dir, ic, grpcSvc)
+
+	data, err := ioutil.ReadFile(docFileOf(dir, ic))
+	assert.NoError(t, err)
+	var api v3Helper.API
+	assert.NoError(t, json.Unmarshal(data, &api))
+	getUser := api.Paths["/user"].Get
+	if assert.NotNil(t, getUser) {
+		assert.NotEqual(t, "httpsrvGetUser", getUser.OperationID)
+		assert.Nil(t, getUser.RequestBody)
+		assert.Len(t, getUser.Parameters, 2)
+	}
+}
+
+func TestProtoTypeSchema(t *testing.T) {
+	assert.Equal(t, v3Helper.StringT, protoTypeSchema(v3.Int64).Type)
+	assert.Equal(t, v3Helper.Int64F, protoTypeSchema(v3.Int64).Format)
+	assert.Equal(t, v3Helper.Time, protoTypeSchema(v3.Time))
+	assert.Equal(t, v3Helper.Any, protoTypeSchema(v3.Empty))
+	schema := protoTypeSchema(v3.Message{Name: "map<string, int32>", IsMap: true})
+	assert.Equal(t, v3Helper.Int, schema.AdditionalProperties)
+	schema = protoTypeSchema(v3.Message{Name: "repeated Book", IsRepeated: true})
+	assert.Equal(t, "#/components/schemas/Book", schema.Items.Ref)
+}
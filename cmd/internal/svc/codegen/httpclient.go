@@ -9,6 +9,7 @@ import (
 	"github.com/youminxue/odin/toolkit/copier"
 	v3helper "github.com/youminxue/odin/toolkit/openapi/v3"
 	"github.com/youminxue/odin/version"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
@@ -30,6 +31,7 @@ import (
 	"github.com/youminxue/odin/toolkit/fileutils"
 	"github.com/youminxue/odin/toolkit/stringutils"
 	"github.com/youminxue/odin/framework/registry"
+	"github.com/youminxue/odin/framework/rest"
 	"github.com/youminxue/odin/framework/restclient"
 	v3 "github.com/youminxue/odin/toolkit/openapi/v3"
 	"github.com/opentracing-contrib/go-stdlib/nethttp"
@@ -147,8 +149,25 @@ func (receiver *{{.Meta.Name}}Client) SetClient(client *resty.Client) {
 		{{- end }}
 		{{- end }}
 		{{- else if eq $p.Type "context.Context" }}
+		{{- else if isStream $p.Type }}
+		if {{$p.Name}} != nil {
+			_req.SetHeader("Content-Type", {{$p.Name}}.ContentType())
+			_req.SetBody({{$p.Name}}.Reader())
+		}
 		{{- else if not (isBuiltin $p)}}
-		if options.GzipReqBody {
+		if _encoding := restclient.EncodingOf("{{$.Meta.Name | lower}}", options); _encoding != "" {
+			_body, _err := rest.Marshal(_encoding, {{$p.Name}}{{ protoRequest $m $p }})
+			if _err != nil {
+				{{- range $r := $m.Results }}
+					{{- if eq $r.Type "error" }}
+				{{ $r.Name }} = errors.Wrap(_err, "error")
+					{{- end }}
+				{{- end }}
+				return
+			}
+			_req.SetHeader("Content-Type", _encoding)
+			_req.SetBody(_body)
+		} else if options.GzipReqBody {
 			pr, pw := io.Pipe()
 			go func() {
 				gw := gzip.NewWriter(pw)
@@ -224,16 +243,23 @@ func (receiver *{{.Meta.Name}}Client) SetClient(client *resty.Client) {
 		{{- range $r := $m.Results }}
 			{{- if eq $r.Type "*os.File" }}
 				_req.SetDoNotParseResponse(true)
+			{{- else if isStream $r.Type }}
+				_req.SetDoNotParseResponse(true)
+				if _req.Header.Get("Accept") == "" {
+					_req.SetHeader("Accept", v3.NDJSONMediaType)
+				}
 			{{- end }}
 		{{- end }}
 
-		{{- if eq $.RoutePatternStrategy 1}}
-		_path := "/{{$.Meta.Name | lower}}/{{$m.Name | noSplitPattern}}"
-		{{- else }}
-		_path := "/{{$m.Name | pattern}}"
+		{{- if not ($m | rawBody) }}
+		if _encoding := restclient.EncodingOf("{{$.Meta.Name | lower}}", options); _encoding != "" {
+			_req.SetHeader("Accept", _encoding)
+		}
 		{{- end }}
 
-		{{- if eq ($m.Name | httpMethod) "GET" }}
+		_path := "{{routePattern $m $.Meta.Name $.RoutePatternStrategy | openAPIPattern}}"
+
+		{{- if ($m | routeMethod | noRequestBody) }}
 		_req.SetQueryParamsFromValues(_urlValues)
 		{{- else }}
 		if _req.Body != nil {
@@ -242,7 +268,17 @@ func (receiver *{{.Meta.Name}}Client) SetClient(client *resty.Client) {
 			_req.SetFormDataFromValues(_urlValues)
 		}
 		{{- end }}
-		_resp, _err = _req.{{$m.Name | restyMethod}}(_path)
+		_resp, _err = restclient.Call{
+			Service: "{{$.Meta.Name | lower}}",
+			Method:  "{{$m | routeMethod}}",
+			Path:    _path,
+			{{- if $m | rawBody }}
+			RawBody: true,
+			{{- end }}
+			{{- if $m | streamBody }}
+			Stream: true,
+			{{- end }}
+		}.Execute(_req, options)
 		if _err != nil {
 			{{- range $r := $m.Results }}
 				{{- if eq $r.Type "error" }}
@@ -252,9 +288,17 @@ func (receiver *{{.Meta.Name}}Client) SetClient(client *resty.Client) {
 			return
 		}
 		if _resp.IsError() {
+			{{- if $m | rawBody }}
+			defer _resp.RawBody().Close()
+			{{- end }}
 			{{- range $r := $m.Results }}
 				{{- if eq $r.Type "error" }}
-			{{ $r.Name }} = errors.New(_resp.String())
+				{{- if $m | rawBody }}
+			_body, _ := io.ReadAll(_resp.RawBody())
+			{{ $r.Name }} = rest.DecodeBizError(_resp.StatusCode(), _body)
+				{{- else }}
+			{{ $r.Name }} = rest.DecodeBizError(_resp.StatusCode(), _resp.Body())
+				{{- end }}
 				{{- end }}
 			{{- end }}
 			return
@@ -300,6 +344,10 @@ func (receiver *{{.Meta.Name}}Client) SetClient(client *resty.Client) {
 				{{ $r.Name }} = _outFile
 				return
 				{{- $done = true }}	
+			{{- else if isStream $r.Type }}
+				{{ $r.Name }} = v3.NewResponseStream(_resp.RawResponse)
+				return
+				{{- $done = true }}
 			{{- end }}
 		{{- end }}
 		{{- if not $done }}
@@ -310,7 +358,7 @@ func (receiver *{{.Meta.Name}}Client) SetClient(client *resty.Client) {
 				{{- end }}
 				{{- end }}
 			}
-			if _err = json.Unmarshal(_resp.Body(), &_result); _err != nil {
+			if _err = rest.Unmarshal(_resp.Header().Get("Content-Type"), _resp.Body(), &_result{{ protoResponse $m }}); _err != nil {
 				{{- range $r := $m.Results }}
 					{{- if eq $r.Type "error" }}
 				{{ $r.Name }} = errors.Wrap(_err, "error")
@@ -341,7 +389,7 @@ func New{{.Meta.Name}}Client(opts ...restclient.RestClientOption) *{{.Meta.Name}
 	}
 
 	svcClient.client.OnBeforeRequest(func(_ *resty.Client, request *resty.Request) error {
-		request.URL = svcClient.provider.SelectServer() + svcClient.rootPath + request.URL
+		request.URL = restclient.SelectServer(request, svcClient.provider) + svcClient.rootPath + request.URL
 		return nil
 	})
 
@@ -361,8 +409,29 @@ func New{{.Meta.Name}}Client(opts ...restclient.RestClientOption) *{{.Meta.Name}
 }
 `
 
-func restyMethod(method string) string {
-	return strings.Title(strings.ToLower(httpMethod(method)))
+// rawBody reports whether response body of method is read by caller rather than parsed as json
+func rawBody(method astutils.MethodMeta) bool {
+	for _, item := range method.Results {
+		if item.Type == "*os.File" || v3helper.IsStream(item.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// streamBody reports whether method returns a stream read by caller
+func streamBody(method astutils.MethodMeta) bool {
+	for _, item := range method.Results {
+		if v3helper.IsStream(item.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// noRequestBody reports whether parameters of method should be sent as query string only
+func noRequestBody(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
 }
 
 // GenGoClient generates golang http client code from result of parsing svc.go file in project root path
@@ -413,19 +482,28 @@ func GenGoClient(dir string, ic astutils.InterfaceCollector, env string, routePa
 	funcMap := make(map[string]interface{})
 	funcMap["toLowerCamel"] = strcase.ToLowerCamel
 	funcMap["toCamel"] = strcase.ToCamel
-	funcMap["httpMethod"] = httpMethod
-	funcMap["pattern"] = apiPattern
+	funcMap["routeMethod"] = routeMethod
+	funcMap["routePattern"] = routePattern
+	funcMap["openAPIPattern"] = openAPIPattern
+	funcMap["noRequestBody"] = noRequestBody
 	funcMap["lower"] = strings.ToLower
 	funcMap["contains"] = strings.Contains
 	funcMap["isBuiltin"] = v3helper.IsBuiltin
-	funcMap["restyMethod"] = restyMethod
+	funcMap["rawBody"] = rawBody
+	funcMap["streamBody"] = streamBody
 	funcMap["toUpper"] = strings.ToUpper
-	funcMap["noSplitPattern"] = noSplitPattern
 	funcMap["isOptional"] = v3helper.IsOptional
 	funcMap["convertCase"] = caseconvertor
 	funcMap["isSlice"] = v3helper.IsSlice
 	funcMap["isVarargs"] = v3helper.IsVarargs
 	funcMap["IsEnum"] = v3helper.IsEnum
+	funcMap["isStream"] = v3helper.IsStream
+	funcMap["protoRequest"] = func(method astutils.MethodMeta, p astutils.FieldMeta) string {
+		return protoRequestOptions(method, p, caseconvertor)
+	}
+	funcMap["protoResponse"] = func(method astutils.MethodMeta) string {
+		return protoResponseOptions(method, func(result string) string { return "&_result." + strcase.ToCamel(result) })
+	}
 	if tpl, err = template.New("client.go.tmpl").Funcs(funcMap).Parse(clientTmpl); err != nil {
 		panic(err)
 	}
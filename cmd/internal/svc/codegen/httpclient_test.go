@@ -4,7 +4,9 @@ import (
 	"github.com/iancoleman/strcase"
 	"github.com/pkg/errors"
 	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
 	"github.com/youminxue/odin/toolkit/astutils"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
@@ -112,3 +114,24 @@ func TestGenGoClientPanic_MkdirAll(t *testing.T) {
 		}, ShouldPanic)
 	})
 }
+
+func TestGenGoClient_stream(t *testing.T) {
+	MkdirAll = os.MkdirAll
+	Open = os.Open
+	Create = os.Create
+	Stat = os.Stat
+	dir := filepath.Join(testDir, "streamsvc")
+	clientDir := filepath.Join(dir, "client")
+	defer os.RemoveAll(clientDir)
+	ic := astutils.BuildInterfaceCollector(filepath.Join(dir, "svc.go"), astutils.ExprString)
+	GenGoClient(dir, ic, "", 1, strcase.ToLowerCamel)
+
+	source, err := ioutil.ReadFile(filepath.Join(clientDir, "client.go"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(source), `_req.SetDoNotParseResponse(true)`)
+	assert.Contains(t, string(source), `_req.SetHeader("Accept", v3.NDJSONMediaType)`)
+	assert.Contains(t, string(source), `events = v3.NewResponseStream(_resp.RawResponse)`)
+	assert.Contains(t, string(source), `Stream:  true,`)
+	assert.Contains(t, string(source), `_req.SetHeader("Content-Type", events.ContentType())`)
+	assert.Contains(t, string(source), `_req.SetBody(events.Reader())`)
+}
@@ -29,8 +29,6 @@ var cpimportTmpl = `
 	"github.com/slok/goresilience/circuitbreaker"
 	rerrors "github.com/slok/goresilience/errors"
 	"github.com/slok/goresilience/metrics"
-	"github.com/slok/goresilience/retry"
-	"github.com/slok/goresilience/timeout"
 	v3 "github.com/youminxue/odin/toolkit/openapi/v3"
 	"os"
 	"time"
@@ -127,6 +125,8 @@ func New{{.SvcName}}ClientProxy(client *{{.SvcName}}Client, opts ...ProxyOption)
 		opt(cp)
 	}
 
+	// timeout, retries and hedging are per call, set them by Options or GDD_CLIENT_POLICY and GDD_CLIENT_POLICIES,
+	// calls time out in 3 minutes and are retried 3 times by default
 	if cp.runner == nil {
 		var mid []goresilience.Middleware
 		mid = append(mid, metrics.NewMiddleware("{{.ServicePackage}}_client", metrics.NewPrometheusRecorder(prometheus.DefaultRegisterer)))
@@ -137,13 +137,7 @@ func New{{.SvcName}}ClientProxy(client *{{.SvcName}}Client, opts ...ProxyOption)
 			WaitDurationInOpenState:            5 * time.Second,
 			MetricsSlidingWindowBucketQuantity: 10,
 			MetricsBucketDuration:              1 * time.Second,
-		}),
-			timeout.NewMiddleware(timeout.Config{
-				Timeout: 3 * time.Minute,
-			}),
-			retry.NewMiddleware(retry.Config{
-				Times: 3,
-			}))
+		}))
 
 		cp.runner = goresilience.RunnerChain(mid...)
 	}
@@ -11,6 +11,7 @@ import (
 	"github.com/iancoleman/strcase"
 	"github.com/sirupsen/logrus"
 	"github.com/youminxue/odin/toolkit/astutils"
+	"github.com/youminxue/odin/toolkit/stringutils"
 )
 
 var httpHandlerTmpl = `/**
@@ -37,8 +38,8 @@ func Routes(handler {{.Meta.Name}}Handler) []rest.Route {
 		{{- range $m := .Meta.Methods }}
 		{
 			Name: "{{$m.Name}}",
-			Method: "{{$m.Name | httpMethod}}",
-			Pattern: {{- if eq $.RoutePatternStrategy 1}}"/{{$.Meta.Name | lower}}/{{$m.Name | noSplitPattern}}",{{- else }}"/{{$m.Name | pattern}}",{{- end }}
+			Method: "{{$m | routeMethod}}",
+			Pattern: "{{routePattern $m $.Meta.Name $.RoutePatternStrategy}}",
 			HandlerFunc: handler.{{$m.Name}},
 		},
 		{{- end }}
@@ -69,11 +70,10 @@ var RouteAnnotationStore = framework.AnnotationStore{
 `
 
 func noSplitPattern(method string) string {
-	httpMethods := []string{"GET", "POST", "PUT", "DELETE"}
 	snake := strcase.ToSnake(method)
 	splits := strings.Split(snake, "_")
 	head := strings.ToUpper(splits[0])
-	for _, m := range httpMethods {
+	for _, m := range astutils.HttpMethods {
 		if head == m {
 			return strings.ToLower(method[len(m):])
 		}
@@ -82,11 +82,10 @@ func noSplitPattern(method string) string {
 }
 
 func httpMethod(method string) string {
-	httpMethods := []string{"GET", "POST", "PUT", "DELETE"}
 	snake := strcase.ToSnake(method)
 	splits := strings.Split(snake, "_")
 	head := strings.ToUpper(splits[0])
-	for _, m := range httpMethods {
+	for _, m := range astutils.HttpMethods {
 		if head == m {
 			return m
 		}
@@ -94,6 +93,25 @@ func httpMethod(method string) string {
 	return "POST"
 }
 
+// routeMethod returns http method of m, @route annotation takes precedence over method name prefix
+func routeMethod(m astutils.MethodMeta) string {
+	if stringutils.IsNotEmpty(m.HttpMethod) {
+		return m.HttpMethod
+	}
+	return httpMethod(m.Name)
+}
+
+// routePattern returns url pattern of m, @route annotation takes precedence over routePatternStrategy
+func routePattern(m astutils.MethodMeta, svcName string, routePatternStrategy int) string {
+	if stringutils.IsNotEmpty(m.Path) {
+		return m.Path
+	}
+	if routePatternStrategy == 1 {
+		return "/" + strings.ToLower(svcName) + "/" + noSplitPattern(m.Name)
+	}
+	return "/" + astutils.Pattern(m.Name)
+}
+
 // GenHttpHandler generates http handler interface and routes
 func GenHttpHandler(dir string, ic astutils.InterfaceCollector, routePatternStrategy int) {
 	var (
@@ -125,10 +143,8 @@ func GenHttpHandler(dir string, ic astutils.InterfaceCollector, routePatternStra
 	defer f.Close()
 
 	funcMap := make(map[string]interface{})
-	funcMap["httpMethod"] = httpMethod
-	funcMap["pattern"] = astutils.Pattern
-	funcMap["noSplitPattern"] = noSplitPattern
-	funcMap["lower"] = strings.ToLower
+	funcMap["routeMethod"] = routeMethod
+	funcMap["routePattern"] = routePattern
 	if tpl, err = template.New("handler.go.tmpl").Funcs(funcMap).Parse(httpHandlerTmpl); err != nil {
 		panic(err)
 	}
@@ -2,6 +2,7 @@ package codegen
 
 import (
 	"github.com/stretchr/testify/assert"
+	"github.com/youminxue/odin/toolkit/astutils"
 	"testing"
 )
 
@@ -29,3 +30,41 @@ func Test_httpMethod(t *testing.T) {
 		})
 	}
 }
+
+func Test_routePattern(t *testing.T) {
+	tests := []struct {
+		name                 string
+		method               astutils.MethodMeta
+		routePatternStrategy int
+		wantMethod           string
+		wantPattern          string
+	}{
+		{
+			name:        "derived",
+			method:      astutils.MethodMeta{Name: "PatchShelves_ShelfBooks_Book"},
+			wantMethod:  "PATCH",
+			wantPattern: "/shelves/:shelf/books/:book",
+		},
+		{
+			name:                 "no split",
+			method:               astutils.MethodMeta{Name: "GetBooks"},
+			routePatternStrategy: 1,
+			wantMethod:           "GET",
+			wantPattern:          "/bookshelf/books",
+		},
+		{
+			name:                 "annotated",
+			method:               astutils.MethodMeta{Name: "UpdateStatus", HttpMethod: "PATCH", Path: "/orders/:id/status"},
+			routePatternStrategy: 1,
+			wantMethod:           "PATCH",
+			wantPattern:          "/orders/:id/status",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantMethod, routeMethod(tt.method))
+			assert.Equal(t, tt.wantPattern, routePattern(tt.method, "Bookshelf", tt.routePatternStrategy))
+		})
+	}
+	assert.Equal(t, "/orders/{id}/status", openAPIPattern("/orders/:id/status"))
+}
@@ -45,7 +45,7 @@ var appendHttpHandlerImplTmpl = `
 		{{ $p.Name }}.StringSetter(paramsFromCtx.ByName("{{$p.Name}}"))
 		{{- else if $p.Type | isSupport }}
 		if casted, _err := cast.{{$p.Type | castFunc}}E(paramsFromCtx.ByName("{{$p.Name}}")); _err != nil {
-			http.Error(_writer, _err.Error(), http.StatusBadRequest)
+			rest.HandleBadRequestErr(_writer, _req, _err)
 			return
 		} else {
 			{{$p.Name}} = casted
@@ -54,13 +54,13 @@ var appendHttpHandlerImplTmpl = `
 		{{$p.Name}} = paramsFromCtx.ByName("{{$p.Name}}")
 		{{- end }}
 		if _err := rest.ValidateVar({{$p.Name}}, "{{$p.ValidateTag}}", "{{$p.Name}}"); _err != nil {
-			http.Error(_writer, _err.Error(), http.StatusBadRequest)
+			rest.HandleBadRequestErr(_writer, _req, _err)
 			return
 		}
 		{{- else if or (eq $p.Type "*multipart.FileHeader") (eq $p.Type "[]*multipart.FileHeader") }}
 		{{- if not $multipartFormParsed }}
 		if _err := _req.ParseMultipartForm(32 << 20); _err != nil {
-			http.Error(_writer, _err.Error(), http.StatusBadRequest)
+			rest.HandleBadRequestErr(_writer, _req, _err)
 			return
 		}
 		{{- $multipartFormParsed = true }}
@@ -76,7 +76,7 @@ var appendHttpHandlerImplTmpl = `
 		{{- else if or (eq $p.Type "v3.FileModel") (eq $p.Type "*v3.FileModel") (eq $p.Type "[]v3.FileModel") (eq $p.Type "*[]v3.FileModel") (eq $p.Type "...v3.FileModel") }}
 		{{- if not $multipartFormParsed }}
 		if _err := _req.ParseMultipartForm(32 << 20); _err != nil {
-			http.Error(_writer, _err.Error(), http.StatusBadRequest)
+			rest.HandleBadRequestErr(_writer, _req, _err)
 			return
 		}
 		{{- $multipartFormParsed = true }}
@@ -85,7 +85,7 @@ var appendHttpHandlerImplTmpl = `
 		if exists {
 			{{- if not (isOptional $p.Type) }}
 			if len({{$p.Name}}FileHeaders) == 0 {
-				http.Error(_writer, "no file uploaded for parameter {{$p.Name}}", http.StatusBadRequest)
+				rest.HandleBadRequestErr(_writer, _req, errors.New("no file uploaded for parameter {{$p.Name}}"))
 				return
 			}
 			{{- end }}
@@ -98,7 +98,7 @@ var appendHttpHandlerImplTmpl = `
 			for _, _fh :=range {{$p.Name}}FileHeaders {
 				_f, _err := _fh.Open()
 				if _err != nil {
-					http.Error(_writer, _err.Error(), http.StatusBadRequest)
+					rest.HandleBadRequestErr(_writer, _req, _err)
 					return
 				}
 				{{- if isOptional $p.Type }}
@@ -118,7 +118,7 @@ var appendHttpHandlerImplTmpl = `
 				_fh := {{$p.Name}}FileHeaders[0]
 				_f, _err := _fh.Open()
 				if _err != nil {
-					http.Error(_writer, _err.Error(), http.StatusBadRequest)
+					rest.HandleBadRequestErr(_writer, _req, _err)
 					return
 				}
 				{{- if isOptional $p.Type }}
@@ -135,28 +135,30 @@ var appendHttpHandlerImplTmpl = `
 			}
 			{{- end}}
 		}{{- if not (isOptional $p.Type) }} else {
-			http.Error(_writer, "missing parameter {{$p.Name}}", http.StatusBadRequest)
+			rest.HandleBadRequestErr(_writer, _req, errors.New("missing parameter {{$p.Name}}"))
 			return
 		}{{- end }}
+		{{- else if isStream $p.Type }}
+		{{$p.Name}} = v3.NewReaderStream(_req.Header.Get("Content-Type"), _req.Body)
 		{{- else if eq $p.Type "context.Context" }}
 		{{$p.Name}} = _req.Context()
 		{{- else if not (isBuiltin $p)}}
 		{{- if isOptional $p.Type }}
 		if _req.Body != nil {
-			if _err := json.NewDecoder(_req.Body).Decode(&{{$p.Name}}); _err != nil {
+			if _err := rest.DecodeBody(_req, &{{$p.Name}}{{ protoRequest $m $p }}); _err != nil {
 				if _err != io.EOF {
-					http.Error(_writer, _err.Error(), http.StatusBadRequest)
+					rest.HandleBadRequestErr(_writer, _req, _err)
 					return				
 				}
 			} else {
 				{{- if isStruct $p }}
 				if _err := rest.ValidateStruct({{$p.Name}}); _err != nil {
-					http.Error(_writer, _err.Error(), http.StatusBadRequest)
+					rest.HandleBadRequestErr(_writer, _req, _err)
 					return
 				}
 				{{- else }}
 				if _err := rest.ValidateVar({{$p.Name}}, "{{$p.ValidateTag}}", ""); _err != nil {
-					http.Error(_writer, _err.Error(), http.StatusBadRequest)
+					rest.HandleBadRequestErr(_writer, _req, _err)
 					return
 				}
 				{{- end }}
@@ -164,21 +166,21 @@ var appendHttpHandlerImplTmpl = `
 		}
 		{{- else }}
 		if _req.Body == nil {
-			http.Error(_writer, "missing request body", http.StatusBadRequest)
+			rest.HandleBadRequestErr(_writer, _req, errors.New("missing request body"))
 			return
 		} else {
-			if _err := json.NewDecoder(_req.Body).Decode(&{{$p.Name}}); _err != nil {
-				http.Error(_writer, _err.Error(), http.StatusBadRequest)
+			if _err := rest.DecodeBody(_req, &{{$p.Name}}{{ protoRequest $m $p }}); _err != nil {
+				rest.HandleBadRequestErr(_writer, _req, _err)
 				return	
 			} else {
 				{{- if isStruct $p }}
 				if _err := rest.ValidateStruct({{$p.Name}}); _err != nil {
-					http.Error(_writer, _err.Error(), http.StatusBadRequest)
+					rest.HandleBadRequestErr(_writer, _req, _err)
 					return
 				}
 				{{- else }}
 				if _err := rest.ValidateVar({{$p.Name}}, "{{$p.ValidateTag}}", ""); _err != nil {
-					http.Error(_writer, _err.Error(), http.StatusBadRequest)
+					rest.HandleBadRequestErr(_writer, _req, _err)
 					return
 				}
 				{{- end }}
@@ -188,7 +190,7 @@ var appendHttpHandlerImplTmpl = `
 		{{- else if isSlice $p.Type }}
 		{{- if not $formParsed }}
 		if _err := _req.ParseForm(); _err != nil {
-			http.Error(_writer, _err.Error(), http.StatusBadRequest)
+			rest.HandleBadRequestErr(_writer, _req, _err)
 			return
 		}
 		{{- $formParsed = true }}
@@ -211,7 +213,7 @@ var appendHttpHandlerImplTmpl = `
 			}
 			{{- else if $p.Type | isSupport }}
 			if casted, _err := cast.{{$p.Type | castFunc}}E(_req.Form["{{$p.Name}}"]); _err != nil {
-				http.Error(_writer, _err.Error(), http.StatusBadRequest)
+				rest.HandleBadRequestErr(_writer, _req, _err)
 				return
 			} else {
 				{{- if isOptional $p.Type }}
@@ -229,7 +231,7 @@ var appendHttpHandlerImplTmpl = `
 			{{- end }}
 			{{- end }}
 			if _err := rest.ValidateVar({{$p.Name}}, "{{$p.ValidateTag}}", "{{$p.Name}}"); _err != nil {
-				http.Error(_writer, _err.Error(), http.StatusBadRequest)
+				rest.HandleBadRequestErr(_writer, _req, _err)
 				return
 			}
 		} else {
@@ -251,7 +253,7 @@ var appendHttpHandlerImplTmpl = `
 				}
 				{{- else if $p.Type | isSupport }}
 				if casted, _err := cast.{{$p.Type | castFunc}}E(_req.Form["{{$p.Name}}[]"]); _err != nil {
-					http.Error(_writer, _err.Error(), http.StatusBadRequest)
+					rest.HandleBadRequestErr(_writer, _req, _err)
 					return
 				} else {
 					{{- if isOptional $p.Type }}
@@ -269,18 +271,18 @@ var appendHttpHandlerImplTmpl = `
 				{{- end }}
 				{{- end }}
 				if _err := rest.ValidateVar({{$p.Name}}, "{{$p.ValidateTag}}", "{{$p.Name}}"); _err != nil {
-					http.Error(_writer, _err.Error(), http.StatusBadRequest)
+					rest.HandleBadRequestErr(_writer, _req, _err)
 					return
 				}
 			}{{- if not (isOptional $p.Type) }} else {
-				http.Error(_writer, "missing parameter {{$p.Name}}", http.StatusBadRequest)
+				rest.HandleBadRequestErr(_writer, _req, errors.New("missing parameter {{$p.Name}}"))
 				return
 			}{{- end }}
 		}
 		{{- else }}
 		{{- if not $formParsed }}
 		if _err := _req.ParseForm(); _err != nil {
-			http.Error(_writer, _err.Error(), http.StatusBadRequest)
+			rest.HandleBadRequestErr(_writer, _req, _err)
 			return
 		}
 		{{- $formParsed = true }}
@@ -293,7 +295,7 @@ var appendHttpHandlerImplTmpl = `
 			{{ $p.Name }}.StringSetter(_req.FormValue("{{$p.Name}}"))
 			{{- else if $p.Type | isSupport }}
 			if casted, _err := cast.{{$p.Type | castFunc}}E(_req.FormValue("{{$p.Name}}")); _err != nil {
-				http.Error(_writer, _err.Error(), http.StatusBadRequest)
+				rest.HandleBadRequestErr(_writer, _req, _err)
 				return
 			} else {
 				{{- if isOptional $p.Type }}
@@ -311,11 +313,11 @@ var appendHttpHandlerImplTmpl = `
 			{{- end }}
 			{{- end }}
 			if _err := rest.ValidateVar({{$p.Name}}, "{{$p.ValidateTag}}", "{{$p.Name}}"); _err != nil {
-				http.Error(_writer, _err.Error(), http.StatusBadRequest)
+				rest.HandleBadRequestErr(_writer, _req, _err)
 				return
 			}
 		}{{- if not (isOptional $p.Type) }} else {
-			http.Error(_writer, "missing parameter {{$p.Name}}", http.StatusBadRequest)
+			rest.HandleBadRequestErr(_writer, _req, errors.New("missing parameter {{$p.Name}}"))
 			return
 		}{{- end }}
 		{{- end }}
@@ -332,13 +334,7 @@ var appendHttpHandlerImplTmpl = `
 		{{- range $r := $m.Results }}
 			{{- if eq $r.Type "error" }}
 				if {{ $r.Name }} != nil {
-					if errors.Is({{ $r.Name }}, context.Canceled) {
-						http.Error(_writer, {{ $r.Name }}.Error(), http.StatusBadRequest)
-					} else if _err, ok := {{ $r.Name }}.(*rest.BizError); ok {
-						http.Error(_writer, _err.Error(), _err.StatusCode)
-					} else {
-						http.Error(_writer, {{ $r.Name }}.Error(), http.StatusInternalServerError)
-					}
+					rest.HandleErr(_writer, _req, {{ $r.Name }})
 					return
 				}
 			{{- end }}
@@ -347,14 +343,14 @@ var appendHttpHandlerImplTmpl = `
 		{{- range $r := $m.Results }}
 			{{- if eq $r.Type "*os.File" }}
 				if {{$r.Name}} == nil {
-					http.Error(_writer, "No file returned", http.StatusInternalServerError)
+					rest.HandleErr(_writer, _req, errors.New("No file returned"))
 					return
 				}
 				defer {{$r.Name}}.Close()
 				var _fi os.FileInfo
 				_fi, _err := {{$r.Name}}.Stat()
 				if _err != nil {
-					http.Error(_writer, _err.Error(), http.StatusInternalServerError)
+					rest.HandleErr(_writer, _req, _err)
 					return
 				}
 				_writer.Header().Set("Content-Disposition", "attachment; filename="+_fi.Name())
@@ -362,10 +358,13 @@ var appendHttpHandlerImplTmpl = `
 				_writer.Header().Set("Content-Length", fmt.Sprintf("%d", _fi.Size()))
 				io.Copy(_writer, {{$r.Name}})
 				{{- $done = true }}	
+			{{- else if isStream $r.Type }}
+				rest.WriteStream(_writer, _req, {{$r.Name}})
+				{{- $done = true }}
 			{{- end }}
 		{{- end }}
 		{{- if not $done }}
-			if _err := json.NewEncoder(_writer).Encode(struct{
+			if _err := rest.WriteBody(_writer, _req, struct{
 				{{- range $r := $m.Results }}
 				{{- if ne $r.Type "error" }}
 				{{ $r.Name | toCamel }} {{ $r.Type }} ` + "`" + `json:"{{ $r.Name | convertCase }}{{if $.Omitempty}},omitempty{{end}}"` + "`" + `
@@ -377,8 +376,8 @@ var appendHttpHandlerImplTmpl = `
 				{{ $r.Name | toCamel }}: {{ $r.Name }},
 				{{- end }}
 				{{- end }}
-			}); _err != nil {
-				http.Error(_writer, _err.Error(), http.StatusInternalServerError)
+			}{{ protoResponse $m }}); _err != nil {
+				rest.HandleErr(_writer, _req, _err)
 				return
 			}
 		{{- end }}
@@ -498,6 +497,13 @@ func GenHttpHandlerImpl(dir string, ic astutils.InterfaceCollector, omitempty bo
 	funcMap["IsEnum"] = v3helper.IsEnum
 	funcMap["TrimPrefix"] = strings.TrimPrefix
 	funcMap["ElementType"] = v3helper.ElementType
+	funcMap["isStream"] = v3helper.IsStream
+	funcMap["protoRequest"] = func(method astutils.MethodMeta, p astutils.FieldMeta) string {
+		return protoRequestOptions(method, p, caseconvertor)
+	}
+	funcMap["protoResponse"] = func(method astutils.MethodMeta) string {
+		return protoResponseOptions(method, func(result string) string { return result })
+	}
 	if tpl, err = template.New("handlerimpl.go.tmpl").Funcs(funcMap).Parse(tmpl); err != nil {
 		panic(err)
 	}
@@ -2,8 +2,12 @@ package codegen
 
 import (
 	"fmt"
+	"github.com/iancoleman/strcase"
+	"github.com/stretchr/testify/assert"
 	"github.com/youminxue/odin/toolkit/astutils"
 	"github.com/youminxue/odin/toolkit/copier"
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"testing"
 )
@@ -15,3 +19,18 @@ func Test_unimplementedMethods(t *testing.T) {
 	unimplementedMethods(&meta, filepath.Join(testDir, "transport/httpsrv"))
 	fmt.Println(len(meta.Methods))
 }
+
+func TestGenHttpHandlerImpl_stream(t *testing.T) {
+	dir := filepath.Join(testDir, "streamsvc")
+	httpDir := filepath.Join(dir, "transport")
+	defer os.RemoveAll(httpDir)
+	ic := astutils.BuildInterfaceCollector(filepath.Join(dir, "svc.go"), astutils.ExprString)
+	GenHttpHandlerImpl(dir, ic, false, strcase.ToLowerCamel)
+
+	source, err := ioutil.ReadFile(filepath.Join(httpDir, "httpsrv", "handlerimpl.go"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(source), `rest.WriteStream(_writer, _req, events)`)
+	assert.Contains(t, string(source), `events = v3.NewReaderStream(_req.Header.Get("Content-Type"), _req.Body)`)
+	// stream results are written by rest.WriteStream only
+	assert.NotContains(t, string(source), `Events *v3.Stream`)
+}
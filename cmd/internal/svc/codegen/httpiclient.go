@@ -24,13 +24,14 @@ import (
 	"github.com/go-resty/resty/v2"
 	"{{.VoPackage}}"
 	"{{.DtoPackage}}"
+	"github.com/youminxue/odin/framework/restclient"
 	v3 "github.com/youminxue/odin/toolkit/openapi/v3"
 	"os"
 )
 
-type Options struct {
-	GzipReqBody bool
-}
+// Options is per-call options such as timeout, retry policy, idempotency key and hedging,
+// build it by restclient.NewOptions with restclient.CallOption
+type Options = restclient.Options
 
 type I{{.Meta.Name}}Client interface {
 {{- range $m := .Meta.Methods }}
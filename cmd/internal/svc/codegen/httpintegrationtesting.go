@@ -24,7 +24,7 @@ var appendIntegrationTestingTmpl = `
 func Test_{{$response.Name | cleanName}}(t *testing.T) {
 	apitest.New("{{$response.Name}}").
 		Handler(router).
-		{{$response.OriginalRequest.Method | toString | capital}}("{{ $response.OriginalRequest.URL.Path | toEndpoint }}").
+		{{$response.OriginalRequest.Method | apitestMethod}}("{{ $response.OriginalRequest.URL.Path | toEndpoint }}").
 {{- range $header := $response.OriginalRequest.Header }}
 {{- if not $header.Disabled }}
 		Header("{{$header.Key}}", "{{$header.Value}}").
@@ -138,6 +138,17 @@ func capital(input string) string {
 	return strings.Title(strings.ToLower(input))
 }
 
+// apitestMethod returns apitest request method call for input, http methods without a shortcut
+// such as HEAD and OPTIONS are set by Method and followed by URL
+func apitestMethod(input postman.Method) string {
+	switch input {
+	case postman.Get, postman.Post, postman.Put, postman.Patch, postman.Delete:
+		return capital(toString(input))
+	default:
+		return fmt.Sprintf("Method(http.Method%s).URL", capital(toString(input)))
+	}
+}
+
 func GenHttpIntegrationTesting(dir string, ic astutils.InterfaceCollector, postmanCollectionPath, dotenvPath string) {
 	var (
 		err                error
@@ -188,6 +199,7 @@ func GenHttpIntegrationTesting(dir string, ic astutils.InterfaceCollector, postm
 	funcMap["toEndpoint"] = toEndpoint
 	funcMap["toString"] = toString
 	funcMap["capital"] = capital
+	funcMap["apitestMethod"] = apitestMethod
 	funcMap["cleanName"] = cleanName
 	if tpl, err = template.New("integration_test.go.tmpl").Funcs(funcMap).Parse(tmpl); err != nil {
 		panic(err)
@@ -3,7 +3,9 @@ package codegen
 import (
 	"github.com/Jeffail/gabs/v2"
 	"github.com/goccy/go-yaml"
+	"github.com/joho/godotenv"
 	"github.com/sirupsen/logrus"
+	"github.com/youminxue/odin/toolkit/cast"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -31,8 +33,13 @@ spec:
           imagePullPolicy: Always
           ports:
             - name: http-port
-              containerPort: 6060
+              containerPort: {{.HttpPort}}
               protocol: TCP
+{{- if .GrpcPort}}
+            - name: grpc-port
+              containerPort: {{.GrpcPort}}
+              protocol: TCP
+{{- end}}
           resources:
             requests:
               cpu: 100m
@@ -49,9 +56,16 @@ spec:
   selector:
     app: {{.SvcName}}
   ports:
-    - protocol: TCP
-      port: 6060
-      targetPort: 6060`
+    - name: http-port
+      protocol: TCP
+      port: {{.HttpPort}}
+      targetPort: {{.HttpPort}}
+{{- if .GrpcPort}}
+    - name: grpc-port
+      protocol: TCP
+      port: {{.GrpcPort}}
+      targetPort: {{.GrpcPort}}
+{{- end}}`
 
 // GenK8sDeployment generates deployment kind yaml file for kubernetes deploy.
 func GenK8sDeployment(dir string, svcname, image string) {
@@ -69,12 +83,17 @@ func GenK8sDeployment(dir string, svcname, image string) {
 		if tpl, err = template.New("deployment.tmpl").Parse(deploymentTmpl); err != nil {
 			panic(err)
 		}
+		ports := getK8sPorts(dir)
 		if err = tpl.Execute(f, struct {
-			SvcName string
-			Image   string
+			SvcName  string
+			Image    string
+			HttpPort int
+			GrpcPort int
 		}{
-			SvcName: svcname,
-			Image:   image,
+			SvcName:  svcname,
+			Image:    image,
+			HttpPort: ports.HttpPort,
+			GrpcPort: ports.GrpcPort,
 		}); err != nil {
 			panic(err)
 		}
@@ -87,6 +106,28 @@ func GenK8sDeployment(dir string, svcname, image string) {
 	}
 }
 
+type k8sPorts struct {
+	HttpPort int
+	GrpcPort int
+}
+
+// getK8sPorts reads GDD_PORT, GDD_GRPC_PORT and GDD_SINGLE_PORT_ENABLE from .env file in dir.
+// GrpcPort is zero if the service has no grpc transport or serves grpc on http port.
+func getK8sPorts(dir string) k8sPorts {
+	env, _ := godotenv.Read(filepath.Join(dir, ".env"))
+	ports := k8sPorts{
+		HttpPort: cast.ToIntOrDefault(env["GDD_PORT"], 6060),
+	}
+	if _, err := os.Stat(filepath.Join(dir, "transport", "grpc")); err != nil {
+		return ports
+	}
+	if cast.ToBoolOrDefault(env["GDD_SINGLE_PORT_ENABLE"], false) {
+		return ports
+	}
+	ports.GrpcPort = cast.ToIntOrDefault(env["GDD_GRPC_PORT"], 50051)
+	return ports
+}
+
 func modifyVersion(yfile string, image string) []byte {
 	var (
 		f                             *os.File
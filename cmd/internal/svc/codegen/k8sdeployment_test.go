@@ -2,7 +2,9 @@ package codegen
 
 import (
 	"fmt"
+	"github.com/stretchr/testify/assert"
 	"github.com/youminxue/odin/toolkit/pathutils"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
@@ -107,3 +109,19 @@ func TestGenK8sDeployment2(t *testing.T) {
 		})
 	}
 }
+
+func TestGetK8sPorts(t *testing.T) {
+	dir := filepath.Join("testdata", "k8sports")
+	os.MkdirAll(filepath.Join(dir, "transport", "grpc"), os.ModePerm)
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, ".env"), []byte("GDD_PORT=8080\nGDD_GRPC_PORT=9090\n"), os.ModePerm)
+	assert.Equal(t, k8sPorts{HttpPort: 8080, GrpcPort: 9090}, getK8sPorts(dir))
+
+	ioutil.WriteFile(filepath.Join(dir, ".env"), []byte("GDD_PORT=8080\nGDD_SINGLE_PORT_ENABLE=true\n"), os.ModePerm)
+	assert.Equal(t, k8sPorts{HttpPort: 8080}, getK8sPorts(dir))
+
+	os.RemoveAll(filepath.Join(dir, "transport"))
+	os.Remove(filepath.Join(dir, ".env"))
+	assert.Equal(t, k8sPorts{HttpPort: 6060}, getK8sPorts(dir))
+}
@@ -30,8 +30,13 @@ spec:
           imagePullPolicy: Always
           ports:
             - name: http-port
-              containerPort: 6060
+              containerPort: {{.HttpPort}}
               protocol: TCP
+{{- if .GrpcPort}}
+            - name: grpc-port
+              containerPort: {{.GrpcPort}}
+              protocol: TCP
+{{- end}}
           resources:
             requests:
               cpu: 100m
@@ -46,9 +51,16 @@ spec:
   selector:
     app: {{.SvcName}}
   ports:
-    - protocol: TCP
-      port: 6060
-      targetPort: 6060
+    - name: http-port
+      protocol: TCP
+      port: {{.HttpPort}}
+      targetPort: {{.HttpPort}}
+{{- if .GrpcPort}}
+    - name: grpc-port
+      protocol: TCP
+      port: {{.GrpcPort}}
+      targetPort: {{.GrpcPort}}
+{{- end}}
   clusterIP: None`
 
 // GenK8sStatefulset generates statefulset kind yaml file for kubernetes deploy
@@ -67,12 +79,17 @@ func GenK8sStatefulset(dir string, svcname, image string) {
 		if tpl, err = template.New("statefulset.tmpl").Parse(statefulsetTmpl); err != nil {
 			panic(err)
 		}
+		ports := getK8sPorts(dir)
 		if err = tpl.Execute(f, struct {
-			SvcName string
-			Image   string
+			SvcName  string
+			Image    string
+			HttpPort int
+			GrpcPort int
 		}{
-			SvcName: svcname,
-			Image:   image,
+			SvcName:  svcname,
+			Image:    image,
+			HttpPort: ports.HttpPort,
+			GrpcPort: ports.GrpcPort,
 		}); err != nil {
 			panic(err)
 		}
@@ -18,6 +18,7 @@ var mainTmpl = `/**
 package main
 
 import (
+	"github.com/youminxue/odin/framework/auth"
 	"github.com/youminxue/odin/framework/rest"
 	{{.ServiceAlias}} "{{.ServicePackage}}"
     "{{.ConfigPackage}}"
@@ -29,6 +30,8 @@ func main() {
     svc := {{.ServiceAlias}}.New{{.SvcName}}(conf)
 	handler := httpsrv.New{{.SvcName}}Handler(svc)
 	srv := rest.NewRestServer()
+	// set GDD_AUTH_ENABLE=true to enforce @auth and @role annotations
+	srv.AddMiddleware(rest.Auth(auth.NewAuthorizerFromConfig(httpsrv.RouteAnnotationStore)))
 	srv.AddRoute(httpsrv.Routes(handler)...)
 	srv.Run()
 }
@@ -0,0 +1,3 @@
+module streamsvc
+
+go 1.16
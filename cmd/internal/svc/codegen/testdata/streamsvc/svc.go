@@ -0,0 +1,17 @@
+package service
+
+import (
+	"context"
+	v3 "github.com/youminxue/odin/toolkit/openapi/v3"
+)
+
+// Streamsvc streams events
+type Streamsvc interface {
+	// ListEvents streams events happened since the given time
+	ListEvents(ctx context.Context, since int64) (
+		// events are written as NDJSON or server-sent events
+		events *v3.Stream, err error)
+
+	// ImportEvents reads events from request body
+	ImportEvents(ctx context.Context, events *v3.Stream) (count int, err error)
+}
@@ -69,6 +69,8 @@ type Svc struct {
 	Env string
 	// ClientPkg is client package name
 	ClientPkg string
+	// Transcoding indicates whether generate grpc-json transcoding routes serving unary rpcs as REST apis
+	Transcoding bool
 
 	cmd        *exec.Cmd
 	restartSig chan int
@@ -248,6 +250,13 @@ func WithDocPath(docfile string) SvcOption {
 	}
 }
 
+// WithTranscoding sets whether generate grpc-json transcoding routes when generating grpc service
+func WithTranscoding(transcoding bool) SvcOption {
+	return func(svc *Svc) {
+		svc.Transcoding = transcoding
+	}
+}
+
 // NewSvc new Svc instance
 func NewSvc(dir string, opts ...SvcOption) ISvc {
 	ret := Svc{
@@ -511,6 +520,11 @@ func (receiver *Svc) Grpc(p v3.ProtoGenerator) {
 		panic(err)
 	}
 	codegen.GenSvcImplGrpc(dir, ic, grpcSvc)
+	if receiver.Transcoding {
+		codegen.GenGrpcTranscoding(dir, ic, grpcSvc)
+		codegen.GenGrpcTranscodingDoc(dir, ic, grpcSvc)
+	}
 	codegen.GenMainGrpc(dir, ic, grpcSvc)
 	codegen.GenMethodAnnotationStore(dir, ic)
+	codegen.GenProtoMessageStore(dir, grpcSvc)
 }
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"github.com/pkg/errors"
+	"strings"
+	"sync"
+)
+
+// APIKeyAuthenticator authenticates callers by api key in a header. Keys are kept as sha256 digests.
+type APIKeyAuthenticator struct {
+	header string
+	mu     sync.RWMutex
+	keys   map[[sha256.Size]byte]*Principal
+}
+
+// NewAPIKeyAuthenticator creates an APIKeyAuthenticator reading api key from header, keys maps api key to its owner
+func NewAPIKeyAuthenticator(header string, keys map[string]*Principal) *APIKeyAuthenticator {
+	a := &APIKeyAuthenticator{
+		header: header,
+	}
+	a.SetKeys(keys)
+	return a
+}
+
+// SetKeys replaces all api keys, it is safe to call concurrently with Authenticate
+func (a *APIKeyAuthenticator) SetKeys(keys map[string]*Principal) {
+	digests := make(map[[sha256.Size]byte]*Principal, len(keys))
+	for key, principal := range keys {
+		digests[sha256.Sum256([]byte(key))] = principal
+	}
+	a.mu.Lock()
+	a.keys = digests
+	a.mu.Unlock()
+}
+
+// Authenticate implements Authenticator
+func (a *APIKeyAuthenticator) Authenticate(ctx context.Context) (*Principal, error) {
+	key := HeaderFromContext(ctx, a.header)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	a.mu.RLock()
+	principal, ok := a.keys[sha256.Sum256([]byte(key))]
+	a.mu.RUnlock()
+	if !ok {
+		return nil, errors.New("invalid api key")
+	}
+	return principal, nil
+}
+
+// ParseAPIKeys parses a comma separated list of api keys in the form of key=subject:role1|role2,
+// e.g. key1=service-a:admin|ops,key2=service-b
+func ParseAPIKeys(value string) (map[string]*Principal, error) {
+	keys := make(map[string]*Principal)
+	for i, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" || strings.TrimSpace(kv[1]) == "" {
+			return nil, fmt.Errorf("invalid api key at position %d, want key=subject:role1|role2", i)
+		}
+		owner := strings.SplitN(strings.TrimSpace(kv[1]), ":", 2)
+		principal := &Principal{
+			Subject: owner[0],
+		}
+		if len(owner) == 2 && owner[1] != "" {
+			principal.Roles = strings.Split(owner[1], "|")
+		}
+		keys[strings.TrimSpace(kv[0])] = principal
+	}
+	return keys, nil
+}
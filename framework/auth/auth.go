@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/youminxue/odin/framework"
+	"github.com/youminxue/odin/framework/internal/config"
+	"github.com/youminxue/odin/toolkit/cast"
+	"github.com/youminxue/odin/toolkit/stringutils"
+	logger "github.com/youminxue/odin/toolkit/zlogger"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// AnnotationAuth marks a method requiring an authenticated caller, e.g. @auth
+	AnnotationAuth = "@auth"
+	// AnnotationRole marks a method requiring an authenticated caller with any of the given roles, e.g. @role(admin,ops)
+	AnnotationRole = "@role"
+)
+
+// ErrNoCredentials is returned by Authenticator when the caller didn't present credentials it understands,
+// so that the next Authenticator can have a try
+var ErrNoCredentials = errors.New("no credentials")
+
+// Authorizer authenticates the caller of fullMethod and decides whether the call is allowed. It is shared by
+// rest.Auth middleware and grpcx_auth interceptors. For http, fullMethod is the route name, for grpc it is the
+// full rpc method name such as /helloworld.Greeter/SayHelloRpc. The returned context is passed to the handler.
+// Errors should be grpc status errors with codes.Unauthenticated or codes.PermissionDenied.
+type Authorizer interface {
+	Authorize(ctx context.Context, fullMethod string) (context.Context, error)
+}
+
+// Authenticator verifies credentials carried by ctx and returns the caller
+type Authenticator interface {
+	Authenticate(ctx context.Context) (*Principal, error)
+}
+
+// Principal is an authenticated caller
+type Principal struct {
+	Subject string
+	Roles   []string
+	Claims  map[string]interface{}
+}
+
+// HasRole reports whether p has any of roles
+func (p *Principal) HasRole(roles ...string) bool {
+	for _, role := range roles {
+		role = strings.TrimSpace(role)
+		for _, item := range p.Roles {
+			if item == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type principalCtxKey struct{}
+
+type headerCtxKey struct{}
+
+// ContextWithPrincipal returns a copy of ctx carrying principal
+func ContextWithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalCtxKey{}, principal)
+}
+
+// PrincipalFromContext returns the authenticated caller or nil
+func PrincipalFromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalCtxKey{}).(*Principal)
+	return principal
+}
+
+// ContextWithHeader returns a copy of ctx carrying http request header for authenticators
+func ContextWithHeader(ctx context.Context, header http.Header) context.Context {
+	return context.WithValue(ctx, headerCtxKey{}, header)
+}
+
+// HeaderFromContext returns the value of header key from http request header or grpc incoming metadata
+func HeaderFromContext(ctx context.Context, key string) string {
+	if header, ok := ctx.Value(headerCtxKey{}).(http.Header); ok {
+		return header.Get(key)
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// BearerToken returns the token from Authorization header with Bearer scheme
+func BearerToken(ctx context.Context) string {
+	value := HeaderFromContext(ctx, "Authorization")
+	if len(value) > 7 && strings.EqualFold(value[:7], "Bearer ") {
+		return strings.TrimSpace(value[7:])
+	}
+	return ""
+}
+
+// AnnotationAuthorizer enforces @auth and @role annotations generated into framework.AnnotationStore.
+// Methods without them are public, but credentials are still verified if presented.
+type AnnotationAuthorizer struct {
+	store          framework.AnnotationStore
+	authenticators []Authenticator
+}
+
+// NewAuthorizer creates an AnnotationAuthorizer trying authenticators in order
+func NewAuthorizer(store framework.AnnotationStore, authenticators ...Authenticator) *AnnotationAuthorizer {
+	return &AnnotationAuthorizer{
+		store:          store,
+		authenticators: authenticators,
+	}
+}
+
+// NewAuthorizerFromConfig creates an AnnotationAuthorizer with jwt authenticator if GDD_AUTH_JWKS_FILE is set
+// and api key authenticator if GDD_AUTH_API_KEYS is set. Annotations are enforced only if GDD_AUTH_ENABLE is true,
+// otherwise all methods are public. It panics if enforcement is enabled without any authenticator, as all annotated
+// methods would be rejected. Misconfiguration of an authenticator is logged, and the affected authenticator rejects
+// all credentials rather than letting requests through.
+func NewAuthorizerFromConfig(store framework.AnnotationStore) *AnnotationAuthorizer {
+	if !cast.ToBoolOrDefault(config.GddAuthEnable.Load(), config.DefaultGddAuthEnable) {
+		if hasAuthAnnotation(store) {
+			logger.Warn().Msgf("[odin] @auth and @role annotations are not enforced, set %s=true to enforce them", config.GddAuthEnable)
+		}
+		return NewAuthorizer(nil)
+	}
+	var authenticators []Authenticator
+	if file := config.GddAuthJwksFile.LoadOrDefault(config.DefaultGddAuthJwksFile); stringutils.IsNotEmpty(file) {
+		interval, err := time.ParseDuration(config.GddAuthJwksRefreshInterval.LoadOrDefault(config.DefaultGddAuthJwksRefreshInterval))
+		if err != nil {
+			logger.Error().Err(err).Msg("[odin] invalid jwks refresh interval, use default")
+			interval, _ = time.ParseDuration(config.DefaultGddAuthJwksRefreshInterval)
+		}
+		keys, err := NewJWKSFile(file, interval)
+		if err != nil {
+			logger.Error().Err(err).Msgf("[odin] failed to load jwks file %s", file)
+		}
+		authenticators = append(authenticators, NewJWTAuthenticator(keys,
+			WithJWTIssuer(config.GddAuthJwtIssuer.LoadOrDefault(config.DefaultGddAuthJwtIssuer)),
+			WithJWTAudience(config.GddAuthJwtAudience.LoadOrDefault(config.DefaultGddAuthJwtAudience)),
+			WithJWTRolesClaim(config.GddAuthJwtRolesClaim.LoadOrDefault(config.DefaultGddAuthJwtRolesClaim)),
+		))
+	}
+	if value := config.GddAuthApiKeys.LoadOrDefault(config.DefaultGddAuthApiKeys); stringutils.IsNotEmpty(value) {
+		keys, err := ParseAPIKeys(value)
+		if err != nil {
+			logger.Error().Err(err).Msg("[odin] failed to parse api keys")
+		}
+		authenticators = append(authenticators, NewAPIKeyAuthenticator(config.GddAuthApiKeyHeader.LoadOrDefault(config.DefaultGddAuthApiKeyHeader), keys))
+	}
+	if len(authenticators) == 0 {
+		logger.Panic().Msgf("[odin] %s is true, but neither %s nor %s is set", config.GddAuthEnable, config.GddAuthJwksFile, config.GddAuthApiKeys)
+	}
+	return NewAuthorizer(store, authenticators...)
+}
+
+func hasAuthAnnotation(store framework.AnnotationStore) bool {
+	for key := range store {
+		if store.HasAnnotation(key, AnnotationAuth) || store.HasAnnotation(key, AnnotationRole) {
+			return true
+		}
+	}
+	return false
+}
+
+// annotationKey returns the key of fullMethod in AnnotationStore. Keys of grpc full methods such as
+// /helloworld.Greeter/SayHelloRpc are rpc names, and http route names are keys as they are.
+func annotationKey(fullMethod string) string {
+	if strings.HasPrefix(fullMethod, "/") && strings.Count(fullMethod, "/") == 2 {
+		return fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+	}
+	return fullMethod
+}
+
+// Authorize implements Authorizer
+func (a *AnnotationAuthorizer) Authorize(ctx context.Context, fullMethod string) (context.Context, error) {
+	key := annotationKey(fullMethod)
+	principal, err := a.authenticate(ctx)
+	if err != nil {
+		return ctx, status.Error(codes.Unauthenticated, err.Error())
+	}
+	hasRole := a.store.HasAnnotation(key, AnnotationRole)
+	if principal == nil {
+		if hasRole || a.store.HasAnnotation(key, AnnotationAuth) {
+			return ctx, status.Error(codes.Unauthenticated, "missing credentials")
+		}
+		return ctx, nil
+	}
+	if hasRole && !principal.HasRole(a.store.GetParams(key, AnnotationRole)...) {
+		return ctx, status.Error(codes.PermissionDenied, "permission denied")
+	}
+	return ContextWithPrincipal(ctx, principal), nil
+}
+
+func (a *AnnotationAuthorizer) authenticate(ctx context.Context) (*Principal, error) {
+	for _, authenticator := range a.authenticators {
+		principal, err := authenticator.Authenticate(ctx)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return principal, err
+	}
+	return nil, nil
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"github.com/youminxue/odin/framework"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"os"
+	"testing"
+)
+
+var store = framework.AnnotationStore{
+	"GetUser": {
+		{Name: AnnotationAuth},
+	},
+	"DeleteUserRpc": {
+		{Name: AnnotationRole, Params: []string{"admin", " ops"}},
+	},
+}
+
+func apiKeyContext(key string) context.Context {
+	header := http.Header{}
+	header.Set("X-API-Key", key)
+	return ContextWithHeader(context.Background(), header)
+}
+
+func TestAnnotationAuthorizer(t *testing.T) {
+	keys, err := ParseAPIKeys("k1=svc-a:ops, k2=svc-b")
+	require.NoError(t, err)
+	a := NewAuthorizer(store, NewJWTAuthenticator(StaticKeySet{}), NewAPIKeyAuthenticator("X-API-Key", keys))
+
+	ctx, err := a.Authorize(context.Background(), "ListUsers")
+	require.NoError(t, err)
+	require.Nil(t, PrincipalFromContext(ctx))
+
+	_, err = a.Authorize(context.Background(), "GetUser")
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = a.Authorize(apiKeyContext("bad"), "ListUsers")
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	ctx, err = a.Authorize(apiKeyContext("k2"), "GetUser")
+	require.NoError(t, err)
+	require.Equal(t, "svc-b", PrincipalFromContext(ctx).Subject)
+
+	_, err = a.Authorize(apiKeyContext("k2"), "/helloworld.Users/DeleteUserRpc")
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", "k1"))
+	ctx, err = a.Authorize(ctx, "/helloworld.Users/DeleteUserRpc")
+	require.NoError(t, err)
+	require.Equal(t, "svc-a", PrincipalFromContext(ctx).Subject)
+
+	// http keys are not split like grpc full methods
+	_, err = a.Authorize(context.Background(), "GET /users/GetUser")
+	require.NoError(t, err)
+}
+
+func TestAnnotationKey(t *testing.T) {
+	require.Equal(t, "SayHelloRpc", annotationKey("/helloworld.Greeter/SayHelloRpc"))
+	require.Equal(t, "GetUser", annotationKey("GetUser"))
+	require.Equal(t, "GET /users/GetUser", annotationKey("GET /users/GetUser"))
+	require.Equal(t, "/users/1/GetUser", annotationKey("/users/1/GetUser"))
+}
+
+func TestParseAPIKeys(t *testing.T) {
+	keys, err := ParseAPIKeys("k1=svc-a:admin|ops,k2=svc-b")
+	require.NoError(t, err)
+	require.Equal(t, map[string]*Principal{
+		"k1": {Subject: "svc-a", Roles: []string{"admin", "ops"}},
+		"k2": {Subject: "svc-b"},
+	}, keys)
+
+	_, err = ParseAPIKeys("k1")
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "k1")
+}
+
+func TestNewAuthorizerFromConfig(t *testing.T) {
+	// annotations are not enforced by default
+	_, err := NewAuthorizerFromConfig(store).Authorize(context.Background(), "DeleteUserRpc")
+	require.NoError(t, err)
+
+	_ = os.Setenv("GDD_AUTH_ENABLE", "true")
+	defer os.Unsetenv("GDD_AUTH_ENABLE")
+	require.Panics(t, func() {
+		NewAuthorizerFromConfig(store)
+	})
+
+	_ = os.Setenv("GDD_AUTH_API_KEYS", "k1=svc-a:admin")
+	_ = os.Setenv("GDD_AUTH_JWKS_FILE", "/not/exist/jwks.json")
+	defer os.Unsetenv("GDD_AUTH_API_KEYS")
+	defer os.Unsetenv("GDD_AUTH_JWKS_FILE")
+	a := NewAuthorizerFromConfig(store)
+	require.Len(t, a.authenticators, 2)
+
+	_, err = a.Authorize(apiKeyContext("k1"), "DeleteUserRpc")
+	require.NoError(t, err)
+	_, err = a.Authorize(bearerContext("token"), "ListUsers")
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
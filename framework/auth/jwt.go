@@ -0,0 +1,326 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var jwtMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "HS256", "HS384", "HS512"}
+
+// KeySet looks up the key for verifying JWT signature by key id
+type KeySet interface {
+	Key(kid string) (interface{}, error)
+}
+
+// ParseJWKS parses a JSON Web Key Set into keys indexed by kid. RSA, EC and oct keys are supported,
+// keys for encryption are skipped.
+func ParseJWKS(data []byte) (map[string]interface{}, error) {
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+			K   string `json:"k"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, errors.Wrap(err, "invalid jwks")
+	}
+	keys := make(map[string]interface{})
+	for _, item := range jwks.Keys {
+		if item.Use == "enc" {
+			continue
+		}
+		var (
+			key interface{}
+			err error
+		)
+		switch item.Kty {
+		case "RSA":
+			key, err = rsaPublicKey(item.N, item.E)
+		case "EC":
+			key, err = ecdsaPublicKey(item.Crv, item.X, item.Y)
+		case "oct":
+			key, err = base64.RawURLEncoding.DecodeString(item.K)
+		default:
+			err = fmt.Errorf("unsupported key type %q", item.Kty)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid key %q", item.Kid)
+		}
+		keys[item.Kid] = key
+	}
+	return keys, nil
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+func rsaPublicKey(n, e string) (*rsa.PublicKey, error) {
+	modulus, err := decodeBigInt(n)
+	if err != nil {
+		return nil, err
+	}
+	exponent, err := decodeBigInt(e)
+	if err != nil {
+		return nil, err
+	}
+	return &rsa.PublicKey{N: modulus, E: int(exponent.Int64())}, nil
+}
+
+func ecdsaPublicKey(crv, x, y string) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", crv)
+	}
+	px, err := decodeBigInt(x)
+	if err != nil {
+		return nil, err
+	}
+	py, err := decodeBigInt(y)
+	if err != nil {
+		return nil, err
+	}
+	if !curve.IsOnCurve(px, py) {
+		return nil, errors.New("point is not on curve")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: px, Y: py}, nil
+}
+
+// JWKSFile is a KeySet loaded from a local JWKS file. The file is checked every refresh interval and
+// reloaded when its modification time changes, an unknown kid triggers an early check, so keys can be
+// rotated by rewriting the file without restarting the service.
+type JWKSFile struct {
+	path     string
+	interval time.Duration
+
+	mu        sync.RWMutex
+	keys      map[string]interface{}
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+// minJWKSCheckInterval bounds how often unknown kids can trigger checking the file
+const minJWKSCheckInterval = time.Second
+
+// NewJWKSFile creates a JWKSFile and loads keys from path. The returned JWKSFile is usable even with an error,
+// it keeps checking the file and picks keys up once the file becomes valid.
+func NewJWKSFile(path string, refreshInterval time.Duration) (*JWKSFile, error) {
+	f := &JWKSFile{
+		path:     path,
+		interval: refreshInterval,
+		keys:     make(map[string]interface{}),
+	}
+	return f, f.Reload()
+}
+
+// Reload loads keys from the file if it changed since last load
+func (f *JWKSFile) Reload() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.reload()
+}
+
+func (f *JWKSFile) reload() error {
+	f.checkedAt = time.Now()
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if info.ModTime().Equal(f.modTime) {
+		return nil
+	}
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return err
+	}
+	f.keys = keys
+	f.modTime = info.ModTime()
+	return nil
+}
+
+// Key implements KeySet. Empty kid matches the only key in the set.
+func (f *JWKSFile) Key(kid string) (interface{}, error) {
+	f.mu.RLock()
+	key, ok := f.lookup(kid)
+	elapsed := time.Since(f.checkedAt)
+	f.mu.RUnlock()
+	if ok && elapsed < f.interval {
+		return key, nil
+	}
+	if !ok && elapsed < minJWKSCheckInterval {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if time.Since(f.checkedAt) >= minJWKSCheckInterval {
+		_ = f.reload()
+	}
+	if key, ok = f.lookup(kid); !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	return key, nil
+}
+
+func (f *JWKSFile) lookup(kid string) (interface{}, bool) {
+	if kid == "" && len(f.keys) == 1 {
+		for _, key := range f.keys {
+			return key, true
+		}
+	}
+	key, ok := f.keys[kid]
+	return key, ok
+}
+
+// StaticKeySet is a KeySet holding fixed keys indexed by kid
+type StaticKeySet map[string]interface{}
+
+// Key implements KeySet. Empty kid matches the only key in the set.
+func (s StaticKeySet) Key(kid string) (interface{}, error) {
+	if kid == "" && len(s) == 1 {
+		for _, key := range s {
+			return key, nil
+		}
+	}
+	if key, ok := s[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+// JWTAuthenticator authenticates callers by JWT in Authorization header with Bearer scheme,
+// such as id tokens or access tokens issued by an OIDC provider
+type JWTAuthenticator struct {
+	keys       KeySet
+	issuer     string
+	audience   string
+	rolesClaim string
+	parser     *jwt.Parser
+}
+
+// JWTOption configures JWTAuthenticator
+type JWTOption func(*JWTAuthenticator)
+
+// WithJWTIssuer sets expected iss claim
+func WithJWTIssuer(issuer string) JWTOption {
+	return func(a *JWTAuthenticator) {
+		a.issuer = issuer
+	}
+}
+
+// WithJWTAudience sets expected aud claim
+func WithJWTAudience(audience string) JWTOption {
+	return func(a *JWTAuthenticator) {
+		a.audience = audience
+	}
+}
+
+// WithJWTRolesClaim sets the dot separated path of the claim holding roles, e.g. realm_access.roles.
+// The claim can be an array of strings or a space separated string like scope.
+func WithJWTRolesClaim(claim string) JWTOption {
+	return func(a *JWTAuthenticator) {
+		a.rolesClaim = claim
+	}
+}
+
+// NewJWTAuthenticator creates a JWTAuthenticator verifying signatures with keys
+func NewJWTAuthenticator(keys KeySet, opts ...JWTOption) *JWTAuthenticator {
+	a := &JWTAuthenticator{
+		keys:       keys,
+		rolesClaim: "roles",
+		parser:     jwt.NewParser(jwt.WithValidMethods(jwtMethods)),
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Authenticate implements Authenticator
+func (a *JWTAuthenticator) Authenticate(ctx context.Context) (*Principal, error) {
+	token := BearerToken(ctx)
+	if token == "" {
+		return nil, ErrNoCredentials
+	}
+	claims := jwt.MapClaims{}
+	_, err := a.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return a.keys.Key(kid)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid token")
+	}
+	if a.issuer != "" && !claims.VerifyIssuer(a.issuer, true) {
+		return nil, errors.New("invalid token: unexpected issuer")
+	}
+	if a.audience != "" && !claims.VerifyAudience(a.audience, true) {
+		return nil, errors.New("invalid token: unexpected audience")
+	}
+	subject, _ := claims["sub"].(string)
+	return &Principal{
+		Subject: subject,
+		Roles:   a.roles(claims),
+		Claims:  claims,
+	}, nil
+}
+
+func (a *JWTAuthenticator) roles(claims jwt.MapClaims) []string {
+	var value interface{} = map[string]interface{}(claims)
+	for _, field := range strings.Split(a.rolesClaim, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = m[field]
+	}
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		roles := make([]string, 0, len(v))
+		for _, item := range v {
+			if role, ok := item.(string); ok {
+				roles = append(roles, role)
+			}
+		}
+		return roles
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func rsaJwk(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kid": kid,
+		"kty": "RSA",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func writeJWKS(t *testing.T, path string, keys ...map[string]string) {
+	data, err := json.Marshal(map[string]interface{}{"keys": keys})
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(path, data, 0644))
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func bearerContext(token string) context.Context {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+token)
+	return ContextWithHeader(context.Background(), header)
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	a := NewJWTAuthenticator(StaticKeySet{"k1": &key.PublicKey},
+		WithJWTIssuer("https://idp.example.com"),
+		WithJWTAudience("odin"),
+		WithJWTRolesClaim("realm_access.roles"),
+	)
+	claims := jwt.MapClaims{
+		"sub":          "u1",
+		"iss":          "https://idp.example.com",
+		"aud":          []string{"odin", "other"},
+		"exp":          time.Now().Add(time.Minute).Unix(),
+		"realm_access": map[string]interface{}{"roles": []string{"admin", "ops"}},
+	}
+	principal, err := a.Authenticate(bearerContext(signToken(t, jwt.SigningMethodRS256, "k1", key, claims)))
+	require.NoError(t, err)
+	require.Equal(t, "u1", principal.Subject)
+	require.Equal(t, []string{"admin", "ops"}, principal.Roles)
+
+	_, err = a.Authenticate(context.Background())
+	require.ErrorIs(t, err, ErrNoCredentials)
+
+	claims["exp"] = time.Now().Add(-time.Minute).Unix()
+	_, err = a.Authenticate(bearerContext(signToken(t, jwt.SigningMethodRS256, "k1", key, claims)))
+	require.Error(t, err)
+
+	claims["exp"] = time.Now().Add(time.Minute).Unix()
+	claims["aud"] = "other"
+	_, err = a.Authenticate(bearerContext(signToken(t, jwt.SigningMethodRS256, "k1", key, claims)))
+	require.Error(t, err)
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	claims["aud"] = "odin"
+	_, err = a.Authenticate(bearerContext(signToken(t, jwt.SigningMethodRS256, "k1", other, claims)))
+	require.Error(t, err)
+
+	_, err = a.Authenticate(bearerContext(signToken(t, jwt.SigningMethodHS256, "k1", []byte("secret"), claims)))
+	require.Error(t, err)
+}
+
+func TestJWTAuthenticator_scope(t *testing.T) {
+	a := NewJWTAuthenticator(StaticKeySet{"": []byte("secret")}, WithJWTRolesClaim("scope"))
+	principal, err := a.Authenticate(bearerContext(signToken(t, jwt.SigningMethodHS256, "", []byte("secret"), jwt.MapClaims{
+		"sub":   "u1",
+		"scope": "read write",
+	})))
+	require.NoError(t, err)
+	require.Equal(t, []string{"read", "write"}, principal.Roles)
+}
+
+func TestJWKSFile_rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	k1, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	k2, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	writeJWKS(t, path, rsaJwk("k1", &k1.PublicKey))
+
+	keys, err := NewJWKSFile(path, time.Hour)
+	require.NoError(t, err)
+	a := NewJWTAuthenticator(keys)
+	_, err = a.Authenticate(bearerContext(signToken(t, jwt.SigningMethodRS256, "k1", k1, jwt.MapClaims{"sub": "u1"})))
+	require.NoError(t, err)
+
+	writeJWKS(t, path, map[string]string{
+		"kid": "k2",
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(k2.X.Bytes()),
+		"y":   base64.RawURLEncoding.EncodeToString(k2.Y.Bytes()),
+	})
+	modTime := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+	keys.checkedAt = time.Now().Add(-minJWKSCheckInterval)
+
+	_, err = a.Authenticate(bearerContext(signToken(t, jwt.SigningMethodES256, "k2", k2, jwt.MapClaims{"sub": "u1"})))
+	require.NoError(t, err)
+	_, err = keys.Key("k1")
+	require.Error(t, err)
+}
+
+func TestParseJWKS(t *testing.T) {
+	keys, err := ParseJWKS([]byte(`{"keys":[{"kid":"s","kty":"oct","k":"c2VjcmV0"},{"kid":"e","kty":"RSA","use":"enc","n":"AQAB","e":"AQAB"}]}`))
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"s": []byte("secret")}, keys)
+
+	_, err = ParseJWKS([]byte(`{"keys":[{"kid":"x","kty":"OKP"}]}`))
+	require.Error(t, err)
+	_, err = ParseJWKS([]byte(`{"keys":[{"kid":"x","kty":"EC","crv":"P-256","x":"AQ","y":"AQ"}]}`))
+	require.Error(t, err)
+}
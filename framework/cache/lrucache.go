@@ -25,6 +25,11 @@ type LruCacheAdapter struct {
 	store *lru.Cache
 }
 
+// NewLruCacheAdapter wraps store as an IStore
+func NewLruCacheAdapter(store *lru.Cache) *LruCacheAdapter {
+	return &LruCacheAdapter{store}
+}
+
 func (l *LruCacheAdapter) Get(key interface{}) (value interface{}, ok bool) {
 	return l.store.Get(key)
 }
@@ -3,12 +3,13 @@ package grpcx_auth
 import (
 	"context"
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/youminxue/odin/framework/auth"
 	"google.golang.org/grpc"
 )
 
-type Authorizer interface {
-	Authorize(ctx context.Context, fullMethod string) (context.Context, error)
-}
+// Authorizer is shared with rest.Auth middleware, see auth.NewAuthorizer for enforcing annotations
+// from generated MethodAnnotationStore
+type Authorizer = auth.Authorizer
 
 // UnaryServerInterceptor returns a server interceptor function to authenticate and authorize unary RPC
 func UnaryServerInterceptor(authorizer Authorizer) grpc.UnaryServerInterceptor {
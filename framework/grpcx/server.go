@@ -7,6 +7,7 @@ import (
 	"github.com/youminxue/odin/framework"
 	"github.com/youminxue/odin/framework/internal/banner"
 	"github.com/youminxue/odin/framework/internal/config"
+	"github.com/youminxue/odin/framework/lifecycle"
 	register "github.com/youminxue/odin/framework/registry"
 	"github.com/youminxue/odin/toolkit/cast"
 	"github.com/youminxue/odin/toolkit/timeutils"
@@ -17,6 +18,7 @@ import (
 	"os"
 	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -75,10 +77,38 @@ func (srv *GrpcServer) printServices() {
 	logger.Info().Msg("===================================================")
 }
 
+// Start registers srv to service registries and serves grpc on lis in background. Run calls it with a listener
+// on GDD_GRPC_PORT, rest.RestServer.RunWithGrpc calls it to share GDD_PORT with http.
+func (srv *GrpcServer) Start(lis net.Listener) {
+	register.NewGrpc(srv.data)
+	reflection.Register(srv)
+	srv.printServices()
+	go func() {
+		logger.Info().Msgf("Grpc server is listening at %v", lis.Addr())
+		logger.Info().Msgf("Grpc server started in %s", time.Since(startAt))
+		if err := srv.Serve(lis); err != nil {
+			logger.Error().Msgf("failed to serve: %v", err)
+		}
+	}()
+}
+
+// Shutdown deregisters srv from service registries and stops it gracefully until ctx is done
+func (srv *GrpcServer) Shutdown(ctx context.Context) {
+	register.ShutdownGrpc()
+	if err := timeutils.CallWithCtx(ctx, func() struct{} {
+		srv.GracefulStop()
+		return struct{}{}
+	}); err != nil {
+		logger.Error().Err(err).Msg("")
+	}
+}
+
 // Run runs grpc server
 func (srv *GrpcServer) Run() {
 	banner.Print()
-	register.NewGrpc(srv.data)
+	if err := lifecycle.Start(context.Background()); err != nil {
+		logger.Panic().Err(err).Msg("[odin] failed to start lifecycle hooks")
+	}
 	port := config.DefaultGddGrpcPort
 	if p, err := cast.ToIntE(config.GddGrpcPort.Load()); err == nil {
 		port = p
@@ -87,18 +117,11 @@ func (srv *GrpcServer) Run() {
 	if err != nil {
 		logger.Panic().Msgf("failed to listen: %v", err)
 	}
-	reflection.Register(srv)
-	srv.printServices()
-	go func() {
-		logger.Info().Msgf("Grpc server is listening at %v", lis.Addr())
-		logger.Info().Msgf("Grpc server started in %s", time.Since(startAt))
-		if err := srv.Serve(lis); err != nil {
-			logger.Error().Msgf("failed to serve: %v", err)
-		}
-	}()
+	srv.Start(lis)
+	lifecycle.SetReady(true)
 
 	defer func() {
-		register.ShutdownGrpc()
+		lifecycle.Drain(register.MarkUnhealthyGrpc)
 
 		grace, err := time.ParseDuration(config.GddGraceTimeout.Load())
 		if err != nil {
@@ -110,18 +133,16 @@ func (srv *GrpcServer) Run() {
 
 		ctx, cancel := context.WithTimeout(context.Background(), grace)
 		defer cancel()
-		if err := timeutils.CallWithCtx(ctx, func() struct{} {
-			srv.GracefulStop()
-			return struct{}{}
-		}); err != nil {
-			logger.Error().Err(err).Msg("")
+		srv.Shutdown(ctx)
+		if err := lifecycle.Stop(context.Background()); err != nil {
+			logger.Error().Err(err).Msg("[odin] failed to stop lifecycle hooks")
 		}
 	}()
 
 	c := make(chan os.Signal, 1)
-	// We'll accept graceful shutdowns when quit via SIGINT (Ctrl+C)
-	// SIGKILL, SIGQUIT or SIGTERM (Ctrl+/) will not be caught.
-	signal.Notify(c, os.Interrupt)
+	// We'll accept graceful shutdowns when quit via SIGINT (Ctrl+C) or SIGTERM sent by orchestrators like kubernetes
+	// SIGKILL or SIGQUIT (Ctrl+/) will not be caught.
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
 	// Block until we receive our signal.
 	<-c
@@ -121,14 +121,48 @@ const (
 	GddLogReqEnable envVariable = "GDD_LOG_REQ_ENABLE"
 	GddLogCaller    envVariable = "GDD_LOG_CALLER"
 	GddLogDiscard   envVariable = "GDD_LOG_DISCARD"
+	// GddLogReqMaxBodySize caps how many bytes of request and response body are logged
+	GddLogReqMaxBodySize envVariable = "GDD_LOG_REQ_MAX_BODY_SIZE"
+	// GddLogReqSkipContentTypes is a comma separated list of content type prefixes whose body won't be logged
+	GddLogReqSkipContentTypes envVariable = "GDD_LOG_REQ_SKIP_CONTENT_TYPES"
+	// GddLogReqRedactHeaders is a comma separated list of request and response headers to be redacted
+	GddLogReqRedactHeaders envVariable = "GDD_LOG_REQ_REDACT_HEADERS"
+	// GddLogReqRedactFields is a comma separated list of json fields to be redacted, e.g. password,user.token
+	GddLogReqRedactFields envVariable = "GDD_LOG_REQ_REDACT_FIELDS"
+	// GddLogReqSampleRate is the fraction of requests to be logged, from 0 to 1
+	GddLogReqSampleRate envVariable = "GDD_LOG_REQ_SAMPLE_RATE"
 	// GddGraceTimeout sets graceful shutdown timeout
 	GddGraceTimeout envVariable = "GDD_GRACE_TIMEOUT"
+	// GddPreStopDelay sets how long to wait after the instance is marked unhealthy in service registry and
+	// before listeners are closed, so that clients have time to stop sending requests to it
+	GddPreStopDelay envVariable = "GDD_PRE_STOP_DELAY"
+	// GddHookTimeout sets default timeout of each OnStart and OnStop hook of lifecycle package
+	GddHookTimeout envVariable = "GDD_HOOK_TIMEOUT"
 	// GddWriteTimeout sets http connection write timeout
 	GddWriteTimeout envVariable = "GDD_WRITE_TIMEOUT"
 	// GddReadTimeout sets http connection read timeout
 	GddReadTimeout envVariable = "GDD_READ_TIMEOUT"
 	// GddIdleTimeout sets http connection idle timeout
 	GddIdleTimeout envVariable = "GDD_IDLE_TIMEOUT"
+	// GddTlsCertFile is the path of PEM encoded server certificate, setting it with GddTlsKeyFile enables https.
+	// Both files are reloaded when changed.
+	GddTlsCertFile envVariable = "GDD_TLS_CERT_FILE"
+	// GddTlsKeyFile is the path of PEM encoded server private key
+	GddTlsKeyFile envVariable = "GDD_TLS_KEY_FILE"
+	// GddTlsClientCaFile is the path of PEM encoded CA certificates for verifying client certificates, setting it enables mutual TLS
+	GddTlsClientCaFile envVariable = "GDD_TLS_CLIENT_CA_FILE"
+	// GddTlsClientAuth is the client certificate policy: none, request, require, verify_if_given or require_and_verify.
+	// It defaults to require_and_verify if GddTlsClientCaFile is set, otherwise none.
+	GddTlsClientAuth envVariable = "GDD_TLS_CLIENT_AUTH"
+	// GddTlsMinVersion is the minimum TLS version, 1.0, 1.1, 1.2 or 1.3
+	GddTlsMinVersion envVariable = "GDD_TLS_MIN_VERSION"
+	// GddTlsReloadInterval is how often certificate files are checked for changes
+	GddTlsReloadInterval envVariable = "GDD_TLS_RELOAD_INTERVAL"
+	// GddH2cEnable enables HTTP/2 over cleartext for http server without TLS
+	GddH2cEnable envVariable = "GDD_H2C_ENABLE"
+	// GddSinglePortEnable serves http and grpc on GDD_PORT together by sniffing connections, only for servers
+	// started by RestServer.RunWithGrpc and without TLS
+	GddSinglePortEnable envVariable = "GDD_SINGLE_PORT_ENABLE"
 	// GddRouteRootPath sets root path for all routes
 	GddRouteRootPath envVariable = "GDD_ROUTE_ROOT_PATH"
 	// GddServiceName sets service name
@@ -159,6 +193,15 @@ const (
 	GddRetryCount         envVariable = "GDD_RETRY_COUNT"
 	GddTracingMetricsRoot envVariable = "GDD_TRACING_METRICS_ROOT"
 
+	// GddClientPolicy is the default call policy of generated http clients,
+	// e.g. timeout:3s;retries:2;backoff:100ms;max_backoff:1s;retry_status:502|503|504;hedge:95;hedge_max:1;encoding:msgpack.
+	// It is timeout:3m;retries:3 if not set, the same as timeout and retry middlewares of client proxies generated
+	// before, except that non-idempotent calls without Idempotency-Key are no longer retried.
+	GddClientPolicy envVariable = "GDD_CLIENT_POLICY"
+	// GddClientPolicies is a comma separated list of per downstream service call policies overriding GddClientPolicy,
+	// e.g. usersvc=timeout:2s;retries:3,ordersvc=hedge:99
+	GddClientPolicies envVariable = "GDD_CLIENT_POLICIES"
+
 	GddServiceDiscoveryMode envVariable = "GDD_SERVICE_DISCOVERY_MODE"
 
 	GddNacosNamespaceId         envVariable = "GDD_NACOS_NAMESPACE_ID"
@@ -180,6 +223,8 @@ const (
 
 	// GddWeight node weight
 	GddWeight envVariable = "GDD_WEIGHT"
+	// GddZone is the zone this node is deployed in, it is registered as zone metadata for zone aware load balancing
+	GddZone envVariable = "GDD_ZONE"
 
 	GddApolloCluster      envVariable = "GDD_APOLLO_CLUSTER"
 	GddApolloAddr         envVariable = "GDD_APOLLO_ADDR"
@@ -195,10 +240,76 @@ const (
 
 	GddStatsFreq envVariable = "GDD_STATS_FREQ"
 
+	// GddOutlierEnable enables outlier ejection of unhealthy upstream instances for gateway and restclient
+	GddOutlierEnable envVariable = "GDD_OUTLIER_ENABLE"
+	// GddOutlierConsecutiveErrors ejects an instance after this many consecutive failures
+	GddOutlierConsecutiveErrors envVariable = "GDD_OUTLIER_CONSECUTIVE_ERRORS"
+	// GddOutlierErrorRate ejects an instance when its failure rate in GddOutlierInterval reaches this value
+	GddOutlierErrorRate envVariable = "GDD_OUTLIER_ERROR_RATE"
+	// GddOutlierMinRequests is the minimum requests in GddOutlierInterval before GddOutlierErrorRate takes effect
+	GddOutlierMinRequests envVariable = "GDD_OUTLIER_MIN_REQUESTS"
+	// GddOutlierInterval is the statistic window of failure rate
+	GddOutlierInterval envVariable = "GDD_OUTLIER_INTERVAL"
+	// GddOutlierBaseEjectionTime is multiplied by how many times an instance has been ejected
+	GddOutlierBaseEjectionTime envVariable = "GDD_OUTLIER_BASE_EJECTION_TIME"
+	// GddOutlierMaxEjectionTime caps ejection time
+	GddOutlierMaxEjectionTime envVariable = "GDD_OUTLIER_MAX_EJECTION_TIME"
+	// GddOutlierSlowThreshold treats responses slower than this as failures, 0 to disable
+	GddOutlierSlowThreshold envVariable = "GDD_OUTLIER_SLOW_THRESHOLD"
+	// GddOutlierHealthPath enables active health check by probing this path of every known instance, empty to disable
+	GddOutlierHealthPath envVariable = "GDD_OUTLIER_HEALTH_PATH"
+	// GddOutlierHealthInterval active health check interval
+	GddOutlierHealthInterval envVariable = "GDD_OUTLIER_HEALTH_INTERVAL"
+	// GddOutlierHealthTimeout active health check timeout
+	GddOutlierHealthTimeout envVariable = "GDD_OUTLIER_HEALTH_TIMEOUT"
+	// GddOutlierIdleTimeout forgets instances neither selected nor requested for this long, 0 to keep them forever
+	GddOutlierIdleTimeout envVariable = "GDD_OUTLIER_IDLE_TIMEOUT"
+
+	// GddRatelimitEnable enables http rate limiting middleware for rest server
+	GddRatelimitEnable envVariable = "GDD_RATELIMIT_ENABLE"
+	// GddRatelimitDefault is the limit applied to routes without their own limit, e.g. 100-S-200, empty means no limit
+	GddRatelimitDefault envVariable = "GDD_RATELIMIT_DEFAULT"
+	// GddRatelimitRoutes is a comma separated list of per-route limits, e.g. GetUser=10-S-20,SaveUser=100-M
+	GddRatelimitRoutes envVariable = "GDD_RATELIMIT_ROUTES"
+	// GddRatelimitKey is a comma separated list of key extractors: ip, route, user or header:<name>
+	GddRatelimitKey envVariable = "GDD_RATELIMIT_KEY"
+
+	// GddAuthEnable enforces @auth and @role annotations by generated main functions, annotated apis are public
+	// if it is false. GDD_AUTH_JWKS_FILE or GDD_AUTH_API_KEYS must be set as well if it is true.
+	GddAuthEnable envVariable = "GDD_AUTH_ENABLE"
+	// GddAuthJwksFile is the path of a local JWKS file holding the keys for verifying JWT, it is reloaded when changed
+	GddAuthJwksFile envVariable = "GDD_AUTH_JWKS_FILE"
+	// GddAuthJwksRefreshInterval is how often the JWKS file is checked for key rotation
+	GddAuthJwksRefreshInterval envVariable = "GDD_AUTH_JWKS_REFRESH_INTERVAL"
+	// GddAuthJwtIssuer is the expected iss claim of JWT, empty means not checked
+	GddAuthJwtIssuer envVariable = "GDD_AUTH_JWT_ISSUER"
+	// GddAuthJwtAudience is the expected aud claim of JWT, empty means not checked
+	GddAuthJwtAudience envVariable = "GDD_AUTH_JWT_AUDIENCE"
+	// GddAuthJwtRolesClaim is the dot separated path of the claim holding roles, e.g. realm_access.roles
+	GddAuthJwtRolesClaim envVariable = "GDD_AUTH_JWT_ROLES_CLAIM"
+	// GddAuthApiKeyHeader is the header carrying api key
+	GddAuthApiKeyHeader envVariable = "GDD_AUTH_API_KEY_HEADER"
+	// GddAuthApiKeys is a comma separated list of api keys, e.g. key1=service-a:admin|ops,key2=service-b
+	GddAuthApiKeys envVariable = "GDD_AUTH_API_KEYS"
+
 	GddRegisterHost  envVariable = "GDD_REGISTER_HOST"
 	GddEtcdEndpoints envVariable = "GDD_ETCD_ENDPOINTS"
 	GddEtcdLease     envVariable = "GDD_ETCD_LEASE"
 
+	// GddStaticFile is the path of yaml file listing endpoints of services for static service discovery mode
+	GddStaticFile envVariable = "GDD_STATIC_FILE"
+	// GddStaticWatchInterval is the interval of checking GddStaticFile for changes, e.g. 5s
+	GddStaticWatchInterval envVariable = "GDD_STATIC_WATCH_INTERVAL"
+	// GddDnsDomain is the domain of SRV records for dns service discovery mode, service usersvc_rest
+	// is resolved from _usersvc_rest._tcp.<GddDnsDomain>
+	GddDnsDomain envVariable = "GDD_DNS_DOMAIN"
+	// GddDnsServer is the address of DNS server, e.g. 127.0.0.1:8600. If empty, the system resolver is used.
+	GddDnsServer envVariable = "GDD_DNS_SERVER"
+	// GddDnsRefreshInterval is the interval of resolving SRV records again, e.g. 30s
+	GddDnsRefreshInterval envVariable = "GDD_DNS_REFRESH_INTERVAL"
+	// GddDnsScheme is the scheme of base urls of rest services resolved from SRV records
+	GddDnsScheme envVariable = "GDD_DNS_SCHEME"
+
 	// configs for memberlist component
 	// GddMemSeed sets cluster seeds for joining
 	GddMemSeed envVariable = "GDD_MEM_SEED"
@@ -249,6 +360,34 @@ const (
 	// GddMemCIDRsAllowed If not set, allow any connection (default), otherwise specify all networks
 	// allowed connecting (you must specify IPv6/IPv4 separately)
 	GddMemCIDRsAllowed envVariable = "GDD_MEM_CIDRS_ALLOWED"
+	// GddMemDynamicProbeTimeout derives probe timeout from measured RTTs, GddMemProbeTimeout becomes the upper bound
+	GddMemDynamicProbeTimeout envVariable = "GDD_MEM_DYNAMIC_PROBE_TIMEOUT"
+	// GddMemDynamicPacketSize discovers the largest UDP packet size which can be delivered to other nodes
+	GddMemDynamicPacketSize envVariable = "GDD_MEM_DYNAMIC_PACKET_SIZE"
+	// GddMemCoordinates maintains network coordinates to estimate RTTs between nodes,
+	// SWRRServiceProvider prefers nearby instances if enabled. It should be enabled on all nodes.
+	GddMemCoordinates envVariable = "GDD_MEM_COORDINATES"
+	// GddMemSecretKey is the base64 encoded primary key for gossip encryption, 16, 24 or 32 bytes to select AES-128,
+	// AES-192 or AES-256. Setting it enables gossip encryption.
+	GddMemSecretKey envVariable = "GDD_MEM_SECRET_KEY"
+	// GddMemSecondaryKeys is a comma separated list of base64 encoded keys accepted for decryption besides
+	// GddMemSecretKey, used for rotating keys without downtime
+	GddMemSecondaryKeys envVariable = "GDD_MEM_SECONDARY_KEYS"
+	// GddMemGossipVerifyIncoming drops unencrypted incoming messages if gossip encryption is enabled,
+	// set it false on all nodes while enabling encryption on a running cluster
+	GddMemGossipVerifyIncoming envVariable = "GDD_MEM_GOSSIP_VERIFY_INCOMING"
+	// GddMemGossipVerifyOutgoing encrypts outgoing messages if gossip encryption is enabled
+	GddMemGossipVerifyOutgoing envVariable = "GDD_MEM_GOSSIP_VERIFY_OUTGOING"
+	// GddMemTlsCertFile is the path of PEM encoded certificate of this node, setting it with GddMemTlsKeyFile and
+	// GddMemTlsCaFile wraps TCP connections between nodes with mutual TLS
+	GddMemTlsCertFile envVariable = "GDD_MEM_TLS_CERT_FILE"
+	// GddMemTlsKeyFile is the path of PEM encoded private key of this node
+	GddMemTlsKeyFile envVariable = "GDD_MEM_TLS_KEY_FILE"
+	// GddMemTlsCaFile is the path of PEM encoded CA certificates for verifying other nodes
+	GddMemTlsCaFile envVariable = "GDD_MEM_TLS_CA_FILE"
+	// GddMemTlsServerName is the name in certificates of all nodes. If empty, certificates are verified against
+	// node addresses.
+	GddMemTlsServerName envVariable = "GDD_MEM_TLS_SERVER_NAME"
 )
 
 // Load loads value from environment variable
@@ -361,6 +500,14 @@ func GetPort() uint64 {
 	return uint64(httpPort)
 }
 
+// GetScheme returns https if server certificate is configured, otherwise http
+func GetScheme() string {
+	if stringutils.IsNotEmpty(GddTlsCertFile.Load()) {
+		return "https"
+	}
+	return "http"
+}
+
 func GetGrpcPort() uint64 {
 	grpcPort := DefaultGddGrpcPort
 	if stringutils.IsNotEmpty(GddGrpcPort.Load()) {
@@ -371,6 +518,11 @@ func GetGrpcPort() uint64 {
 	return uint64(grpcPort)
 }
 
+// SinglePortEnabled reports whether grpc shares GDD_PORT with http
+func SinglePortEnabled() bool {
+	return cast.ToBoolOrDefault(GddSinglePortEnable.Load(), DefaultGddSinglePortEnable)
+}
+
 func ServiceDiscoveryMap() map[string]struct{} {
 	modeStr := GddServiceDiscoveryMode.LoadOrDefault(DefaultGddServiceDiscoveryMode)
 	if stringutils.IsEmpty(modeStr) {
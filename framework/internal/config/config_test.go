@@ -337,3 +337,14 @@ func Test_envVariable_MarshalJSON(t *testing.T) {
 		So(string(data), ShouldEqual, `"8080"`)
 	})
 }
+
+func TestGetGrpcPort(t *testing.T) {
+	Convey("Grpc port should be GDD_GRPC_PORT even in single port mode", t, func() {
+		config.GddPort.Write("8080")
+		config.GddGrpcPort.Write("9090")
+		So(config.GetGrpcPort(), ShouldEqual, 9090)
+		config.GddSinglePortEnable.Write("true")
+		defer config.GddSinglePortEnable.Write("")
+		So(config.GetGrpcPort(), ShouldEqual, 9090)
+	})
+}
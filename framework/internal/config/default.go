@@ -6,28 +6,45 @@ const FrameworkName = "odin"
 
 const (
 	// Default configs for framework component
-	DefaultGddBanner             = true
-	DefaultGddBannerText         = FrameworkName
-	DefaultGddLogLevel           = "info"
-	DefaultGddLogFormat          = "text"
-	DefaultGddLogReqEnable       = false
-	DefaultGddLogCaller          = false
-	DefaultGddLogDiscard         = false
-	DefaultGddGraceTimeout       = "15s"
-	DefaultGddWriteTimeout       = "15s"
-	DefaultGddReadTimeout        = "15s"
-	DefaultGddIdleTimeout        = "60s"
-	DefaultGddServiceName        = ""
-	DefaultGddRouteRootPath      = ""
-	DefaultGddHost               = ""
-	DefaultGddPort               = 6060
-	DefaultGddGrpcPort           = 50051
-	DefaultGddRetryCount         = 0
-	DefaultGddManage             = true
-	DefaultGddManageUser         = "admin"
-	DefaultGddManagePass         = "admin"
-	DefaultGddTracingMetricsRoot = "tracing"
-	DefaultGddWeight             = 1
+	DefaultGddBanner                 = true
+	DefaultGddBannerText             = FrameworkName
+	DefaultGddLogLevel               = "info"
+	DefaultGddLogFormat              = "text"
+	DefaultGddLogReqEnable           = false
+	DefaultGddLogCaller              = false
+	DefaultGddLogDiscard             = false
+	DefaultGddLogReqMaxBodySize      = 4096
+	DefaultGddLogReqSkipContentTypes = "multipart/form-data,application/octet-stream,image/,audio/,video/,application/zip,application/pdf"
+	DefaultGddLogReqRedactHeaders    = "Authorization,Proxy-Authorization,Cookie,Set-Cookie"
+	DefaultGddLogReqRedactFields     = "password"
+	DefaultGddLogReqSampleRate       = 1.0
+	DefaultGddGraceTimeout           = "15s"
+	DefaultGddPreStopDelay           = "0s"
+	DefaultGddHookTimeout            = "10s"
+	DefaultGddWriteTimeout           = "15s"
+	DefaultGddReadTimeout            = "15s"
+	DefaultGddIdleTimeout            = "60s"
+	DefaultGddTlsCertFile            = ""
+	DefaultGddTlsKeyFile             = ""
+	DefaultGddTlsClientCaFile        = ""
+	DefaultGddTlsClientAuth          = ""
+	DefaultGddTlsMinVersion          = "1.2"
+	DefaultGddTlsReloadInterval      = "10s"
+	DefaultGddH2cEnable              = false
+	DefaultGddSinglePortEnable       = false
+	DefaultGddServiceName            = ""
+	DefaultGddRouteRootPath          = ""
+	DefaultGddHost                   = ""
+	DefaultGddPort                   = 6060
+	DefaultGddGrpcPort               = 50051
+	DefaultGddRetryCount             = 0
+	DefaultGddClientPolicy           = "timeout:3m;retries:3"
+	DefaultGddClientPolicies         = ""
+	DefaultGddManage                 = true
+	DefaultGddManageUser             = "admin"
+	DefaultGddManagePass             = "admin"
+	DefaultGddTracingMetricsRoot     = "tracing"
+	DefaultGddWeight                 = 1
 
 	DefaultGddServiceDiscoveryMode = ""
 
@@ -67,10 +84,44 @@ const (
 
 	DefaultGddStatsFreq = "1s"
 
+	DefaultGddOutlierEnable            = false
+	DefaultGddOutlierConsecutiveErrors = 5
+	DefaultGddOutlierErrorRate         = 0.5
+	DefaultGddOutlierMinRequests       = 10
+	DefaultGddOutlierInterval          = "10s"
+	DefaultGddOutlierBaseEjectionTime  = "30s"
+	DefaultGddOutlierMaxEjectionTime   = "5m"
+	DefaultGddOutlierSlowThreshold     = "0s"
+	DefaultGddOutlierHealthPath        = ""
+	DefaultGddOutlierHealthInterval    = "10s"
+	DefaultGddOutlierHealthTimeout     = "3s"
+	DefaultGddOutlierIdleTimeout       = "10m"
+
+	DefaultGddRatelimitEnable  = false
+	DefaultGddRatelimitDefault = ""
+	DefaultGddRatelimitRoutes  = ""
+	DefaultGddRatelimitKey     = "ip"
+
+	DefaultGddAuthEnable              = false
+	DefaultGddAuthJwksFile            = ""
+	DefaultGddAuthJwksRefreshInterval = "1m"
+	DefaultGddAuthJwtIssuer           = ""
+	DefaultGddAuthJwtAudience         = ""
+	DefaultGddAuthJwtRolesClaim       = "roles"
+	DefaultGddAuthApiKeyHeader        = "X-API-Key"
+	DefaultGddAuthApiKeys             = ""
+
 	DefaultGddRegisterHost        = ""
 	DefaultGddEtcdEndpoints       = ""
 	DefaultGddEtcdLease     int64 = 5
 
+	DefaultGddStaticFile          = "services.yml"
+	DefaultGddStaticWatchInterval = "5s"
+	DefaultGddDnsDomain           = ""
+	DefaultGddDnsServer           = ""
+	DefaultGddDnsRefreshInterval  = "30s"
+	DefaultGddDnsScheme           = "http"
+
 	// Default configs for memberlist component
 	DefaultGddMemSeed           = ""
 	DefaultGddMemPort           = 7946
@@ -91,4 +142,11 @@ const (
 	DefaultGddMemHost           = ""
 	DefaultGddMemCIDRsAllowed   = ""
 	DefaultGddMemLogDisable     = false
+
+	DefaultGddMemDynamicProbeTimeout = false
+	DefaultGddMemDynamicPacketSize   = false
+	DefaultGddMemCoordinates         = false
+
+	DefaultGddMemGossipVerifyIncoming = true
+	DefaultGddMemGossipVerifyOutgoing = true
 )
@@ -0,0 +1,247 @@
+package lifecycle
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"github.com/youminxue/odin/framework/internal/config"
+	logger "github.com/youminxue/odin/toolkit/zlogger"
+)
+
+// Hook is a pair of callbacks run when servers start and stop. Either callback can be nil.
+type Hook struct {
+	Name    string
+	OnStart func(ctx context.Context) error
+	OnStop  func(ctx context.Context) error
+	// Timeout bounds each callback, GDD_HOOK_TIMEOUT is used if it is zero
+	Timeout time.Duration
+}
+
+// Lifecycle coordinates hooks and readiness of servers running in the same process.
+// OnStart hooks run in the order they were appended before the first server starts listening,
+// OnStop hooks run in reverse order after the last server has shut down.
+type Lifecycle struct {
+	lock      sync.Mutex
+	hooks     []Hook
+	started   []Hook
+	servers   int
+	startOnce sync.Once
+	startErr  error
+	stopOnce  sync.Once
+	stopped   chan struct{}
+	stopErr   error
+	ready     int32
+}
+
+// New creates a Lifecycle instance
+func New() *Lifecycle {
+	return &Lifecycle{
+		stopped: make(chan struct{}),
+	}
+}
+
+var defaultLifecycle = New()
+
+// Default returns the Lifecycle shared by rest and grpc servers
+func Default() *Lifecycle {
+	return defaultLifecycle
+}
+
+// Append appends hook, which should be done before servers run
+func (l *Lifecycle) Append(hook Hook) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.hooks = append(l.hooks, hook)
+}
+
+// Start is called by each server before listening. OnStart hooks are run only by the first call,
+// if any of them fails, OnStop hooks of those already started are run in reverse order and the error is returned.
+func (l *Lifecycle) Start(ctx context.Context) error {
+	l.lock.Lock()
+	l.servers++
+	l.lock.Unlock()
+	l.startOnce.Do(func() {
+		l.lock.Lock()
+		hooks := append([]Hook(nil), l.hooks...)
+		l.lock.Unlock()
+		for _, hook := range hooks {
+			if hook.OnStart != nil {
+				if err := runHook(ctx, hook, "OnStart", hook.OnStart); err != nil {
+					l.startErr = err
+					if stopErr := l.runStopHooks(ctx); stopErr != nil {
+						logger.Error().Err(stopErr).Msg("[odin] failed to stop lifecycle hooks")
+					}
+					return
+				}
+			}
+			l.lock.Lock()
+			l.started = append(l.started, hook)
+			l.lock.Unlock()
+		}
+	})
+	return l.startErr
+}
+
+// Stop is called by each server after its listener has been shut down. The last call runs OnStop hooks
+// in reverse order and returns all their errors, other calls wait for it until ctx is done.
+func (l *Lifecycle) Stop(ctx context.Context) error {
+	l.lock.Lock()
+	l.servers--
+	last := l.servers <= 0
+	l.lock.Unlock()
+	if !last {
+		select {
+		case <-l.stopped:
+			return l.stopErr
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "[odin] wait for lifecycle hooks to stop")
+		}
+	}
+	l.stopOnce.Do(func() {
+		l.stopErr = l.runStopHooks(ctx)
+		close(l.stopped)
+	})
+	return l.stopErr
+}
+
+func (l *Lifecycle) runStopHooks(ctx context.Context) error {
+	l.lock.Lock()
+	started := l.started
+	l.started = nil
+	l.lock.Unlock()
+	var result error
+	for i := len(started) - 1; i >= 0; i-- {
+		hook := started[i]
+		if hook.OnStop == nil {
+			continue
+		}
+		if err := runHook(ctx, hook, "OnStop", hook.OnStop); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+	return result
+}
+
+// Ready reports whether servers are serving and not draining
+func (l *Lifecycle) Ready() bool {
+	return atomic.LoadInt32(&l.ready) == 1
+}
+
+// SetReady marks servers ready or not ready for traffic
+func (l *Lifecycle) SetReady(ready bool) {
+	var value int32
+	if ready {
+		value = 1
+	}
+	atomic.StoreInt32(&l.ready, value)
+}
+
+// Drain marks servers not ready, calls markUnhealthy to mark the instance unhealthy in service registry,
+// then waits GDD_PRE_STOP_DELAY for clients to stop sending requests before listeners are closed
+func (l *Lifecycle) Drain(markUnhealthy func()) {
+	l.SetReady(false)
+	if markUnhealthy != nil {
+		markUnhealthy()
+	}
+	delay := PreStopDelay()
+	if delay > 0 {
+		logger.Info().Msgf("[odin] draining for %s before shutting down", delay)
+		time.Sleep(delay)
+	}
+}
+
+func runHook(ctx context.Context, hook Hook, phase string, fn func(ctx context.Context) error) error {
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = HookTimeout()
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	begin := time.Now()
+	result := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				result <- errors.Errorf("panic: %v", r)
+			}
+		}()
+		result <- fn(ctx)
+	}()
+	var err error
+	select {
+	case err = <-result:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		err = errors.Wrapf(err, "[odin] %s hook %s failed", phase, hook.Name)
+		logger.Error().Err(err).Msgf("[odin] %s hook %s failed after %s", phase, hook.Name, time.Since(begin))
+		return err
+	}
+	logger.Info().Msgf("[odin] %s hook %s finished in %s", phase, hook.Name, time.Since(begin))
+	return nil
+}
+
+// PreStopDelay returns GDD_PRE_STOP_DELAY
+func PreStopDelay() time.Duration {
+	return parseDuration(config.GddPreStopDelay.Load(), string(config.GddPreStopDelay), config.DefaultGddPreStopDelay)
+}
+
+// HookTimeout returns GDD_HOOK_TIMEOUT
+func HookTimeout() time.Duration {
+	return parseDuration(config.GddHookTimeout.Load(), string(config.GddHookTimeout), config.DefaultGddHookTimeout)
+}
+
+func parseDuration(value string, name string, defaultValue string) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		logger.Debug().Msgf("Parse %s %s as time.Duration failed: %s, use default %s instead.\n", name,
+			value, err.Error(), defaultValue)
+		d, _ = time.ParseDuration(defaultValue)
+	}
+	return d
+}
+
+// Append appends hook to the default Lifecycle
+func Append(hook Hook) {
+	defaultLifecycle.Append(hook)
+}
+
+// OnStart appends a hook named name running fn when servers start
+func OnStart(name string, fn func(ctx context.Context) error) {
+	defaultLifecycle.Append(Hook{Name: name, OnStart: fn})
+}
+
+// OnStop appends a hook named name running fn after servers have shut down
+func OnStop(name string, fn func(ctx context.Context) error) {
+	defaultLifecycle.Append(Hook{Name: name, OnStop: fn})
+}
+
+// Start starts the default Lifecycle
+func Start(ctx context.Context) error {
+	return defaultLifecycle.Start(ctx)
+}
+
+// Stop stops the default Lifecycle
+func Stop(ctx context.Context) error {
+	return defaultLifecycle.Stop(ctx)
+}
+
+// Ready reports whether the default Lifecycle is ready
+func Ready() bool {
+	return defaultLifecycle.Ready()
+}
+
+// SetReady marks the default Lifecycle ready or not ready
+func SetReady(ready bool) {
+	defaultLifecycle.SetReady(ready)
+}
+
+// Drain drains the default Lifecycle
+func Drain(markUnhealthy func()) {
+	defaultLifecycle.Drain(markUnhealthy)
+}
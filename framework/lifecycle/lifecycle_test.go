@@ -0,0 +1,100 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/youminxue/odin/framework/internal/config"
+)
+
+func TestLifecycle(t *testing.T) {
+	var (
+		lock  sync.Mutex
+		calls []string
+	)
+	record := func(call string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			lock.Lock()
+			defer lock.Unlock()
+			calls = append(calls, call)
+			return nil
+		}
+	}
+	l := New()
+	l.Append(Hook{Name: "db", OnStart: record("start db"), OnStop: record("stop db")})
+	l.Append(Hook{Name: "cache", OnStop: record("stop cache")})
+	l.Append(Hook{Name: "consumer", OnStart: record("start consumer"), OnStop: func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}, Timeout: 10 * time.Millisecond})
+
+	// rest and grpc servers share the lifecycle, hooks run only once
+	require.NoError(t, l.Start(context.Background()))
+	require.NoError(t, l.Start(context.Background()))
+	require.Equal(t, []string{"start db", "start consumer"}, calls)
+
+	l.SetReady(true)
+	require.True(t, l.Ready())
+	l.Drain(nil)
+	require.False(t, l.Ready())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- l.Stop(context.Background())
+	}()
+	select {
+	case <-done:
+		t.Fatal("the first server should wait for the last one")
+	case <-time.After(20 * time.Millisecond):
+	}
+	err := l.Stop(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "OnStop hook consumer failed")
+	require.Equal(t, err, <-done)
+	require.Equal(t, []string{"start db", "start consumer", "stop cache", "stop db"}, calls)
+}
+
+func TestLifecycle_StartFailed(t *testing.T) {
+	var stopped []string
+	l := New()
+	l.Append(Hook{Name: "db", OnStop: func(ctx context.Context) error {
+		stopped = append(stopped, "db")
+		return nil
+	}})
+	l.Append(Hook{Name: "mq", OnStart: func(ctx context.Context) error {
+		return errors.New("connection refused")
+	}, OnStop: func(ctx context.Context) error {
+		stopped = append(stopped, "mq")
+		return nil
+	}})
+	l.Append(Hook{Name: "panic", OnStart: func(ctx context.Context) error {
+		panic("should not run")
+	}})
+	err := l.Start(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "OnStart hook mq failed: connection refused")
+	require.Equal(t, []string{"db"}, stopped)
+	require.NoError(t, l.Stop(context.Background()))
+	require.Equal(t, []string{"db"}, stopped)
+}
+
+func TestRunHook_Panic(t *testing.T) {
+	err := runHook(context.Background(), Hook{Name: "boom"}, "OnStart", func(ctx context.Context) error {
+		panic("boom")
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "panic: boom")
+}
+
+func TestPreStopDelay(t *testing.T) {
+	_ = config.GddPreStopDelay.Write("5s")
+	defer config.GddPreStopDelay.Write("")
+	require.Equal(t, 5*time.Second, PreStopDelay())
+	_ = config.GddPreStopDelay.Write("abc")
+	require.Equal(t, time.Duration(0), PreStopDelay())
+	require.Equal(t, 10*time.Second, HookTimeout())
+}
@@ -0,0 +1,559 @@
+package outlier
+
+import (
+	"context"
+	"fmt"
+	"github.com/youminxue/odin/framework/internal/config"
+	"github.com/youminxue/odin/framework/registry"
+	"github.com/youminxue/odin/toolkit/cast"
+	"github.com/youminxue/odin/toolkit/loadbalance"
+	"github.com/youminxue/odin/toolkit/stringutils"
+	logger "github.com/youminxue/odin/toolkit/zlogger"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxSelectAttempts is how many times Provider asks underlying provider for a not ejected instance
+const maxSelectAttempts = 5
+
+type instance struct {
+	baseUrl             string
+	windowStart         time.Time
+	windowRequests      int
+	windowFailures      int
+	requests            uint64
+	failures            uint64
+	consecutiveFailures int
+	latency             time.Duration
+	ejections           int
+	ejectedUntil        time.Time
+	healthErr           string
+	// lastSeen is when the instance was selected or requested last time
+	lastSeen time.Time
+}
+
+// Stat is a snapshot of an upstream instance
+type Stat struct {
+	Instance            string     `json:"instance"`
+	Requests            uint64     `json:"requests"`
+	Failures            uint64     `json:"failures"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	ErrorRate           float64    `json:"errorRate"`
+	Latency             string     `json:"latency"`
+	Ejected             bool       `json:"ejected"`
+	Ejections           int        `json:"ejections"`
+	EjectedUntil        *time.Time `json:"ejectedUntil,omitempty"`
+	HealthCheckError    string     `json:"healthCheckError,omitempty"`
+}
+
+// Detector tracks failures and latency of upstream instances by passive reports and optional active health check,
+// and ejects outliers for a while
+type Detector struct {
+	consecutiveErrors int
+	errorRate         float64
+	minRequests       int
+	interval          time.Duration
+	baseEjectionTime  time.Duration
+	maxEjectionTime   time.Duration
+	slowThreshold     time.Duration
+	healthPath        string
+	healthInterval    time.Duration
+	healthTimeout     time.Duration
+	idleTimeout       time.Duration
+	client            *http.Client
+	now               func() time.Time
+
+	mu        sync.RWMutex
+	instances map[string]*instance
+	lastSweep time.Time
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+type DetectorOption func(*Detector)
+
+// WithConsecutiveErrors ejects an instance after n consecutive failures, 0 to disable
+func WithConsecutiveErrors(n int) DetectorOption {
+	return func(d *Detector) {
+		d.consecutiveErrors = n
+	}
+}
+
+// WithErrorRate ejects an instance when its failure rate within interval reaches rate with at least minRequests requests, 0 rate to disable
+func WithErrorRate(rate float64, minRequests int, interval time.Duration) DetectorOption {
+	return func(d *Detector) {
+		d.errorRate = rate
+		d.minRequests = minRequests
+		d.interval = interval
+	}
+}
+
+// WithEjectionTime sets ejection time which is base multiplied by how many times the instance has been ejected, capped by max
+func WithEjectionTime(base, max time.Duration) DetectorOption {
+	return func(d *Detector) {
+		d.baseEjectionTime = base
+		d.maxEjectionTime = max
+	}
+}
+
+// WithSlowThreshold treats responses slower than threshold as failures
+func WithSlowThreshold(threshold time.Duration) DetectorOption {
+	return func(d *Detector) {
+		d.slowThreshold = threshold
+	}
+}
+
+// WithHealthCheck probes path of every known instance by GET request every interval,
+// failed probes count as consecutive failures and a successful probe brings an ejected instance back
+func WithHealthCheck(path string, interval, timeout time.Duration) DetectorOption {
+	return func(d *Detector) {
+		d.healthPath = path
+		d.healthInterval = interval
+		d.healthTimeout = timeout
+	}
+}
+
+// WithIdleTimeout forgets instances neither selected nor requested for timeout, such as instances removed from
+// service registries, 0 to keep them forever
+func WithIdleTimeout(timeout time.Duration) DetectorOption {
+	return func(d *Detector) {
+		d.idleTimeout = timeout
+	}
+}
+
+// WithHttpClient sets http client for active health check
+func WithHttpClient(client *http.Client) DetectorOption {
+	return func(d *Detector) {
+		d.client = client
+	}
+}
+
+// NewDetector creates a Detector instance, call Close to stop active health check
+func NewDetector(opts ...DetectorOption) *Detector {
+	d := &Detector{
+		consecutiveErrors: config.DefaultGddOutlierConsecutiveErrors,
+		errorRate:         config.DefaultGddOutlierErrorRate,
+		minRequests:       config.DefaultGddOutlierMinRequests,
+		interval:          10 * time.Second,
+		baseEjectionTime:  30 * time.Second,
+		maxEjectionTime:   5 * time.Minute,
+		healthInterval:    10 * time.Second,
+		healthTimeout:     3 * time.Second,
+		idleTimeout:       10 * time.Minute,
+		client:            http.DefaultClient,
+		now:               time.Now,
+		instances:         make(map[string]*instance),
+		stop:              make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	if stringutils.IsNotEmpty(d.healthPath) && d.healthInterval > 0 {
+		go d.healthCheckLoop()
+	}
+	return d
+}
+
+func loadDuration(value, defaultValue string) time.Duration {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		duration, _ = time.ParseDuration(defaultValue)
+	}
+	return duration
+}
+
+// NewDetectorFromConfig creates a Detector instance from GDD_OUTLIER_* environment variables
+func NewDetectorFromConfig() *Detector {
+	consecutiveErrors := config.DefaultGddOutlierConsecutiveErrors
+	if n, err := cast.ToIntE(config.GddOutlierConsecutiveErrors.Load()); err == nil {
+		consecutiveErrors = n
+	}
+	errorRate := config.DefaultGddOutlierErrorRate
+	if rate, err := cast.ToFloat64E(config.GddOutlierErrorRate.Load()); err == nil {
+		errorRate = rate
+	}
+	minRequests := config.DefaultGddOutlierMinRequests
+	if n, err := cast.ToIntE(config.GddOutlierMinRequests.Load()); err == nil {
+		minRequests = n
+	}
+	return NewDetector(
+		WithConsecutiveErrors(consecutiveErrors),
+		WithErrorRate(errorRate, minRequests, loadDuration(config.GddOutlierInterval.Load(), config.DefaultGddOutlierInterval)),
+		WithEjectionTime(loadDuration(config.GddOutlierBaseEjectionTime.Load(), config.DefaultGddOutlierBaseEjectionTime),
+			loadDuration(config.GddOutlierMaxEjectionTime.Load(), config.DefaultGddOutlierMaxEjectionTime)),
+		WithSlowThreshold(loadDuration(config.GddOutlierSlowThreshold.Load(), config.DefaultGddOutlierSlowThreshold)),
+		WithHealthCheck(config.GddOutlierHealthPath.LoadOrDefault(config.DefaultGddOutlierHealthPath),
+			loadDuration(config.GddOutlierHealthInterval.Load(), config.DefaultGddOutlierHealthInterval),
+			loadDuration(config.GddOutlierHealthTimeout.Load(), config.DefaultGddOutlierHealthTimeout)),
+		WithIdleTimeout(loadDuration(config.GddOutlierIdleTimeout.Load(), config.DefaultGddOutlierIdleTimeout)),
+	)
+}
+
+var defaultDetector *Detector
+var defaultDetectorOnce sync.Once
+
+// DefaultDetector returns the Detector shared by gateway and restclient, created from GDD_OUTLIER_* environment variables
+func DefaultDetector() *Detector {
+	defaultDetectorOnce.Do(func() {
+		defaultDetector = NewDetectorFromConfig()
+	})
+	return defaultDetector
+}
+
+// Enabled reports whether GDD_OUTLIER_ENABLE is true
+func Enabled() bool {
+	return cast.ToBoolOrDefault(config.GddOutlierEnable.Load(), config.DefaultGddOutlierEnable)
+}
+
+// instanceKey returns scheme and host of server as key, so that requests to different paths of the same instance are tracked together
+func instanceKey(server string) string {
+	u, err := url.Parse(server)
+	if err != nil || stringutils.IsEmpty(u.Host) {
+		return server
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// getOrAdd returns the instance of server and marks it seen, idle instances are swept at most once per idle
+// timeout. It must be called with lock held.
+func (d *Detector) getOrAdd(server string) *instance {
+	now := d.now()
+	d.sweep(now)
+	key := instanceKey(server)
+	ins, ok := d.instances[key]
+	if !ok {
+		ins = &instance{
+			baseUrl:     server,
+			windowStart: now,
+		}
+		d.instances[key] = ins
+	}
+	ins.lastSeen = now
+	return ins
+}
+
+// sweep removes instances not seen for idle timeout, ejected ones are kept until ejection ends so that they are
+// not brought back early by being forgotten
+func (d *Detector) sweep(now time.Time) {
+	if d.idleTimeout <= 0 || now.Sub(d.lastSweep) < d.idleTimeout {
+		return
+	}
+	d.lastSweep = now
+	for key, ins := range d.instances {
+		if now.Sub(ins.lastSeen) >= d.idleTimeout && !now.Before(ins.ejectedUntil) {
+			delete(d.instances, key)
+		}
+	}
+}
+
+// Track adds server to known instances for active health check
+func (d *Detector) Track(server string) {
+	if stringutils.IsEmpty(server) {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ins := d.getOrAdd(server)
+	if len(server) > len(ins.baseUrl) {
+		// prefer base url with route root path for health check
+		ins.baseUrl = server
+	}
+}
+
+// Report records result of a request to server
+func (d *Detector) Report(server string, success bool, latency time.Duration) {
+	if stringutils.IsEmpty(server) {
+		return
+	}
+	if d.slowThreshold > 0 && latency > d.slowThreshold {
+		success = false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ins := d.getOrAdd(server)
+	now := d.now()
+	if d.interval > 0 && now.Sub(ins.windowStart) >= d.interval {
+		if ins.windowFailures == 0 && now.After(ins.ejectedUntil) {
+			ins.ejections = 0
+		}
+		ins.windowStart = now
+		ins.windowRequests = 0
+		ins.windowFailures = 0
+	}
+	if ins.latency == 0 {
+		ins.latency = latency
+	} else {
+		// exponentially weighted moving average
+		ins.latency = time.Duration(0.8*float64(ins.latency) + 0.2*float64(latency))
+	}
+	ins.requests++
+	ins.windowRequests++
+	if success {
+		ins.consecutiveFailures = 0
+		return
+	}
+	ins.failures++
+	ins.windowFailures++
+	ins.consecutiveFailures++
+	d.checkEjection(server, ins, now)
+}
+
+func (d *Detector) checkEjection(server string, ins *instance, now time.Time) {
+	if now.Before(ins.ejectedUntil) {
+		return
+	}
+	var reason string
+	if d.consecutiveErrors > 0 && ins.consecutiveFailures >= d.consecutiveErrors {
+		reason = fmt.Sprintf("%d consecutive failures", ins.consecutiveFailures)
+	} else if d.errorRate > 0 && ins.windowRequests >= d.minRequests &&
+		float64(ins.windowFailures)/float64(ins.windowRequests) >= d.errorRate {
+		reason = fmt.Sprintf("%d failures out of %d requests", ins.windowFailures, ins.windowRequests)
+	}
+	if stringutils.IsEmpty(reason) {
+		return
+	}
+	ins.ejections++
+	ejection := d.baseEjectionTime * time.Duration(ins.ejections)
+	if d.maxEjectionTime > 0 && ejection > d.maxEjectionTime {
+		ejection = d.maxEjectionTime
+	}
+	ins.ejectedUntil = now.Add(ejection)
+	ins.consecutiveFailures = 0
+	ins.windowStart = now
+	ins.windowRequests = 0
+	ins.windowFailures = 0
+	logger.Warn().Msgf("[odin] instance %s is ejected for %s because of %s", server, ejection, reason)
+}
+
+// Ejected reports whether server is ejected currently
+func (d *Detector) Ejected(server string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	ins, ok := d.instances[instanceKey(server)]
+	if !ok {
+		return false
+	}
+	return d.now().Before(ins.ejectedUntil)
+}
+
+// Snapshot returns stats of all known instances sorted by instance
+func (d *Detector) Snapshot() []Stat {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	now := d.now()
+	stats := make([]Stat, 0, len(d.instances))
+	for key, ins := range d.instances {
+		stat := Stat{
+			Instance:            key,
+			Requests:            ins.requests,
+			Failures:            ins.failures,
+			ConsecutiveFailures: ins.consecutiveFailures,
+			Latency:             ins.latency.String(),
+			Ejected:             now.Before(ins.ejectedUntil),
+			Ejections:           ins.ejections,
+			HealthCheckError:    ins.healthErr,
+		}
+		if ins.windowRequests > 0 {
+			stat.ErrorRate = float64(ins.windowFailures) / float64(ins.windowRequests)
+		}
+		if stat.Ejected {
+			until := ins.ejectedUntil
+			stat.EjectedUntil = &until
+		}
+		stats = append(stats, stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Instance < stats[j].Instance
+	})
+	return stats
+}
+
+// Close stops active health check
+func (d *Detector) Close() {
+	d.stopOnce.Do(func() {
+		close(d.stop)
+	})
+}
+
+func (d *Detector) healthCheckLoop() {
+	ticker := time.NewTicker(d.healthInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+			d.CheckHealth()
+		}
+	}
+}
+
+// CheckHealth probes all known instances once
+func (d *Detector) CheckHealth() {
+	d.mu.RLock()
+	baseUrls := make([]string, 0, len(d.instances))
+	for _, ins := range d.instances {
+		baseUrls = append(baseUrls, ins.baseUrl)
+	}
+	d.mu.RUnlock()
+	var wg sync.WaitGroup
+	for _, baseUrl := range baseUrls {
+		wg.Add(1)
+		go func(baseUrl string) {
+			defer wg.Done()
+			d.probe(baseUrl)
+		}(baseUrl)
+	}
+	wg.Wait()
+}
+
+func (d *Detector) probe(baseUrl string) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.healthTimeout)
+	defer cancel()
+	var probeErr error
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(baseUrl, "/")+"/"+strings.TrimPrefix(d.healthPath, "/"), nil)
+	if err != nil {
+		probeErr = err
+	} else if resp, err := d.client.Do(req); err != nil {
+		probeErr = err
+	} else {
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusBadRequest {
+			probeErr = fmt.Errorf("health check responded %s", resp.Status)
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ins, ok := d.instances[instanceKey(baseUrl)]
+	if !ok {
+		return
+	}
+	now := d.now()
+	if probeErr == nil {
+		ins.healthErr = ""
+		ins.consecutiveFailures = 0
+		if now.Before(ins.ejectedUntil) {
+			ins.ejectedUntil = time.Time{}
+			logger.Info().Msgf("[odin] instance %s is brought back by health check", baseUrl)
+		}
+		return
+	}
+	ins.healthErr = probeErr.Error()
+	ins.consecutiveFailures++
+	d.checkEjection(baseUrl, ins, now)
+}
+
+var _ registry.IBalancedServiceProvider = (*Provider)(nil)
+
+// Provider skips ejected instances selected by the underlying service provider
+type Provider struct {
+	provider registry.IServiceProvider
+	detector *Detector
+}
+
+// SelectServer asks the underlying provider for a not ejected instance.
+// If all attempts hit ejected instances, the last selected one is returned to fail open
+func (p *Provider) SelectServer() string {
+	var server string
+	for i := 0; i < maxSelectAttempts; i++ {
+		server = p.provider.SelectServer()
+		if stringutils.IsEmpty(server) {
+			return server
+		}
+		p.detector.Track(server)
+		if !p.detector.Ejected(server) {
+			return server
+		}
+	}
+	return server
+}
+
+// Pick asks the underlying provider for a not ejected instance like SelectServer,
+// it falls back to SelectServer if the underlying provider is not a registry.IBalancedServiceProvider
+func (p *Provider) Pick(key string) (string, loadbalance.DoneFunc) {
+	balanced, ok := p.provider.(registry.IBalancedServiceProvider)
+	if !ok {
+		return p.SelectServer(), func(time.Duration, error) {}
+	}
+	var (
+		server string
+		done   loadbalance.DoneFunc
+	)
+	for i := 0; i < maxSelectAttempts; i++ {
+		server, done = balanced.Pick(key)
+		if stringutils.IsEmpty(server) {
+			return server, done
+		}
+		p.detector.Track(server)
+		if !p.detector.Ejected(server) || i == maxSelectAttempts-1 {
+			break
+		}
+		done(0, nil)
+	}
+	return server, done
+}
+
+// Instances returns not ejected instances of the underlying provider, all of them if every instance is ejected
+func (p *Provider) Instances() []loadbalance.Instance {
+	ip, ok := p.provider.(registry.IInstanceProvider)
+	if !ok {
+		return nil
+	}
+	instances := ip.Instances()
+	ret := make([]loadbalance.Instance, 0, len(instances))
+	for _, item := range instances {
+		p.detector.Track(item.BaseUrl)
+		if !p.detector.Ejected(item.BaseUrl) {
+			ret = append(ret, item)
+		}
+	}
+	if len(ret) == 0 {
+		return instances
+	}
+	return ret
+}
+
+// Wrap returns a service provider skipping ejected instances
+func (d *Detector) Wrap(provider registry.IServiceProvider) registry.IServiceProvider {
+	if _, ok := provider.(*Provider); ok {
+		return provider
+	}
+	return &Provider{
+		provider: provider,
+		detector: d,
+	}
+}
+
+type transport struct {
+	next     http.RoundTripper
+	detector *Detector
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	server := req.URL.Scheme + "://" + req.URL.Host
+	if err != nil {
+		if req.Context().Err() == nil {
+			t.detector.Report(server, false, time.Since(start))
+		}
+		return resp, err
+	}
+	t.detector.Report(server, resp.StatusCode < http.StatusInternalServerError, time.Since(start))
+	return resp, err
+}
+
+// Transport reports result of every request sent through next to the detector
+func (d *Detector) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &transport{
+		next:     next,
+		detector: d,
+	}
+}
@@ -0,0 +1,166 @@
+package outlier
+
+import (
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type mockProvider struct {
+	servers []string
+	current uint64
+}
+
+func (m *mockProvider) SelectServer() string {
+	next := atomic.AddUint64(&m.current, 1)
+	return m.servers[int(next)%len(m.servers)]
+}
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func newTestDetector(c *clock, opts ...DetectorOption) *Detector {
+	d := NewDetector(opts...)
+	d.now = c.Now
+	return d
+}
+
+func TestDetector_consecutiveErrors(t *testing.T) {
+	c := &clock{now: time.Now()}
+	d := newTestDetector(c, WithConsecutiveErrors(3), WithErrorRate(0, 0, 0), WithEjectionTime(10*time.Second, 15*time.Second))
+	server := "http://10.0.0.1:6060/api"
+	d.Report(server, false, time.Millisecond)
+	d.Report(server, false, time.Millisecond)
+	d.Report(server, true, time.Millisecond)
+	d.Report(server, false, time.Millisecond)
+	d.Report(server, false, time.Millisecond)
+	require.False(t, d.Ejected(server))
+	d.Report(server, false, time.Millisecond)
+	require.True(t, d.Ejected(server))
+	require.True(t, d.Ejected("http://10.0.0.1:6060"))
+
+	c.now = c.now.Add(11 * time.Second)
+	require.False(t, d.Ejected(server))
+
+	for i := 0; i < 3; i++ {
+		d.Report(server, false, time.Millisecond)
+	}
+	stats := d.Snapshot()
+	require.Len(t, stats, 1)
+	require.Equal(t, "http://10.0.0.1:6060", stats[0].Instance)
+	require.True(t, stats[0].Ejected)
+	require.Equal(t, 2, stats[0].Ejections)
+	require.Equal(t, c.now.Add(15*time.Second), *stats[0].EjectedUntil)
+}
+
+func TestDetector_errorRate(t *testing.T) {
+	c := &clock{now: time.Now()}
+	d := newTestDetector(c, WithConsecutiveErrors(0), WithErrorRate(0.5, 4, time.Minute))
+	server := "http://10.0.0.1:6060"
+	d.Report(server, false, time.Millisecond)
+	d.Report(server, true, time.Millisecond)
+	d.Report(server, false, time.Millisecond)
+	require.False(t, d.Ejected(server))
+	d.Report(server, true, time.Millisecond)
+	d.Report(server, false, time.Millisecond)
+	require.True(t, d.Ejected(server))
+}
+
+func TestDetector_slowThreshold(t *testing.T) {
+	c := &clock{now: time.Now()}
+	d := newTestDetector(c, WithConsecutiveErrors(2), WithSlowThreshold(100*time.Millisecond))
+	server := "http://10.0.0.1:6060"
+	d.Report(server, true, time.Second)
+	d.Report(server, true, time.Second)
+	require.True(t, d.Ejected(server))
+}
+
+func TestDetector_Wrap(t *testing.T) {
+	c := &clock{now: time.Now()}
+	d := newTestDetector(c, WithConsecutiveErrors(1))
+	provider := d.Wrap(&mockProvider{servers: []string{"http://10.0.0.1:6060", "http://10.0.0.2:6060"}})
+	d.Report("http://10.0.0.1:6060", false, time.Millisecond)
+	for i := 0; i < 4; i++ {
+		require.Equal(t, "http://10.0.0.2:6060", provider.SelectServer())
+	}
+	require.Equal(t, provider, d.Wrap(provider))
+
+	d.Report("http://10.0.0.2:6060", false, time.Millisecond)
+	require.NotEmpty(t, provider.SelectServer())
+}
+
+func TestDetector_CheckHealth(t *testing.T) {
+	var healthy int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/health", r.URL.Path)
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+	c := &clock{now: time.Now()}
+	d := newTestDetector(c, WithConsecutiveErrors(2), WithHealthCheck("/health", 0, time.Second))
+	defer d.Close()
+	d.Track(ts.URL + "/api")
+	d.CheckHealth()
+	d.CheckHealth()
+	require.True(t, d.Ejected(ts.URL))
+	require.NotEmpty(t, d.Snapshot()[0].HealthCheckError)
+
+	atomic.StoreInt32(&healthy, 1)
+	d.CheckHealth()
+	require.False(t, d.Ejected(ts.URL))
+	require.Empty(t, d.Snapshot()[0].HealthCheckError)
+}
+
+func TestDetector_Transport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+	d := NewDetector(WithConsecutiveErrors(2))
+	client := &http.Client{Transport: d.Transport(nil)}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(ts.URL + "/hello")
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	require.True(t, d.Ejected(ts.URL))
+	stats := d.Snapshot()
+	require.Equal(t, uint64(2), stats[0].Requests)
+	require.Equal(t, uint64(2), stats[0].Failures)
+}
+
+func TestDetector_idleTimeout(t *testing.T) {
+	c := &clock{now: time.Now()}
+	d := newTestDetector(c, WithConsecutiveErrors(1), WithEjectionTime(time.Hour, time.Hour), WithIdleTimeout(time.Minute))
+	d.Track("http://10.0.0.1:6060")
+	d.Report("http://10.0.0.2:6060", false, time.Millisecond)
+	require.True(t, d.Ejected("http://10.0.0.2:6060"))
+
+	c.now = c.now.Add(30 * time.Second)
+	d.Track("http://10.0.0.3:6060")
+	require.Len(t, d.Snapshot(), 3)
+
+	// 10.0.0.1 is forgotten, while ejected 10.0.0.2 is kept until ejection ends
+	c.now = c.now.Add(40 * time.Second)
+	d.Track("http://10.0.0.3:6060")
+	stats := d.Snapshot()
+	require.Len(t, stats, 2)
+	require.Equal(t, "http://10.0.0.2:6060", stats[0].Instance)
+	require.Equal(t, "http://10.0.0.3:6060", stats[1].Instance)
+
+	c.now = c.now.Add(time.Hour)
+	d.Track("http://10.0.0.3:6060")
+	stats = d.Snapshot()
+	require.Len(t, stats, 1)
+	require.Equal(t, "http://10.0.0.3:6060", stats[0].Instance)
+}
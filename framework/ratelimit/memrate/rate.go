@@ -74,6 +74,14 @@ func (lim *Limiter) Limit() Limit {
 	return lim.limit
 }
 
+// TokensAt returns the number of tokens available at time t.
+func (lim *Limiter) TokensAt(t time.Time) float64 {
+	lim.mu.Lock()
+	defer lim.mu.Unlock()
+	_, _, tokens := lim.advance(t)
+	return tokens
+}
+
 // Burst returns the maximum burst size. Burst is the maximum number of tokens
 // that can be consumed in a single call to Allow, Reserve, or Wait, so higher
 // Burst values allow more events to happen at once.
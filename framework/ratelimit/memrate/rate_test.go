@@ -102,6 +102,20 @@ func TestLimiterBurst1(t *testing.T) {
 	})
 }
 
+func TestLimiterTokensAt(t *testing.T) {
+	lim := NewLimiter(10, 3)
+	if tokens := lim.TokensAt(t0); tokens != 3 {
+		t.Errorf("TokensAt(t0) = %v, want 3", tokens)
+	}
+	lim.AllowN(t0, 3)
+	if tokens := lim.TokensAt(t0); tokens != 0 {
+		t.Errorf("TokensAt(t0) = %v, want 0", tokens)
+	}
+	if tokens := lim.TokensAt(t2); tokens != 2 {
+		t.Errorf("TokensAt(t2) = %v, want 2", tokens)
+	}
+}
+
 func TestLimiterBurst3(t *testing.T) {
 	run(t, NewLimiter(10, 3), []allow{
 		{t0, 2, true},
@@ -0,0 +1,248 @@
+package registry
+
+import (
+	"time"
+
+	"github.com/youminxue/odin/framework/internal/config"
+	"github.com/youminxue/odin/framework/registry/constants"
+	"github.com/youminxue/odin/framework/registry/dns"
+	"github.com/youminxue/odin/framework/registry/etcd"
+	"github.com/youminxue/odin/framework/registry/memberlist"
+	"github.com/youminxue/odin/framework/registry/nacos"
+	"github.com/youminxue/odin/framework/registry/static"
+	"github.com/youminxue/odin/toolkit/loadbalance"
+	logger "github.com/youminxue/odin/toolkit/zlogger"
+)
+
+// nacosPollInterval is the interval of listing instances from nacos, the naming client answers from its local
+// cache which is kept in sync by nacos server pushing
+const nacosPollInterval = 5 * time.Second
+
+// resyncInterval is the interval of listing instances from backends pushing changes, in case any is missed
+const resyncInterval = 30 * time.Second
+
+var _ INativeProvider = nacosRegistry{}
+var _ INativeProvider = etcdRegistry{}
+var _ INativeProvider = memberlistRegistry{}
+
+func init() {
+	RegisterBackend(constants.SD_NACOS, func() Registry { return nacosRegistry{} })
+	RegisterBackend(constants.SD_ETCD, func() Registry { return etcdRegistry{} })
+	RegisterBackend(constants.SD_MEMBERLIST, func() Registry { return memberlistRegistry{} })
+	RegisterBackend(constants.SD_STATIC, func() Registry { return staticRegistry{} })
+	RegisterBackend(constants.SD_DNS, func() Registry { return dnsRegistry{} })
+}
+
+type nacosRegistry struct{}
+
+func (nacosRegistry) Name() string {
+	return constants.SD_NACOS
+}
+
+func (nacosRegistry) Register(t constants.ServiceType, data ...map[string]interface{}) error {
+	if t == constants.GRPC_TYPE {
+		nacos.NewGrpc(data...)
+	} else {
+		nacos.NewRest(data...)
+	}
+	return nil
+}
+
+func (nacosRegistry) Deregister(t constants.ServiceType) error {
+	if t == constants.GRPC_TYPE {
+		nacos.ShutdownGrpc()
+	} else {
+		nacos.ShutdownRest()
+	}
+	return nil
+}
+
+func (nacosRegistry) MarkUnhealthy(t constants.ServiceType) error {
+	if t == constants.GRPC_TYPE {
+		nacos.MarkUnhealthyGrpc()
+	} else {
+		nacos.MarkUnhealthyRest()
+	}
+	return nil
+}
+
+func (nacosRegistry) List(service string) ([]loadbalance.Instance, error) {
+	cluster := config.GddNacosClusterName.LoadOrDefault(config.DefaultGddNacosClusterName)
+	group := config.GddNacosGroupName.LoadOrDefault(config.DefaultGddNacosGroupName)
+	return nacos.ListInstances(service, []string{cluster}, group)
+}
+
+func (nacosRegistry) NewServiceProvider(service string) IServiceProvider {
+	cluster := config.GddNacosClusterName.LoadOrDefault(config.DefaultGddNacosClusterName)
+	group := config.GddNacosGroupName.LoadOrDefault(config.DefaultGddNacosGroupName)
+	return nacos.NewWRRServiceProvider(service, nacos.WithNacosClusters([]string{cluster}), nacos.WithNacosGroupName(group))
+}
+
+func (r nacosRegistry) Watch(service string) (<-chan Event, func(), error) {
+	return WatchInstances(service, nacosPollInterval, func() ([]loadbalance.Instance, error) {
+		return r.List(service)
+	}, nil)
+}
+
+type etcdRegistry struct{}
+
+func (etcdRegistry) Name() string {
+	return constants.SD_ETCD
+}
+
+func (etcdRegistry) Register(t constants.ServiceType, data ...map[string]interface{}) error {
+	if t == constants.GRPC_TYPE {
+		etcd.NewGrpc(data...)
+	} else {
+		etcd.NewRest(data...)
+	}
+	return nil
+}
+
+func (etcdRegistry) Deregister(t constants.ServiceType) error {
+	if t == constants.GRPC_TYPE {
+		etcd.ShutdownGrpc()
+	} else {
+		etcd.ShutdownRest()
+	}
+	return nil
+}
+
+func (etcdRegistry) MarkUnhealthy(t constants.ServiceType) error {
+	if t == constants.GRPC_TYPE {
+		etcd.MarkUnhealthyGrpc()
+	} else {
+		etcd.MarkUnhealthyRest()
+	}
+	return nil
+}
+
+func (etcdRegistry) List(service string) ([]loadbalance.Instance, error) {
+	return etcd.ListInstances(service)
+}
+
+func (etcdRegistry) NewServiceProvider(service string) IServiceProvider {
+	return etcd.NewSWRRServiceProvider(service)
+}
+
+func (etcdRegistry) Watch(service string) (<-chan Event, func(), error) {
+	return WatchInstances(service, resyncInterval, func() ([]loadbalance.Instance, error) {
+		return etcd.ListInstances(service)
+	}, func(kick func()) func() {
+		stop, err := etcd.WatchService(service, kick)
+		if err != nil {
+			logger.Error().Err(err).Msgf("[odin] failed to watch %s in etcd, fall back to polling", service)
+			return func() {}
+		}
+		return stop
+	})
+}
+
+type memberlistRegistry struct{}
+
+func (memberlistRegistry) Name() string {
+	return constants.SD_MEMBERLIST
+}
+
+func (memberlistRegistry) Register(t constants.ServiceType, data ...map[string]interface{}) error {
+	if t == constants.GRPC_TYPE {
+		memberlist.NewGrpc(data...)
+	} else {
+		memberlist.NewRest(data...)
+	}
+	return nil
+}
+
+// Deregister leaves the cluster, as services of local node are gossiped as metadata of the node
+func (memberlistRegistry) Deregister(constants.ServiceType) error {
+	memberlist.Shutdown()
+	return nil
+}
+
+func (memberlistRegistry) MarkUnhealthy(t constants.ServiceType) error {
+	if t == constants.GRPC_TYPE {
+		memberlist.MarkUnhealthyGrpc()
+	} else {
+		memberlist.MarkUnhealthyRest()
+	}
+	return nil
+}
+
+func (memberlistRegistry) List(service string) ([]loadbalance.Instance, error) {
+	return memberlist.ListInstances(service), nil
+}
+
+// NewServiceProvider returns the memberlist provider, which weights nodes by round-trip times if
+// GDD_MEM_COORDINATES is enabled
+func (memberlistRegistry) NewServiceProvider(service string) IServiceProvider {
+	return memberlist.NewSWRRServiceProvider(service)
+}
+
+func (memberlistRegistry) Watch(service string) (<-chan Event, func(), error) {
+	return WatchInstances(service, resyncInterval, func() ([]loadbalance.Instance, error) {
+		return memberlist.ListInstances(service), nil
+	}, memberlist.WatchNodes)
+}
+
+type staticRegistry struct{}
+
+func (staticRegistry) Name() string {
+	return constants.SD_STATIC
+}
+
+func (staticRegistry) Register(t constants.ServiceType, data ...map[string]interface{}) error {
+	if t == constants.GRPC_TYPE {
+		return static.NewGrpc(data...)
+	}
+	return static.NewRest(data...)
+}
+
+func (staticRegistry) Deregister(constants.ServiceType) error {
+	return nil
+}
+
+func (staticRegistry) List(service string) ([]loadbalance.Instance, error) {
+	return static.ListInstances(service)
+}
+
+func (staticRegistry) Watch(service string) (<-chan Event, func(), error) {
+	return WatchInstances(service, resyncInterval, func() ([]loadbalance.Instance, error) {
+		return static.ListInstances(service)
+	}, func(kick func()) func() {
+		stop, err := static.Watch(kick)
+		if err != nil {
+			logger.Error().Err(err).Msgf("[odin] failed to watch %s in static file, fall back to polling", service)
+			return func() {}
+		}
+		return stop
+	})
+}
+
+type dnsRegistry struct{}
+
+func (dnsRegistry) Name() string {
+	return constants.SD_DNS
+}
+
+func (dnsRegistry) Register(t constants.ServiceType, data ...map[string]interface{}) error {
+	if t == constants.GRPC_TYPE {
+		dns.NewGrpc(data...)
+	} else {
+		dns.NewRest(data...)
+	}
+	return nil
+}
+
+func (dnsRegistry) Deregister(constants.ServiceType) error {
+	return nil
+}
+
+func (dnsRegistry) List(service string) ([]loadbalance.Instance, error) {
+	return dns.ListInstances(service)
+}
+
+func (dnsRegistry) Watch(service string) (<-chan Event, func(), error) {
+	return WatchInstances(service, dns.RefreshInterval(), func() ([]loadbalance.Instance, error) {
+		return dns.ListInstances(service)
+	}, nil)
+}
@@ -0,0 +1,75 @@
+package registry
+
+import (
+	"github.com/youminxue/odin/framework/internal/config"
+	"github.com/youminxue/odin/toolkit/loadbalance"
+	logger "github.com/youminxue/odin/toolkit/zlogger"
+	"time"
+)
+
+// IInstanceProvider is implemented by service providers exposing all instances of a service,
+// such as the nacos, etcd, memberlist, static and dns service providers
+type IInstanceProvider interface {
+	Instances() []loadbalance.Instance
+}
+
+// IBalancedServiceProvider picks servers for requests and takes feedback of them.
+// Clients and gateway prefer Pick to SelectServer if a provider implements it.
+type IBalancedServiceProvider interface {
+	IServiceProvider
+	// Pick selects a server for a request with affinity key, done must be called once the request completes
+	Pick(key string) (server string, done loadbalance.DoneFunc)
+}
+
+var _ IBalancedServiceProvider = (*BalancedProvider)(nil)
+
+// BalancedProvider selects instances of the underlying provider by a loadbalance.Balancer
+type BalancedProvider struct {
+	provider IInstanceProvider
+	balancer loadbalance.Balancer
+}
+
+// NewBalancedProvider creates a BalancedProvider, balancer is round robin if nil.
+// Balancers such as least request and p2c keep state, so share one BalancedProvider for a service.
+func NewBalancedProvider(provider IInstanceProvider, balancer loadbalance.Balancer) *BalancedProvider {
+	if balancer == nil {
+		balancer = loadbalance.NewRoundRobin()
+	}
+	return &BalancedProvider{
+		provider: provider,
+		balancer: balancer,
+	}
+}
+
+// Provider returns the underlying provider
+func (p *BalancedProvider) Provider() IInstanceProvider {
+	return p.provider
+}
+
+// Instances returns all instances of the underlying provider
+func (p *BalancedProvider) Instances() []loadbalance.Instance {
+	return p.provider.Instances()
+}
+
+// Pick selects a server for a request with affinity key, empty string if no instance is available
+func (p *BalancedProvider) Pick(key string) (string, loadbalance.DoneFunc) {
+	instance, done, err := p.balancer.Pick(p.provider.Instances(), key)
+	if err != nil {
+		logger.Error().Err(err).Msg("[odin] server not found")
+		return "", func(time.Duration, error) {}
+	}
+	return instance.BaseUrl, done
+}
+
+// SelectServer selects a server without affinity. The request is not tracked, so prefer Pick for
+// balancers relying on outstanding requests or latencies.
+func (p *BalancedProvider) SelectServer() string {
+	server, done := p.Pick("")
+	done(0, nil)
+	return server
+}
+
+// ZoneAware creates a balancer preferring instances in the zone configured by GDD_ZONE, see loadbalance.NewZoneAware
+func ZoneAware(next loadbalance.Balancer) loadbalance.Balancer {
+	return loadbalance.NewZoneAware(config.GddZone.Load(), next)
+}
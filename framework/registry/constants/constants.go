@@ -4,6 +4,8 @@ const (
 	SD_NACOS      = "nacos"
 	SD_ETCD       = "etcd"
 	SD_MEMBERLIST = "memberlist"
+	SD_STATIC     = "static"
+	SD_DNS        = "dns"
 )
 
 type ServiceType string
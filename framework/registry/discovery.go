@@ -0,0 +1,411 @@
+package registry
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"github.com/youminxue/odin/framework/internal/config"
+	"github.com/youminxue/odin/framework/registry/constants"
+	"github.com/youminxue/odin/toolkit/loadbalance"
+	"github.com/youminxue/odin/toolkit/stringutils"
+	logger "github.com/youminxue/odin/toolkit/zlogger"
+)
+
+// Registry is a service discovery backend, such as nacos, etcd or memberlist. Backends are plugged in by
+// RegisterBackend and enabled by GDD_SERVICE_DISCOVERY_MODE.
+type Registry interface {
+	// Name returns the mode of the backend in GDD_SERVICE_DISCOVERY_MODE
+	Name() string
+	// Register registers the rest or grpc service of local node, data is added to metadata of the instance
+	Register(t constants.ServiceType, data ...map[string]interface{}) error
+	// Deregister deregisters the rest or grpc service of local node
+	Deregister(t constants.ServiceType) error
+	// List returns instances of service sorted by base url
+	List(service string) ([]loadbalance.Instance, error)
+	// Watch sends instances of service to the returned channel whenever they change, the first event holding
+	// current instances is ready on return. Call the returned function to stop watching.
+	Watch(service string) (<-chan Event, func(), error)
+}
+
+// IUnhealthyMarker is implemented by backends able to mark services of local node unhealthy ahead of deregistering,
+// so that clients stop sending requests to them while in-flight ones are draining
+type IUnhealthyMarker interface {
+	MarkUnhealthy(t constants.ServiceType) error
+}
+
+// INativeProvider is implemented by backends having service providers of their own, such as the memberlist
+// provider weighting instances by round-trip times and the nacos weighted round-robin provider
+type INativeProvider interface {
+	NewServiceProvider(service string) IServiceProvider
+}
+
+// Event is a change of instances of a service
+type Event struct {
+	Service string
+	// Instances are all instances of the service after the change sorted by base url
+	Instances []loadbalance.Instance
+	// Added and Removed are instances added and removed by the change compared by base url,
+	// instances whose weight or metadata change are in neither
+	Added   []loadbalance.Instance
+	Removed []loadbalance.Instance
+}
+
+func newEvent(service string, old, instances []loadbalance.Instance) Event {
+	e := Event{
+		Service:   service,
+		Instances: instances,
+	}
+	oldUrls := make(map[string]struct{}, len(old))
+	for _, item := range old {
+		oldUrls[item.BaseUrl] = struct{}{}
+	}
+	urls := make(map[string]struct{}, len(instances))
+	for _, item := range instances {
+		urls[item.BaseUrl] = struct{}{}
+		if _, ok := oldUrls[item.BaseUrl]; !ok {
+			e.Added = append(e.Added, item)
+		}
+	}
+	for _, item := range old {
+		if _, ok := urls[item.BaseUrl]; !ok {
+			e.Removed = append(e.Removed, item)
+		}
+	}
+	return e
+}
+
+func equalInstances(a, b []loadbalance.Instance) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].BaseUrl != b[i].BaseUrl || a[i].Weight != b[i].Weight || len(a[i].Metadata) != len(b[i].Metadata) {
+			return false
+		}
+		for k, v := range a[i].Metadata {
+			if b[i].Metadata[k] != v {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// WatchInstances implements Registry.Watch for backends by listing instances every interval, and at once when
+// subscribe calls kick if subscribe is not nil. kick never blocks, so backends may call it from their event loops.
+func WatchInstances(service string, interval time.Duration, list func() ([]loadbalance.Instance, error),
+	subscribe func(kick func()) func()) (<-chan Event, func(), error) {
+	instances, err := list()
+	if err != nil {
+		return nil, nil, err
+	}
+	ch := make(chan Event, 1)
+	ch <- newEvent(service, nil, instances)
+	kickCh := make(chan struct{}, 1)
+	unsubscribe := func() {}
+	if subscribe != nil {
+		unsubscribe = subscribe(func() {
+			select {
+			case kickCh <- struct{}{}:
+			default:
+			}
+		})
+	}
+	stopCh := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+			case <-kickCh:
+			}
+			latest, err := list()
+			if err != nil {
+				logger.Error().Err(err).Msgf("[odin] failed to list instances of %s", service)
+				continue
+			}
+			if equalInstances(instances, latest) {
+				continue
+			}
+			e := newEvent(service, instances, latest)
+			instances = latest
+			select {
+			case ch <- e:
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			unsubscribe()
+			close(stopCh)
+		})
+	}, nil
+}
+
+// mergeInstances returns instances of all groups sorted by base url, the first one wins for duplicated base urls
+func mergeInstances(groups [][]loadbalance.Instance) []loadbalance.Instance {
+	var ret []loadbalance.Instance
+	seen := make(map[string]struct{})
+	for _, group := range groups {
+		for _, item := range group {
+			if _, ok := seen[item.BaseUrl]; ok {
+				continue
+			}
+			seen[item.BaseUrl] = struct{}{}
+			ret = append(ret, item)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].BaseUrl < ret[j].BaseUrl
+	})
+	return ret
+}
+
+var backendsLock sync.RWMutex
+var backends = make(map[string]func() Registry)
+
+// RegisterBackend plugs in a service discovery backend for mode, newRegistry is called by DefaultDiscovery
+// if mode is in GDD_SERVICE_DISCOVERY_MODE
+func RegisterBackend(mode string, newRegistry func() Registry) {
+	backendsLock.Lock()
+	defer backendsLock.Unlock()
+	backends[mode] = newRegistry
+}
+
+// Discovery registers local services to and discovers services from several backends as a whole
+type Discovery struct {
+	registries []Registry
+}
+
+// NewDiscovery creates a Discovery over registries
+func NewDiscovery(registries ...Registry) *Discovery {
+	return &Discovery{
+		registries: registries,
+	}
+}
+
+var discoveryLock sync.Mutex
+var defaultModes string
+var defaultDiscovery *Discovery
+
+// DefaultDiscovery returns the Discovery over backends of modes in GDD_SERVICE_DISCOVERY_MODE in order,
+// it is built again once the env changes
+func DefaultDiscovery() *Discovery {
+	modes := config.GddServiceDiscoveryMode.LoadOrDefault(config.DefaultGddServiceDiscoveryMode)
+	discoveryLock.Lock()
+	defer discoveryLock.Unlock()
+	if defaultDiscovery != nil && modes == defaultModes {
+		return defaultDiscovery
+	}
+	var registries []Registry
+	seen := make(map[string]struct{})
+	for _, mode := range strings.Split(modes, ",") {
+		mode = strings.TrimSpace(mode)
+		if _, ok := seen[mode]; ok || stringutils.IsEmpty(mode) {
+			continue
+		}
+		seen[mode] = struct{}{}
+		backendsLock.RLock()
+		newRegistry, ok := backends[mode]
+		backendsLock.RUnlock()
+		if !ok {
+			logger.Warn().Msgf("[odin] unknown service discovery mode: %s", mode)
+			continue
+		}
+		registries = append(registries, newRegistry())
+	}
+	defaultModes = modes
+	defaultDiscovery = NewDiscovery(registries...)
+	return defaultDiscovery
+}
+
+// Registries returns backends of the Discovery
+func (d *Discovery) Registries() []Registry {
+	return d.registries
+}
+
+// Register registers the rest or grpc service of local node to all backends
+func (d *Discovery) Register(t constants.ServiceType, data ...map[string]interface{}) error {
+	var result error
+	for _, r := range d.registries {
+		if err := r.Register(t, data...); err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "[odin] failed to register %s service to %s", t, r.Name()))
+		}
+	}
+	return result
+}
+
+// Deregister deregisters the rest or grpc service of local node from all backends
+func (d *Discovery) Deregister(t constants.ServiceType) error {
+	var result error
+	for _, r := range d.registries {
+		if err := r.Deregister(t); err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "[odin] failed to deregister %s service from %s", t, r.Name()))
+		}
+	}
+	return result
+}
+
+// MarkUnhealthy marks the rest or grpc service of local node unhealthy in backends implementing IUnhealthyMarker
+func (d *Discovery) MarkUnhealthy(t constants.ServiceType) error {
+	var result error
+	for _, r := range d.registries {
+		marker, ok := r.(IUnhealthyMarker)
+		if !ok {
+			continue
+		}
+		if err := marker.MarkUnhealthy(t); err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "[odin] failed to mark %s service unhealthy in %s", t, r.Name()))
+		}
+	}
+	return result
+}
+
+// List returns instances of service from all backends sorted by base url. Backends failing to list are skipped,
+// error is returned only if all of them fail.
+func (d *Discovery) List(service string) ([]loadbalance.Instance, error) {
+	var groups [][]loadbalance.Instance
+	var result error
+	for _, r := range d.registries {
+		instances, err := r.List(service)
+		if err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "[odin] failed to list %s from %s", service, r.Name()))
+			continue
+		}
+		groups = append(groups, instances)
+	}
+	if len(groups) == 0 && result != nil {
+		return nil, result
+	}
+	if result != nil {
+		logger.Warn().Err(result).Msg("")
+	}
+	return mergeInstances(groups), nil
+}
+
+// HasService reports whether any backend has instances of service
+func (d *Discovery) HasService(service string) bool {
+	instances, err := d.List(service)
+	return err == nil && len(instances) > 0
+}
+
+// Watch sends instances of service from all backends to the returned channel whenever they change, the first
+// event holding current instances is ready on return. Backends failing to watch are skipped, error is returned
+// only if all of them fail. Call the returned function to stop watching.
+func (d *Discovery) Watch(service string) (<-chan Event, func(), error) {
+	type indexedEvent struct {
+		index int
+		event Event
+	}
+	var chs []<-chan Event
+	var stops []func()
+	var result error
+	for _, r := range d.registries {
+		ch, stop, err := r.Watch(service)
+		if err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "[odin] failed to watch %s in %s", service, r.Name()))
+			continue
+		}
+		chs = append(chs, ch)
+		stops = append(stops, stop)
+	}
+	if len(chs) == 0 && result != nil {
+		return nil, nil, result
+	}
+	if result != nil {
+		logger.Warn().Err(result).Msg("")
+	}
+	groups := make([][]loadbalance.Instance, len(chs))
+	for i, ch := range chs {
+		groups[i] = (<-ch).Instances
+	}
+	instances := mergeInstances(groups)
+	out := make(chan Event, 1)
+	out <- newEvent(service, nil, instances)
+	stopCh := make(chan struct{})
+	in := make(chan indexedEvent)
+	for i, ch := range chs {
+		go func(i int, ch <-chan Event) {
+			for {
+				select {
+				case e := <-ch:
+					select {
+					case in <- indexedEvent{index: i, event: e}:
+					case <-stopCh:
+						return
+					}
+				case <-stopCh:
+					return
+				}
+			}
+		}(i, ch)
+	}
+	go func() {
+		for {
+			select {
+			case ie := <-in:
+				groups[ie.index] = ie.event.Instances
+				latest := mergeInstances(groups)
+				if equalInstances(instances, latest) {
+					continue
+				}
+				e := newEvent(service, instances, latest)
+				instances = latest
+				select {
+				case out <- e:
+				case <-stopCh:
+					return
+				}
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return out, func() {
+		once.Do(func() {
+			close(stopCh)
+			for _, stop := range stops {
+				stop()
+			}
+		})
+	}, nil
+}
+
+// NewServiceProvider creates a provider of service. If only one backend has instances of the service and it
+// implements INativeProvider, its own provider is returned, otherwise a smooth weighted round-robin provider over
+// all backends is returned. Call Close of the provider if it has one once it is not used any more.
+func (d *Discovery) NewServiceProvider(service string) (IServiceProvider, error) {
+	var found []Registry
+	for _, r := range d.registries {
+		if instances, err := r.List(service); err == nil && len(instances) > 0 {
+			found = append(found, r)
+		}
+	}
+	if len(found) == 1 {
+		if np, ok := found[0].(INativeProvider); ok {
+			return np.NewServiceProvider(service), nil
+		}
+	}
+	return d.NewSWRRServiceProvider(service)
+}
+
+// NewSWRRServiceProvider creates a smooth weighted round-robin provider of service over all backends, call Close
+// of the provider once it is not used any more
+func (d *Discovery) NewSWRRServiceProvider(service string) (*SWRRServiceProvider, error) {
+	ch, stop, err := d.Watch(service)
+	if err != nil {
+		return nil, err
+	}
+	return newSWRRServiceProvider(service, ch, stop), nil
+}
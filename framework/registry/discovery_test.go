@@ -0,0 +1,324 @@
+package registry
+
+import (
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/youminxue/odin/framework/internal/config"
+	"github.com/youminxue/odin/framework/registry/constants"
+	"github.com/youminxue/odin/toolkit/loadbalance"
+	gresolver "google.golang.org/grpc/resolver"
+)
+
+// fakeRegistry is an in-memory Registry pushing changes to watchers at once
+type fakeRegistry struct {
+	name       string
+	err        error
+	lock       sync.Mutex
+	services   map[string][]loadbalance.Instance
+	kicks      map[int]func()
+	nextKick   int
+	registered map[constants.ServiceType]bool
+	unhealthy  map[constants.ServiceType]bool
+}
+
+func newFakeRegistry(name string) *fakeRegistry {
+	return &fakeRegistry{
+		name:       name,
+		services:   make(map[string][]loadbalance.Instance),
+		kicks:      make(map[int]func()),
+		registered: make(map[constants.ServiceType]bool),
+		unhealthy:  make(map[constants.ServiceType]bool),
+	}
+}
+
+func (f *fakeRegistry) set(service string, instances ...loadbalance.Instance) {
+	f.lock.Lock()
+	f.services[service] = instances
+	kicks := make([]func(), 0, len(f.kicks))
+	for _, kick := range f.kicks {
+		kicks = append(kicks, kick)
+	}
+	f.lock.Unlock()
+	for _, kick := range kicks {
+		kick()
+	}
+}
+
+func (f *fakeRegistry) Name() string {
+	return f.name
+}
+
+func (f *fakeRegistry) Register(t constants.ServiceType, data ...map[string]interface{}) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.registered[t] = true
+	return f.err
+}
+
+func (f *fakeRegistry) Deregister(t constants.ServiceType) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	delete(f.registered, t)
+	return f.err
+}
+
+func (f *fakeRegistry) List(service string) ([]loadbalance.Instance, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.services[service], nil
+}
+
+func (f *fakeRegistry) Watch(service string) (<-chan Event, func(), error) {
+	return WatchInstances(service, time.Hour, func() ([]loadbalance.Instance, error) {
+		return f.List(service)
+	}, func(kick func()) func() {
+		f.lock.Lock()
+		defer f.lock.Unlock()
+		id := f.nextKick
+		f.nextKick++
+		f.kicks[id] = kick
+		return func() {
+			f.lock.Lock()
+			defer f.lock.Unlock()
+			delete(f.kicks, id)
+		}
+	})
+}
+
+// fakeMarker is a fakeRegistry able to mark services unhealthy
+type fakeMarker struct {
+	*fakeRegistry
+}
+
+func (f fakeMarker) MarkUnhealthy(t constants.ServiceType) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.unhealthy[t] = true
+	return f.err
+}
+
+func instance(baseUrl string, weight int) loadbalance.Instance {
+	return loadbalance.Instance{BaseUrl: baseUrl, Weight: weight}
+}
+
+func TestNewEvent(t *testing.T) {
+	a, b, c := instance("http://a", 1), instance("http://b", 1), instance("http://c", 1)
+	e := newEvent("usersvc_rest", []loadbalance.Instance{a, b}, []loadbalance.Instance{b, c})
+	require.Equal(t, []loadbalance.Instance{b, c}, e.Instances)
+	require.Equal(t, []loadbalance.Instance{c}, e.Added)
+	require.Equal(t, []loadbalance.Instance{a}, e.Removed)
+}
+
+func TestDiscovery_List(t *testing.T) {
+	r1, r2 := newFakeRegistry("r1"), newFakeRegistry("r2")
+	r1.set("usersvc_rest", instance("http://b", 1), loadbalance.Instance{BaseUrl: "http://a", Weight: 2,
+		Metadata: map[string]string{"zone": "hz"}})
+	r2.set("usersvc_rest", instance("http://a", 1), instance("http://c", 1))
+	d := NewDiscovery(r1, r2)
+	instances, err := d.List("usersvc_rest")
+	require.NoError(t, err)
+	require.Equal(t, []loadbalance.Instance{
+		{BaseUrl: "http://a", Weight: 2, Metadata: map[string]string{"zone": "hz"}},
+		instance("http://b", 1),
+		instance("http://c", 1),
+	}, instances)
+	require.True(t, d.HasService("usersvc_rest"))
+	require.False(t, d.HasService("ordersvc_rest"))
+
+	// failing backends are skipped
+	r2.err = errors.New("mock error")
+	instances, err = d.List("usersvc_rest")
+	require.NoError(t, err)
+	require.Len(t, instances, 2)
+
+	r1.err = errors.New("mock error")
+	_, err = d.List("usersvc_rest")
+	require.Error(t, err)
+	require.False(t, d.HasService("usersvc_rest"))
+}
+
+func TestDiscovery_Register(t *testing.T) {
+	r1, r2 := newFakeRegistry("r1"), newFakeRegistry("r2")
+	d := NewDiscovery(r1, fakeMarker{r2})
+	require.NoError(t, d.Register(constants.REST_TYPE))
+	require.True(t, r1.registered[constants.REST_TYPE])
+	require.True(t, r2.registered[constants.REST_TYPE])
+
+	require.NoError(t, d.MarkUnhealthy(constants.REST_TYPE))
+	require.False(t, r1.unhealthy[constants.REST_TYPE])
+	require.True(t, r2.unhealthy[constants.REST_TYPE])
+
+	require.NoError(t, d.Deregister(constants.REST_TYPE))
+	require.False(t, r1.registered[constants.REST_TYPE])
+	require.False(t, r2.registered[constants.REST_TYPE])
+
+	r1.err = errors.New("mock error")
+	err := d.Register(constants.GRPC_TYPE)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "r1")
+	require.True(t, r2.registered[constants.GRPC_TYPE])
+}
+
+func TestDiscovery_Watch(t *testing.T) {
+	r1, r2 := newFakeRegistry("r1"), newFakeRegistry("r2")
+	r1.set("usersvc_rest", instance("http://a", 1))
+	d := NewDiscovery(r1, r2)
+	events, stop, err := d.Watch("usersvc_rest")
+	require.NoError(t, err)
+	defer stop()
+
+	e := <-events
+	require.Equal(t, []loadbalance.Instance{instance("http://a", 1)}, e.Instances)
+	require.Equal(t, e.Instances, e.Added)
+
+	r2.set("usersvc_rest", instance("http://b", 1))
+	e = <-events
+	require.Equal(t, []loadbalance.Instance{instance("http://a", 1), instance("http://b", 1)}, e.Instances)
+	require.Equal(t, []loadbalance.Instance{instance("http://b", 1)}, e.Added)
+	require.Empty(t, e.Removed)
+
+	r1.set("usersvc_rest")
+	e = <-events
+	require.Equal(t, []loadbalance.Instance{instance("http://b", 1)}, e.Instances)
+	require.Empty(t, e.Added)
+	require.Equal(t, []loadbalance.Instance{instance("http://a", 1)}, e.Removed)
+
+	// weight changes are sent too
+	r2.set("usersvc_rest", instance("http://b", 3))
+	e = <-events
+	require.Equal(t, []loadbalance.Instance{instance("http://b", 3)}, e.Instances)
+
+	r1.err = errors.New("mock error")
+	r2.err = errors.New("mock error")
+	_, _, err = d.Watch("usersvc_rest")
+	require.Error(t, err)
+}
+
+func TestSWRRServiceProvider(t *testing.T) {
+	r := newFakeRegistry("r")
+	r.set("usersvc_rest", instance("http://a", 1), instance("http://b", 3))
+	sp, err := NewDiscovery(r).NewSWRRServiceProvider("usersvc_rest")
+	require.NoError(t, err)
+	defer sp.Close()
+	counts := make(map[string]int)
+	for i := 0; i < 8; i++ {
+		counts[sp.SelectServer()]++
+	}
+	require.Equal(t, map[string]int{"http://a": 2, "http://b": 6}, counts)
+	require.Equal(t, []loadbalance.Instance{instance("http://a", 1), instance("http://b", 3)}, sp.Instances())
+
+	r.set("usersvc_rest", instance("http://c", 0))
+	require.Eventually(t, func() bool {
+		return sp.SelectServer() == "http://c"
+	}, time.Second, 10*time.Millisecond)
+
+	sp.Close()
+	sp.Close()
+	r.set("usersvc_rest")
+	time.Sleep(20 * time.Millisecond)
+	require.Equal(t, "http://c", sp.SelectServer())
+
+	empty, err := NewDiscovery(r).NewSWRRServiceProvider("ordersvc_rest")
+	require.NoError(t, err)
+	defer empty.Close()
+	require.Equal(t, "", empty.SelectServer())
+}
+
+// fakeNative is a fakeRegistry having its own service provider
+type fakeNative struct {
+	*fakeRegistry
+}
+
+type nativeProvider struct {
+	service string
+}
+
+func (n *nativeProvider) SelectServer() string {
+	return "native"
+}
+
+func (f fakeNative) NewServiceProvider(service string) IServiceProvider {
+	return &nativeProvider{service: service}
+}
+
+func TestDiscovery_NewServiceProvider(t *testing.T) {
+	r1, r2 := newFakeRegistry("r1"), newFakeRegistry("r2")
+	r1.set("usersvc_rest", instance("http://a", 1))
+	d := NewDiscovery(fakeNative{r1}, r2)
+	sp, err := d.NewServiceProvider("usersvc_rest")
+	require.NoError(t, err)
+	require.Equal(t, &nativeProvider{service: "usersvc_rest"}, sp)
+
+	// instances in several backends are merged
+	r2.set("usersvc_rest", instance("http://b", 1))
+	sp, err = d.NewServiceProvider("usersvc_rest")
+	require.NoError(t, err)
+	swrr, ok := sp.(*SWRRServiceProvider)
+	require.True(t, ok)
+	defer swrr.Close()
+	require.Len(t, swrr.Instances(), 2)
+}
+
+func TestAddr(t *testing.T) {
+	require.Equal(t, "10.0.0.1:6060", addr("http://10.0.0.1:6060/api"))
+	require.Equal(t, "10.0.0.1:50051", addr("10.0.0.1:50051"))
+	require.Equal(t, "10.0.0.1:50051", addr("grpc://10.0.0.1:50051"))
+}
+
+type fakeClientConn struct {
+	gresolver.ClientConn
+	states chan gresolver.State
+}
+
+func (f *fakeClientConn) UpdateState(state gresolver.State) error {
+	f.states <- state
+	return nil
+}
+
+func TestResolver(t *testing.T) {
+	r := newFakeRegistry("r")
+	r.set("usersvc_grpc", instance("10.0.0.1:50051", 2))
+	cc := &fakeClientConn{states: make(chan gresolver.State, 10)}
+	b := &builder{discovery: NewDiscovery(r)}
+	res, err := b.Build(gresolver.Target{URL: url.URL{Scheme: schemeName, Host: "usersvc_grpc"}}, cc, gresolver.BuildOptions{})
+	require.NoError(t, err)
+	defer res.Close()
+
+	state := <-cc.states
+	require.Len(t, state.Addresses, 1)
+	require.Equal(t, "10.0.0.1:50051", state.Addresses[0].Addr)
+	require.Equal(t, WeightAddrInfo{Weight: 2}, state.Addresses[0].BalancerAttributes.Value(WeightAttributeKey{}))
+
+	r.set("usersvc_grpc", instance("10.0.0.1:50051", 2), instance("grpc://10.0.0.2:50051", 0))
+	state = <-cc.states
+	require.Len(t, state.Addresses, 2)
+	require.Equal(t, "10.0.0.2:50051", state.Addresses[1].Addr)
+	require.Equal(t, WeightAddrInfo{Weight: 1}, state.Addresses[1].BalancerAttributes.Value(WeightAttributeKey{}))
+
+	_, err = b.Build(gresolver.Target{URL: url.URL{Scheme: schemeName}}, cc, gresolver.BuildOptions{})
+	require.Error(t, err)
+}
+
+func TestDefaultDiscovery(t *testing.T) {
+	fake := newFakeRegistry("fake")
+	RegisterBackend("fake", func() Registry {
+		return fake
+	})
+	defer os.Unsetenv(string(config.GddServiceDiscoveryMode))
+	_ = config.GddServiceDiscoveryMode.Write("fake, unknown,fake")
+	d := DefaultDiscovery()
+	require.Equal(t, []Registry{fake}, d.Registries())
+	require.Same(t, d, DefaultDiscovery())
+
+	_ = config.GddServiceDiscoveryMode.Write("unknown")
+	require.Empty(t, DefaultDiscovery().Registries())
+}
@@ -0,0 +1,159 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/youminxue/odin/framework/internal/config"
+	cons "github.com/youminxue/odin/framework/registry/constants"
+	"github.com/youminxue/odin/toolkit/loadbalance"
+	"github.com/youminxue/odin/toolkit/stringutils"
+	"github.com/youminxue/odin/toolkit/zlogger"
+)
+
+// lookupTimeout bounds a single SRV lookup
+const lookupTimeout = 5 * time.Second
+
+// newResolver returns a resolver querying server, or the system resolver if server is empty
+func newResolver(server string) *net.Resolver {
+	if stringutils.IsEmpty(server) {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+func defaultResolver() *net.Resolver {
+	return newResolver(config.GddDnsServer.LoadOrDefault(config.DefaultGddDnsServer))
+}
+
+// errNoDomain is returned by lookups if GDD_DNS_DOMAIN is not set, so that discovery skips dns mode
+var errNoDomain = errors.New("[odin] env GDD_DNS_DOMAIN is not set")
+
+func domain() (string, error) {
+	d := config.GddDnsDomain.LoadOrDefault(config.DefaultGddDnsDomain)
+	if stringutils.IsEmpty(d) {
+		return "", errNoDomain
+	}
+	return d, nil
+}
+
+func refreshInterval() time.Duration {
+	interval, err := time.ParseDuration(config.GddDnsRefreshInterval.LoadOrDefault(config.DefaultGddDnsRefreshInterval))
+	if err != nil || interval <= 0 {
+		interval, _ = time.ParseDuration(config.DefaultGddDnsRefreshInterval)
+	}
+	return interval
+}
+
+// target is an instance resolved from a SRV record
+type target struct {
+	addr   string
+	weight int
+}
+
+// lookup resolves _service._tcp.domain SRV records. Only records of the lowest priority are returned as others are
+// backups by RFC 2782, sorted by address. Zero weight is treated as 1, so that such targets are still selected.
+func lookup(ctx context.Context, r *net.Resolver, domain, service string) ([]target, error) {
+	_, records, err := r.LookupSRV(ctx, service, "tcp", domain)
+	if err != nil {
+		return nil, errors.Wrapf(err, "[odin] failed to lookup SRV records of %s", service)
+	}
+	var ret []target
+	var priority uint16
+	for _, record := range records {
+		if len(ret) > 0 && record.Priority > priority {
+			continue
+		}
+		if len(ret) > 0 && record.Priority < priority {
+			ret = ret[:0]
+		}
+		priority = record.Priority
+		weight := int(record.Weight)
+		if weight == 0 {
+			weight = 1
+		}
+		ret = append(ret, target{
+			addr:   net.JoinHostPort(strings.TrimSuffix(record.Target, "."), fmt.Sprint(record.Port)),
+			weight: weight,
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].addr < ret[j].addr
+	})
+	return ret, nil
+}
+
+// HasService reports whether SRV records of service can be resolved
+func HasService(service string) bool {
+	d, err := domain()
+	if err != nil {
+		zlogger.Error().Err(err).Msgf("[odin] failed to resolve %s", service)
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+	targets, err := lookup(ctx, defaultResolver(), d, service)
+	return err == nil && len(targets) > 0
+}
+
+// ListInstances resolves instances of service from SRV records, base urls are built with GDD_DNS_SCHEME
+func ListInstances(service string) ([]loadbalance.Instance, error) {
+	d, err := domain()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+	targets, err := lookup(ctx, defaultResolver(), d, service)
+	if err != nil {
+		return nil, err
+	}
+	scheme := config.GddDnsScheme.LoadOrDefault(config.DefaultGddDnsScheme)
+	ret := make([]loadbalance.Instance, 0, len(targets))
+	for _, t := range targets {
+		ret = append(ret, loadbalance.Instance{
+			BaseUrl: fmt.Sprintf("%s://%s", scheme, t.addr),
+			Weight:  t.weight,
+		})
+	}
+	return ret, nil
+}
+
+// RefreshInterval returns the interval of resolving SRV records again configured by GDD_DNS_REFRESH_INTERVAL
+func RefreshInterval() time.Duration {
+	return refreshInterval()
+}
+
+// NewRest does nothing but logging, as SRV records are managed by the DNS server, e.g. kubernetes headless services
+// or consul
+func NewRest(data ...map[string]interface{}) {
+	service := config.GetServiceName() + "_" + string(cons.REST_TYPE)
+	zlogger.Info().Msgf("[odin] %s is not registered in dns mode, add SRV records to DNS server instead", service)
+}
+
+// NewGrpc does nothing but logging like NewRest
+func NewGrpc(data ...map[string]interface{}) {
+	service := config.GetServiceName() + "_" + string(cons.GRPC_TYPE)
+	zlogger.Info().Msgf("[odin] %s is not registered in dns mode, add SRV records to DNS server instead", service)
+}
+
+// MarkUnhealthyRest does nothing, SRV records are managed by the DNS server
+func MarkUnhealthyRest() {}
+
+// MarkUnhealthyGrpc does nothing, SRV records are managed by the DNS server
+func MarkUnhealthyGrpc() {}
+
+func ShutdownRest() {}
+
+func ShutdownGrpc() {}
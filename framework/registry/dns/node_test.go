@@ -0,0 +1,189 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	mdns "github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+	"github.com/youminxue/odin/framework/internal/config"
+	"github.com/youminxue/odin/toolkit/loadbalance"
+	gresolver "google.golang.org/grpc/resolver"
+)
+
+// stubServer is an in-process DNS server answering SRV queries from records
+type stubServer struct {
+	lock    sync.Mutex
+	records map[string][]*mdns.SRV
+	queries int
+}
+
+func (s *stubServer) set(name string, records ...*mdns.SRV) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.records[name] = records
+}
+
+func (s *stubServer) ServeDNS(w mdns.ResponseWriter, r *mdns.Msg) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.queries++
+	m := new(mdns.Msg)
+	m.SetReply(r)
+	question := r.Question[0]
+	records, ok := s.records[question.Name]
+	if !ok || question.Qtype != mdns.TypeSRV {
+		m.Rcode = mdns.RcodeNameError
+	}
+	for _, record := range records {
+		record.Hdr = mdns.RR_Header{Name: question.Name, Rrtype: mdns.TypeSRV, Class: mdns.ClassINET, Ttl: 30}
+		m.Answer = append(m.Answer, record)
+	}
+	_ = w.WriteMsg(m)
+}
+
+func (s *stubServer) count() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.queries
+}
+
+func startStubServer(t *testing.T) (*stubServer, string) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	stub := &stubServer{records: make(map[string][]*mdns.SRV)}
+	server := &mdns.Server{PacketConn: pc, Handler: stub}
+	started := make(chan struct{})
+	server.NotifyStartedFunc = func() {
+		close(started)
+	}
+	go server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() {
+		_ = server.Shutdown()
+	})
+	stub.set("_usersvc_rest._tcp.odin.local.",
+		&mdns.SRV{Priority: 10, Weight: 3, Port: 6060, Target: "node2.odin.local."},
+		&mdns.SRV{Priority: 10, Weight: 1, Port: 6060, Target: "node1.odin.local."},
+		&mdns.SRV{Priority: 20, Weight: 1, Port: 6060, Target: "backup.odin.local."},
+	)
+	return stub, pc.LocalAddr().String()
+}
+
+func TestLookup(t *testing.T) {
+	_, addr := startStubServer(t)
+	targets, err := lookup(context.Background(), newResolver(addr), "odin.local", "usersvc_rest")
+	require.NoError(t, err)
+	require.Equal(t, []target{
+		{addr: "node1.odin.local:6060", weight: 1},
+		{addr: "node2.odin.local:6060", weight: 3},
+	}, targets)
+
+	_, err = lookup(context.Background(), newResolver(addr), "odin.local", "ordersvc_rest")
+	require.Error(t, err)
+}
+
+func TestHasService(t *testing.T) {
+	_, addr := startStubServer(t)
+	config.GddDnsServer.Write(addr)
+	config.GddDnsDomain.Write("odin.local")
+	defer os.Unsetenv(string(config.GddDnsServer))
+	defer os.Unsetenv(string(config.GddDnsDomain))
+	require.True(t, HasService("usersvc_rest"))
+	require.False(t, HasService("ordersvc_rest"))
+}
+
+func TestListInstances_noDomain(t *testing.T) {
+	os.Unsetenv(string(config.GddDnsDomain))
+	require.False(t, HasService("usersvc_rest"))
+	_, err := ListInstances("usersvc_rest")
+	require.Equal(t, errNoDomain, err)
+	sp := NewSWRRServiceProvider("usersvc_rest")
+	require.Equal(t, "", sp.SelectServer())
+}
+
+func TestSWRRServiceProvider(t *testing.T) {
+	stub, addr := startStubServer(t)
+	sp := NewSWRRServiceProvider("usersvc_rest", WithDnsResolver(newResolver(addr)), WithDnsDomain("odin.local"),
+		WithDnsRootPath("/api"), WithDnsRefreshInterval(time.Hour))
+	counts := make(map[string]int)
+	for i := 0; i < 8; i++ {
+		counts[sp.SelectServer()]++
+	}
+	require.Equal(t, map[string]int{
+		"http://node1.odin.local:6060/api": 2,
+		"http://node2.odin.local:6060/api": 6,
+	}, counts)
+	require.Equal(t, []loadbalance.Instance{
+		{BaseUrl: "http://node1.odin.local:6060/api", Weight: 1},
+		{BaseUrl: "http://node2.odin.local:6060/api", Weight: 3},
+	}, sp.Instances())
+	// cached until refresh interval
+	require.Equal(t, 1, stub.count())
+}
+
+func TestRRServiceProvider_refresh(t *testing.T) {
+	stub, addr := startStubServer(t)
+	sp := NewRRServiceProvider("usersvc_rest", WithDnsResolver(newResolver(addr)), WithDnsDomain("odin.local"),
+		WithDnsScheme("https"), WithDnsRefreshInterval(10*time.Millisecond))
+	require.Equal(t, "https://node2.odin.local:6060", sp.SelectServer())
+	require.Equal(t, "https://node1.odin.local:6060", sp.SelectServer())
+
+	stub.set("_usersvc_rest._tcp.odin.local.", &mdns.SRV{Priority: 10, Weight: 1, Port: 6061, Target: "node3.odin.local."})
+	require.Eventually(t, func() bool {
+		return sp.SelectServer() == "https://node3.odin.local:6061"
+	}, time.Second, 20*time.Millisecond)
+
+	// instances resolved before are kept if lookup fails
+	stub.set("_usersvc_rest._tcp.odin.local.")
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, "https://node3.odin.local:6061", sp.SelectServer())
+}
+
+type fakeClientConn struct {
+	gresolver.ClientConn
+	states chan gresolver.State
+}
+
+func (f *fakeClientConn) UpdateState(state gresolver.State) error {
+	f.states <- state
+	return nil
+}
+
+func (f *fakeClientConn) ReportError(error) {}
+
+func TestResolver(t *testing.T) {
+	stub, addr := startStubServer(t)
+	stub.set("_usersvc_grpc._tcp.odin.local.", &mdns.SRV{Priority: 10, Weight: 2, Port: 50051, Target: "node1.odin.local."})
+	cc := &fakeClientConn{states: make(chan gresolver.State, 10)}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &resolver{
+		name:      "usersvc_grpc",
+		resolver:  newResolver(addr),
+		domain:    "odin.local",
+		interval:  time.Hour,
+		cc:        cc,
+		ctx:       ctx,
+		cancel:    cancel,
+		resolveCh: make(chan struct{}, 1),
+	}
+	go r.watch()
+	defer r.Close()
+
+	state := <-cc.states
+	require.Len(t, state.Addresses, 1)
+	require.Equal(t, "node1.odin.local:50051", state.Addresses[0].Addr)
+	require.Equal(t, WeightAddrInfo{Weight: 2}, state.Addresses[0].BalancerAttributes.Value(WeightAttributeKey{}))
+
+	stub.set("_usersvc_grpc._tcp.odin.local.",
+		&mdns.SRV{Priority: 10, Weight: 2, Port: 50051, Target: "node1.odin.local."},
+		&mdns.SRV{Priority: 10, Weight: 1, Port: 50051, Target: "node2.odin.local."},
+	)
+	r.ResolveNow(gresolver.ResolveNowOptions{})
+	state = <-cc.states
+	require.Len(t, state.Addresses, 2)
+}
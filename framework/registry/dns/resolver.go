@@ -0,0 +1,110 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/youminxue/odin/toolkit/zlogger"
+	"google.golang.org/grpc/attributes"
+	gresolver "google.golang.org/grpc/resolver"
+)
+
+// schemeName differs from dns scheme of the builtin grpc resolver, which resolves A records only
+const schemeName = "dnssrv"
+
+var _ gresolver.Builder = (*builder)(nil)
+var _ gresolver.Resolver = (*resolver)(nil)
+
+func init() {
+	gresolver.Register(&builder{})
+}
+
+type builder struct {
+}
+
+func (b *builder) Scheme() string {
+	return schemeName
+}
+
+func (b *builder) Build(target gresolver.Target, cc gresolver.ClientConn, opts gresolver.BuildOptions) (gresolver.Resolver, error) {
+	name := target.URL.Host
+	if len(name) == 0 {
+		return nil, errors.Errorf("Wrong dnssrv URL %s", target.URL.String())
+	}
+	d, err := domain()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &resolver{
+		name:      name,
+		resolver:  defaultResolver(),
+		domain:    d,
+		interval:  refreshInterval(),
+		cc:        cc,
+		ctx:       ctx,
+		cancel:    cancel,
+		resolveCh: make(chan struct{}, 1),
+	}
+	go r.watch()
+	return r, nil
+}
+
+// resolver resolves addresses of a grpc service from SRV records every refresh interval
+type resolver struct {
+	name      string
+	resolver  *net.Resolver
+	domain    string
+	interval  time.Duration
+	cc        gresolver.ClientConn
+	ctx       context.Context
+	cancel    context.CancelFunc
+	resolveCh chan struct{}
+}
+
+func (m *resolver) watch() {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		m.UpdateCC()
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-m.resolveCh:
+		}
+	}
+}
+
+func (m *resolver) UpdateCC() {
+	ctx, cancel := context.WithTimeout(m.ctx, lookupTimeout)
+	defer cancel()
+	targets, err := lookup(ctx, m.resolver, m.domain, m.name)
+	if err != nil {
+		zlogger.Error().Err(err).Msgf("[odin] failed to resolve %s", m.name)
+		m.cc.ReportError(err)
+		return
+	}
+	conns := make([]gresolver.Address, 0, len(targets))
+	for _, item := range targets {
+		conns = append(conns, gresolver.Address{
+			Addr:               item.addr,
+			BalancerAttributes: attributes.New(WeightAttributeKey{}, WeightAddrInfo{Weight: item.weight}),
+		})
+	}
+	m.cc.UpdateState(gresolver.State{Addresses: conns})
+}
+
+// ResolveNow resolves SRV records at once, e.g. when grpc fails to connect to resolved addresses
+func (m *resolver) ResolveNow(gresolver.ResolveNowOptions) {
+	select {
+	case m.resolveCh <- struct{}{}:
+	default:
+	}
+}
+
+func (m *resolver) Close() {
+	m.cancel()
+}
@@ -0,0 +1,243 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/youminxue/odin/framework/internal/config"
+	"github.com/youminxue/odin/toolkit/loadbalance"
+	"github.com/youminxue/odin/toolkit/zlogger"
+	"google.golang.org/grpc"
+)
+
+type server struct {
+	baseUrl       string
+	weight        int
+	currentWeight int
+}
+
+// dnsBase caches instances of a service resolved from SRV records. Cached instances are served while they are
+// resolved again in background every refresh interval, so requests are never blocked by DNS except the first one.
+type dnsBase struct {
+	serviceName string
+	resolver    *net.Resolver
+	domain      string
+	scheme      string
+	rootPath    string
+	interval    time.Duration
+
+	lock       sync.Mutex
+	servers    []*server
+	resolved   bool
+	expireAt   time.Time
+	refreshing int32
+}
+
+type DnsProviderOption func(*dnsBase)
+
+// WithDnsResolver sets resolver for looking up SRV records, the resolver configured by GDD_DNS_SERVER by default
+func WithDnsResolver(resolver *net.Resolver) DnsProviderOption {
+	return func(b *dnsBase) {
+		b.resolver = resolver
+	}
+}
+
+// WithDnsDomain sets domain of SRV records, GDD_DNS_DOMAIN by default
+func WithDnsDomain(domain string) DnsProviderOption {
+	return func(b *dnsBase) {
+		b.domain = domain
+	}
+}
+
+// WithDnsScheme sets scheme of base urls, GDD_DNS_SCHEME by default
+func WithDnsScheme(scheme string) DnsProviderOption {
+	return func(b *dnsBase) {
+		b.scheme = scheme
+	}
+}
+
+// WithDnsRootPath sets route root path of base urls, as SRV records don't carry it
+func WithDnsRootPath(rootPath string) DnsProviderOption {
+	return func(b *dnsBase) {
+		b.rootPath = rootPath
+	}
+}
+
+// WithDnsRefreshInterval sets interval of resolving SRV records again, GDD_DNS_REFRESH_INTERVAL by default
+func WithDnsRefreshInterval(interval time.Duration) DnsProviderOption {
+	return func(b *dnsBase) {
+		b.interval = interval
+	}
+}
+
+func (b *dnsBase) init(serviceName string, opts ...DnsProviderOption) {
+	b.serviceName = serviceName
+	b.scheme = config.GddDnsScheme.LoadOrDefault(config.DefaultGddDnsScheme)
+	b.interval = refreshInterval()
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.resolver == nil {
+		b.resolver = defaultResolver()
+	}
+	if b.domain == "" {
+		// lookups fail with errNoDomain if GDD_DNS_DOMAIN is not set either
+		b.domain, _ = domain()
+	}
+}
+
+// refresh resolves SRV records at the first call and in background once cached instances expire, it must be
+// called with lock held
+func (b *dnsBase) refresh() {
+	if !b.resolved {
+		b.resolved = true
+		b.expireAt = time.Now().Add(b.interval)
+		b.apply(b.lookup())
+		return
+	}
+	if time.Now().Before(b.expireAt) || !atomic.CompareAndSwapInt32(&b.refreshing, 0, 1) {
+		return
+	}
+	b.expireAt = time.Now().Add(b.interval)
+	go func() {
+		defer atomic.StoreInt32(&b.refreshing, 0)
+		targets, err := b.lookup()
+		b.lock.Lock()
+		defer b.lock.Unlock()
+		b.apply(targets, err)
+	}()
+}
+
+func (b *dnsBase) lookup() ([]target, error) {
+	if b.domain == "" {
+		return nil, errNoDomain
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+	return lookup(ctx, b.resolver, b.domain, b.serviceName)
+}
+
+// apply rebuilds servers from targets, current weights of unchanged servers are kept.
+// Cached servers are kept if the lookup failed.
+func (b *dnsBase) apply(targets []target, err error) {
+	if err != nil {
+		zlogger.Error().Err(err).Msgf("[odin] failed to resolve %s, keep instances resolved before", b.serviceName)
+		return
+	}
+	old := make(map[string]*server, len(b.servers))
+	for _, s := range b.servers {
+		old[s.baseUrl] = s
+	}
+	servers := make([]*server, 0, len(targets))
+	for _, t := range targets {
+		s := &server{
+			baseUrl: fmt.Sprintf("%s://%s%s", b.scheme, t.addr, b.rootPath),
+			weight:  t.weight,
+		}
+		if prev, ok := old[s.baseUrl]; ok {
+			s.currentWeight = prev.currentWeight
+		}
+		servers = append(servers, s)
+	}
+	b.servers = servers
+}
+
+// Instances returns all instances of the service sorted by address for client-side load balancing
+func (b *dnsBase) Instances() []loadbalance.Instance {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.refresh()
+	ret := make([]loadbalance.Instance, 0, len(b.servers))
+	for _, item := range b.servers {
+		ret = append(ret, loadbalance.Instance{
+			BaseUrl: item.baseUrl,
+			Weight:  item.weight,
+		})
+	}
+	return ret
+}
+
+// RRServiceProvider is a round-robin IServiceProvider over instances resolved from SRV records
+type RRServiceProvider struct {
+	dnsBase
+	current uint64
+}
+
+// SelectServer selects an instance of the service, empty string if there is none
+func (n *RRServiceProvider) SelectServer() string {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.refresh()
+	if len(n.servers) == 0 {
+		zlogger.Error().Msgf("[odin] %s server not found", n.serviceName)
+		return ""
+	}
+	n.current = (n.current + 1) % uint64(len(n.servers))
+	return n.servers[n.current].baseUrl
+}
+
+// NewRRServiceProvider creates an RRServiceProvider instance
+func NewRRServiceProvider(serviceName string, opts ...DnsProviderOption) *RRServiceProvider {
+	provider := &RRServiceProvider{}
+	provider.init(serviceName, opts...)
+	return provider
+}
+
+// SWRRServiceProvider is a smooth weighted round-robin IServiceProvider over instances resolved from SRV records,
+// weighted by weights of SRV records
+type SWRRServiceProvider struct {
+	dnsBase
+}
+
+// SelectServer selects an instance of the service by weight, empty string if there is none
+func (n *SWRRServiceProvider) SelectServer() string {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.refresh()
+	if len(n.servers) == 0 {
+		zlogger.Error().Msgf("[odin] %s server not found", n.serviceName)
+		return ""
+	}
+	var selected *server
+	total := 0
+	for _, s := range n.servers {
+		s.currentWeight += s.weight
+		total += s.weight
+		if selected == nil || s.currentWeight > selected.currentWeight {
+			selected = s
+		}
+	}
+	selected.currentWeight -= total
+	return selected.baseUrl
+}
+
+// NewSWRRServiceProvider creates an SWRRServiceProvider instance
+func NewSWRRServiceProvider(serviceName string, opts ...DnsProviderOption) *SWRRServiceProvider {
+	provider := &SWRRServiceProvider{}
+	provider.init(serviceName, opts...)
+	return provider
+}
+
+func NewSWRRGrpcClientConn(service string, dialOptions ...grpc.DialOption) *grpc.ClientConn {
+	return NewGrpcClientConn(service, Name, dialOptions...)
+}
+
+func NewRRGrpcClientConn(service string, dialOptions ...grpc.DialOption) *grpc.ClientConn {
+	return NewGrpcClientConn(service, "round_robin", dialOptions...)
+}
+
+func NewGrpcClientConn(service string, lb string, dialOptions ...grpc.DialOption) *grpc.ClientConn {
+	serverAddr := fmt.Sprintf(schemeName+"://%s/", service)
+	dialOptions = append(dialOptions, grpc.WithBlock(), grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy": "`+lb+`"}`))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	grpcConn, err := grpc.DialContext(ctx, serverAddr, dialOptions...)
+	if err != nil {
+		zlogger.Panic().Err(err).Msgf("[odin] failed to connect to server %s", serverAddr)
+	}
+	return grpcConn
+}
@@ -3,12 +3,14 @@ package etcd
 import (
 	"context"
 	"fmt"
+	"github.com/pkg/errors"
 	"github.com/youminxue/odin/framework/buildinfo"
 	"github.com/youminxue/odin/framework/internal/config"
 	cons "github.com/youminxue/odin/framework/registry/constants"
 	"github.com/youminxue/odin/framework/registry/utils"
 	"github.com/youminxue/odin/toolkit/cast"
 	"github.com/youminxue/odin/toolkit/constants"
+	"github.com/youminxue/odin/toolkit/loadbalance"
 	"github.com/youminxue/odin/toolkit/stringutils"
 	"github.com/youminxue/odin/toolkit/zlogger"
 	"go.etcd.io/etcd/client/v3"
@@ -122,6 +124,12 @@ func populateMeta(meta map[string]interface{}, isGrpc bool, userData ...map[stri
 	if stringutils.IsNotEmpty(rr) && !isGrpc {
 		meta["rootPath"] = rr
 	}
+	if !isGrpc {
+		meta["scheme"] = config.GetScheme()
+	}
+	if zone := config.GddZone.Load(); stringutils.IsNotEmpty(zone) {
+		meta[loadbalance.MetaZone] = zone
+	}
 	for _, item := range userData {
 		for k, v := range item {
 			meta[k] = fmt.Sprint(v)
@@ -145,12 +153,23 @@ func NewGrpc(data ...map[string]interface{}) {
 		InitEtcdCli()
 	})
 	service := config.GetServiceName() + "_" + string(cons.GRPC_TYPE)
-	grpcPort := config.GetGrpcPort()
+	grpcPort := utils.GetGrpcRegisterPort()
 	grpcLease = getLeaseID()
 	registerService(service, grpcPort, grpcLease, data...)
 	zlogger.Info().Msgf("[odin] %s registered to etcd successfully", service)
 }
 
+// MarkUnhealthyRest removes the rest endpoint from etcd ahead of shutdown, as etcd endpoints have no health status.
+// Clients watching the service drop the endpoint at once, while the lease is kept alive until the client is closed.
+func MarkUnhealthyRest() {
+	ShutdownRest()
+}
+
+// MarkUnhealthyGrpc removes the grpc endpoint from etcd ahead of shutdown like MarkUnhealthyRest
+func MarkUnhealthyGrpc() {
+	ShutdownGrpc()
+}
+
 func ShutdownRest() {
 	if EtcdCli != nil {
 		service := config.GetServiceName() + "_" + string(cons.REST_TYPE)
@@ -178,7 +197,7 @@ func ShutdownGrpc() {
 			zlogger.Error().Err(err).Msgf("[odin] failed to deregister %s from etcd", service)
 			return
 		}
-		addr := utils.GetRegisterHost() + ":" + strconv.Itoa(int(config.GetGrpcPort()))
+		addr := utils.GetRegisterHost() + ":" + strconv.Itoa(int(utils.GetGrpcRegisterPort()))
 		tctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 		if err = em.DeleteEndpoint(tctx, service+"/"+addr); err != nil {
@@ -216,9 +235,15 @@ type RRServiceProvider struct {
 
 type address struct {
 	addr          string
+	scheme        string
 	rootPath      string
 	weight        int
 	currentWeight int
+	metadata      map[string]string
+}
+
+func (a *address) baseUrl() string {
+	return fmt.Sprintf("%s://%s%s", a.scheme, a.addr, a.rootPath)
 }
 
 type state struct {
@@ -257,16 +282,26 @@ func convertToAddress(ups map[string]*endpoints.Update) (addrs []*address) {
 	for _, up := range ups {
 		weight := 1
 		var rootPath string
+		scheme := "http"
+		meta := make(map[string]string)
 		if metadata, ok := up.Endpoint.Metadata.(map[string]interface{}); !ok {
 			zlogger.Error().Msg("[odin] etcd endpoint metadata is not map[string]string type")
 		} else {
 			weight = int(metadata["weight"].(float64))
 			rootPath = metadata["rootPath"].(string)
+			if s, ok := metadata["scheme"].(string); ok && stringutils.IsNotEmpty(s) {
+				scheme = s
+			}
+			for k, v := range metadata {
+				meta[k] = fmt.Sprint(v)
+			}
 		}
 		addr := &address{
 			addr:     up.Endpoint.Addr,
+			scheme:   scheme,
 			rootPath: rootPath,
 			weight:   weight,
+			metadata: meta,
 		}
 		addrs = append(addrs, addr)
 	}
@@ -288,7 +323,30 @@ func (n *RRServiceProvider) SelectServer() string {
 	next := int(atomic.AddUint64(&n.current, uint64(1)) % uint64(len(instances)))
 	n.current = uint64(next)
 	selected := instances[next]
-	return fmt.Sprintf("http://%s%s", selected.addr, selected.rootPath)
+	return selected.baseUrl()
+}
+
+// Instances returns all instances of the service sorted by base url for client-side load balancing
+func (n *RRServiceProvider) Instances() []loadbalance.Instance {
+	st, _ := n.curState.Load().(state)
+	ret := make([]loadbalance.Instance, 0, len(st.addresses))
+	for _, item := range st.addresses {
+		ret = append(ret, loadbalance.Instance{
+			BaseUrl:  item.baseUrl(),
+			Weight:   item.weight,
+			Metadata: item.metadata,
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].BaseUrl < ret[j].BaseUrl
+	})
+	return ret
+}
+
+// Close stops watching the service
+func (r *RRServiceProvider) Close() {
+	r.cancel()
+	r.wg.Wait()
 }
 
 // NewRRServiceProvider creates new RRServiceProvider instance
@@ -314,6 +372,63 @@ func NewRRServiceProvider(serviceName string) *RRServiceProvider {
 	return r
 }
 
+// ListInstances returns all instances of the service registered in etcd sorted by base url
+func ListInstances(service string) ([]loadbalance.Instance, error) {
+	onceEtcd.Do(func() {
+		InitEtcdCli()
+	})
+	em, err := endpoints.NewManager(EtcdCli, service)
+	if err != nil {
+		return nil, errors.Wrap(err, "[odin] failed to create endpoint manager")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	eps, err := em.List(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "[odin] failed to list %s from etcd", service)
+	}
+	ups := make(map[string]*endpoints.Update, len(eps))
+	for key, ep := range eps {
+		ups[key] = &endpoints.Update{Op: endpoints.Add, Key: key, Endpoint: ep}
+	}
+	ret := make([]loadbalance.Instance, 0, len(ups))
+	for _, item := range convertToAddress(ups) {
+		ret = append(ret, loadbalance.Instance{
+			BaseUrl:  item.baseUrl(),
+			Weight:   item.weight,
+			Metadata: item.metadata,
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].BaseUrl < ret[j].BaseUrl
+	})
+	return ret, nil
+}
+
+// WatchService calls onChange whenever endpoints of the service change in etcd, call the returned function to stop
+// watching
+func WatchService(service string, onChange func()) (func(), error) {
+	onceEtcd.Do(func() {
+		InitEtcdCli()
+	})
+	em, err := endpoints.NewManager(EtcdCli, service)
+	if err != nil {
+		return nil, errors.Wrap(err, "[odin] failed to create endpoint manager")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	wch, err := em.NewWatchChannel(ctx)
+	if err != nil {
+		cancel()
+		return nil, errors.Wrap(err, "[odin] failed to create watch channel")
+	}
+	go func() {
+		for range wch {
+			onChange()
+		}
+	}()
+	return cancel, nil
+}
+
 // SWRRServiceProvider is a smooth weighted round-robin service provider
 type SWRRServiceProvider struct {
 	*RRServiceProvider
@@ -339,7 +454,7 @@ func (n *SWRRServiceProvider) SelectServer() string {
 		}
 	}
 	selected.currentWeight -= total
-	return fmt.Sprintf("http://%s%s", selected.addr, selected.rootPath)
+	return selected.baseUrl()
 }
 
 // NewSWRRServiceProvider creates new SWRRServiceProvider instance
@@ -156,6 +156,18 @@ func setGddMemGossipNodes(conf *memberlist.Config) {
 	}
 }
 
+func setGddMemDynamicProbeTimeout(conf *memberlist.Config) {
+	conf.DynamicProbeTimeout = cast.ToBoolOrDefault(config.GddMemDynamicProbeTimeout.Load(), config.DefaultGddMemDynamicProbeTimeout)
+}
+
+func setGddMemDynamicPacketSize(conf *memberlist.Config) {
+	conf.DynamicPacketSize = cast.ToBoolOrDefault(config.GddMemDynamicPacketSize.Load(), config.DefaultGddMemDynamicPacketSize)
+}
+
+func setGddMemCoordinates(conf *memberlist.Config) {
+	conf.EnableCoordinates = cast.ToBoolOrDefault(config.GddMemCoordinates.Load(), config.DefaultGddMemCoordinates)
+}
+
 func setGddMemIndirectChecks(conf *memberlist.Config) {
 	var set bool
 	if eg, err := cast.ToIntE(config.GddMemIndirectChecks.Load()); err == nil {
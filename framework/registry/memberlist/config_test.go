@@ -376,3 +376,31 @@ func Test_setGddMemRetransmitMult_unset(t *testing.T) {
 		})
 	}
 }
+
+func Test_setGddMemDynamicPacketSize(t *testing.T) {
+	conf := memberlist.DefaultLANConfig()
+	setGddMemDynamicPacketSize(conf)
+	if conf.DynamicPacketSize != config.DefaultGddMemDynamicPacketSize {
+		t.Errorf("DynamicPacketSize = %v, want %v", conf.DynamicPacketSize, config.DefaultGddMemDynamicPacketSize)
+	}
+	config.GddMemDynamicPacketSize.Write("true")
+	defer config.GddMemDynamicPacketSize.Write("")
+	setGddMemDynamicPacketSize(conf)
+	if !conf.DynamicPacketSize {
+		t.Errorf("DynamicPacketSize = false, want true")
+	}
+}
+
+func Test_setGddMemCoordinates(t *testing.T) {
+	conf := memberlist.DefaultLANConfig()
+	setGddMemCoordinates(conf)
+	if conf.EnableCoordinates != config.DefaultGddMemCoordinates {
+		t.Errorf("EnableCoordinates = %v, want %v", conf.EnableCoordinates, config.DefaultGddMemCoordinates)
+	}
+	config.GddMemCoordinates.Write("true")
+	defer config.GddMemCoordinates.Write("")
+	setGddMemCoordinates(conf)
+	if !conf.EnableCoordinates {
+		t.Errorf("EnableCoordinates = false, want true")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/hashicorp/go-msgpack/codec"
+	"github.com/pkg/errors"
 	"github.com/youminxue/odin/framework/registry/constants"
 	"github.com/youminxue/odin/toolkit/memberlist"
 	logger "github.com/youminxue/odin/toolkit/zlogger"
@@ -16,8 +17,11 @@ type Service struct {
 	Host          string                 `json:"host"`
 	Port          int                    `json:"port"`
 	RouteRootPath string                 `json:"routeRootPath"`
+	Scheme        string                 `json:"scheme,omitempty"`
 	Type          constants.ServiceType  `json:"type"`
 	Data          map[string]interface{} `json:"data,omitempty"`
+	// Unhealthy is set when the service is draining before shutdown
+	Unhealthy bool `json:"unhealthy,omitempty"`
 }
 
 func (receiver *Service) BaseUrl() string {
@@ -26,7 +30,11 @@ func (receiver *Service) BaseUrl() string {
 	}
 	switch receiver.Type {
 	case constants.REST_TYPE:
-		return fmt.Sprintf("http://%s:%d%s", receiver.Host, receiver.Port, receiver.RouteRootPath)
+		scheme := receiver.Scheme
+		if scheme == "" {
+			scheme = "http"
+		}
+		return fmt.Sprintf("%s://%s:%d%s", scheme, receiver.Host, receiver.Port, receiver.RouteRootPath)
 	case constants.GRPC_TYPE:
 		return fmt.Sprintf("%s:%d", receiver.Host, receiver.Port)
 	}
@@ -43,10 +51,41 @@ type NodeMeta struct {
 	Weight     int        `json:"weight"`
 }
 
+// messageType is the first byte of user data messages gossiped by delegate
+type messageType uint8
+
+const (
+	userEventMsg messageType = iota + 1
+	kvMsg
+)
+
 type delegate struct {
-	meta  NodeMeta
-	lock  sync.Mutex
-	queue *memberlist.TransmitLimitedQueue
+	meta       NodeMeta
+	lock       sync.Mutex
+	queue      *memberlist.TransmitLimitedQueue
+	userEvents *userEventStore
+	kv         *kvStore
+}
+
+// delegateState is exchanged with other nodes when push/pull-ing state for anti-entropy
+type delegateState struct {
+	EventLTime uint64    `json:"eventLTime"`
+	KVLTime    uint64    `json:"kvLTime"`
+	Entries    []kvEntry `json:"entries"`
+}
+
+func encodeMessage(t messageType, v interface{}) ([]byte, error) {
+	buf := bytes.NewBuffer([]byte{uint8(t)})
+	enc := codec.NewEncoder(buf, &codec.MsgpackHandle{})
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeMessage(buf []byte, v interface{}) error {
+	dec := codec.NewDecoder(bytes.NewReader(buf), &codec.MsgpackHandle{})
+	return dec.Decode(v)
 }
 
 func (d *delegate) AddService(service Service) {
@@ -56,6 +95,18 @@ func (d *delegate) AddService(service Service) {
 	d.meta.Services = append(d.meta.Services, service)
 }
 
+// MarkUnhealthy marks services of type t unhealthy
+func (d *delegate) MarkUnhealthy(t constants.ServiceType) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for i := range d.meta.Services {
+		if d.meta.Services[i].Type == t {
+			d.meta.Services[i].Unhealthy = true
+		}
+	}
+}
+
 // NodeMeta return user custom node meta data
 func (d *delegate) NodeMeta(limit int) []byte {
 	d.lock.Lock()
@@ -76,9 +127,64 @@ func (d *delegate) NodeMeta(limit int) []byte {
 
 // NotifyMsg callback function when received user data message from remote node
 func (d *delegate) NotifyMsg(msg []byte) {
-	d.lock.Lock()
-	defer d.lock.Unlock()
-	// TODO
+	if len(msg) == 0 {
+		return
+	}
+	switch messageType(msg[0]) {
+	case userEventMsg:
+		if d.userEvents == nil {
+			return
+		}
+		var e UserEvent
+		if err := decodeMessage(msg[1:], &e); err != nil {
+			logger.Error().Err(err).Msg("[odin] Failed to decode user event")
+			return
+		}
+		if d.userEvents.handle(e) && d.queue != nil {
+			// copy as msg is reused by memberlist after NotifyMsg returns
+			d.queue.QueueBroadcast(&userEventBroadcast{msg: append([]byte(nil), msg...)})
+		}
+	case kvMsg:
+		if d.kv == nil {
+			return
+		}
+		var e kvEntry
+		if err := decodeMessage(msg[1:], &e); err != nil {
+			logger.Error().Err(err).Msg("[odin] Failed to decode key/value entry")
+			return
+		}
+		if d.kv.apply(e) && d.queue != nil {
+			d.queue.QueueBroadcast(&kvBroadcast{key: e.Key, msg: append([]byte(nil), msg...)})
+		}
+	}
+}
+
+func (d *delegate) fireUserEvent(origin, name string, payload []byte) error {
+	e, err := d.userEvents.newEvent(origin, name, payload)
+	if err != nil {
+		return err
+	}
+	msg, err := encodeMessage(userEventMsg, e)
+	if err != nil {
+		return errors.Wrap(err, "[odin] Failed to encode user event")
+	}
+	d.userEvents.handle(e)
+	d.queue.QueueBroadcast(&userEventBroadcast{msg: msg})
+	return nil
+}
+
+func (d *delegate) setKV(node, key string, value []byte, deleted bool) error {
+	e, err := d.kv.newEntry(node, key, value, deleted)
+	if err != nil {
+		return err
+	}
+	msg, err := encodeMessage(kvMsg, e)
+	if err != nil {
+		return errors.Wrap(err, "[odin] Failed to encode key/value entry")
+	}
+	d.kv.apply(e)
+	d.queue.QueueBroadcast(&kvBroadcast{key: key, msg: msg})
+	return nil
 }
 
 // GetBroadcasts get a number of user data broadcasts
@@ -92,9 +198,41 @@ func (d *delegate) GetBroadcasts(overhead, limit int) [][]byte {
 
 // LocalState also sends user data, but by tcp connection when pushPull-ing state with other node
 func (d *delegate) LocalState(join bool) []byte {
-	return nil
+	if d.userEvents == nil || d.kv == nil {
+		return nil
+	}
+	state := delegateState{
+		EventLTime: d.userEvents.clock.Time(),
+		KVLTime:    d.kv.clock.Time(),
+		Entries:    d.kv.snapshot(),
+	}
+	var buf bytes.Buffer
+	enc := codec.NewEncoder(&buf, &codec.MsgpackHandle{})
+	if err := enc.Encode(state); err != nil {
+		logger.Error().Err(err).Msg("[odin] Failed to encode local state")
+		return nil
+	}
+	return buf.Bytes()
 }
 
 // MergeRemoteState gets user data from remote node by tcp connection when pushPull-ing state with other node
 func (d *delegate) MergeRemoteState(s []byte, join bool) {
+	if len(s) == 0 || d.userEvents == nil || d.kv == nil {
+		return
+	}
+	var state delegateState
+	if err := decodeMessage(s, &state); err != nil {
+		logger.Error().Err(err).Msg("[odin] Failed to decode remote state")
+		return
+	}
+	d.kv.clock.Witness(state.KVLTime)
+	for _, e := range state.Entries {
+		d.kv.apply(e)
+	}
+	if join {
+		// events fired before joining have been delivered to other nodes, don't replay them on this node
+		d.userEvents.ignoreBefore(state.EventLTime)
+	} else {
+		d.userEvents.clock.Witness(state.EventLTime)
+	}
 }
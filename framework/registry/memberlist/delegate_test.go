@@ -3,6 +3,7 @@ package memberlist
 import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/youminxue/odin/framework/registry/constants"
 	"github.com/youminxue/odin/toolkit/memberlist"
 	"sync"
 	"testing"
@@ -205,3 +206,15 @@ func Test_delegate_MergeRemoteState(t *testing.T) {
 	d := delegate{}
 	d.MergeRemoteState(nil, false)
 }
+
+func TestService_BaseUrl(t *testing.T) {
+	service := &Service{
+		Host:          "10.0.0.1",
+		Port:          6060,
+		RouteRootPath: "/api",
+		Type:          constants.REST_TYPE,
+	}
+	require.Equal(t, "http://10.0.0.1:6060/api", service.BaseUrl())
+	service.Scheme = "https"
+	require.Equal(t, "https://10.0.0.1:6060/api", service.BaseUrl())
+}
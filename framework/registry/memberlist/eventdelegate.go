@@ -2,14 +2,39 @@ package memberlist
 
 import (
 	"github.com/youminxue/odin/toolkit/memberlist"
+	"sync"
 )
 
 type eventDelegate struct {
 	ServiceProviders []IMemberlistServiceProvider
+	lock             sync.RWMutex
+}
+
+func (e *eventDelegate) addServiceProvider(sp IMemberlistServiceProvider) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.ServiceProviders = append(e.ServiceProviders, sp)
+}
+
+func (e *eventDelegate) removeServiceProvider(sp IMemberlistServiceProvider) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for i, item := range e.ServiceProviders {
+		if item == sp {
+			e.ServiceProviders = append(e.ServiceProviders[:i], e.ServiceProviders[i+1:]...)
+			return
+		}
+	}
+}
+
+func (e *eventDelegate) serviceProviders() []IMemberlistServiceProvider {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	return append([]IMemberlistServiceProvider(nil), e.ServiceProviders...)
 }
 
 func (e *eventDelegate) NotifySuspectSateChange(node *memberlist.Node) {
-	for _, sp := range e.ServiceProviders {
+	for _, sp := range e.serviceProviders() {
 		if node.State == memberlist.StateSuspect {
 			sp.RemoveNode(node)
 		} else if node.State == memberlist.StateAlive {
@@ -19,28 +44,28 @@ func (e *eventDelegate) NotifySuspectSateChange(node *memberlist.Node) {
 }
 
 func (e *eventDelegate) NotifyWeight(node *memberlist.Node) {
-	for _, sp := range e.ServiceProviders {
+	for _, sp := range e.serviceProviders() {
 		sp.UpdateWeight(node)
 	}
 }
 
 // NotifyJoin callback function when node joined
 func (e *eventDelegate) NotifyJoin(node *memberlist.Node) {
-	for _, sp := range e.ServiceProviders {
+	for _, sp := range e.serviceProviders() {
 		sp.AddNode(node)
 	}
 }
 
 // NotifyLeave callback function when node leave
 func (e *eventDelegate) NotifyLeave(node *memberlist.Node) {
-	for _, sp := range e.ServiceProviders {
+	for _, sp := range e.serviceProviders() {
 		sp.RemoveNode(node)
 	}
 }
 
 // NotifyUpdate callback function when node updated
 func (e *eventDelegate) NotifyUpdate(node *memberlist.Node) {
-	for _, sp := range e.ServiceProviders {
+	for _, sp := range e.serviceProviders() {
 		sp.AddNode(node)
 	}
 }
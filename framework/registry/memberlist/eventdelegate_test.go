@@ -356,3 +356,19 @@ func Test_eventDelegate_NotifyUpdate1(t *testing.T) {
 		})
 	}
 }
+
+func Test_eventDelegate_removeServiceProvider(t *testing.T) {
+	sp1 := newMockServiceProvider("test1")
+	sp2 := newMockServiceProvider("test2")
+	e := &eventDelegate{}
+	e.addServiceProvider(sp1)
+	e.addServiceProvider(sp2)
+	e.removeServiceProvider(sp1)
+	e.NotifyJoin(&memberlist.Node{Name: "test01"})
+	if len(sp1.servers) != 0 {
+		t.Errorf("expected: %d, actual: %d", 0, len(sp1.servers))
+	}
+	if len(sp2.servers) != 1 {
+		t.Errorf("expected: %d, actual: %d", 1, len(sp2.servers))
+	}
+}
@@ -0,0 +1,422 @@
+package memberlist
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/youminxue/odin/framework/internal/config"
+	"github.com/youminxue/odin/toolkit/cast"
+	"github.com/youminxue/odin/toolkit/memberlist"
+	"github.com/youminxue/odin/toolkit/stringutils"
+	logger "github.com/youminxue/odin/toolkit/zlogger"
+)
+
+const (
+	// keyringEventName is the user event distributing key operations to all nodes
+	keyringEventName = "odin:keyring"
+	// keyringKVPrefix prefixes keys of the replicated key/value map where nodes report their keyrings
+	keyringKVPrefix = "odin/keyring/"
+
+	keyOpInstall = "install"
+	keyOpUse     = "use"
+	keyOpRemove  = "remove"
+)
+
+var (
+	// ErrKeyringDisabled is returned by key operations if gossip encryption is not enabled
+	ErrKeyringDisabled = errors.New("[odin] gossip encryption is disabled, set GDD_MEM_SECRET_KEY to enable it")
+	// ErrInvalidKey is returned if a key is not base64 encoded 16, 24 or 32 bytes
+	ErrInvalidKey = errors.New("[odin] invalid gossip encryption key")
+	// ErrUnsafeKeyOp is returned if a key operation would break communication with some nodes
+	ErrUnsafeKeyOp = errors.New("[odin] unsafe key operation")
+)
+
+// KeyringStatus is the keyring of a node. Keys are identified by fingerprints, keys themselves are never reported.
+type KeyringStatus struct {
+	PrimaryKey string   `json:"primaryKey"`
+	Keys       []string `json:"keys"`
+}
+
+func (s KeyringStatus) has(fingerprint string) bool {
+	for _, key := range s.Keys {
+		if key == fingerprint {
+			return true
+		}
+	}
+	return false
+}
+
+type keyOp struct {
+	Op  string `json:"op"`
+	Key string `json:"key"`
+}
+
+// KeyFingerprint identifies key without revealing it
+func KeyFingerprint(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+func decodeKey(key string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidKey, err.Error())
+	}
+	if err = memberlist.ValidateKey(raw); err != nil {
+		return nil, errors.Wrap(ErrInvalidKey, err.Error())
+	}
+	return raw, nil
+}
+
+// loadGddMemKeys returns primary and secondary gossip encryption keys from env, nil primary key if not set
+func loadGddMemKeys() ([]byte, [][]byte, error) {
+	var secondaries [][]byte
+	for _, item := range strings.Split(config.GddMemSecondaryKeys.Load(), ",") {
+		if stringutils.IsEmpty(strings.TrimSpace(item)) {
+			continue
+		}
+		key, err := decodeKey(item)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "bad key in %s", config.GddMemSecondaryKeys)
+		}
+		secondaries = append(secondaries, key)
+	}
+	if stringutils.IsEmpty(config.GddMemSecretKey.Load()) {
+		if len(secondaries) > 0 {
+			return nil, nil, errors.Errorf("[odin] %s is required by %s", config.GddMemSecretKey, config.GddMemSecondaryKeys)
+		}
+		return nil, nil, nil
+	}
+	primary, err := decodeKey(config.GddMemSecretKey.Load())
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "bad key in %s", config.GddMemSecretKey)
+	}
+	return primary, secondaries, nil
+}
+
+var keyringLock sync.Mutex
+
+// envKeys are keys last loaded from GDD_MEM_SECRET_KEY and GDD_MEM_SECONDARY_KEYS
+var envKeys [][]byte
+
+// apiKeys are keys installed by InstallKey or made primary by UseKey by fingerprint, env reloading never removes them
+var apiKeys = make(map[string][]byte)
+
+func setGddMemGossipVerify(conf *memberlist.Config) {
+	conf.GossipVerifyIncoming = cast.ToBoolOrDefault(config.GddMemGossipVerifyIncoming.Load(), config.DefaultGddMemGossipVerifyIncoming)
+	conf.GossipVerifyOutgoing = cast.ToBoolOrDefault(config.GddMemGossipVerifyOutgoing.Load(), config.DefaultGddMemGossipVerifyOutgoing)
+}
+
+// setGddMemKeys enables gossip encryption if GDD_MEM_SECRET_KEY is set
+func setGddMemKeys(conf *memberlist.Config) error {
+	setGddMemGossipVerify(conf)
+	primary, secondaries, err := loadGddMemKeys()
+	if err != nil || primary == nil {
+		return err
+	}
+	if conf.Keyring, err = memberlist.NewKeyring(secondaries, primary); err != nil {
+		return err
+	}
+	keyringLock.Lock()
+	envKeys = append([][]byte{primary}, secondaries...)
+	keyringLock.Unlock()
+	return nil
+}
+
+// reloadGddMemKeys applies GDD_MEM_SECRET_KEY and GDD_MEM_SECONDARY_KEYS changed by remote config to keyring.
+// As remote config reaches nodes at slightly different time, rotate keys in steps: add the new key to
+// GDD_MEM_SECONDARY_KEYS, then swap it with GDD_MEM_SECRET_KEY, at last remove the old key.
+// The primary key is switched only if primaryChanged is true, and only keys dropped from the env are removed,
+// so that keys rotated by InstallKey, UseKey and RemoveKey are kept.
+func reloadGddMemKeys(conf *memberlist.Config, primaryChanged bool) error {
+	primary, secondaries, err := loadGddMemKeys()
+	if err != nil {
+		return err
+	}
+	keyring := conf.Keyring
+	if keyring == nil || len(keyring.GetKeys()) == 0 {
+		if primary != nil {
+			return errors.New("[odin] enabling gossip encryption on a running node requires restart")
+		}
+		return nil
+	}
+	if primary == nil {
+		return errors.New("[odin] disabling gossip encryption on a running node requires restart")
+	}
+	keyringLock.Lock()
+	defer keyringLock.Unlock()
+	keys := append([][]byte{primary}, secondaries...)
+	for _, key := range keys {
+		if err = keyring.AddKey(key); err != nil {
+			return err
+		}
+	}
+	if primaryChanged {
+		if err = keyring.UseKey(primary); err != nil {
+			return err
+		}
+	}
+	current := keyring.GetPrimaryKey()
+	for _, old := range envKeys {
+		if containsKey(keys, old) || bytes.Equal(old, current) {
+			continue
+		}
+		if _, ok := apiKeys[KeyFingerprint(old)]; ok {
+			continue
+		}
+		if err = keyring.RemoveKey(old); err != nil {
+			return err
+		}
+	}
+	envKeys = keys
+	if mlist != nil {
+		publishKeyringStatus()
+	}
+	return nil
+}
+
+func containsKey(keys [][]byte, key []byte) bool {
+	for _, item := range keys {
+		if bytes.Equal(item, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// setGddMemTLS wraps TCP connections between nodes with mutual TLS if GDD_MEM_TLS_CERT_FILE is set
+func setGddMemTLS(conf *memberlist.Config) error {
+	certFile := config.GddMemTlsCertFile.Load()
+	if stringutils.IsEmpty(certFile) {
+		return nil
+	}
+	keyFile := config.GddMemTlsKeyFile.Load()
+	caFile := config.GddMemTlsCaFile.Load()
+	if stringutils.IsEmpty(keyFile) || stringutils.IsEmpty(caFile) {
+		return errors.Errorf("[odin] %s and %s are required by %s", config.GddMemTlsKeyFile, config.GddMemTlsCaFile, config.GddMemTlsCertFile)
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return errors.Wrap(err, "[odin] failed to load memberlist certificate")
+	}
+	ca, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return errors.Errorf("[odin] no certificate found in %s", caFile)
+	}
+	transport, err := memberlist.NewTLSTransport(&memberlist.NetTransportConfig{
+		BindAddrs: []string{conf.BindAddr},
+		BindPort:  conf.BindPort,
+		Logger:    log.New(conf.LogOutput, "", log.LstdFlags),
+	}, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ServerName:   config.GddMemTlsServerName.Load(),
+		MinVersion:   tls.VersionTLS12,
+	})
+	if err != nil {
+		return err
+	}
+	if conf.BindPort == 0 {
+		conf.BindPort = transport.GetAutoBindPort()
+		conf.AdvertisePort = conf.BindPort
+	}
+	conf.Transport = transport
+	return nil
+}
+
+func localKeyringStatus(keyring *memberlist.Keyring) KeyringStatus {
+	var status KeyringStatus
+	for _, key := range keyring.GetKeys() {
+		status.Keys = append(status.Keys, KeyFingerprint(key))
+	}
+	if primary := keyring.GetPrimaryKey(); primary != nil {
+		status.PrimaryKey = KeyFingerprint(primary)
+	}
+	return status
+}
+
+// publishKeyringStatus reports keyring of local node to other nodes by the replicated key/value map
+func publishKeyringStatus() {
+	keyring := mlist.Config().Keyring
+	if keyring == nil {
+		return
+	}
+	value, _ := json.Marshal(localKeyringStatus(keyring))
+	if err := KVSet(keyringKVPrefix+mlist.LocalNode().Name, value); err != nil {
+		logger.Error().Err(err).Msg("[odin] failed to publish keyring status")
+	}
+}
+
+// applyKeyOp applies op to keyring of local node
+func applyKeyOp(op keyOp) error {
+	keyring := mlist.Config().Keyring
+	if keyring == nil || len(keyring.GetKeys()) == 0 {
+		return ErrKeyringDisabled
+	}
+	key, err := decodeKey(op.Key)
+	if err != nil {
+		return err
+	}
+	keyringLock.Lock()
+	switch op.Op {
+	case keyOpInstall:
+		if err = keyring.AddKey(key); err == nil {
+			apiKeys[KeyFingerprint(key)] = key
+		}
+	case keyOpUse:
+		if err = keyring.UseKey(key); err == nil {
+			apiKeys[KeyFingerprint(key)] = key
+		}
+	case keyOpRemove:
+		if err = keyring.RemoveKey(key); err == nil {
+			delete(apiKeys, KeyFingerprint(key))
+		}
+	default:
+		err = errors.Errorf("[odin] unknown key operation %s", op.Op)
+	}
+	keyringLock.Unlock()
+	if err != nil {
+		return err
+	}
+	publishKeyringStatus()
+	return nil
+}
+
+// handleKeyringEvent applies key operations fired by other nodes
+func handleKeyringEvent(e UserEvent) {
+	if e.Origin == mlist.LocalNode().Name {
+		return
+	}
+	var op keyOp
+	if err := json.Unmarshal(e.Payload, &op); err != nil {
+		logger.Error().Err(err).Msgf("[odin] failed to decode key operation from %s", e.Origin)
+		return
+	}
+	if err := applyKeyOp(op); err != nil {
+		logger.Error().Err(err).Msgf("[odin] failed to %s key from %s", op.Op, e.Origin)
+		return
+	}
+	logger.Info().Msgf("[odin] %s key %s requested by %s", op.Op, keyFingerprintOf(op.Key), e.Origin)
+}
+
+func keyFingerprintOf(key string) string {
+	raw, err := decodeKey(key)
+	if err != nil {
+		return ""
+	}
+	return KeyFingerprint(raw)
+}
+
+// fireKeyOp applies op locally and distributes it to all nodes. Keys are gossiped, so gossip must be encrypted.
+func fireKeyOp(op keyOp) error {
+	assertMlistNotNil()
+	if !mlist.Config().EncryptionEnabled() || !mlist.Config().GossipVerifyOutgoing {
+		return ErrKeyringDisabled
+	}
+	if err := applyKeyOp(op); err != nil {
+		return err
+	}
+	payload, _ := json.Marshal(op)
+	return FireUserEvent(keyringEventName, payload)
+}
+
+// ListKeys returns keyrings reported by live nodes by node name, nodes which haven't reported yet are missing
+func ListKeys() (map[string]KeyringStatus, error) {
+	assertMlistNotNil()
+	if !mlist.Config().EncryptionEnabled() {
+		return nil, ErrKeyringDisabled
+	}
+	ret := make(map[string]KeyringStatus)
+	for _, node := range mlist.Members() {
+		value, ok := KVGet(keyringKVPrefix + node.Name)
+		if !ok {
+			continue
+		}
+		var status KeyringStatus
+		if err := json.Unmarshal(value, &status); err != nil {
+			continue
+		}
+		ret[node.Name] = status
+	}
+	ret[mlist.LocalNode().Name] = localKeyringStatus(mlist.Config().Keyring)
+	return ret, nil
+}
+
+// nodesWithout returns sorted names of live nodes whose keyring doesn't satisfy pred
+func nodesWithout(pred func(KeyringStatus) bool) ([]string, error) {
+	statuses, err := ListKeys()
+	if err != nil {
+		return nil, err
+	}
+	var nodes []string
+	for _, node := range mlist.Members() {
+		if status, ok := statuses[node.Name]; !ok || !pred(status) {
+			nodes = append(nodes, node.Name)
+		}
+	}
+	sort.Strings(nodes)
+	return nodes, nil
+}
+
+// InstallKey installs base64 encoded key on all nodes in the cluster for decryption. It is the first step of
+// key rotation, call ListKeys to check that all nodes have installed it before UseKey.
+func InstallKey(key string) error {
+	return fireKeyOp(keyOp{Op: keyOpInstall, Key: key})
+}
+
+// UseKey makes base64 encoded key the primary key for encryption on all nodes in the cluster.
+// It fails if any live node hasn't installed the key, which couldn't decrypt messages then.
+func UseKey(key string) error {
+	raw, err := decodeKey(key)
+	if err != nil {
+		return err
+	}
+	fingerprint := KeyFingerprint(raw)
+	missing, err := nodesWithout(func(status KeyringStatus) bool {
+		return status.has(fingerprint)
+	})
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return errors.Wrapf(ErrUnsafeKeyOp, "key %s is not installed on nodes %v", fingerprint, missing)
+	}
+	return fireKeyOp(keyOp{Op: keyOpUse, Key: key})
+}
+
+// RemoveKey removes base64 encoded key from all nodes in the cluster. It is the last step of key rotation,
+// it fails if any live node still uses the key as primary key.
+func RemoveKey(key string) error {
+	raw, err := decodeKey(key)
+	if err != nil {
+		return err
+	}
+	fingerprint := KeyFingerprint(raw)
+	using, err := nodesWithout(func(status KeyringStatus) bool {
+		return status.PrimaryKey != fingerprint
+	})
+	if err != nil {
+		return err
+	}
+	if len(using) > 0 {
+		return errors.Wrapf(ErrUnsafeKeyOp, "key %s is the primary key of nodes %v", fingerprint, using)
+	}
+	return fireKeyOp(keyOp{Op: keyOpRemove, Key: key})
+}
@@ -0,0 +1,208 @@
+package memberlist
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/apolloconfig/agollo/v4/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/youminxue/odin/framework/internal/config"
+	"github.com/youminxue/odin/toolkit/memberlist"
+	"github.com/youminxue/odin/toolkit/memberlist/mock"
+)
+
+func testKey(b byte) ([]byte, string) {
+	key := make([]byte, 16)
+	for i := range key {
+		key[i] = b
+	}
+	return key, base64.StdEncoding.EncodeToString(key)
+}
+
+func Test_setGddMemKeys(t *testing.T) {
+	defer os.Unsetenv(string(config.GddMemSecretKey))
+	defer os.Unsetenv(string(config.GddMemSecondaryKeys))
+	k1, s1 := testKey(1)
+	k2, s2 := testKey(2)
+
+	conf := memberlist.DefaultWANConfig()
+	require.NoError(t, setGddMemKeys(conf))
+	require.Nil(t, conf.Keyring)
+
+	config.GddMemSecondaryKeys.Write(s2)
+	require.Error(t, setGddMemKeys(conf))
+
+	config.GddMemSecretKey.Write(s1)
+	require.NoError(t, setGddMemKeys(conf))
+	require.Equal(t, k1, conf.Keyring.GetPrimaryKey())
+	require.Equal(t, [][]byte{k1, k2}, conf.Keyring.GetKeys())
+	require.True(t, conf.GossipVerifyIncoming)
+	require.True(t, conf.GossipVerifyOutgoing)
+
+	config.GddMemSecretKey.Write("abc")
+	require.True(t, errors.Is(setGddMemKeys(conf), ErrInvalidKey))
+}
+
+func Test_reloadGddMemKeys(t *testing.T) {
+	defer os.Unsetenv(string(config.GddMemSecretKey))
+	defer os.Unsetenv(string(config.GddMemSecondaryKeys))
+	k1, s1 := testKey(1)
+	k2, s2 := testKey(2)
+	config.GddMemSecretKey.Write(s1)
+	conf := memberlist.DefaultWANConfig()
+	require.NoError(t, setGddMemKeys(conf))
+
+	config.GddMemSecondaryKeys.Write(s2)
+	require.NoError(t, reloadGddMemKeys(conf, false))
+	require.Equal(t, [][]byte{k1, k2}, conf.Keyring.GetKeys())
+
+	config.GddMemSecretKey.Write(s2)
+	config.GddMemSecondaryKeys.Write(s1)
+	require.NoError(t, reloadGddMemKeys(conf, true))
+	require.Equal(t, k2, conf.Keyring.GetPrimaryKey())
+
+	_ = os.Unsetenv(string(config.GddMemSecondaryKeys))
+	require.NoError(t, reloadGddMemKeys(conf, false))
+	require.Equal(t, [][]byte{k2}, conf.Keyring.GetKeys())
+
+	_ = os.Unsetenv(string(config.GddMemSecretKey))
+	require.Error(t, reloadGddMemKeys(conf, true))
+
+	// enabling encryption requires restart
+	config.GddMemSecretKey.Write(s1)
+	require.Error(t, reloadGddMemKeys(memberlist.DefaultWANConfig(), true))
+}
+
+// setupKeyringCluster makes local node a and remote node b share keyring with primary key k1
+func setupKeyringCluster(t *testing.T) (*memberlist.Config, func()) {
+	k1, _ := testKey(1)
+	keyring, err := memberlist.NewKeyring(nil, k1)
+	require.NoError(t, err)
+	conf := memberlist.DefaultWANConfig()
+	conf.Keyring = keyring
+
+	ctrl := gomock.NewController(t)
+	mm := mock.NewMockIMemberlist(ctrl)
+	local := &memberlist.Node{Name: "a"}
+	mm.EXPECT().Config().Return(conf).AnyTimes()
+	mm.EXPECT().LocalNode().Return(local).AnyTimes()
+	mm.EXPECT().Members().Return([]*memberlist.Node{local, {Name: "b"}}).AnyTimes()
+	oldMlist, oldDelegator := mlist, delegator
+	mlist, delegator = mm, newTestDelegate()
+	reportKeyring(t, "b", KeyringStatus{PrimaryKey: KeyFingerprint(k1), Keys: []string{KeyFingerprint(k1)}})
+	return conf, func() {
+		mlist, delegator = oldMlist, oldDelegator
+		ctrl.Finish()
+	}
+}
+
+func reportKeyring(t *testing.T, node string, status KeyringStatus) {
+	value, _ := json.Marshal(status)
+	require.NoError(t, delegator.setKV(node, keyringKVPrefix+node, value, false))
+}
+
+func TestKeyRotation(t *testing.T) {
+	conf, teardown := setupKeyringCluster(t)
+	defer teardown()
+	k1, s1 := testKey(1)
+	k2, s2 := testKey(2)
+
+	require.NoError(t, InstallKey(s2))
+	require.Equal(t, [][]byte{k1, k2}, conf.Keyring.GetKeys())
+
+	// b hasn't installed k2 yet
+	err := UseKey(s2)
+	require.True(t, errors.Is(err, ErrUnsafeKeyOp))
+	require.Equal(t, k1, conf.Keyring.GetPrimaryKey())
+
+	reportKeyring(t, "b", KeyringStatus{PrimaryKey: KeyFingerprint(k1), Keys: []string{KeyFingerprint(k1), KeyFingerprint(k2)}})
+	require.NoError(t, UseKey(s2))
+	require.Equal(t, k2, conf.Keyring.GetPrimaryKey())
+
+	// b still encrypts with k1
+	err = RemoveKey(s1)
+	require.True(t, errors.Is(err, ErrUnsafeKeyOp))
+
+	reportKeyring(t, "b", KeyringStatus{PrimaryKey: KeyFingerprint(k2), Keys: []string{KeyFingerprint(k1), KeyFingerprint(k2)}})
+	require.NoError(t, RemoveKey(s1))
+	require.Equal(t, [][]byte{k2}, conf.Keyring.GetKeys())
+
+	keys, err := ListKeys()
+	require.NoError(t, err)
+	require.Equal(t, KeyringStatus{PrimaryKey: KeyFingerprint(k2), Keys: []string{KeyFingerprint(k2)}}, keys["a"])
+
+	require.True(t, errors.Is(InstallKey("abc"), ErrInvalidKey))
+}
+
+func TestKeyRotation_disabled(t *testing.T) {
+	conf, teardown := setupKeyringCluster(t)
+	defer teardown()
+	_, s2 := testKey(2)
+
+	conf.GossipVerifyOutgoing = false
+	require.True(t, errors.Is(InstallKey(s2), ErrKeyringDisabled))
+
+	conf.Keyring = nil
+	_, err := ListKeys()
+	require.True(t, errors.Is(err, ErrKeyringDisabled))
+}
+
+func Test_handleKeyringEvent(t *testing.T) {
+	conf, teardown := setupKeyringCluster(t)
+	defer teardown()
+	k2, s2 := testKey(2)
+
+	payload, _ := json.Marshal(keyOp{Op: keyOpInstall, Key: s2})
+	handleKeyringEvent(UserEvent{Name: keyringEventName, Origin: "b", Payload: payload})
+	require.Len(t, conf.Keyring.GetKeys(), 2)
+
+	payload, _ = json.Marshal(keyOp{Op: keyOpUse, Key: s2})
+	handleKeyringEvent(UserEvent{Name: keyringEventName, Origin: "a", Payload: payload})
+	require.NotEqual(t, k2, conf.Keyring.GetPrimaryKey())
+
+	handleKeyringEvent(UserEvent{Name: keyringEventName, Origin: "b", Payload: payload})
+	require.Equal(t, k2, conf.Keyring.GetPrimaryKey())
+	value, ok := delegator.kv.get(keyringKVPrefix + "a")
+	require.True(t, ok)
+	var status KeyringStatus
+	require.NoError(t, json.Unmarshal(value, &status))
+	require.Equal(t, KeyFingerprint(k2), status.PrimaryKey)
+}
+
+func TestKeyRotation_reloadUnrelatedConfig(t *testing.T) {
+	conf, teardown := setupKeyringCluster(t)
+	defer teardown()
+	defer os.Unsetenv(string(config.GddMemSecretKey))
+	defer os.Unsetenv(string(config.GddMemSecondaryKeys))
+	defer os.Unsetenv(string(config.GddMemProbeInterval))
+	k1, s1 := testKey(1)
+	k2, s2 := testKey(2)
+	k3, s3 := testKey(3)
+	config.GddMemSecretKey.Write(s1)
+	envKeys = [][]byte{k1}
+
+	require.NoError(t, InstallKey(s2))
+	reportKeyring(t, "b", KeyringStatus{PrimaryKey: KeyFingerprint(k1), Keys: []string{KeyFingerprint(k1), KeyFingerprint(k2)}})
+	require.NoError(t, UseKey(s2))
+	reportKeyring(t, "b", KeyringStatus{PrimaryKey: KeyFingerprint(k2), Keys: []string{KeyFingerprint(k1), KeyFingerprint(k2)}})
+	require.NoError(t, RemoveKey(s1))
+
+	listener := &memConfigListener{memConf: conf}
+	listener.SkippedFirstEvent = true
+	listener.OnChange(&storage.ChangeEvent{Changes: map[string]*storage.ConfigChange{
+		"gdd.mem.probe.interval": {NewValue: "2s", ChangeType: storage.MODIFIED},
+	}})
+	require.Equal(t, k2, conf.Keyring.GetPrimaryKey())
+	require.Equal(t, [][]byte{k2}, conf.Keyring.GetKeys())
+
+	// changing secondary keys neither switches primary key nor removes keys installed by api
+	listener.OnChange(&storage.ChangeEvent{Changes: map[string]*storage.ConfigChange{
+		"gdd.mem.secondary.keys": {NewValue: s3, ChangeType: storage.ADDED},
+	}})
+	require.Equal(t, k2, conf.Keyring.GetPrimaryKey())
+	require.ElementsMatch(t, [][]byte{k1, k2, k3}, conf.Keyring.GetKeys())
+}
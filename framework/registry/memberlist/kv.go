@@ -0,0 +1,298 @@
+package memberlist
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/youminxue/odin/toolkit/memberlist"
+	logger "github.com/youminxue/odin/toolkit/zlogger"
+)
+
+// KVSizeLimit is the max size in bytes of key and value of an entry in the replicated key/value map
+const KVSizeLimit = 512
+
+// kvDispatchSize is the number of changes waiting for watchers, more are dropped
+const kvDispatchSize = 1024
+
+// kvStateSizeLimit is the max size in bytes of entries sent by push/pull state, newest entries are sent first
+const kvStateSizeLimit = 256 * 1024
+
+// kvEntryOverhead is the approximate encoded size of an entry besides key, value and node name
+const kvEntryOverhead = 32
+
+// kvDefaultTombstoneTTL is how long tombstones are kept before collected if not set by newKVStore
+const kvDefaultTombstoneTTL = 5 * time.Minute
+
+// kvEntry is a versioned entry of the replicated key/value map. Deleted entries are kept as tombstones until
+// collected by kvStore.reap, so that stale values from other nodes don't come back.
+type kvEntry struct {
+	Key     string `json:"key"`
+	Value   []byte `json:"value,omitempty"`
+	LTime   uint64 `json:"ltime"`
+	Node    string `json:"node"`
+	Deleted bool   `json:"deleted,omitempty"`
+	// deletedAt is when the tombstone was applied locally, it is not replicated
+	deletedAt time.Time
+}
+
+func (e kvEntry) size() int {
+	return len(e.Key) + len(e.Value) + len(e.Node) + kvEntryOverhead
+}
+
+// newerThan implements last-writer-wins, ties of lamport time are broken by node name
+func (e kvEntry) newerThan(other kvEntry) bool {
+	if e.LTime != other.LTime {
+		return e.LTime > other.LTime
+	}
+	return e.Node > other.Node
+}
+
+// KVChange is a change of the replicated key/value map
+type KVChange struct {
+	Key   string
+	Value []byte
+	// Deleted is true if the key is deleted, Value is nil then
+	Deleted bool
+	// Node is the name of the node which made the change
+	Node string
+}
+
+// kvStore is an eventually consistent key/value map, each key is resolved by last-writer-wins
+type kvStore struct {
+	clock        lamportClock
+	lock         sync.RWMutex
+	entries      map[string]kvEntry
+	watchers     map[uint64]func(KVChange)
+	nextId       uint64
+	dispatch     chan KVChange
+	dispatchOnce sync.Once
+	// tombstoneTTL is how long tombstones are kept, they should have reached all nodes by then
+	tombstoneTTL time.Duration
+	lastReap     time.Time
+	now          func() time.Time
+}
+
+// newKVStore creates a kvStore collecting tombstones older than tombstoneTTL, kvDefaultTombstoneTTL is used if it
+// is not positive
+func newKVStore(tombstoneTTL time.Duration) *kvStore {
+	if tombstoneTTL <= 0 {
+		tombstoneTTL = kvDefaultTombstoneTTL
+	}
+	return &kvStore{
+		entries:      make(map[string]kvEntry),
+		watchers:     make(map[uint64]func(KVChange)),
+		dispatch:     make(chan KVChange, kvDispatchSize),
+		tombstoneTTL: tombstoneTTL,
+		now:          time.Now,
+	}
+}
+
+// kvTombstoneTTL keeps tombstones for GossipToTheDeadTime, but no less than two push/pull intervals, so that nodes
+// missing the broadcast of a deletion get the tombstone by state sync
+func kvTombstoneTTL(conf *memberlist.Config) time.Duration {
+	ttl := conf.GossipToTheDeadTime
+	if ttl < 2*conf.PushPullInterval {
+		ttl = 2 * conf.PushPullInterval
+	}
+	return ttl
+}
+
+// reap collects tombstones older than tombstoneTTL at most once per half of it, it must be called with lock held.
+// A value deleted by a collected tombstone may come back from a node which has been partitioned since before the
+// deletion, as in other gossip based stores.
+func (s *kvStore) reap() {
+	now := s.now()
+	if now.Sub(s.lastReap) < s.tombstoneTTL/2 {
+		return
+	}
+	s.lastReap = now
+	for key, e := range s.entries {
+		if e.Deleted && now.Sub(e.deletedAt) >= s.tombstoneTTL {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// newEntry creates an entry changed by local node
+func (s *kvStore) newEntry(node, key string, value []byte, deleted bool) (kvEntry, error) {
+	if key == "" {
+		return kvEntry{}, errors.New("[odin] key must not be empty")
+	}
+	if len(key)+len(value) > KVSizeLimit {
+		return kvEntry{}, errors.Errorf("[odin] key/value entry %s exceeds size limit of %d bytes", key, KVSizeLimit)
+	}
+	return kvEntry{
+		Key:     key,
+		Value:   value,
+		LTime:   s.clock.Increment(),
+		Node:    node,
+		Deleted: deleted,
+	}, nil
+}
+
+// apply stores e if it is newer than the stored one and notifies watchers, it returns false if e is stale,
+// otherwise e should be broadcast to other nodes
+func (s *kvStore) apply(e kvEntry) bool {
+	s.clock.Witness(e.LTime)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.reap()
+	if cur, ok := s.entries[e.Key]; ok && !e.newerThan(cur) {
+		return false
+	}
+	if e.Deleted {
+		e.deletedAt = s.now()
+	}
+	s.entries[e.Key] = e
+
+	s.dispatchOnce.Do(func() {
+		go s.loop()
+	})
+	change := KVChange{
+		Key:     e.Key,
+		Value:   e.Value,
+		Deleted: e.Deleted,
+		Node:    e.Node,
+	}
+	select {
+	case s.dispatch <- change:
+	default:
+		logger.Warn().Msgf("[odin] too many key/value changes waiting for watchers, change of %s is dropped", e.Key)
+	}
+	return true
+}
+
+func (s *kvStore) loop() {
+	for change := range s.dispatch {
+		s.lock.RLock()
+		watchers := make([]func(KVChange), 0, len(s.watchers))
+		for _, watcher := range s.watchers {
+			watchers = append(watchers, watcher)
+		}
+		s.lock.RUnlock()
+		for _, watcher := range watchers {
+			watcher(change)
+		}
+	}
+}
+
+func (s *kvStore) get(key string) ([]byte, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	e, ok := s.entries[key]
+	if !ok || e.Deleted {
+		return nil, false
+	}
+	return e.Value, true
+}
+
+func (s *kvStore) keys() []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	var keys []string
+	for key, e := range s.entries {
+		if !e.Deleted {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// snapshot returns entries including tombstones for push/pull state, newest first up to kvStateSizeLimit bytes.
+// Entries left out are still delivered by broadcasts, or by state of other nodes.
+func (s *kvStore) snapshot() []kvEntry {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.reap()
+	entries := make([]kvEntry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].newerThan(entries[j])
+	})
+	size := 0
+	for i, e := range entries {
+		if size += e.size(); size > kvStateSizeLimit {
+			logger.Warn().Msgf("[odin] key/value map exceeds state size limit of %d bytes, %d older entries are not synced by state",
+				kvStateSizeLimit, len(entries)-i)
+			return entries[:i]
+		}
+	}
+	return entries
+}
+
+func (s *kvStore) watch(watcher func(KVChange)) func() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.nextId++
+	id := s.nextId
+	s.watchers[id] = watcher
+	return func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		delete(s.watchers, id)
+	}
+}
+
+// kvBroadcast invalidates queued broadcasts of the same key, which carry older entries
+type kvBroadcast struct {
+	key string
+	msg []byte
+}
+
+func (b *kvBroadcast) Invalidates(other memberlist.Broadcast) bool {
+	if o, ok := other.(*kvBroadcast); ok {
+		return b.key == o.key
+	}
+	return false
+}
+
+func (b *kvBroadcast) Name() string {
+	return "kv:" + b.key
+}
+
+func (b *kvBroadcast) Message() []byte {
+	return b.msg
+}
+
+func (b *kvBroadcast) Finished() {
+}
+
+// KVSet sets value of key in the key/value map replicated to all nodes in the cluster. Concurrent writes of the same
+// key from different nodes are resolved by last-writer-wins on lamport time. The map is meant for small data such as
+// feature flags and config fan-out, keep it small as it is fully replicated to every node.
+func KVSet(key string, value []byte) error {
+	assertMlistNotNil()
+	return delegator.setKV(mlist.LocalNode().Name, key, value, false)
+}
+
+// KVDelete deletes key from the replicated key/value map
+func KVDelete(key string) error {
+	assertMlistNotNil()
+	return delegator.setKV(mlist.LocalNode().Name, key, nil, true)
+}
+
+// KVGet returns value of key from local replica of the key/value map
+func KVGet(key string) ([]byte, bool) {
+	assertMlistNotNil()
+	return delegator.kv.get(key)
+}
+
+// KVKeys returns sorted keys of local replica of the key/value map
+func KVKeys() []string {
+	assertMlistNotNil()
+	return delegator.kv.keys()
+}
+
+// WatchKV calls watcher with changes of the replicated key/value map made by any node, including local node.
+// Watchers are called one by one in a separate goroutine, so they should return quickly.
+// Call the returned function to stop watching.
+func WatchKV(watcher func(KVChange)) func() {
+	assertMlistNotNil()
+	return delegator.kv.watch(watcher)
+}
@@ -0,0 +1,130 @@
+package memberlist
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/youminxue/odin/toolkit/memberlist"
+)
+
+func TestKVSet(t *testing.T) {
+	a, b := newTestDelegate(), newTestDelegate()
+	changes := make(chan KVChange, 10)
+	b.kv.watch(func(change KVChange) {
+		changes <- change
+	})
+
+	require.NoError(t, a.setKV("a", "flag", []byte("on"), false))
+	gossip(a, b)
+	value, ok := b.kv.get("flag")
+	require.True(t, ok)
+	require.Equal(t, []byte("on"), value)
+	select {
+	case change := <-changes:
+		require.Equal(t, "flag", change.Key)
+		require.Equal(t, "a", change.Node)
+	case <-time.After(time.Second):
+		t.Fatal("key/value change not received")
+	}
+
+	require.NoError(t, b.setKV("b", "flag", nil, true))
+	gossip(b, a)
+	_, ok = a.kv.get("flag")
+	require.False(t, ok)
+	require.Empty(t, a.kv.keys())
+
+	require.Error(t, a.setKV("a", "", nil, false))
+	require.Error(t, a.setKV("a", "big", make([]byte, KVSizeLimit), false))
+}
+
+func TestKVLastWriterWins(t *testing.T) {
+	a, b := newTestDelegate(), newTestDelegate()
+	// concurrent writes at the same lamport time are resolved by node name
+	require.NoError(t, a.setKV("a", "flag", []byte("a"), false))
+	require.NoError(t, b.setKV("b", "flag", []byte("b"), false))
+	msgsA := a.GetBroadcasts(0, 65535)
+	msgsB := b.GetBroadcasts(0, 65535)
+	for _, msg := range msgsB {
+		a.NotifyMsg(msg)
+	}
+	for _, msg := range msgsA {
+		b.NotifyMsg(msg)
+	}
+	valueA, _ := a.kv.get("flag")
+	valueB, _ := b.kv.get("flag")
+	require.Equal(t, []byte("b"), valueA)
+	require.Equal(t, []byte("b"), valueB)
+
+	// stale entries are neither applied nor rebroadcast
+	require.Equal(t, 0, b.queue.NumQueued())
+
+	// later write wins regardless of node name
+	require.NoError(t, a.setKV("a", "flag", []byte("a2"), false))
+	gossip(a, b)
+	valueB, _ = b.kv.get("flag")
+	require.Equal(t, []byte("a2"), valueB)
+}
+
+func TestKVMergeRemoteState(t *testing.T) {
+	a, b := newTestDelegate(), newTestDelegate()
+	require.NoError(t, a.setKV("a", "x", []byte("1"), false))
+	require.NoError(t, a.setKV("a", "y", []byte("2"), false))
+	require.NoError(t, a.setKV("a", "y", nil, true))
+
+	b.MergeRemoteState(a.LocalState(false), false)
+	require.Equal(t, []string{"x"}, b.kv.keys())
+	_, ok := b.kv.get("y")
+	require.False(t, ok)
+
+	// tombstones prevent deleted values from coming back
+	require.NoError(t, b.setKV("b", "z", []byte("3"), false))
+	a.MergeRemoteState(b.LocalState(false), false)
+	require.Equal(t, []string{"x", "z"}, a.kv.keys())
+
+	require.NotPanics(t, func() {
+		(&delegate{}).MergeRemoteState([]byte("bad state"), false)
+		a.MergeRemoteState([]byte("bad state"), false)
+	})
+}
+
+func TestKVTombstoneReap(t *testing.T) {
+	a := newTestDelegate()
+	now := time.Now()
+	a.kv.now = func() time.Time {
+		return now
+	}
+	require.NoError(t, a.setKV("a", "x", []byte("1"), false))
+	require.NoError(t, a.setKV("a", "y", []byte("2"), false))
+	require.NoError(t, a.setKV("a", "y", nil, true))
+	require.Len(t, a.kv.snapshot(), 2)
+
+	now = now.Add(kvDefaultTombstoneTTL)
+	entries := a.kv.snapshot()
+	require.Len(t, entries, 1)
+	require.Equal(t, "x", entries[0].Key)
+}
+
+func TestKVSnapshotSizeLimit(t *testing.T) {
+	a := newTestDelegate()
+	value := make([]byte, KVSizeLimit-8)
+	n := kvStateSizeLimit/(KVSizeLimit+kvEntryOverhead) + 10
+	for i := 0; i < n; i++ {
+		require.NoError(t, a.setKV("a", fmt.Sprintf("key%05d", i), value, false))
+	}
+	entries := a.kv.snapshot()
+	require.Less(t, len(entries), n)
+	size := 0
+	for _, e := range entries {
+		size += e.size()
+	}
+	require.LessOrEqual(t, size, kvStateSizeLimit)
+	// newest entries are sent first
+	require.Equal(t, fmt.Sprintf("key%05d", n-1), entries[0].Key)
+}
+
+func TestKVTombstoneTTL(t *testing.T) {
+	require.Equal(t, 2*time.Minute, kvTombstoneTTL(&memberlist.Config{GossipToTheDeadTime: time.Minute, PushPullInterval: time.Minute}))
+	require.Equal(t, 10*time.Minute, kvTombstoneTTL(&memberlist.Config{GossipToTheDeadTime: 10 * time.Minute, PushPullInterval: time.Minute}))
+}
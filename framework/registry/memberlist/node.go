@@ -11,14 +11,17 @@ import (
 	"github.com/youminxue/odin/framework/configmgr"
 	"github.com/youminxue/odin/framework/internal/config"
 	cons "github.com/youminxue/odin/framework/registry/constants"
+	"github.com/youminxue/odin/framework/registry/utils"
 	"github.com/youminxue/odin/toolkit/cast"
 	"github.com/youminxue/odin/toolkit/constants"
+	"github.com/youminxue/odin/toolkit/loadbalance"
 	"github.com/youminxue/odin/toolkit/memberlist"
 	"github.com/youminxue/odin/toolkit/stringutils"
 	logger "github.com/youminxue/odin/toolkit/zlogger"
 	"io/ioutil"
 	"os"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -43,6 +46,12 @@ func init() {
 		return
 	}
 	mconf = newConf()
+	if err := setGddMemKeys(mconf); err != nil {
+		panic(errors.Wrap(err, "[odin] Failed to set gossip encryption keys"))
+	}
+	if err := setGddMemTLS(mconf); err != nil {
+		panic(errors.Wrap(err, "[odin] Failed to create TLS transport"))
+	}
 	queue := &memberlist.TransmitLimitedQueue{
 		NumNodes:             numNodes,
 		RetransmitMultGetter: retransmitMultGetter,
@@ -74,7 +83,9 @@ func init() {
 			BuildTime:  buildTime,
 			Weight:     weight,
 		},
-		queue: queue,
+		queue:      queue,
+		userEvents: newUserEventStore(),
+		kv:         newKVStore(kvTombstoneTTL(mconf)),
 	}
 	mconf.Delegate = delegator
 	mconf.Events = events
@@ -86,6 +97,8 @@ func init() {
 		mlist.Shutdown()
 		panic(errors.Wrap(err, "[odin] Node register failed"))
 	}
+	delegator.userEvents.subscribe(keyringEventName, handleKeyringEvent)
+	publishKeyringStatus()
 	local := mlist.LocalNode()
 	logger.Info().Msgf("memberlist created. local node is Node %s, memberlist port %s", local.Name, fmt.Sprint(local.Port))
 	registerConfigListener(mconf)
@@ -193,6 +206,9 @@ func newConf() *memberlist.Config {
 	setGddMemRetransmitMult(cfg)
 	setGddMemGossipNodes(cfg)
 	setGddMemGossipInterval(cfg)
+	setGddMemDynamicProbeTimeout(cfg)
+	setGddMemDynamicPacketSize(cfg)
+	setGddMemCoordinates(cfg)
 	// if env GDD_MEM_WEIGHT is set to > 0, then disable weight calculation, client will always use the same weight
 	weight := config.DefaultGddWeight
 	if stringutils.IsNotEmpty(config.GddWeight.Load()) {
@@ -275,11 +291,10 @@ func NewRest(data ...map[string]interface{}) {
 		Host:          mlist.AdvertiseAddr(),
 		Port:          int(httpPort),
 		RouteRootPath: rr,
+		Scheme:        config.GetScheme(),
 		Type:          cons.REST_TYPE,
 	}
-	if len(data) > 0 {
-		si.Data = data[0]
-	}
+	si.Data = serviceData(data...)
 	delegator.AddService(si)
 	if err := mlist.UpdateNode(mlist.Config().TCPTimeout); err != nil {
 		panic(errors.Wrapf(err, "[odin] failed to register %s service to memberlist", service))
@@ -287,19 +302,34 @@ func NewRest(data ...map[string]interface{}) {
 	logger.Info().Msgf("[odin] registered %s service to memberlist successfully", service)
 }
 
+// serviceData returns user data of service with zone added if GDD_ZONE is set
+func serviceData(data ...map[string]interface{}) map[string]interface{} {
+	var ret map[string]interface{}
+	if len(data) > 0 {
+		ret = data[0]
+	}
+	if zone := config.GddZone.Load(); stringutils.IsNotEmpty(zone) {
+		copied := make(map[string]interface{}, len(ret)+1)
+		for k, v := range ret {
+			copied[k] = v
+		}
+		copied[loadbalance.MetaZone] = zone
+		ret = copied
+	}
+	return ret
+}
+
 func NewGrpc(data ...map[string]interface{}) {
 	assertMlistNotNil()
 	service := config.GetServiceName() + "_" + string(cons.GRPC_TYPE)
-	grpcPort := config.GetGrpcPort()
+	grpcPort := utils.GetGrpcRegisterPort()
 	si := Service{
 		Name: service,
 		Host: mlist.AdvertiseAddr(),
 		Port: int(grpcPort),
 		Type: cons.GRPC_TYPE,
 	}
-	if len(data) > 0 {
-		si.Data = data[0]
-	}
+	si.Data = serviceData(data...)
 	delegator.AddService(si)
 	if err := mlist.UpdateNode(mlist.Config().TCPTimeout); err != nil {
 		panic(errors.Wrapf(err, "[odin] failed to register %s service to memberlist", service))
@@ -307,6 +337,29 @@ func NewGrpc(data ...map[string]interface{}) {
 	logger.Info().Msgf("[odin] registered %s service to memberlist successfully", service)
 }
 
+// MarkUnhealthyRest marks the rest service of local node unhealthy, so that other nodes stop selecting it
+// before the node leaves the cluster
+func MarkUnhealthyRest() {
+	markUnhealthy(cons.REST_TYPE)
+}
+
+// MarkUnhealthyGrpc marks the grpc service of local node unhealthy like MarkUnhealthyRest
+func MarkUnhealthyGrpc() {
+	markUnhealthy(cons.GRPC_TYPE)
+}
+
+func markUnhealthy(t cons.ServiceType) {
+	if mlist == nil {
+		return
+	}
+	delegator.MarkUnhealthy(t)
+	if err := mlist.UpdateNode(mlist.Config().TCPTimeout); err != nil {
+		logger.Error().Err(err).Msgf("[odin] failed to mark %s service unhealthy in memberlist", t)
+		return
+	}
+	logger.Info().Msgf("[odin] marked %s service unhealthy in memberlist successfully", t)
+}
+
 type memConfigListener struct {
 	configmgr.BaseApolloListener
 	memConf *memberlist.Config
@@ -319,9 +372,11 @@ func (c *memConfigListener) OnChange(event *storage.ChangeEvent) {
 		c.SkippedFirstEvent = true
 		return
 	}
+	changed := make(map[string]bool)
 	for key, value := range event.Changes {
 		upperKey := strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
 		if strings.HasPrefix(upperKey, "GDD_MEM_") {
+			changed[upperKey] = true
 			if value.ChangeType == storage.DELETED {
 				_ = os.Unsetenv(upperKey)
 				continue
@@ -335,10 +390,19 @@ func (c *memConfigListener) OnChange(event *storage.ChangeEvent) {
 	setGddMemProbeInterval(c.memConf)
 	setGddMemGossipInterval(c.memConf)
 	setGddMemProbeTimeout(c.memConf)
+	setGddMemDynamicProbeTimeout(c.memConf)
 	setGddMemSuspicionMult(c.memConf)
 	setGddMemRetransmitMult(c.memConf)
 	setGddMemGossipNodes(c.memConf)
 	setGddMemIndirectChecks(c.memConf)
+	setGddMemGossipVerify(c.memConf)
+	// keys are reloaded only if they change, or keys rotated by the keyring api would be reverted
+	primaryChanged := changed[string(config.GddMemSecretKey)]
+	if primaryChanged || changed[string(config.GddMemSecondaryKeys)] {
+		if err := reloadGddMemKeys(c.memConf, primaryChanged); err != nil {
+			logger.Error().Err(err).Msg("[odin] failed to reload gossip encryption keys")
+		}
+	}
 }
 
 func CallbackOnChange(listener *memConfigListener) func(event *configmgr.NacosChangeEvent) {
@@ -407,10 +471,91 @@ func RegisterServiceProvider(sp IMemberlistServiceProvider) {
 			sp.AddNode(node)
 		}
 	}
-	events.ServiceProviders = append(events.ServiceProviders, sp)
+	events.addServiceProvider(sp)
+}
+
+// UnregisterServiceProvider stops notifying sp of cluster membership changes
+func UnregisterServiceProvider(sp IMemberlistServiceProvider) {
+	events.removeServiceProvider(sp)
+}
+
+// HasService checks whether any alive node in the cluster is supplying the service specified by name
+func HasService(name string) bool {
+	if mlist == nil {
+		return false
+	}
+	for _, node := range mlist.Members() {
+		meta, _ := ParseMeta(node)
+		for _, service := range meta.Services {
+			if service.Name == name {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 func LocalNode() *memberlist.Node {
 	assertMlistNotNil()
 	return mlist.LocalNode()
 }
+
+// ListInstances returns healthy instances of the service supplied by alive nodes sorted by base url
+func ListInstances(name string) []loadbalance.Instance {
+	if mlist == nil {
+		return nil
+	}
+	var ret []loadbalance.Instance
+	for _, node := range mlist.Members() {
+		meta, _ := ParseMeta(node)
+		for _, service := range meta.Services {
+			if service.Name != name || service.Unhealthy {
+				continue
+			}
+			weight := meta.Weight
+			if weight <= 0 {
+				weight = node.Weight
+			}
+			metadata := make(map[string]string, len(service.Data))
+			for k, v := range service.Data {
+				metadata[k] = fmt.Sprint(v)
+			}
+			ret = append(ret, loadbalance.Instance{
+				BaseUrl:  service.BaseUrl(),
+				Weight:   weight,
+				Metadata: metadata,
+			})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].BaseUrl < ret[j].BaseUrl
+	})
+	return ret
+}
+
+// nodeWatcher calls onChange on cluster membership changes
+type nodeWatcher struct {
+	onChange func()
+}
+
+func (w *nodeWatcher) AddNode(*memberlist.Node) {
+	w.onChange()
+}
+
+func (w *nodeWatcher) UpdateWeight(*memberlist.Node) {
+	w.onChange()
+}
+
+func (w *nodeWatcher) RemoveNode(*memberlist.Node) {
+	w.onChange()
+}
+
+// WatchNodes calls onChange whenever a node joins, leaves or updates, onChange must not block.
+// Call the returned function to stop watching.
+func WatchNodes(onChange func()) func() {
+	w := &nodeWatcher{onChange: onChange}
+	events.addServiceProvider(w)
+	return func() {
+		events.removeServiceProvider(w)
+	}
+}
@@ -3,10 +3,12 @@ package memberlist
 import (
 	"context"
 	"fmt"
+	"github.com/youminxue/odin/toolkit/loadbalance"
 	"github.com/youminxue/odin/toolkit/memberlist"
 	"github.com/youminxue/odin/toolkit/stringutils"
 	logger "github.com/youminxue/odin/toolkit/zlogger"
 	"google.golang.org/grpc"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -25,6 +27,7 @@ type server struct {
 	baseUrl       string
 	weight        int
 	currentWeight int
+	metadata      map[string]string
 }
 
 func (s *server) Weight() int {
@@ -53,8 +56,16 @@ func (m *base) AddNode(node *memberlist.Node) {
 	if stringutils.IsEmpty(service.Name) {
 		return
 	}
+	if service.Unhealthy {
+		m.RemoveNode(node)
+		return
+	}
 	baseUrl := service.BaseUrl()
 	weight := meta.Weight
+	metadata := make(map[string]string, len(service.Data))
+	for k, v := range service.Data {
+		metadata[k] = fmt.Sprint(v)
+	}
 	if s, exists := m.nodeMap[node.Name]; !exists {
 		s = &server{
 			service:       m.name,
@@ -62,6 +73,7 @@ func (m *base) AddNode(node *memberlist.Node) {
 			baseUrl:       baseUrl,
 			weight:        weight,
 			currentWeight: 0,
+			metadata:      metadata,
 		}
 		m.nodes = append(m.nodes, s)
 		m.nodeMap[node.Name] = s
@@ -70,6 +82,7 @@ func (m *base) AddNode(node *memberlist.Node) {
 		old := *s
 		s.baseUrl = baseUrl
 		s.weight = weight
+		s.metadata = metadata
 		logger.Info().Msgf("[odin] node %s update, supplying %s service, old: %+v, new: %+v", node.Name, service.Name, old, *s)
 	}
 }
@@ -90,6 +103,22 @@ func (m *base) UpdateWeight(node *memberlist.Node) {
 	}
 }
 
+// Instances returns all nodes supplying the service sorted by base url
+func (m *base) Instances() []loadbalance.Instance {
+	ret := make([]loadbalance.Instance, 0, len(m.nodes))
+	for _, item := range m.nodes {
+		ret = append(ret, loadbalance.Instance{
+			BaseUrl:  item.baseUrl,
+			Weight:   item.weight,
+			Metadata: item.metadata,
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].BaseUrl < ret[j].BaseUrl
+	})
+	return ret
+}
+
 func (m *base) GetServer(nodeName string) *server {
 	return m.nodeMap[nodeName]
 }
@@ -156,6 +185,18 @@ func (m *RRServiceProvider) SelectServer() string {
 	return selected.baseUrl
 }
 
+// Instances returns all nodes supplying the service for client-side load balancing
+func (m *RRServiceProvider) Instances() []loadbalance.Instance {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.base.Instances()
+}
+
+// Close stops receiving join, leave and weight events of the cluster
+func (m *RRServiceProvider) Close() {
+	UnregisterServiceProvider(m)
+}
+
 // NewRRServiceProvider create an RRServiceProvider instance
 func NewRRServiceProvider(name string) *RRServiceProvider {
 	sp := &RRServiceProvider{
@@ -170,11 +211,30 @@ func NewRRServiceProvider(name string) *RRServiceProvider {
 
 var _ IMemberlistServiceProvider = (*SWRRServiceProvider)(nil)
 
+const (
+	// rttWeightScale scales up weights before they are divided by relative RTT, so that small weights keep precision
+	rttWeightScale = 100
+	// rttFloor treats RTTs below it as equal, so that jitter on a fast network doesn't skew weights
+	rttFloor = time.Millisecond
+)
+
 // SWRRServiceProvider is a smooth weighted round-robin algo implementation for IMemberlistServiceProvider
 // https://github.com/nginx/nginx/commit/52327e0627f49dbda1e8db695e63a4b0af4448b1
+// If network coordinates are enabled by GDD_MEM_COORDINATES, weights are divided by RTT relative to the nearest
+// instance, so that nearby instances are preferred.
 type SWRRServiceProvider struct {
 	base base
 	lock sync.RWMutex
+	// rtt estimates RTT to node
+	rtt func(node string) (time.Duration, bool)
+}
+
+// estimateRTT estimates RTT from local node to node, false if unknown or network coordinates are disabled
+func estimateRTT(node string) (time.Duration, bool) {
+	if mlist == nil || !mlist.Config().EnableCoordinates {
+		return 0, false
+	}
+	return mlist.EstimateRTT(node)
 }
 
 func (m *SWRRServiceProvider) AddNode(node *memberlist.Node) {
@@ -207,10 +267,11 @@ func (m *SWRRServiceProvider) SelectServer() string {
 	}
 	var selected *server
 	total := 0
+	weights := m.effectiveWeights()
 	for i := 0; i < len(m.base.nodes); i++ {
 		s := m.base.nodes[i]
-		s.currentWeight += s.weight
-		total += s.weight
+		s.currentWeight += weights[i]
+		total += weights[i]
 		if selected == nil || s.currentWeight > selected.currentWeight {
 			selected = s
 		}
@@ -219,6 +280,57 @@ func (m *SWRRServiceProvider) SelectServer() string {
 	return selected.baseUrl
 }
 
+// effectiveWeights returns weights of nodes divided by their RTT relative to the nearest node,
+// weights are unchanged if RTTs are unknown
+func (m *SWRRServiceProvider) effectiveWeights() []int {
+	weights := make([]int, len(m.base.nodes))
+	rtts := make([]time.Duration, len(m.base.nodes))
+	var nearest time.Duration
+	for i, s := range m.base.nodes {
+		weights[i] = s.weight
+		if m.rtt == nil {
+			continue
+		}
+		if rtt, ok := m.rtt(s.node); ok {
+			if rtt < rttFloor {
+				rtt = rttFloor
+			}
+			rtts[i] = rtt
+			if nearest == 0 || rtt < nearest {
+				nearest = rtt
+			}
+		}
+	}
+	if nearest == 0 {
+		return weights
+	}
+	for i := range weights {
+		if weights[i] <= 0 {
+			continue
+		}
+		weights[i] *= rttWeightScale
+		if rtts[i] > 0 {
+			weights[i] = int(float64(weights[i]) * float64(nearest) / float64(rtts[i]))
+			if weights[i] < 1 {
+				weights[i] = 1
+			}
+		}
+	}
+	return weights
+}
+
+// Instances returns all nodes supplying the service for client-side load balancing
+func (m *SWRRServiceProvider) Instances() []loadbalance.Instance {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.base.Instances()
+}
+
+// Close stops receiving join, leave and weight events of the cluster
+func (m *SWRRServiceProvider) Close() {
+	UnregisterServiceProvider(m)
+}
+
 // NewSWRRServiceProvider create an SWRRServiceProvider instance
 func NewSWRRServiceProvider(name string) *SWRRServiceProvider {
 	sp := &SWRRServiceProvider{
@@ -226,6 +338,7 @@ func NewSWRRServiceProvider(name string) *SWRRServiceProvider {
 			name:    name,
 			nodeMap: make(map[string]*server),
 		},
+		rtt: estimateRTT,
 	}
 	RegisterServiceProvider(sp)
 	return sp
@@ -1,8 +1,12 @@
 package memberlist
 
 import (
+	"github.com/stretchr/testify/require"
+	"github.com/youminxue/odin/framework/registry/constants"
 	"github.com/youminxue/odin/toolkit/memberlist"
 	"sync"
+	"testing"
+	"time"
 )
 
 type mockServiceProvider struct {
@@ -53,3 +57,71 @@ func newMockServiceProvider(name string) *mockServiceProvider {
 		name:      name,
 	}
 }
+
+func TestRRServiceProvider_unhealthy(t *testing.T) {
+	d := &delegate{}
+	d.AddService(Service{
+		Name: "test_rest",
+		Host: "127.0.0.1",
+		Port: 6060,
+		Type: constants.REST_TYPE,
+	})
+	d.AddService(Service{
+		Name: "test_grpc",
+		Host: "127.0.0.1",
+		Port: 50051,
+		Type: constants.GRPC_TYPE,
+	})
+	node := &memberlist.Node{Name: "node1", Meta: d.NodeMeta(memberlist.MetaMaxSize)}
+	rest := NewRRServiceProvider("test_rest")
+	grpc := NewRRServiceProvider("test_grpc")
+	rest.AddNode(node)
+	grpc.AddNode(node)
+	require.Len(t, rest.Instances(), 1)
+
+	d.MarkUnhealthy(constants.REST_TYPE)
+	node.Meta = d.NodeMeta(memberlist.MetaMaxSize)
+	rest.AddNode(node)
+	grpc.AddNode(node)
+	require.Empty(t, rest.Instances())
+	require.Equal(t, "127.0.0.1:50051", grpc.SelectServer())
+}
+
+func TestSWRRServiceProvider_preferNearby(t *testing.T) {
+	sp := &SWRRServiceProvider{
+		base: base{
+			name:    "test",
+			nodeMap: make(map[string]*server),
+		},
+		rtt: func(node string) (time.Duration, bool) {
+			switch node {
+			case "near":
+				return 100 * time.Microsecond, true
+			case "far":
+				return 9 * time.Millisecond, true
+			}
+			return 0, false
+		},
+	}
+	for _, name := range []string{"near", "far", "unknown"} {
+		d := &delegate{meta: NodeMeta{Weight: 1}}
+		d.AddService(Service{
+			Name: "test",
+			Host: name,
+			Port: 6060,
+			Type: constants.REST_TYPE,
+		})
+		sp.AddNode(&memberlist.Node{Name: name, Meta: d.NodeMeta(memberlist.MetaMaxSize)})
+	}
+	require.Equal(t, []int{100, 11, 100}, sp.effectiveWeights())
+
+	counts := make(map[string]int)
+	for i := 0; i < 211; i++ {
+		counts[sp.SelectServer()]++
+	}
+	require.Equal(t, 100, counts["http://near:6060"])
+	require.Equal(t, 11, counts["http://far:6060"])
+
+	sp.rtt = nil
+	require.Equal(t, []int{1, 1, 1}, sp.effectiveWeights())
+}
@@ -0,0 +1,225 @@
+package memberlist
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/youminxue/odin/toolkit/memberlist"
+	logger "github.com/youminxue/odin/toolkit/zlogger"
+)
+
+// UserEventSizeLimit is the max size in bytes of name and payload of a user event, so that it fits in a gossip packet
+const UserEventSizeLimit = 512
+
+// userEventBufferSize is the number of recent lamport times whose user events are remembered for de-duplication,
+// events older than that are dropped
+const userEventBufferSize = 512
+
+// userEventDispatchSize is the number of received user events waiting for subscribers, more are dropped
+const userEventDispatchSize = 1024
+
+// lamportClock is a thread safe lamport clock, which orders events across nodes without synchronized wall clocks
+type lamportClock struct {
+	counter uint64
+}
+
+// Time returns current time of the clock
+func (c *lamportClock) Time() uint64 {
+	return atomic.LoadUint64(&c.counter)
+}
+
+// Increment increments the clock and returns the new time
+func (c *lamportClock) Increment() uint64 {
+	return atomic.AddUint64(&c.counter, 1)
+}
+
+// Witness moves the clock past v, which is observed from other nodes
+func (c *lamportClock) Witness(v uint64) {
+	for {
+		cur := atomic.LoadUint64(&c.counter)
+		if v < cur {
+			return
+		}
+		if atomic.CompareAndSwapUint64(&c.counter, cur, v+1) {
+			return
+		}
+	}
+}
+
+// UserEvent is an application defined event broadcast to all nodes in the cluster, e.g. for cache invalidation
+type UserEvent struct {
+	// LTime is the lamport time when the event was fired
+	LTime uint64 `json:"ltime"`
+	Name  string `json:"name"`
+	// Payload is opaque to memberlist, keep it small
+	Payload []byte `json:"payload,omitempty"`
+	// Origin is the name of the node which fired the event
+	Origin string `json:"origin"`
+}
+
+func (e UserEvent) equal(other UserEvent) bool {
+	return e.LTime == other.LTime && e.Name == other.Name && e.Origin == other.Origin && bytes.Equal(e.Payload, other.Payload)
+}
+
+type userEventCollection struct {
+	ltime  uint64
+	events []UserEvent
+}
+
+type userEventSubscription struct {
+	name    string
+	handler func(UserEvent)
+}
+
+// userEventStore de-duplicates user events by lamport time and dispatches them to subscribers in order
+type userEventStore struct {
+	clock lamportClock
+	lock  sync.Mutex
+	// buffer is indexed by lamport time modulo its length
+	buffer []*userEventCollection
+	// minTime drops events fired before the node joined the cluster, which are replayed by other nodes
+	minTime       uint64
+	subscriptions map[uint64]userEventSubscription
+	nextId        uint64
+	dispatch      chan UserEvent
+	dispatchOnce  sync.Once
+}
+
+func newUserEventStore() *userEventStore {
+	return &userEventStore{
+		buffer:        make([]*userEventCollection, userEventBufferSize),
+		subscriptions: make(map[uint64]userEventSubscription),
+		dispatch:      make(chan UserEvent, userEventDispatchSize),
+	}
+}
+
+// newEvent creates an event fired by local node
+func (s *userEventStore) newEvent(origin, name string, payload []byte) (UserEvent, error) {
+	if len(name)+len(payload) > UserEventSizeLimit {
+		return UserEvent{}, errors.Errorf("[odin] user event %s exceeds size limit of %d bytes", name, UserEventSizeLimit)
+	}
+	e := UserEvent{
+		LTime:   s.clock.Time(),
+		Name:    name,
+		Payload: payload,
+		Origin:  origin,
+	}
+	s.clock.Increment()
+	return e, nil
+}
+
+// handle records e and dispatches it to subscribers, it returns false if e has been seen or is too old,
+// otherwise e should be broadcast to other nodes
+func (s *userEventStore) handle(e UserEvent) bool {
+	s.clock.Witness(e.LTime)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if e.LTime < s.minTime {
+		return false
+	}
+	if cur := s.clock.Time(); cur > userEventBufferSize && e.LTime < cur-userEventBufferSize {
+		return false
+	}
+	idx := e.LTime % uint64(len(s.buffer))
+	c := s.buffer[idx]
+	if c != nil && c.ltime == e.LTime {
+		for _, seen := range c.events {
+			if seen.equal(e) {
+				return false
+			}
+		}
+	} else {
+		c = &userEventCollection{ltime: e.LTime}
+		s.buffer[idx] = c
+	}
+	c.events = append(c.events, e)
+
+	s.dispatchOnce.Do(func() {
+		go s.loop()
+	})
+	select {
+	case s.dispatch <- e:
+	default:
+		logger.Warn().Msgf("[odin] too many user events waiting for subscribers, event %s from %s is dropped", e.Name, e.Origin)
+	}
+	return true
+}
+
+func (s *userEventStore) loop() {
+	for e := range s.dispatch {
+		s.lock.Lock()
+		var handlers []func(UserEvent)
+		for _, sub := range s.subscriptions {
+			if sub.name == "" || sub.name == e.Name {
+				handlers = append(handlers, sub.handler)
+			}
+		}
+		s.lock.Unlock()
+		for _, handler := range handlers {
+			handler(e)
+		}
+	}
+}
+
+// ignoreBefore drops events fired before ltime, used when joining a cluster whose events happened before
+func (s *userEventStore) ignoreBefore(ltime uint64) {
+	s.clock.Witness(ltime)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if ltime > s.minTime {
+		s.minTime = ltime
+	}
+}
+
+func (s *userEventStore) subscribe(name string, handler func(UserEvent)) func() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.nextId++
+	id := s.nextId
+	s.subscriptions[id] = userEventSubscription{
+		name:    name,
+		handler: handler,
+	}
+	return func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		delete(s.subscriptions, id)
+	}
+}
+
+// userEventBroadcast is never invalidated by other broadcasts
+type userEventBroadcast struct {
+	msg []byte
+}
+
+func (b *userEventBroadcast) Invalidates(other memberlist.Broadcast) bool {
+	return false
+}
+
+func (b *userEventBroadcast) Message() []byte {
+	return b.msg
+}
+
+func (b *userEventBroadcast) Finished() {
+}
+
+func (b *userEventBroadcast) UniqueBroadcast() {
+}
+
+// FireUserEvent broadcasts a user event named name to all nodes in the cluster including local node. Events are
+// delivered at most once to each node, in best effort, so don't rely on them for data which must not be lost.
+func FireUserEvent(name string, payload []byte) error {
+	assertMlistNotNil()
+	return delegator.fireUserEvent(mlist.LocalNode().Name, name, payload)
+}
+
+// SubscribeUserEvent calls handler with user events named name, or all user events if name is empty.
+// Handlers are called one by one in a separate goroutine, so they should return quickly.
+// Call the returned function to unsubscribe.
+func SubscribeUserEvent(name string, handler func(UserEvent)) func() {
+	assertMlistNotNil()
+	return delegator.userEvents.subscribe(name, handler)
+}
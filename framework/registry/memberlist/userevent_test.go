@@ -0,0 +1,104 @@
+package memberlist
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/youminxue/odin/toolkit/memberlist"
+)
+
+func newTestDelegate() *delegate {
+	return &delegate{
+		queue: &memberlist.TransmitLimitedQueue{
+			RetransmitMult: 1,
+			NumNodes:       func() int { return 2 },
+		},
+		userEvents: newUserEventStore(),
+		kv:         newKVStore(0),
+	}
+}
+
+// gossip delivers all queued broadcasts of from to to
+func gossip(from, to *delegate) {
+	for _, msg := range from.GetBroadcasts(0, 65535) {
+		to.NotifyMsg(msg)
+	}
+}
+
+func TestLamportClock(t *testing.T) {
+	var c lamportClock
+	require.Equal(t, uint64(0), c.Time())
+	require.Equal(t, uint64(1), c.Increment())
+	c.Witness(10)
+	require.Equal(t, uint64(11), c.Time())
+	c.Witness(3)
+	require.Equal(t, uint64(11), c.Time())
+}
+
+func TestUserEvent(t *testing.T) {
+	a, b := newTestDelegate(), newTestDelegate()
+	received := make(chan UserEvent, 10)
+	unsubscribe := b.userEvents.subscribe("cache", func(e UserEvent) {
+		received <- e
+	})
+
+	require.NoError(t, a.fireUserEvent("a", "cache", []byte("user:1")))
+	require.NoError(t, a.fireUserEvent("a", "other", nil))
+	gossip(a, b)
+
+	select {
+	case e := <-received:
+		require.Equal(t, "cache", e.Name)
+		require.Equal(t, []byte("user:1"), e.Payload)
+		require.Equal(t, "a", e.Origin)
+	case <-time.After(time.Second):
+		t.Fatal("user event not received")
+	}
+
+	// b rebroadcasts events on first receipt, a has seen them
+	require.Equal(t, 2, b.queue.NumQueued())
+	received2 := make(chan UserEvent, 10)
+	a.userEvents.subscribe("", func(e UserEvent) {
+		received2 <- e
+	})
+	gossip(b, a)
+	require.Equal(t, 0, a.queue.NumQueued())
+
+	// duplicates are dropped
+	require.NoError(t, a.fireUserEvent("a", "cache", []byte("user:2")))
+	msgs := a.GetBroadcasts(0, 65535)
+	require.Len(t, msgs, 1)
+	b.NotifyMsg(msgs[0])
+	b.NotifyMsg(msgs[0])
+	require.Equal(t, 1, b.queue.NumQueued())
+	select {
+	case e := <-received:
+		require.Equal(t, []byte("user:2"), e.Payload)
+	case <-time.After(time.Second):
+		t.Fatal("user event not received")
+	}
+	select {
+	case e := <-received:
+		t.Fatalf("duplicated user event %v", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	unsubscribe()
+	require.Error(t, a.fireUserEvent("a", "big", make([]byte, UserEventSizeLimit)))
+}
+
+func TestUserEventIgnoreBeforeJoin(t *testing.T) {
+	a, b := newTestDelegate(), newTestDelegate()
+	require.NoError(t, a.fireUserEvent("a", "cache", nil))
+	old := a.GetBroadcasts(0, 65535)
+	require.Len(t, old, 1)
+
+	b.MergeRemoteState(a.LocalState(true), true)
+	b.NotifyMsg(old[0])
+	require.Equal(t, 0, b.queue.NumQueued())
+
+	require.NoError(t, a.fireUserEvent("a", "cache", nil))
+	gossip(a, b)
+	require.Equal(t, 1, b.queue.NumQueued())
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/youminxue/odin/framework/registry/utils"
 	"github.com/youminxue/odin/toolkit/cast"
 	"github.com/youminxue/odin/toolkit/constants"
+	"github.com/youminxue/odin/toolkit/loadbalance"
 	"github.com/youminxue/odin/toolkit/stringutils"
 	logger "github.com/youminxue/odin/toolkit/zlogger"
 	"google.golang.org/grpc"
@@ -30,6 +31,9 @@ var NamingClient naming_client.INamingClient
 var onceNacos sync.Once
 var NewNamingClient = clients.NewNamingClient
 
+// restInstance and grpcInstance are kept for marking the registered instances unhealthy on shutdown
+var restInstance, grpcInstance *vo.RegisterInstanceParam
+
 func InitialiseNacosNamingClient() {
 	var err error
 	NamingClient, err = NewNamingClient(config.GetNacosClientParam())
@@ -68,13 +72,17 @@ func NewRest(data ...map[string]interface{}) {
 	metadata["buildUser"] = buildinfo.BuildUser
 	metadata["buildTime"] = buildTime
 	metadata["weight"] = strconv.Itoa(weight)
+	if zone := config.GddZone.Load(); stringutils.IsNotEmpty(zone) {
+		metadata[loadbalance.MetaZone] = zone
+	}
 	metadata["rootPath"] = rr
+	metadata["scheme"] = config.GetScheme()
 	for _, item := range data {
 		for k, v := range item {
 			metadata[k] = fmt.Sprint(v)
 		}
 	}
-	success, err := NamingClient.RegisterInstance(vo.RegisterInstanceParam{
+	param := vo.RegisterInstanceParam{
 		Ip:          registerHost,
 		Port:        httpPort,
 		Weight:      float64(weight),
@@ -85,10 +93,12 @@ func NewRest(data ...map[string]interface{}) {
 		ServiceName: service,
 		GroupName:   config.GddNacosGroupName.LoadOrDefault(config.DefaultGddNacosGroupName),
 		Ephemeral:   true,
-	})
+	}
+	success, err := NamingClient.RegisterInstance(param)
 	if err != nil {
 		panic(errors.Errorf("[odin] %s failed to register to nacos server: %s", service, err))
 	}
+	restInstance = &param
 	if success {
 		logger.Info().Msgf("[odin] %s registered to nacos server successfully", service)
 	}
@@ -99,7 +109,7 @@ func NewGrpc(data ...map[string]interface{}) {
 		InitialiseNacosNamingClient()
 	})
 	registerHost := utils.GetRegisterHost()
-	grpcPort := config.GetGrpcPort()
+	grpcPort := utils.GetGrpcRegisterPort()
 	service := config.GetServiceName() + "_" + string(cons.GRPC_TYPE)
 	weight := config.DefaultGddWeight
 	if stringutils.IsNotEmpty(config.GddWeight.Load()) {
@@ -120,12 +130,15 @@ func NewGrpc(data ...map[string]interface{}) {
 	metadata["buildUser"] = buildinfo.BuildUser
 	metadata["buildTime"] = buildTime
 	metadata["weight"] = strconv.Itoa(weight)
+	if zone := config.GddZone.Load(); stringutils.IsNotEmpty(zone) {
+		metadata[loadbalance.MetaZone] = zone
+	}
 	for _, item := range data {
 		for k, v := range item {
 			metadata[k] = fmt.Sprint(v)
 		}
 	}
-	success, err := NamingClient.RegisterInstance(vo.RegisterInstanceParam{
+	param := vo.RegisterInstanceParam{
 		Ip:          registerHost,
 		Port:        grpcPort,
 		Weight:      float64(weight),
@@ -136,15 +149,54 @@ func NewGrpc(data ...map[string]interface{}) {
 		ServiceName: service,
 		GroupName:   config.GddNacosGroupName.LoadOrDefault(config.DefaultGddNacosGroupName),
 		Ephemeral:   true,
-	})
+	}
+	success, err := NamingClient.RegisterInstance(param)
 	if err != nil {
 		panic(errors.Errorf("[odin] %s failed to register to nacos server: %s", service, err))
 	}
+	grpcInstance = &param
 	if success {
 		logger.Info().Msgf("[odin] %s registered to nacos server successfully", service)
 	}
 }
 
+// MarkUnhealthyRest disables the registered rest instance, so that clients stop selecting it before it is deregistered
+func MarkUnhealthyRest() {
+	markUnhealthy(restInstance)
+}
+
+// MarkUnhealthyGrpc disables the registered grpc instance, so that clients stop selecting it before it is deregistered
+func MarkUnhealthyGrpc() {
+	markUnhealthy(grpcInstance)
+}
+
+func markUnhealthy(instance *vo.RegisterInstanceParam) {
+	if NamingClient == nil || instance == nil {
+		return
+	}
+	success, err := NamingClient.UpdateInstance(vo.UpdateInstanceParam{
+		Ip:          instance.Ip,
+		Port:        instance.Port,
+		Weight:      instance.Weight,
+		Enable:      false,
+		Healthy:     false,
+		Metadata:    instance.Metadata,
+		ClusterName: instance.ClusterName,
+		ServiceName: instance.ServiceName,
+		GroupName:   instance.GroupName,
+		Ephemeral:   instance.Ephemeral,
+	})
+	if err != nil {
+		logger.Error().Err(err).Msgf("[odin] failed to mark %s unhealthy in nacos server", instance.ServiceName)
+		return
+	}
+	if !success {
+		logger.Error().Msgf("[odin] failed to mark %s unhealthy in nacos server", instance.ServiceName)
+		return
+	}
+	logger.Info().Msgf("[odin] marked %s unhealthy in nacos server successfully", instance.ServiceName)
+}
+
 func ShutdownRest() {
 	if NamingClient != nil {
 		registerHost := utils.GetRegisterHost()
@@ -171,7 +223,7 @@ func ShutdownRest() {
 func ShutdownGrpc() {
 	if NamingClient != nil {
 		registerHost := utils.GetRegisterHost()
-		grpcPort := config.GetGrpcPort()
+		grpcPort := utils.GetGrpcRegisterPort()
 		service := config.GetServiceName() + "_" + string(cons.GRPC_TYPE)
 		success, err := NamingClient.DeregisterInstance(vo.DeregisterInstanceParam{
 			Ip:          registerHost,
@@ -263,6 +315,69 @@ func (a instance) Less(i, j int) bool {
 	return a[i].InstanceId < a[j].InstanceId
 }
 
+// scheme returns the scheme advertised in instance metadata, instances registered by older versions use http
+func scheme(metadata map[string]string) string {
+	if s := metadata["scheme"]; stringutils.IsNotEmpty(s) {
+		return s
+	}
+	return "http"
+}
+
+func baseUrl(instance model.Instance) string {
+	return fmt.Sprintf("%s://%s:%d%s", scheme(instance.Metadata), instance.Ip, instance.Port, instance.Metadata["rootPath"])
+}
+
+// selectInstances returns healthy instances of the service sorted by base url
+func selectInstances(client naming_client.INamingClient, serviceName string, clusters []string, groupName string) ([]loadbalance.Instance, error) {
+	if client == nil {
+		return nil, errors.New("[odin] nacos discovery client has not been initialized")
+	}
+	instances, err := client.SelectInstances(vo.SelectInstancesParam{
+		Clusters:    clusters,
+		ServiceName: serviceName,
+		GroupName:   groupName,
+		HealthyOnly: true,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "[odin] failed to select instances of %s", serviceName)
+	}
+	ret := make([]loadbalance.Instance, 0, len(instances))
+	for _, item := range instances {
+		ret = append(ret, loadbalance.Instance{
+			BaseUrl:  baseUrl(item),
+			Weight:   int(item.Weight),
+			Metadata: item.Metadata,
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].BaseUrl < ret[j].BaseUrl
+	})
+	return ret, nil
+}
+
+// ListInstances returns healthy instances of the service in clusters and group sorted by base url,
+// error is returned if nacos can't be reached
+func ListInstances(serviceName string, clusters []string, groupName string) ([]loadbalance.Instance, error) {
+	if NamingClient == nil {
+		onceNacos.Do(func() {
+			InitialiseNacosNamingClient()
+		})
+	}
+	return selectInstances(NamingClient, serviceName, clusters, groupName)
+}
+
+// Instances returns all healthy instances of the service sorted by base url for client-side load balancing
+func (b *nacosBase) Instances() []loadbalance.Instance {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	ret, err := selectInstances(b.namingClient, b.serviceName, b.clusters, b.groupName)
+	if err != nil {
+		logger.Error().Err(err).Msgf("[odin] %s server not found", b.serviceName)
+		return nil
+	}
+	return ret
+}
+
 // RRServiceProvider is a simple round-robin load balance implementation for IServiceProvider
 type RRServiceProvider struct {
 	nacosBase
@@ -295,7 +410,7 @@ func (n *RRServiceProvider) SelectServer() string {
 	next := int(atomic.AddUint64(&n.current, uint64(1)) % uint64(len(instances)))
 	n.current = uint64(next)
 	selected := instances[next]
-	return fmt.Sprintf("http://%s:%d%s", selected.Ip, selected.Port, selected.Metadata["rootPath"])
+	return baseUrl(selected)
 }
 
 // NewRRServiceProvider creates new ServiceProvider instance
@@ -337,7 +452,7 @@ func (n *WRRServiceProvider) SelectServer() string {
 		logger.Error().Err(err).Msgf("[odin] %s server not found", n.serviceName)
 		return ""
 	}
-	return fmt.Sprintf("http://%s:%d%s", instance.Ip, instance.Port, instance.Metadata["rootPath"])
+	return baseUrl(*instance)
 }
 
 // NewWRRServiceProvider creates new ServiceProvider instance
@@ -297,3 +297,80 @@ func TestNacosWRRServiceProvider_SelectServer(t *testing.T) {
 	got := n.SelectServer()
 	require.Equal(t, got, "http://10.10.10.10:80/api")
 }
+
+func TestNacosWRRServiceProvider_SelectServerHttps(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	host := services.Hosts[1]
+	host.Metadata = map[string]string{"rootPath": "/api", "scheme": "https"}
+	namingClient := mock.NewMockINamingClient(ctrl)
+	namingClient.
+		EXPECT().
+		SelectOneHealthyInstance(gomock.Any()).
+		AnyTimes().
+		Return(&host, nil)
+
+	n := nacos.NewWRRServiceProvider("testsvc", nacos.WithNacosNamingClient(namingClient))
+	require.Equal(t, "https://"+host.Ip+":80/api", n.SelectServer())
+}
+
+func TestMarkUnhealthyRest(t *testing.T) {
+	setup()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	namingClient := mock.NewMockINamingClient(ctrl)
+	namingClient.
+		EXPECT().
+		RegisterInstance(gomock.Any()).
+		Return(true, nil)
+	namingClient.
+		EXPECT().
+		UpdateInstance(gomock.Any()).
+		DoAndReturn(func(param vo.UpdateInstanceParam) (bool, error) {
+			require.False(t, param.Enable)
+			require.False(t, param.Healthy)
+			require.Equal(t, "seed_rest", param.ServiceName)
+			require.Equal(t, uint64(8088), param.Port)
+			require.Equal(t, "/v1", param.Metadata["rootPath"])
+			return true, nil
+		})
+	nacos.NewNamingClient = func(param vo.NacosClientParam) (iClient naming_client.INamingClient, err error) {
+		return namingClient, nil
+	}
+	nacos.NamingClient = namingClient
+
+	nacos.NewRest()
+	nacos.MarkUnhealthyRest()
+}
+
+func TestListInstances(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	namingClient := mock.NewMockINamingClient(ctrl)
+	param := vo.SelectInstancesParam{
+		Clusters:    []string{"a"},
+		ServiceName: "testsvc",
+		GroupName:   "DEFAULT_GROUP",
+		HealthyOnly: true,
+	}
+	gomock.InOrder(
+		namingClient.EXPECT().SelectInstances(param).Return(services.Hosts, nil),
+		namingClient.EXPECT().SelectInstances(param).Return(nil, errors.New("mock error")),
+	)
+	old := nacos.NamingClient
+	nacos.NamingClient = namingClient
+	defer func() {
+		nacos.NamingClient = old
+	}()
+
+	instances, err := nacos.ListInstances("testsvc", []string{"a"}, "DEFAULT_GROUP")
+	require.NoError(t, err)
+	require.Len(t, instances, len(services.Hosts))
+
+	// nacos outage is reported rather than taken as no instance
+	_, err = nacos.ListInstances("testsvc", []string{"a"}, "DEFAULT_GROUP")
+	require.Error(t, err)
+}
@@ -1,11 +1,7 @@
 package registry
 
 import (
-	"github.com/youminxue/odin/framework/internal/config"
 	"github.com/youminxue/odin/framework/registry/constants"
-	"github.com/youminxue/odin/framework/registry/etcd"
-	"github.com/youminxue/odin/framework/registry/memberlist"
-	"github.com/youminxue/odin/framework/registry/nacos"
 	logger "github.com/youminxue/odin/toolkit/zlogger"
 )
 
@@ -13,62 +9,45 @@ type IServiceProvider interface {
 	SelectServer() string
 }
 
+// NewRest registers the rest service to all backends of DefaultDiscovery
 func NewRest(data ...map[string]interface{}) {
-	for mode, _ := range config.ServiceDiscoveryMap() {
-		switch mode {
-		case constants.SD_NACOS:
-			nacos.NewRest(data...)
-		case constants.SD_ETCD:
-			etcd.NewRest(data...)
-		case constants.SD_MEMBERLIST:
-			memberlist.NewRest(data...)
-		default:
-			logger.Warn().Msgf("[odin] unknown service discovery mode: %s", mode)
-		}
+	if err := DefaultDiscovery().Register(constants.REST_TYPE, data...); err != nil {
+		logger.Panic().Err(err).Msg("[odin] failed to register rest service")
 	}
 }
 
+// NewGrpc registers the grpc service to all backends of DefaultDiscovery
 func NewGrpc(data ...map[string]interface{}) {
-	for mode, _ := range config.ServiceDiscoveryMap() {
-		switch mode {
-		case constants.SD_NACOS:
-			nacos.NewGrpc(data...)
-		case constants.SD_ETCD:
-			etcd.NewGrpc(data...)
-		case constants.SD_MEMBERLIST:
-			memberlist.NewGrpc(data...)
-		default:
-			logger.Warn().Msgf("[odin] unknown service discovery mode: %s", mode)
-		}
+	if err := DefaultDiscovery().Register(constants.GRPC_TYPE, data...); err != nil {
+		logger.Panic().Err(err).Msg("[odin] failed to register grpc service")
 	}
 }
 
+// ShutdownRest deregisters the rest service from all backends of DefaultDiscovery
 func ShutdownRest() {
-	for mode, _ := range config.ServiceDiscoveryMap() {
-		switch mode {
-		case constants.SD_NACOS:
-			nacos.ShutdownRest()
-		case constants.SD_ETCD:
-			etcd.ShutdownRest()
-		case constants.SD_MEMBERLIST:
-			memberlist.Shutdown()
-		default:
-			logger.Warn().Msgf("[odin] unknown service discovery mode: %s", mode)
-		}
+	if err := DefaultDiscovery().Deregister(constants.REST_TYPE); err != nil {
+		logger.Error().Err(err).Msg("[odin] failed to deregister rest service")
 	}
 }
 
+// ShutdownGrpc deregisters the grpc service from all backends of DefaultDiscovery
 func ShutdownGrpc() {
-	for mode, _ := range config.ServiceDiscoveryMap() {
-		switch mode {
-		case constants.SD_NACOS:
-			nacos.ShutdownGrpc()
-		case constants.SD_ETCD:
-			etcd.ShutdownGrpc()
-		case constants.SD_MEMBERLIST:
-			memberlist.Shutdown()
-		default:
-			logger.Warn().Msgf("[odin] unknown service discovery mode: %s", mode)
-		}
+	if err := DefaultDiscovery().Deregister(constants.GRPC_TYPE); err != nil {
+		logger.Error().Err(err).Msg("[odin] failed to deregister grpc service")
+	}
+}
+
+// MarkUnhealthyRest marks the rest service unhealthy in all service registries ahead of ShutdownRest,
+// so that clients stop sending requests to it while in-flight ones are draining
+func MarkUnhealthyRest() {
+	if err := DefaultDiscovery().MarkUnhealthy(constants.REST_TYPE); err != nil {
+		logger.Error().Err(err).Msg("[odin] failed to mark rest service unhealthy")
+	}
+}
+
+// MarkUnhealthyGrpc marks the grpc service unhealthy in all service registries ahead of ShutdownGrpc
+func MarkUnhealthyGrpc() {
+	if err := DefaultDiscovery().MarkUnhealthy(constants.GRPC_TYPE); err != nil {
+		logger.Error().Err(err).Msg("[odin] failed to mark grpc service unhealthy")
 	}
 }
@@ -0,0 +1,133 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/youminxue/odin/toolkit/loadbalance"
+	logger "github.com/youminxue/odin/toolkit/zlogger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/attributes"
+	gresolver "google.golang.org/grpc/resolver"
+)
+
+const schemeName = "odin"
+
+var _ gresolver.Builder = (*builder)(nil)
+var _ gresolver.Resolver = (*resolver)(nil)
+
+func init() {
+	gresolver.Register(&builder{})
+}
+
+// builder builds resolvers over discovery, DefaultDiscovery is used if discovery is nil
+type builder struct {
+	discovery *Discovery
+}
+
+func (b *builder) Scheme() string {
+	return schemeName
+}
+
+func (b *builder) Build(target gresolver.Target, cc gresolver.ClientConn, opts gresolver.BuildOptions) (gresolver.Resolver, error) {
+	name := target.URL.Host
+	if len(name) == 0 {
+		return nil, errors.Errorf("Wrong odin URL %s", target.URL.String())
+	}
+	d := b.discovery
+	if d == nil {
+		d = DefaultDiscovery()
+	}
+	events, stop, err := d.Watch(name)
+	if err != nil {
+		return nil, err
+	}
+	r := &resolver{
+		cc:   cc,
+		stop: stop,
+		done: make(chan struct{}),
+	}
+	r.UpdateCC((<-events).Instances)
+	go r.watch(events)
+	return r, nil
+}
+
+// resolver resolves addresses of a grpc service from backends of a Discovery, and updates them on changes
+type resolver struct {
+	cc   gresolver.ClientConn
+	stop func()
+	done chan struct{}
+}
+
+func (m *resolver) watch(events <-chan Event) {
+	for {
+		select {
+		case e := <-events:
+			m.UpdateCC(e.Instances)
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// addr returns host:port of base url, base urls of grpc services may have no scheme
+func addr(baseUrl string) string {
+	if !strings.Contains(baseUrl, "://") {
+		return strings.SplitN(baseUrl, "/", 2)[0]
+	}
+	u, err := url.Parse(baseUrl)
+	if err != nil {
+		return baseUrl
+	}
+	return u.Host
+}
+
+func (m *resolver) UpdateCC(instances []loadbalance.Instance) {
+	conns := make([]gresolver.Address, 0, len(instances))
+	for _, item := range instances {
+		weight := item.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		conns = append(conns, gresolver.Address{
+			Addr:               addr(item.BaseUrl),
+			BalancerAttributes: attributes.New(WeightAttributeKey{}, WeightAddrInfo{Weight: weight}),
+		})
+	}
+	m.cc.UpdateState(gresolver.State{Addresses: conns})
+}
+
+func (m *resolver) ResolveNow(gresolver.ResolveNowOptions) {}
+
+func (m *resolver) Close() {
+	close(m.done)
+	m.stop()
+}
+
+// NewSWRRGrpcClientConn connects to service over all backends with smooth weighted round-robin load balancing
+func (d *Discovery) NewSWRRGrpcClientConn(service string, dialOptions ...grpc.DialOption) *grpc.ClientConn {
+	return d.NewGrpcClientConn(service, Name, dialOptions...)
+}
+
+// NewRRGrpcClientConn connects to service over all backends with round-robin load balancing
+func (d *Discovery) NewRRGrpcClientConn(service string, dialOptions ...grpc.DialOption) *grpc.ClientConn {
+	return d.NewGrpcClientConn(service, "round_robin", dialOptions...)
+}
+
+// NewGrpcClientConn connects to service over all backends with load balancing policy lb
+func (d *Discovery) NewGrpcClientConn(service string, lb string, dialOptions ...grpc.DialOption) *grpc.ClientConn {
+	serverAddr := fmt.Sprintf(schemeName+"://%s/", service)
+	dialOptions = append(dialOptions, grpc.WithResolvers(&builder{discovery: d}), grpc.WithBlock(),
+		grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy": "`+lb+`"}`))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	grpcConn, err := grpc.DialContext(ctx, serverAddr, dialOptions...)
+	if err != nil {
+		logger.Panic().Err(err).Msgf("[odin] failed to connect to server %s", serverAddr)
+	}
+	return grpcConn
+}
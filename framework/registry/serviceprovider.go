@@ -0,0 +1,117 @@
+package registry
+
+import (
+	"sync"
+
+	"github.com/youminxue/odin/toolkit/loadbalance"
+	logger "github.com/youminxue/odin/toolkit/zlogger"
+)
+
+var _ IServiceProvider = (*SWRRServiceProvider)(nil)
+var _ IInstanceProvider = (*SWRRServiceProvider)(nil)
+
+type server struct {
+	instance      loadbalance.Instance
+	currentWeight int
+}
+
+// SWRRServiceProvider is a smooth weighted round-robin IServiceProvider over instances of a service from any
+// backend, it is kept in sync by events of Discovery.Watch
+// https://github.com/nginx/nginx/commit/52327e0627f49dbda1e8db695e63a4b0af4448b1
+type SWRRServiceProvider struct {
+	name    string
+	lock    sync.Mutex
+	servers []*server
+	stop    func()
+	done    chan struct{}
+}
+
+func newSWRRServiceProvider(name string, events <-chan Event, stop func()) *SWRRServiceProvider {
+	p := &SWRRServiceProvider{
+		name: name,
+		stop: stop,
+		done: make(chan struct{}),
+	}
+	// the first event is ready on return of Watch, so instances are available once the provider is created
+	p.update((<-events).Instances)
+	go p.watch(events)
+	return p
+}
+
+func (p *SWRRServiceProvider) watch(events <-chan Event) {
+	for {
+		select {
+		case e := <-events:
+			p.update(e.Instances)
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// update replaces servers with instances, current weights of unchanged servers are kept
+func (p *SWRRServiceProvider) update(instances []loadbalance.Instance) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	old := make(map[string]*server, len(p.servers))
+	for _, s := range p.servers {
+		old[s.instance.BaseUrl] = s
+	}
+	servers := make([]*server, 0, len(instances))
+	for _, item := range instances {
+		s := &server{instance: item}
+		if s.instance.Weight <= 0 {
+			s.instance.Weight = 1
+		}
+		if prev, ok := old[item.BaseUrl]; ok {
+			s.currentWeight = prev.currentWeight
+		}
+		servers = append(servers, s)
+	}
+	p.servers = servers
+}
+
+// SelectServer selects an instance of the service by weight, empty string if there is none
+func (p *SWRRServiceProvider) SelectServer() string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if len(p.servers) == 0 {
+		logger.Error().Msgf("[odin] %s server not found", p.name)
+		return ""
+	}
+	var selected *server
+	total := 0
+	for _, s := range p.servers {
+		s.currentWeight += s.instance.Weight
+		total += s.instance.Weight
+		if selected == nil || s.currentWeight > selected.currentWeight {
+			selected = s
+		}
+	}
+	selected.currentWeight -= total
+	return selected.instance.BaseUrl
+}
+
+// Instances returns all instances of the service sorted by base url for client-side load balancing
+func (p *SWRRServiceProvider) Instances() []loadbalance.Instance {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	ret := make([]loadbalance.Instance, 0, len(p.servers))
+	for _, s := range p.servers {
+		ret = append(ret, s.instance)
+	}
+	return ret
+}
+
+// Close stops watching the service, instances known so far are kept
+func (p *SWRRServiceProvider) Close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	select {
+	case <-p.done:
+		return
+	default:
+	}
+	close(p.done)
+	p.stop()
+}
@@ -0,0 +1,301 @@
+package static
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/youminxue/odin/framework/internal/config"
+	cons "github.com/youminxue/odin/framework/registry/constants"
+	"github.com/youminxue/odin/toolkit/loadbalance"
+	"github.com/youminxue/odin/toolkit/stringutils"
+	"github.com/youminxue/odin/toolkit/zlogger"
+)
+
+// Endpoint is an instance of a service listed in the static file. The file maps service names to endpoints, e.g.
+//
+//	usersvc_rest:
+//	  - addr: 10.0.0.1:6060
+//	    rootPath: /api
+//	    weight: 2
+//	    metadata:
+//	      zone: hz
+//	usersvc_grpc:
+//	  - addr: 10.0.0.1:50051
+type Endpoint struct {
+	// Addr is host:port of the instance
+	Addr string `json:"addr"`
+	// Scheme is the scheme of rest services, http by default
+	Scheme string `json:"scheme"`
+	// RootPath is the route root path of rest services
+	RootPath string `json:"rootPath"`
+	// Weight is the weight of the instance, 1 by default
+	Weight int `json:"weight"`
+	// Metadata such as zone
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+// BaseUrl returns scheme, address and root path of the endpoint
+func (e Endpoint) BaseUrl() string {
+	return fmt.Sprintf("%s://%s%s", e.Scheme, e.Addr, e.RootPath)
+}
+
+func (e Endpoint) metadata() map[string]string {
+	ret := make(map[string]string, len(e.Metadata))
+	for k, v := range e.Metadata {
+		ret[k] = fmt.Sprint(v)
+	}
+	return ret
+}
+
+// parse parses services from yaml data and fills in defaults
+func parse(data []byte) (map[string][]Endpoint, error) {
+	services := make(map[string][]Endpoint)
+	if err := yaml.Unmarshal(data, &services); err != nil {
+		return nil, errors.Wrap(err, "[odin] failed to parse static services")
+	}
+	for service, endpoints := range services {
+		for i := range endpoints {
+			e := &endpoints[i]
+			if _, _, err := net.SplitHostPort(e.Addr); err != nil {
+				return nil, errors.Wrapf(err, "[odin] bad address of service %s", service)
+			}
+			if e.Weight < 0 {
+				return nil, errors.Errorf("[odin] negative weight of service %s at %s", service, e.Addr)
+			}
+			if e.Weight == 0 {
+				e.Weight = 1
+			}
+			if stringutils.IsEmpty(e.Scheme) {
+				e.Scheme = "http"
+			}
+		}
+		sort.SliceStable(endpoints, func(i, j int) bool {
+			return endpoints[i].Addr < endpoints[j].Addr
+		})
+	}
+	return services, nil
+}
+
+// registry keeps services listed in a yaml file and reloads them when the file changes
+type registry struct {
+	file     string
+	lock     sync.RWMutex
+	services map[string][]Endpoint
+	// version increases every time services change
+	version uint64
+	modTime time.Time
+	size    int64
+
+	watchLock   sync.Mutex
+	watchers    map[uint64]func()
+	nextWatcher uint64
+}
+
+func newRegistry(file string) (*registry, error) {
+	r := &registry{
+		file:     file,
+		watchers: make(map[uint64]func()),
+	}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload reads the file again if it is modified, returns true if services change
+func (r *registry) reload() (bool, error) {
+	// stat follows symlinks, so that files mounted from kubernetes configmaps are reloaded too
+	info, err := os.Stat(r.file)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	r.lock.RLock()
+	modified := !info.ModTime().Equal(r.modTime) || info.Size() != r.size
+	r.lock.RUnlock()
+	if !modified {
+		return false, nil
+	}
+	data, err := ioutil.ReadFile(r.file)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	services, err := parse(data)
+	if err != nil {
+		return false, err
+	}
+	r.lock.Lock()
+	r.modTime, r.size = info.ModTime(), info.Size()
+	changed := !reflect.DeepEqual(services, r.services)
+	if changed {
+		r.services = services
+		r.version++
+	}
+	r.lock.Unlock()
+	if changed {
+		r.notify()
+	}
+	return changed, nil
+}
+
+// run reloads the file every interval until stop is closed
+func (r *registry) run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			changed, err := r.reload()
+			if err != nil {
+				zlogger.Error().Err(err).Msgf("[odin] failed to reload %s, keep services loaded before", r.file)
+				continue
+			}
+			if changed {
+				zlogger.Info().Msgf("[odin] services reloaded from %s", r.file)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// endpoints returns endpoints of service sorted by address, and version of services
+func (r *registry) endpoints(service string) ([]Endpoint, uint64) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.services[service], r.version
+}
+
+func (r *registry) hasService(service string) bool {
+	endpoints, _ := r.endpoints(service)
+	return len(endpoints) > 0
+}
+
+// watch calls watcher after services change, call the returned function to stop watching
+func (r *registry) watch(watcher func()) func() {
+	r.watchLock.Lock()
+	defer r.watchLock.Unlock()
+	id := r.nextWatcher
+	r.nextWatcher++
+	r.watchers[id] = watcher
+	return func() {
+		r.watchLock.Lock()
+		defer r.watchLock.Unlock()
+		delete(r.watchers, id)
+	}
+}
+
+func (r *registry) notify() {
+	r.watchLock.Lock()
+	watchers := make([]func(), 0, len(r.watchers))
+	for _, watcher := range r.watchers {
+		watchers = append(watchers, watcher)
+	}
+	r.watchLock.Unlock()
+	for _, watcher := range watchers {
+		watcher()
+	}
+}
+
+var regLock sync.Mutex
+var reg *registry
+
+// getRegistry loads the file configured by GDD_STATIC_FILE and starts watching it on first successful call. An
+// error is returned if the file fails to load, and it is loaded again on next call.
+func getRegistry() (*registry, error) {
+	regLock.Lock()
+	defer regLock.Unlock()
+	if reg != nil {
+		return reg, nil
+	}
+	file := config.GddStaticFile.LoadOrDefault(config.DefaultGddStaticFile)
+	r, err := newRegistry(file)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "[odin] failed to load static services from %s", file)
+	}
+	interval, err := time.ParseDuration(config.GddStaticWatchInterval.LoadOrDefault(config.DefaultGddStaticWatchInterval))
+	if err != nil || interval <= 0 {
+		interval, _ = time.ParseDuration(config.DefaultGddStaticWatchInterval)
+	}
+	go r.run(interval, nil)
+	zlogger.Info().Msgf("[odin] static services loaded from %s", file)
+	reg = r
+	return reg, nil
+}
+
+// HasService reports whether service is listed in the static file
+func HasService(service string) bool {
+	r, err := getRegistry()
+	if err != nil {
+		zlogger.Error().Err(err).Msgf("[odin] failed to list %s", service)
+		return false
+	}
+	return r.hasService(service)
+}
+
+// ListInstances returns endpoints of service listed in the static file sorted by address
+func ListInstances(service string) ([]loadbalance.Instance, error) {
+	r, err := getRegistry()
+	if err != nil {
+		return nil, err
+	}
+	endpoints, _ := r.endpoints(service)
+	ret := make([]loadbalance.Instance, 0, len(endpoints))
+	for _, e := range endpoints {
+		ret = append(ret, loadbalance.Instance{
+			BaseUrl:  e.BaseUrl(),
+			Weight:   e.Weight,
+			Metadata: e.metadata(),
+		})
+	}
+	return ret, nil
+}
+
+// Watch calls onChange after the static file is reloaded with changes, call the returned function to stop watching
+func Watch(onChange func()) (func(), error) {
+	r, err := getRegistry()
+	if err != nil {
+		return nil, err
+	}
+	return r.watch(onChange), nil
+}
+
+// NewRest loads the static file to fail fast on startup if it is missing or malformed, services are not registered
+// but listed in the static file by hand
+func NewRest(data ...map[string]interface{}) error {
+	if _, err := getRegistry(); err != nil {
+		return err
+	}
+	service := config.GetServiceName() + "_" + string(cons.REST_TYPE)
+	zlogger.Info().Msgf("[odin] %s is not registered in static mode, list it in %s", service,
+		config.GddStaticFile.LoadOrDefault(config.DefaultGddStaticFile))
+	return nil
+}
+
+// NewGrpc loads the static file like NewRest
+func NewGrpc(data ...map[string]interface{}) error {
+	if _, err := getRegistry(); err != nil {
+		return err
+	}
+	service := config.GetServiceName() + "_" + string(cons.GRPC_TYPE)
+	zlogger.Info().Msgf("[odin] %s is not registered in static mode, list it in %s", service,
+		config.GddStaticFile.LoadOrDefault(config.DefaultGddStaticFile))
+	return nil
+}
+
+// MarkUnhealthyRest does nothing, remove the endpoint from the static file instead
+func MarkUnhealthyRest() {}
+
+// MarkUnhealthyGrpc does nothing, remove the endpoint from the static file instead
+func MarkUnhealthyGrpc() {}
+
+func ShutdownRest() {}
+
+func ShutdownGrpc() {}
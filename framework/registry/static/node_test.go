@@ -0,0 +1,188 @@
+package static
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/youminxue/odin/framework/internal/config"
+	"github.com/youminxue/odin/toolkit/loadbalance"
+	gresolver "google.golang.org/grpc/resolver"
+)
+
+const testServices = `
+usersvc_rest:
+  - addr: 10.0.0.2:6060
+    rootPath: /api
+    weight: 3
+    metadata:
+      zone: hz
+      version: 2
+  - addr: 10.0.0.1:6060
+    rootPath: /api
+usersvc_grpc:
+  - addr: 10.0.0.1:50051
+`
+
+func writeServices(t *testing.T, file, content string) {
+	require.NoError(t, ioutil.WriteFile(file, []byte(content), 0644))
+	// make sure modification time changes on file systems of coarse time resolution
+	later := time.Now().Add(time.Duration(len(content)) * time.Second)
+	require.NoError(t, os.Chtimes(file, later, later))
+}
+
+func newTestRegistry(t *testing.T) (*registry, string) {
+	file := filepath.Join(t.TempDir(), "services.yml")
+	writeServices(t, file, testServices)
+	r, err := newRegistry(file)
+	require.NoError(t, err)
+	return r, file
+}
+
+func TestParse(t *testing.T) {
+	services, err := parse([]byte(testServices))
+	require.NoError(t, err)
+	require.Equal(t, []Endpoint{
+		{Addr: "10.0.0.1:6060", Scheme: "http", RootPath: "/api", Weight: 1},
+		{Addr: "10.0.0.2:6060", Scheme: "http", RootPath: "/api", Weight: 3,
+			Metadata: map[string]interface{}{"zone": "hz", "version": float64(2)}},
+	}, services["usersvc_rest"])
+	require.Equal(t, "http://10.0.0.1:6060/api", services["usersvc_rest"][0].BaseUrl())
+	require.Equal(t, map[string]string{"zone": "hz", "version": "2"}, services["usersvc_rest"][1].metadata())
+
+	_, err = parse([]byte("usersvc_rest:\n  - addr: 10.0.0.1\n"))
+	require.Error(t, err)
+	_, err = parse([]byte("usersvc_rest:\n  - addr: 10.0.0.1:6060\n    weight: -1\n"))
+	require.Error(t, err)
+	_, err = parse([]byte("usersvc_rest: abc"))
+	require.Error(t, err)
+}
+
+func TestRegistry_reload(t *testing.T) {
+	r, file := newTestRegistry(t)
+	require.True(t, r.hasService("usersvc_grpc"))
+	require.False(t, r.hasService("ordersvc_rest"))
+	changes := make(chan struct{}, 10)
+	unwatch := r.watch(func() {
+		changes <- struct{}{}
+	})
+
+	changed, err := r.reload()
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	writeServices(t, file, testServices+"ordersvc_rest:\n  - addr: 10.0.0.3:6060\n")
+	changed, err = r.reload()
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.True(t, r.hasService("ordersvc_rest"))
+	require.Len(t, changes, 1)
+
+	// bad file is not applied
+	writeServices(t, file, "ordersvc_rest: [")
+	_, err = r.reload()
+	require.Error(t, err)
+	require.True(t, r.hasService("ordersvc_rest"))
+
+	unwatch()
+	writeServices(t, file, testServices)
+	changed, err = r.reload()
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.False(t, r.hasService("ordersvc_rest"))
+	require.Len(t, changes, 1)
+}
+
+func TestSWRRServiceProvider(t *testing.T) {
+	r, file := newTestRegistry(t)
+	sp := &SWRRServiceProvider{base: base{reg: r, name: "usersvc_rest"}}
+	counts := make(map[string]int)
+	for i := 0; i < 8; i++ {
+		counts[sp.SelectServer()]++
+	}
+	require.Equal(t, map[string]int{
+		"http://10.0.0.1:6060/api": 2,
+		"http://10.0.0.2:6060/api": 6,
+	}, counts)
+	require.Equal(t, []loadbalance.Instance{
+		{BaseUrl: "http://10.0.0.1:6060/api", Weight: 1, Metadata: map[string]string{}},
+		{BaseUrl: "http://10.0.0.2:6060/api", Weight: 3, Metadata: map[string]string{"zone": "hz", "version": "2"}},
+	}, sp.Instances())
+
+	writeServices(t, file, "usersvc_rest:\n  - addr: 10.0.0.3:6060\n")
+	_, err := r.reload()
+	require.NoError(t, err)
+	require.Equal(t, "http://10.0.0.3:6060", sp.SelectServer())
+
+	empty := &SWRRServiceProvider{base: base{reg: r, name: "ordersvc_rest"}}
+	require.Equal(t, "", empty.SelectServer())
+}
+
+func TestRRServiceProvider(t *testing.T) {
+	r, _ := newTestRegistry(t)
+	sp := &RRServiceProvider{base: base{reg: r, name: "usersvc_rest"}}
+	require.Equal(t, "http://10.0.0.2:6060/api", sp.SelectServer())
+	require.Equal(t, "http://10.0.0.1:6060/api", sp.SelectServer())
+	require.Equal(t, "http://10.0.0.2:6060/api", sp.SelectServer())
+}
+
+type fakeClientConn struct {
+	gresolver.ClientConn
+	states chan gresolver.State
+}
+
+func (f *fakeClientConn) UpdateState(state gresolver.State) error {
+	f.states <- state
+	return nil
+}
+
+func TestResolver(t *testing.T) {
+	r, file := newTestRegistry(t)
+	cc := &fakeClientConn{states: make(chan gresolver.State, 10)}
+	res := &resolver{reg: r, name: "usersvc_grpc", cc: cc}
+	res.UpdateCC()
+	res.unwatch = r.watch(res.UpdateCC)
+	defer res.Close()
+
+	state := <-cc.states
+	require.Len(t, state.Addresses, 1)
+	require.Equal(t, "10.0.0.1:50051", state.Addresses[0].Addr)
+	require.Equal(t, WeightAddrInfo{Weight: 1}, state.Addresses[0].BalancerAttributes.Value(WeightAttributeKey{}))
+
+	writeServices(t, file, testServices+"  - addr: 10.0.0.2:50051\n    weight: 2\n")
+	_, err := r.reload()
+	require.NoError(t, err)
+	state = <-cc.states
+	require.Len(t, state.Addresses, 2)
+	require.Equal(t, "10.0.0.2:50051", state.Addresses[1].Addr)
+	require.Equal(t, WeightAddrInfo{Weight: 2}, state.Addresses[1].BalancerAttributes.Value(WeightAttributeKey{}))
+}
+
+func TestGetRegistry(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "services.yml")
+	config.GddStaticFile.Write(file)
+	config.GddServiceName.Write("usersvc")
+	defer os.Unsetenv(string(config.GddStaticFile))
+	defer os.Unsetenv(string(config.GddServiceName))
+	defer func() {
+		reg = nil
+	}()
+
+	require.Error(t, NewRest())
+	_, err := ListInstances("usersvc_rest")
+	require.Error(t, err)
+	require.False(t, HasService("usersvc_rest"))
+	sp := NewSWRRServiceProvider("usersvc_rest")
+	require.Equal(t, "", sp.SelectServer())
+
+	// loaded on next call once the file is fixed
+	writeServices(t, file, testServices)
+	require.NoError(t, NewRest())
+	instances, err := ListInstances("usersvc_rest")
+	require.NoError(t, err)
+	require.Len(t, instances, 2)
+	require.Len(t, sp.Instances(), 2)
+}
@@ -0,0 +1,68 @@
+package static
+
+import (
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/attributes"
+	gresolver "google.golang.org/grpc/resolver"
+)
+
+const schemeName = "static"
+
+var _ gresolver.Builder = (*builder)(nil)
+var _ gresolver.Resolver = (*resolver)(nil)
+
+func init() {
+	gresolver.Register(&builder{})
+}
+
+type builder struct {
+}
+
+func (b *builder) Scheme() string {
+	return schemeName
+}
+
+func (b *builder) Build(target gresolver.Target, cc gresolver.ClientConn, opts gresolver.BuildOptions) (gresolver.Resolver, error) {
+	name := target.URL.Host
+	if len(name) == 0 {
+		return nil, errors.Errorf("Wrong static URL %s", target.URL.String())
+	}
+	reg, err := getRegistry()
+	if err != nil {
+		return nil, err
+	}
+	r := &resolver{
+		reg:  reg,
+		name: name,
+		cc:   cc,
+	}
+	r.UpdateCC()
+	r.unwatch = r.reg.watch(r.UpdateCC)
+	return r, nil
+}
+
+// resolver resolves addresses of a grpc service from the static file, and updates them when the file changes
+type resolver struct {
+	reg     *registry
+	name    string
+	cc      gresolver.ClientConn
+	unwatch func()
+}
+
+func (m *resolver) UpdateCC() {
+	endpoints, _ := m.reg.endpoints(m.name)
+	conns := make([]gresolver.Address, 0, len(endpoints))
+	for _, item := range endpoints {
+		conns = append(conns, gresolver.Address{
+			Addr:               item.Addr,
+			BalancerAttributes: attributes.New(WeightAttributeKey{}, WeightAddrInfo{Weight: item.Weight}),
+		})
+	}
+	m.cc.UpdateState(gresolver.State{Addresses: conns})
+}
+
+func (m *resolver) ResolveNow(gresolver.ResolveNowOptions) {}
+
+func (m *resolver) Close() {
+	m.unwatch()
+}
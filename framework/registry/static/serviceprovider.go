@@ -0,0 +1,177 @@
+package static
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/youminxue/odin/toolkit/loadbalance"
+	"github.com/youminxue/odin/toolkit/zlogger"
+	"google.golang.org/grpc"
+)
+
+type server struct {
+	baseUrl       string
+	weight        int
+	currentWeight int
+	metadata      map[string]string
+}
+
+// base keeps servers of a service in sync with the static file
+type base struct {
+	reg     *registry
+	name    string
+	version uint64
+	servers []*server
+}
+
+// refresh rebuilds servers if services are reloaded, current weights of unchanged servers are kept. The static
+// file is loaded again if it failed to load before.
+func (b *base) refresh() {
+	if b.reg == nil {
+		reg, err := getRegistry()
+		if err != nil {
+			zlogger.Error().Err(err).Msgf("[odin] failed to list %s", b.name)
+			return
+		}
+		b.reg = reg
+	}
+	endpoints, version := b.reg.endpoints(b.name)
+	if b.servers != nil && version == b.version {
+		return
+	}
+	old := make(map[string]*server, len(b.servers))
+	for _, s := range b.servers {
+		old[s.baseUrl] = s
+	}
+	servers := make([]*server, 0, len(endpoints))
+	for _, e := range endpoints {
+		s := &server{
+			baseUrl:  e.BaseUrl(),
+			weight:   e.Weight,
+			metadata: e.metadata(),
+		}
+		if prev, ok := old[s.baseUrl]; ok {
+			s.currentWeight = prev.currentWeight
+		}
+		servers = append(servers, s)
+	}
+	b.servers = servers
+	b.version = version
+}
+
+// Instances returns all endpoints of the service sorted by address
+func (b *base) Instances() []loadbalance.Instance {
+	b.refresh()
+	ret := make([]loadbalance.Instance, 0, len(b.servers))
+	for _, item := range b.servers {
+		ret = append(ret, loadbalance.Instance{
+			BaseUrl:  item.baseUrl,
+			Weight:   item.weight,
+			Metadata: item.metadata,
+		})
+	}
+	return ret
+}
+
+// RRServiceProvider is a round-robin IServiceProvider over endpoints in the static file
+type RRServiceProvider struct {
+	base    base
+	current uint64
+	lock    sync.Mutex
+}
+
+// SelectServer selects an endpoint of the service, empty string if there is none
+func (m *RRServiceProvider) SelectServer() string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.base.refresh()
+	if len(m.base.servers) == 0 {
+		zlogger.Error().Msgf("[odin] %s server not found", m.base.name)
+		return ""
+	}
+	m.current = (m.current + 1) % uint64(len(m.base.servers))
+	return m.base.servers[m.current].baseUrl
+}
+
+// Instances returns all endpoints of the service for client-side load balancing
+func (m *RRServiceProvider) Instances() []loadbalance.Instance {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.base.Instances()
+}
+
+// NewRRServiceProvider creates an RRServiceProvider instance
+func NewRRServiceProvider(name string) *RRServiceProvider {
+	return &RRServiceProvider{
+		base: base{
+			name: name,
+		},
+	}
+}
+
+// SWRRServiceProvider is a smooth weighted round-robin IServiceProvider over endpoints in the static file
+// https://github.com/nginx/nginx/commit/52327e0627f49dbda1e8db695e63a4b0af4448b1
+type SWRRServiceProvider struct {
+	base base
+	lock sync.Mutex
+}
+
+// SelectServer selects an endpoint of the service by weight, empty string if there is none
+func (m *SWRRServiceProvider) SelectServer() string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.base.refresh()
+	if len(m.base.servers) == 0 {
+		zlogger.Error().Msgf("[odin] %s server not found", m.base.name)
+		return ""
+	}
+	var selected *server
+	total := 0
+	for _, s := range m.base.servers {
+		s.currentWeight += s.weight
+		total += s.weight
+		if selected == nil || s.currentWeight > selected.currentWeight {
+			selected = s
+		}
+	}
+	selected.currentWeight -= total
+	return selected.baseUrl
+}
+
+// Instances returns all endpoints of the service for client-side load balancing
+func (m *SWRRServiceProvider) Instances() []loadbalance.Instance {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.base.Instances()
+}
+
+// NewSWRRServiceProvider creates an SWRRServiceProvider instance
+func NewSWRRServiceProvider(name string) *SWRRServiceProvider {
+	return &SWRRServiceProvider{
+		base: base{
+			name: name,
+		},
+	}
+}
+
+func NewSWRRGrpcClientConn(service string, dialOptions ...grpc.DialOption) *grpc.ClientConn {
+	return NewGrpcClientConn(service, Name, dialOptions...)
+}
+
+func NewRRGrpcClientConn(service string, dialOptions ...grpc.DialOption) *grpc.ClientConn {
+	return NewGrpcClientConn(service, "round_robin", dialOptions...)
+}
+
+func NewGrpcClientConn(service string, lb string, dialOptions ...grpc.DialOption) *grpc.ClientConn {
+	serverAddr := fmt.Sprintf(schemeName+"://%s/", service)
+	dialOptions = append(dialOptions, grpc.WithBlock(), grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy": "`+lb+`"}`))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	grpcConn, err := grpc.DialContext(ctx, serverAddr, dialOptions...)
+	if err != nil {
+		zlogger.Panic().Err(err).Msgf("[odin] failed to connect to server %s", serverAddr)
+	}
+	return grpcConn
+}
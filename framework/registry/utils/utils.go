@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"sync/atomic"
+
 	"github.com/hashicorp/go-sockaddr"
 	"github.com/youminxue/odin/framework/internal/config"
 	"github.com/youminxue/odin/toolkit/stringutils"
@@ -26,3 +28,21 @@ func GetRegisterHost() string {
 	}
 	return registerHost
 }
+
+// grpcRegisterPort overrides GDD_GRPC_PORT for registration if not zero
+var grpcRegisterPort uint64
+
+// SetGrpcRegisterPort sets the port grpc service is registered with, such as GDD_PORT if grpc shares it with http
+// in single port mode, zero restores GDD_GRPC_PORT
+func SetGrpcRegisterPort(port uint64) {
+	atomic.StoreUint64(&grpcRegisterPort, port)
+}
+
+// GetGrpcRegisterPort returns the port grpc service is registered with, GDD_GRPC_PORT unless set by
+// SetGrpcRegisterPort
+func GetGrpcRegisterPort() uint64 {
+	if port := atomic.LoadUint64(&grpcRegisterPort); port > 0 {
+		return port
+	}
+	return config.GetGrpcPort()
+}
@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/youminxue/odin/framework/internal/config"
+)
+
+func TestGetGrpcRegisterPort(t *testing.T) {
+	config.GddGrpcPort.Write("9090")
+	defer os.Unsetenv(string(config.GddGrpcPort))
+	require.Equal(t, uint64(9090), GetGrpcRegisterPort())
+
+	SetGrpcRegisterPort(8080)
+	require.Equal(t, uint64(8080), GetGrpcRegisterPort())
+	SetGrpcRegisterPort(0)
+	require.Equal(t, uint64(9090), GetGrpcRegisterPort())
+}
@@ -0,0 +1,65 @@
+package rest
+
+import (
+	"github.com/pkg/errors"
+	"github.com/youminxue/odin/framework/auth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+)
+
+// Auth creates a middleware authenticating and authorizing requests by authorizer with the matched route name,
+// which is the method name of generated handlers, so auth.NewAuthorizer can enforce annotations from the
+// generated httpsrv.RouteAnnotationStore. Requests of unnamed routes are authorized with http method and path,
+// which are not annotated. The subject of authenticated caller is also stored by ContextWithUserId.
+// Failures are rendered by HandleErr with 401 or 403 status code.
+func Auth(authorizer auth.Authorizer) func(inner http.Handler) http.Handler {
+	return authBy(authorizer, func(route string) string {
+		return route
+	})
+}
+
+// AuthByMethod creates a middleware like Auth, but authorizes requests with the full rpc method mapped from the
+// matched route name by fullMethods, such as transcoding.FullMethods generated for grpc-json transcoding routes,
+// so that transcoded requests are authorized by the same annotations as rpc calls. Routes not in fullMethods are
+// authorized with the route name.
+func AuthByMethod(authorizer auth.Authorizer, fullMethods map[string]string) func(inner http.Handler) http.Handler {
+	return authBy(authorizer, func(route string) string {
+		if fullMethod, ok := fullMethods[route]; ok {
+			return fullMethod
+		}
+		return route
+	})
+}
+
+func authBy(authorizer auth.Authorizer, keyOf func(route string) string) func(inner http.Handler) http.Handler {
+	return func(inner http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := RateLimitByRoute(r)
+			if route == "" {
+				route = r.Method + " " + r.URL.Path
+			}
+			ctx, err := authorizer.Authorize(auth.ContextWithHeader(r.Context(), r.Header), keyOf(route))
+			if err != nil {
+				HandleErr(w, r, authError(w, err))
+				return
+			}
+			if principal := auth.PrincipalFromContext(ctx); principal != nil && UserIdFromContext(ctx) == "" {
+				ctx = ContextWithUserId(ctx, principal.Subject)
+			}
+			inner.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func authError(w http.ResponseWriter, err error) error {
+	if _, ok := AsBizError(err); ok {
+		return err
+	}
+	s, _ := status.FromError(err)
+	if s.Code() == codes.PermissionDenied {
+		return NewBizError(errors.New(s.Message()), WithStatusCode(http.StatusForbidden))
+	}
+	w.Header().Set(HeaderWWWAuthenticate, "Bearer")
+	return NewBizError(errors.New(s.Message()), WithStatusCode(http.StatusUnauthorized))
+}
@@ -0,0 +1,76 @@
+package rest
+
+import (
+	"github.com/stretchr/testify/require"
+	"github.com/youminxue/odin/framework"
+	"github.com/youminxue/odin/framework/auth"
+	"github.com/youminxue/odin/framework/rest/httprouter"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuth(t *testing.T) {
+	store := framework.AnnotationStore{
+		"DeleteUser": {
+			{Name: auth.AnnotationRole, Params: []string{"admin"}},
+		},
+	}
+	authorizer := auth.NewAuthorizer(store, auth.NewAPIKeyAuthenticator("X-API-Key", map[string]*auth.Principal{
+		"k1": {Subject: "svc-a", Roles: []string{"admin"}},
+		"k2": {Subject: "svc-b"},
+	}))
+	router := httprouter.New()
+	router.SaveMatchedRoutePath = true
+	router.Handler(http.MethodDelete, "/user", Auth(authorizer)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(UserIdFromContext(r.Context())))
+	})), "DeleteUser")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/user", nil))
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.Equal(t, "Bearer", w.Header().Get(HeaderWWWAuthenticate))
+	require.Contains(t, w.Body.String(), "missing credentials")
+
+	r := httptest.NewRequest(http.MethodDelete, "/user", nil)
+	r.Header.Set("X-API-Key", "k2")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	r = httptest.NewRequest(http.MethodDelete, "/user", nil)
+	r.Header.Set("X-API-Key", "k1")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "svc-a", w.Body.String())
+}
+
+func TestAuthByMethod(t *testing.T) {
+	store := framework.AnnotationStore{
+		"DeleteUserRpc": {
+			{Name: auth.AnnotationRole, Params: []string{"admin"}},
+		},
+	}
+	authorizer := auth.NewAuthorizer(store, auth.NewAPIKeyAuthenticator("X-API-Key", map[string]*auth.Principal{
+		"k1": {Subject: "svc-a", Roles: []string{"admin"}},
+	}))
+	router := httprouter.New()
+	router.SaveMatchedRoutePath = true
+	router.Handler(http.MethodDelete, "/user", AuthByMethod(authorizer, map[string]string{
+		"DeleteUser": "/usersvc.UsersvcService/DeleteUserRpc",
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(UserIdFromContext(r.Context())))
+	})), "DeleteUser")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/user", nil))
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	r := httptest.NewRequest(http.MethodDelete, "/user", nil)
+	r.Header.Set("X-API-Key", "k1")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "svc-a", w.Body.String())
+}
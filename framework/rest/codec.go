@@ -0,0 +1,490 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/hashicorp/go-msgpack/codec"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// MediaTypeJSON is the default media type of request and response bodies
+	MediaTypeJSON = "application/json"
+	// MediaTypeMsgPack is the media type of MessagePack bodies
+	MediaTypeMsgPack = "application/msgpack"
+	// MediaTypeProtobuf is the media type of protobuf bodies
+	MediaTypeProtobuf = "application/x-protobuf"
+	// MediaTypeForm is the media type of url encoded form bodies
+	MediaTypeForm = "application/x-www-form-urlencoded"
+)
+
+// errUnsupportedBody is returned by codecs which cannot encode or decode the given value,
+// e.g. protobuf codec for a value without registered message
+var errUnsupportedBody = errors.New("unsupported body")
+
+// BodyOptions are options of encoding and decoding a body, only protobuf codec uses them for now
+type BodyOptions struct {
+	// ProtoMessage is the name of the protobuf message of the body registered by RegisterProtoMessage
+	ProtoMessage string
+	// ProtoValue is encoded into or decoded from ProtoMessage instead of the body value,
+	// e.g. the only result of a method whose json body wraps it in an object
+	ProtoValue interface{}
+	// ProtoField is the json name of the field of ProtoMessage holding the body value,
+	// e.g. the struct parameter of a method whose gRPC request message carries all parameters
+	ProtoField string
+}
+
+// BodyOption sets BodyOptions
+type BodyOption func(*BodyOptions)
+
+// WithProtoMessage sets the name of the protobuf message of the body
+func WithProtoMessage(name string) BodyOption {
+	return func(options *BodyOptions) {
+		options.ProtoMessage = name
+	}
+}
+
+// WithProtoValue sets the value encoded into or decoded from the protobuf message instead of the body value
+func WithProtoValue(v interface{}) BodyOption {
+	return func(options *BodyOptions) {
+		options.ProtoValue = v
+	}
+}
+
+// WithProtoField sets the json name of the field of the protobuf message holding the body value
+func WithProtoField(name string) BodyOption {
+	return func(options *BodyOptions) {
+		options.ProtoField = name
+	}
+}
+
+func newBodyOptions(opts []BodyOption) BodyOptions {
+	var options BodyOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// Codec encodes and decodes request and response bodies of a media type
+type Codec interface {
+	// ContentType returns value of Content-Type header of encoded bodies
+	ContentType() string
+	// Marshal encodes v, it returns an error wrapping errUnsupportedBody if v cannot be encoded by the codec
+	Marshal(v interface{}, options BodyOptions) ([]byte, error)
+	// Unmarshal decodes data into v, which must be a non-nil pointer
+	Unmarshal(data []byte, v interface{}, options BodyOptions) error
+}
+
+var (
+	codecMu sync.RWMutex
+	codecs  = make(map[string]Codec)
+)
+
+func init() {
+	RegisterCodec(jsonCodec{})
+	RegisterCodec(newMsgPackCodec(), "application/x-msgpack", "application/vnd.msgpack")
+	RegisterCodec(protobufCodec{}, "application/protobuf", "application/vnd.google.protobuf")
+	RegisterCodec(formCodec{})
+}
+
+// RegisterCodec registers codec for its content type and aliases, an existing codec of the same media type is replaced
+func RegisterCodec(c Codec, aliases ...string) {
+	codecMu.Lock()
+	defer codecMu.Unlock()
+	for _, item := range append([]string{c.ContentType()}, aliases...) {
+		codecs[baseMediaType(item)] = c
+	}
+}
+
+// CodecOf returns the codec registered for media type of contentType, json codec for empty contentType
+func CodecOf(contentType string) (Codec, bool) {
+	mediaType := baseMediaType(contentType)
+	if mediaType == "" {
+		mediaType = MediaTypeJSON
+	}
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+	c, ok := codecs[mediaType]
+	return c, ok
+}
+
+func baseMediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.TrimSpace(strings.Split(contentType, ";")[0])
+	}
+	return strings.ToLower(mediaType)
+}
+
+// Marshal encodes v with the codec of contentType, generated http clients use it to send request bodies
+func Marshal(contentType string, v interface{}, opts ...BodyOption) ([]byte, error) {
+	c, ok := CodecOf(contentType)
+	if !ok {
+		return nil, errors.Errorf("no codec registered for %s", contentType)
+	}
+	return c.Marshal(v, newBodyOptions(opts))
+}
+
+// Unmarshal decodes data with the codec of contentType, generated http clients use it to read response bodies.
+// Bodies of unregistered content types such as text/plain are decoded as json.
+func Unmarshal(contentType string, data []byte, v interface{}, opts ...BodyOption) error {
+	c, ok := CodecOf(contentType)
+	if !ok {
+		c = jsonCodec{}
+	}
+	return c.Unmarshal(data, v, newBodyOptions(opts))
+}
+
+// DecodeBody decodes request body of r into v by its Content-Type. Bodies of unregistered content types such as
+// text/plain are decoded as json like Unmarshal, so that clients not setting Content-Type properly keep working.
+// It returns io.EOF if the body is empty, and a BizError with 415 status code if the registered codec cannot
+// decode v, e.g. protobuf body into a non-proto struct.
+func DecodeBody(r *http.Request, v interface{}, opts ...BodyOption) error {
+	contentType := r.Header.Get(HeaderContentType)
+	c, ok := CodecOf(contentType)
+	if !ok {
+		c = jsonCodec{}
+	}
+	if r.Body == nil {
+		return io.EOF
+	}
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return io.EOF
+	}
+	if err = c.Unmarshal(data, v, newBodyOptions(opts)); errors.Is(err, errUnsupportedBody) {
+		return NewBizError(errors.Errorf("unsupported content type %s", contentType), WithStatusCode(http.StatusUnsupportedMediaType))
+	}
+	return err
+}
+
+// WriteBody writes v to w encoded by the first codec accepted by the Accept header of r which is able to encode v,
+// json is used if there is none
+func WriteBody(w http.ResponseWriter, r *http.Request, v interface{}, opts ...BodyOption) error {
+	options := newBodyOptions(opts)
+	var (
+		data []byte
+		err  error
+		c    Codec
+	)
+	for _, mediaType := range accepted(r.Header.Get(HeaderAccept)) {
+		var ok bool
+		if c, ok = CodecOf(mediaType); !ok {
+			continue
+		}
+		if data, err = c.Marshal(v, options); err == nil {
+			break
+		}
+		if !errors.Is(err, errUnsupportedBody) {
+			return err
+		}
+		c = nil
+	}
+	if c == nil {
+		c = jsonCodec{}
+		if data, err = c.Marshal(v, options); err != nil {
+			return err
+		}
+	}
+	w.Header().Set(HeaderContentType, c.ContentType())
+	_, err = w.Write(data)
+	return errors.WithStack(err)
+}
+
+// accepted returns media types of accept ordered by quality, wildcards and media types of zero quality are dropped
+func accepted(accept string) []string {
+	type item struct {
+		mediaType string
+		q         float64
+	}
+	var items []item
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || strings.Contains(mediaType, "*") {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			items = append(items, item{mediaType, q})
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].q > items[j].q })
+	result := make([]string, 0, len(items))
+	for _, it := range items {
+		result = append(result, it.mediaType)
+	}
+	return result
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return "application/json; charset=UTF-8"
+}
+
+func (jsonCodec) Marshal(v interface{}, _ BodyOptions) ([]byte, error) {
+	if m, ok := v.(proto.Message); ok {
+		data, err := protojson.Marshal(m)
+		return data, errors.WithStack(err)
+	}
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}, _ BodyOptions) error {
+	if m, ok := v.(proto.Message); ok {
+		return errors.WithStack(protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, m))
+	}
+	return errors.WithStack(json.Unmarshal(data, v))
+}
+
+type msgPackCodec struct {
+	handle *codec.MsgpackHandle
+}
+
+func newMsgPackCodec() msgPackCodec {
+	handle := &codec.MsgpackHandle{}
+	handle.RawToString = true
+	handle.WriteExt = true
+	handle.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	return msgPackCodec{handle: handle}
+}
+
+func (msgPackCodec) ContentType() string {
+	return MediaTypeMsgPack
+}
+
+func (c msgPackCodec) Marshal(v interface{}, _ BodyOptions) ([]byte, error) {
+	if _, ok := v.(proto.Message); ok {
+		return nil, errors.Wrap(errUnsupportedBody, "protobuf message cannot be encoded as msgpack")
+	}
+	var data []byte
+	if err := codec.NewEncoderBytes(&data, c.handle).Encode(v); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return data, nil
+}
+
+func (c msgPackCodec) Unmarshal(data []byte, v interface{}, _ BodyOptions) error {
+	if _, ok := v.(proto.Message); ok {
+		return errors.Wrap(errUnsupportedBody, "protobuf message cannot be decoded from msgpack")
+	}
+	return errors.WithStack(codec.NewDecoderBytes(data, c.handle).Decode(v))
+}
+
+// formCodec encodes top level fields of a value as url encoded form, nested values are encoded as json strings
+type formCodec struct{}
+
+func (formCodec) ContentType() string {
+	return MediaTypeForm
+}
+
+func (formCodec) Marshal(v interface{}, _ BodyOptions) ([]byte, error) {
+	data, err := jsonCodec{}.Marshal(v, BodyOptions{})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var fields map[string]interface{}
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return nil, errors.Wrap(errUnsupportedBody, "form body must be an object")
+	}
+	values := url.Values{}
+	for key, value := range fields {
+		switch value := value.(type) {
+		case nil:
+		case []interface{}:
+			for _, item := range value {
+				values.Add(key, formValue(item))
+			}
+		default:
+			values.Set(key, formValue(value))
+		}
+	}
+	return []byte(values.Encode()), nil
+}
+
+func formValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64, bool:
+		return fmt.Sprint(v)
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+func (formCodec) Unmarshal(data []byte, v interface{}, _ BodyOptions) error {
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if m, ok := v.(proto.Message); ok {
+		return setProtoFields(m.ProtoReflect(), values)
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("form body must be decoded into a non-nil pointer")
+	}
+	rv = rv.Elem()
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Struct:
+		return decodeFormStruct(values, rv)
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return errors.Wrap(errUnsupportedBody, "form body must be decoded into a struct or a map with string key")
+		}
+		if rv.IsNil() {
+			rv.Set(reflect.MakeMap(rv.Type()))
+		}
+		for key, items := range values {
+			elem := reflect.New(rv.Type().Elem()).Elem()
+			if err = setFormValue(elem, items); err != nil {
+				return errors.Wrapf(err, "invalid form field %s", key)
+			}
+			rv.SetMapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()), elem)
+		}
+		return nil
+	default:
+		return errors.Wrap(errUnsupportedBody, "form body must be decoded into a struct or a map with string key")
+	}
+}
+
+func decodeFormStruct(values url.Values, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := field.Name
+		if tag := field.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+			if n := strings.Split(tag, ",")[0]; n != "" {
+				name = n
+			}
+		}
+		items, ok := values[name]
+		if !ok {
+			// json matches keys case-insensitively too
+			for key, value := range values {
+				if strings.EqualFold(key, name) {
+					items, ok = value, true
+					break
+				}
+			}
+		}
+		if !ok {
+			continue
+		}
+		if err := setFormValue(rv.Field(i), items); err != nil {
+			return errors.Wrapf(err, "invalid form field %s", name)
+		}
+	}
+	return nil
+}
+
+func setFormValue(rv reflect.Value, items []string) error {
+	if len(items) == 0 {
+		return nil
+	}
+	switch rv.Kind() {
+	case reflect.Ptr:
+		elem := reflect.New(rv.Type().Elem())
+		if err := setFormValue(elem.Elem(), items); err != nil {
+			return err
+		}
+		rv.Set(elem)
+		return nil
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+		slice := reflect.MakeSlice(rv.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setFormValue(slice.Index(i), []string{item}); err != nil {
+				return err
+			}
+		}
+		rv.Set(slice)
+		return nil
+	}
+	item := items[0]
+	switch rv.Kind() {
+	case reflect.String:
+		rv.SetString(item)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(item)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		rv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(item, 10, rv.Type().Bits())
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		rv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(item, 10, rv.Type().Bits())
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		rv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(item, rv.Type().Bits())
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		rv.SetFloat(f)
+	case reflect.Interface:
+		if rv.NumMethod() > 0 {
+			return errors.Errorf("cannot decode form value into %s", rv.Type())
+		}
+		rv.Set(reflect.ValueOf(item))
+	default:
+		// nested structs, time.Time, decimal.Decimal and so on are decoded as json, or as json string
+		ptr := rv.Addr().Interface()
+		if err := json.Unmarshal([]byte(item), ptr); err != nil {
+			quoted, _ := json.Marshal(item)
+			if err = json.Unmarshal(quoted, ptr); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+	return nil
+}
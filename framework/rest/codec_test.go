@@ -0,0 +1,144 @@
+package rest
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/apipb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/typepb"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type codecUser struct {
+	Id      int64    `json:"id"`
+	Name    string   `json:"name"`
+	Tags    []string `json:"tags"`
+	Score   *float64 `json:"score"`
+	private string
+}
+
+func TestCodecOf(t *testing.T) {
+	c, ok := CodecOf("")
+	require.True(t, ok)
+	require.Equal(t, "application/json; charset=UTF-8", c.ContentType())
+	c, ok = CodecOf("application/x-msgpack")
+	require.True(t, ok)
+	require.Equal(t, MediaTypeMsgPack, c.ContentType())
+	_, ok = CodecOf("text/csv")
+	require.False(t, ok)
+}
+
+func TestAccepted(t *testing.T) {
+	require.Equal(t, []string{MediaTypeProtobuf, MediaTypeMsgPack},
+		accepted("application/msgpack;q=0.5, */*;q=0.1, application/x-protobuf, application/json;q=0"))
+	require.Empty(t, accepted(""))
+}
+
+func TestDecodeBody(t *testing.T) {
+	body, err := Marshal(MediaTypeMsgPack, codecUser{Id: 1, Name: "jack", Tags: []string{"a"}})
+	require.NoError(t, err)
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	r.Header.Set(HeaderContentType, MediaTypeMsgPack)
+	var user codecUser
+	require.NoError(t, DecodeBody(r, &user))
+	require.Equal(t, codecUser{Id: 1, Name: "jack", Tags: []string{"a"}}, user)
+
+	r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("id=2&Name=rose&tags=a&tags=b&score=9.5"))
+	r.Header.Set(HeaderContentType, MediaTypeForm)
+	user = codecUser{}
+	require.NoError(t, DecodeBody(r, &user))
+	require.Equal(t, int64(2), user.Id)
+	require.Equal(t, "rose", user.Name)
+	require.Equal(t, []string{"a", "b"}, user.Tags)
+	require.Equal(t, 9.5, *user.Score)
+
+	r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(""))
+	require.Equal(t, io.EOF, DecodeBody(r, &user))
+
+	// bodies of unregistered content types are decoded as json
+	r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"id":3,"name":"lily"}`))
+	r.Header.Set(HeaderContentType, "text/plain")
+	user = codecUser{}
+	require.NoError(t, DecodeBody(r, &user))
+	require.Equal(t, codecUser{Id: 3, Name: "lily"}, user)
+
+	r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("x"))
+	r.Header.Set(HeaderContentType, MediaTypeProtobuf)
+	bizErr, ok := AsBizError(DecodeBody(r, &user))
+	require.True(t, ok)
+	require.Equal(t, http.StatusUnsupportedMediaType, bizErr.StatusCode)
+}
+
+func TestWriteBody(t *testing.T) {
+	user := codecUser{Id: 1, Name: "jack"}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(HeaderAccept, "application/msgpack")
+	require.NoError(t, WriteBody(w, r, user))
+	require.Equal(t, MediaTypeMsgPack, w.Header().Get(HeaderContentType))
+	var result codecUser
+	require.NoError(t, Unmarshal(w.Header().Get(HeaderContentType), w.Body.Bytes(), &result))
+	require.Equal(t, user, result)
+
+	// no protobuf message registered for the body, so it falls back to json
+	w = httptest.NewRecorder()
+	r.Header.Set(HeaderAccept, "application/x-protobuf")
+	require.NoError(t, WriteBody(w, r, user))
+	require.Equal(t, "application/json; charset=UTF-8", w.Header().Get(HeaderContentType))
+	require.Equal(t, "{\"id\":1,\"name\":\"jack\",\"tags\":null,\"score\":null}\n", w.Body.String())
+}
+
+type codecMethod struct {
+	Name             string `json:"name"`
+	RequestStreaming bool   `json:"requestStreaming"`
+	Syntax           string `json:"syntax"`
+}
+
+func TestProtobufCodec(t *testing.T) {
+	RegisterProtoMessage("Method", func() proto.Message { return new(apipb.Method) })
+
+	// the only result is the message itself, while json body wraps it
+	body := struct {
+		Data codecMethod `json:"data"`
+	}{Data: codecMethod{Name: "GetUser", RequestStreaming: true, Syntax: "SYNTAX_PROTO3"}}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(HeaderAccept, MediaTypeProtobuf)
+	require.NoError(t, WriteBody(w, r, body, WithProtoMessage("Method"), WithProtoValue(body.Data)))
+	require.Equal(t, MediaTypeProtobuf, w.Header().Get(HeaderContentType))
+	var msg apipb.Method
+	require.NoError(t, proto.Unmarshal(w.Body.Bytes(), &msg))
+	require.Equal(t, "GetUser", msg.Name)
+	require.True(t, msg.RequestStreaming)
+	require.Equal(t, typepb.Syntax_SYNTAX_PROTO3, msg.Syntax)
+
+	var result struct {
+		Data codecMethod `json:"data"`
+	}
+	require.NoError(t, Unmarshal(w.Header().Get(HeaderContentType), w.Body.Bytes(), &result,
+		WithProtoMessage("Method"), WithProtoValue(&result.Data)))
+	require.Equal(t, body, result)
+
+	// the body is a field of the message
+	data, err := Marshal(MediaTypeProtobuf, "ListUsers", WithProtoMessage("Method"), WithProtoField("name"))
+	require.NoError(t, err)
+	r = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data))
+	r.Header.Set(HeaderContentType, MediaTypeProtobuf)
+	var name string
+	require.NoError(t, DecodeBody(r, &name, WithProtoMessage("Method"), WithProtoField("name")))
+	require.Equal(t, "ListUsers", name)
+
+	// proto messages are sent as is
+	now := time.Now().UTC()
+	data, err = Marshal(MediaTypeProtobuf, timestamppb.New(now))
+	require.NoError(t, err)
+	var ts timestamppb.Timestamp
+	require.NoError(t, Unmarshal(MediaTypeProtobuf, data, &ts))
+	require.True(t, now.Equal(ts.AsTime()))
+}
@@ -0,0 +1,172 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ascarter/requestid"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/uber/jaeger-client-go"
+	"github.com/youminxue/odin/toolkit/stringutils"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	// ContentTypeProblemJson is the media type defined by RFC 7807
+	ContentTypeProblemJson = "application/problem+json"
+	contentTypeErrorJson   = "application/json; charset=UTF-8"
+)
+
+// ErrorResponse is the machine-readable envelope written for failed requests.
+// Type, Title, Status, Detail and Instance are only filled for RFC 7807 problem+json responses,
+// Message is only filled for plain json responses.
+type ErrorResponse struct {
+	Type      string `json:"type,omitempty"`
+	Title     string `json:"title,omitempty"`
+	Status    int    `json:"status,omitempty"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	ErrCode   int    `json:"errCode"`
+	Message   string `json:"message,omitempty"`
+	RequestId string `json:"requestId,omitempty"`
+	TraceId   string `json:"traceId,omitempty"`
+}
+
+// ErrorEncoder writes err to w as http response
+type ErrorEncoder func(w http.ResponseWriter, r *http.Request, err error)
+
+var (
+	errorEncoder     ErrorEncoder = DefaultErrorEncoder
+	errorEncoderLock sync.RWMutex
+)
+
+// SetErrorEncoder replaces the error encoder used by HandleErr, nil restores DefaultErrorEncoder
+func SetErrorEncoder(encoder ErrorEncoder) {
+	errorEncoderLock.Lock()
+	defer errorEncoderLock.Unlock()
+	if encoder == nil {
+		encoder = DefaultErrorEncoder
+	}
+	errorEncoder = encoder
+}
+
+// GetErrorEncoder returns the error encoder used by HandleErr
+func GetErrorEncoder() ErrorEncoder {
+	errorEncoderLock.RLock()
+	defer errorEncoderLock.RUnlock()
+	return errorEncoder
+}
+
+// HandleErr writes err to w with the configured ErrorEncoder
+func HandleErr(w http.ResponseWriter, r *http.Request, err error) {
+	GetErrorEncoder()(w, r, err)
+}
+
+// HandleBadRequestErr writes err to w with the configured ErrorEncoder,
+// errors other than BizError are responded with 400 status code
+func HandleBadRequestErr(w http.ResponseWriter, r *http.Request, err error) {
+	if _, ok := AsBizError(err); !ok {
+		err = NewBizError(err, WithStatusCode(http.StatusBadRequest))
+	}
+	HandleErr(w, r, err)
+}
+
+// AsBizError finds the first BizError or *BizError in err's chain
+func AsBizError(err error) (BizError, bool) {
+	var bizErr BizError
+	if errors.As(err, &bizErr) {
+		return bizErr, true
+	}
+	var bizErrPtr *BizError
+	if errors.As(err, &bizErrPtr) && bizErrPtr != nil {
+		return *bizErrPtr, true
+	}
+	return BizError{}, false
+}
+
+// NewErrorResponse converts err to ErrorResponse. Status code is taken from BizError,
+// 400 for context.Canceled and 500 for all other errors. Message is translated by the translator
+// set by SetTranslator if there is a translation for it.
+func NewErrorResponse(r *http.Request, err error) (int, ErrorResponse) {
+	statusCode := http.StatusInternalServerError
+	resp := ErrorResponse{
+		Message: err.Error(),
+	}
+	if bizErr, ok := AsBizError(err); ok {
+		if bizErr.StatusCode > 0 {
+			statusCode = bizErr.StatusCode
+		}
+		resp.ErrCode = bizErr.ErrCode
+		resp.Message = bizErr.ErrMsg
+	} else if errors.Is(err, context.Canceled) {
+		statusCode = http.StatusBadRequest
+	}
+	resp.Message = translate(resp.Message)
+	if r != nil {
+		resp.RequestId, _ = requestid.FromContext(r.Context())
+		resp.TraceId = traceIdFromContext(r.Context())
+	}
+	return statusCode, resp
+}
+
+// DefaultErrorEncoder writes err as json envelope, or as RFC 7807 problem+json if the request accepts it
+func DefaultErrorEncoder(w http.ResponseWriter, r *http.Request, err error) {
+	statusCode, resp := NewErrorResponse(r, err)
+	contentType := contentTypeErrorJson
+	if r != nil && strings.Contains(r.Header.Get("Accept"), ContentTypeProblemJson) {
+		contentType = ContentTypeProblemJson
+		resp.Type = "about:blank"
+		resp.Title = http.StatusText(statusCode)
+		resp.Status = statusCode
+		resp.Detail = resp.Message
+		resp.Instance = r.URL.Path
+		resp.Message = ""
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// DecodeBizError converts an error response back into BizError. Both json envelope and problem+json
+// are supported, other response body is used as error message directly.
+func DecodeBizError(statusCode int, body []byte) BizError {
+	bizErr := BizError{
+		StatusCode: statusCode,
+		ErrMsg:     strings.TrimSpace(string(body)),
+	}
+	var resp ErrorResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return bizErr
+	}
+	if stringutils.IsEmpty(resp.Message) && stringutils.IsEmpty(resp.Detail) {
+		return bizErr
+	}
+	bizErr.ErrCode = resp.ErrCode
+	bizErr.ErrMsg = resp.Message
+	if stringutils.IsEmpty(bizErr.ErrMsg) {
+		bizErr.ErrMsg = resp.Detail
+	}
+	return bizErr
+}
+
+func translate(msg string) string {
+	trans := GetTranslator()
+	if trans == nil || stringutils.IsEmpty(msg) {
+		return msg
+	}
+	if translated, err := trans.T(msg); err == nil && stringutils.IsNotEmpty(translated) {
+		return translated
+	}
+	return msg
+}
+
+func traceIdFromContext(ctx context.Context) string {
+	span := opentracing.SpanFromContext(ctx)
+	if jspan, ok := span.(*jaeger.Span); ok {
+		return jspan.SpanContext().TraceID().String()
+	}
+	return ""
+}
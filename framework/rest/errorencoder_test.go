@@ -0,0 +1,141 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type mockTranslator struct {
+	ut.Translator
+	messages map[string]string
+}
+
+func (m *mockTranslator) T(key interface{}, params ...string) (string, error) {
+	if msg, ok := m.messages[key.(string)]; ok {
+		return msg, nil
+	}
+	return "", ut.ErrUnknowTranslation
+}
+
+func TestDefaultErrorEncoder(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		want       ErrorResponse
+	}{
+		{
+			name:       "BizError",
+			err:        NewBizError(errors.New("user not found"), WithStatusCode(http.StatusNotFound), WithErrCode(100404)),
+			wantStatus: http.StatusNotFound,
+			want:       ErrorResponse{ErrCode: 100404, Message: "user not found"},
+		},
+		{
+			name:       "BizError pointer",
+			err:        errors.Wrap(&BizError{StatusCode: http.StatusForbidden, ErrCode: 100403, ErrMsg: "forbidden"}, "wrapped"),
+			wantStatus: http.StatusForbidden,
+			want:       ErrorResponse{ErrCode: 100403, Message: "forbidden"},
+		},
+		{
+			name:       "context canceled",
+			err:        context.Canceled,
+			wantStatus: http.StatusBadRequest,
+			want:       ErrorResponse{Message: context.Canceled.Error()},
+		},
+		{
+			name:       "unknown error",
+			err:        errors.New("boom"),
+			wantStatus: http.StatusInternalServerError,
+			want:       ErrorResponse{Message: "boom"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			DefaultErrorEncoder(w, httptest.NewRequest(http.MethodGet, "/users/1", nil), tt.err)
+			require.Equal(t, tt.wantStatus, w.Code)
+			require.Equal(t, contentTypeErrorJson, w.Header().Get("Content-Type"))
+			var got ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDefaultErrorEncoder_problemJson(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	r.Header.Set("Accept", ContentTypeProblemJson)
+	DefaultErrorEncoder(w, r, NewBizError(errors.New("user not found"), WithStatusCode(http.StatusNotFound), WithErrCode(100404)))
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Equal(t, ContentTypeProblemJson, w.Header().Get("Content-Type"))
+	var got ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	require.Equal(t, ErrorResponse{
+		Type:     "about:blank",
+		Title:    "Not Found",
+		Status:   http.StatusNotFound,
+		Detail:   "user not found",
+		Instance: "/users/1",
+		ErrCode:  100404,
+	}, got)
+}
+
+func TestDefaultErrorEncoder_translate(t *testing.T) {
+	defer SetTranslator(GetTranslator())
+	SetTranslator(&mockTranslator{messages: map[string]string{"user not found": "用户不存在"}})
+	w := httptest.NewRecorder()
+	DefaultErrorEncoder(w, httptest.NewRequest(http.MethodGet, "/users/1", nil), NewBizError(errors.New("user not found")))
+	var got ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	require.Equal(t, "用户不存在", got.Message)
+
+	w = httptest.NewRecorder()
+	DefaultErrorEncoder(w, httptest.NewRequest(http.MethodGet, "/users/1", nil), errors.New("boom"))
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	require.Equal(t, "boom", got.Message)
+}
+
+func TestSetErrorEncoder(t *testing.T) {
+	defer SetErrorEncoder(nil)
+	SetErrorEncoder(func(w http.ResponseWriter, r *http.Request, err error) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	w := httptest.NewRecorder()
+	HandleErr(w, httptest.NewRequest(http.MethodGet, "/", nil), errors.New("boom"))
+	require.Equal(t, http.StatusTeapot, w.Code)
+}
+
+func TestHandleBadRequestErr(t *testing.T) {
+	w := httptest.NewRecorder()
+	HandleBadRequestErr(w, httptest.NewRequest(http.MethodGet, "/", nil), errors.New("missing parameter userId"))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	HandleBadRequestErr(w, httptest.NewRequest(http.MethodGet, "/", nil), NewBizError(errors.New("conflict"), WithStatusCode(http.StatusConflict)))
+	require.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestDecodeBizError(t *testing.T) {
+	require.Equal(t, BizError{StatusCode: 404, ErrCode: 100404, ErrMsg: "user not found"},
+		DecodeBizError(404, []byte(`{"errCode":100404,"message":"user not found","requestId":"abc"}`)))
+	require.Equal(t, BizError{StatusCode: 404, ErrCode: 100404, ErrMsg: "user not found"},
+		DecodeBizError(404, []byte(`{"type":"about:blank","status":404,"detail":"user not found","errCode":100404}`)))
+	require.Equal(t, BizError{StatusCode: 500, ErrMsg: "internal error"},
+		DecodeBizError(500, []byte("internal error\n")))
+}
+
+func TestValidateVar(t *testing.T) {
+	err := ValidateVar("", "required", "name")
+	bizErr, ok := AsBizError(err)
+	require.True(t, ok)
+	require.Equal(t, http.StatusBadRequest, bizErr.StatusCode)
+	require.Contains(t, bizErr.ErrMsg, "name: ")
+	require.NoError(t, ValidateVar("odin", "required", "name"))
+}
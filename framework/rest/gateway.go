@@ -1,22 +1,26 @@
 package rest
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
 	"fmt"
 	lru "github.com/hashicorp/golang-lru"
-	"github.com/wubin1989/nacos-sdk-go/v2/vo"
+	"github.com/pkg/errors"
 	"github.com/youminxue/odin/framework/cache"
-	"github.com/youminxue/odin/framework/internal/config"
+	"github.com/youminxue/odin/framework/outlier"
 	"github.com/youminxue/odin/framework/registry"
-	"github.com/youminxue/odin/framework/registry/etcd"
-	"github.com/youminxue/odin/framework/registry/nacos"
-	"go.etcd.io/etcd/client/v3"
+	"github.com/youminxue/odin/toolkit/loadbalance"
+	logger "github.com/youminxue/odin/toolkit/zlogger"
+	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
-	"os"
-	"regexp"
-	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Headers borrowed from labstack/echo
@@ -76,6 +80,9 @@ type ProxyTarget struct {
 }
 
 type ProxyConfig struct {
+	// ProviderStore caches service providers by service name.
+	// The default store closes evicted providers so that they stop watching their services,
+	// custom stores should call Close of providers having one on eviction themselves.
 	ProviderStore cache.IStore
 	// To customize the transport to remote.
 	// Examples: If custom TLS certificates are required.
@@ -83,21 +90,20 @@ type ProxyConfig struct {
 
 	// ModifyResponse defines function to modify response from ProxyTarget.
 	ModifyResponse func(*http.Response) error
-}
 
-func captureTokens(pattern *regexp.Regexp, input string) *strings.Replacer {
-	groups := pattern.FindAllStringSubmatch(input, -1)
-	if groups == nil {
-		return nil
-	}
-	values := groups[0][1:]
-	replace := make([]string, 2*len(values))
-	for i, v := range values {
-		j := 2 * i
-		replace[j] = "$" + strconv.Itoa(i+1)
-		replace[j+1] = v
-	}
-	return strings.NewReplacer(replace...)
+	// OutlierDetector ejects unhealthy upstream instances, default to outlier.DefaultDetector() if GDD_OUTLIER_ENABLE is true
+	OutlierDetector *outlier.Detector
+
+	// Routes maps requests to upstream services, default to DefaultGatewayRoutes().
+	// Requests not matching any route are forwarded to the service named by the first path segment
+	Routes *GatewayRouteTable
+
+	// Balancer creates the load balancer of a service, such as loadbalance.NewP2C.
+	// Instances are selected by the discovered service provider if nil
+	Balancer func(service string) loadbalance.Balancer
+
+	// BalanceKey returns affinity key of a request for balancers such as loadbalance.NewConsistentHash
+	BalanceKey func(r *http.Request) string
 }
 
 func getPath(r *http.Request) string {
@@ -115,87 +121,310 @@ func isWebSocket(r *http.Request) bool {
 
 func Proxy(proxyConfig ProxyConfig) func(inner http.Handler) http.Handler {
 	if proxyConfig.ProviderStore == nil {
-		arc, _ := lru.NewARC(128)
-		proxyConfig.ProviderStore = arc
+		store, _ := lru.NewWithEvict(128, onProviderEvicted)
+		proxyConfig.ProviderStore = cache.NewLruCacheAdapter(store)
 	}
 	if proxyConfig.Transport == nil {
 		proxyConfig.Transport = http.DefaultTransport
 	}
+	if proxyConfig.Routes == nil {
+		proxyConfig.Routes = DefaultGatewayRoutes()
+	}
+	if proxyConfig.OutlierDetector == nil && outlier.Enabled() {
+		proxyConfig.OutlierDetector = outlier.DefaultDetector()
+	}
+	detector := proxyConfig.OutlierDetector
+	var balanced balancedProviders
+	lookup := newProviderLookup()
 	return func(inner http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if isWebSocket(r) || r.Header.Get(HeaderAccept) == "text/event-stream" {
-				http.Error(w, fmt.Sprintf("not support"), http.StatusBadGateway)
-				return
+			var serviceName string
+			var retries int
+			if route := proxyConfig.Routes.Match(r); route != nil {
+				if !route.AllowMethod(r.Method) {
+					w.Header().Set(HeaderAllow, strings.Join(route.Methods, ", "))
+					http.Error(w, fmt.Sprintf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+					return
+				}
+				serviceName = route.Service
+				retries = route.Retries
+				r.URL.Path = route.Rewrite(r.URL.Path)
+				r.URL.RawPath = ""
+				for k, v := range route.Headers {
+					r.Header.Set(k, v)
+				}
+				if route.Timeout > 0 {
+					ctx, cancel := context.WithTimeout(r.Context(), route.Timeout)
+					defer cancel()
+					r = r.WithContext(ctx)
+				}
+			} else {
+				parts := strings.Split(r.URL.Path, "/")
+				if len(parts) <= 1 {
+					http.Error(w, fmt.Sprintf("request url must be prefixed / + service name"), http.StatusBadGateway)
+					return
+				}
+				serviceName = parts[1]
+				if path := getPath(r); strings.HasPrefix(path, "/"+serviceName+"/") {
+					r.URL.Path = strings.TrimPrefix(path, "/"+serviceName)
+				}
 			}
-			parts := strings.Split(r.URL.Path, "/")
-			if len(parts) <= 1 {
-				http.Error(w, fmt.Sprintf("request url must be prefixed / + service name"), http.StatusBadGateway)
+			provider := lookup.get(proxyConfig.ProviderStore, serviceName)
+			if provider == nil {
+				http.Error(w, fmt.Sprintf("available server for service %s not found", serviceName), http.StatusBadGateway)
 				return
 			}
-			serviceName := parts[1]
-			modes := strings.Split(os.Getenv("GDD_SERVICE_DISCOVERY_MODE"), ",")
-			var provider registry.IServiceProvider
-			for _, mode := range modes {
-				switch mode {
-				case "nacos":
-					cluster := config.GddNacosClusterName.LoadOrDefault(config.DefaultGddNacosClusterName)
-					group := config.GddNacosGroupName.LoadOrDefault(config.DefaultGddNacosGroupName)
-					_, err := nacos.NamingClient.GetService(vo.GetServiceParam{
-						Clusters:    []string{cluster},
-						ServiceName: serviceName,
-						GroupName:   group,
-					})
-					if err != nil {
-						continue
+			if proxyConfig.Balancer != nil {
+				provider = balanced.get(serviceName, provider, proxyConfig.Balancer)
+			}
+			if detector != nil {
+				provider = detector.Wrap(provider)
+			}
+			var balanceKey string
+			if proxyConfig.BalanceKey != nil {
+				balanceKey = proxyConfig.BalanceKey(r)
+			}
+			if !isIdempotent(r.Method) {
+				retries = 0
+			}
+			if retries > 0 && r.Body != nil && r.Body != http.NoBody && r.GetBody == nil {
+				// buffer request body for replaying it to another upstream instance
+				data, err := ioutil.ReadAll(r.Body)
+				if err != nil {
+					http.Error(w, fmt.Sprintf("read request body error: %s", err), http.StatusBadRequest)
+					return
+				}
+				r.Body = ioutil.NopCloser(bytes.NewReader(data))
+				r.GetBody = func() (io.ReadCloser, error) {
+					return ioutil.NopCloser(bytes.NewReader(data)), nil
+				}
+			}
+			for attempt := 0; ; attempt++ {
+				server, done := pickServer(provider, balanceKey)
+				if server == "" {
+					http.Error(w, fmt.Sprintf("available server for service %s not found", serviceName), http.StatusBadGateway)
+					return
+				}
+				parsed, err := url.Parse(server)
+				if err != nil {
+					done(0, err)
+					http.Error(w, fmt.Sprintf("available server for service %s not found with error: %s", serviceName, err), http.StatusBadGateway)
+					return
+				}
+				tgt := &ProxyTarget{
+					Name: serviceName,
+					URL:  parsed,
+				}
+				if isWebSocket(r) {
+					proxyRaw(tgt, proxyConfig).ServeHTTP(w, r)
+					done(0, nil)
+					return
+				}
+				proxy := proxyHTTP(tgt, proxyConfig)
+				if isEventStream(r) {
+					// flush every write so that server-sent events reach client immediately
+					proxy.FlushInterval = -1
+				}
+				var proxyErr, upstreamErr error
+				var reported bool
+				var latency time.Duration
+				retryable := attempt < retries
+				start := time.Now()
+				proxy.ModifyResponse = func(resp *http.Response) error {
+					failed := resp.StatusCode >= http.StatusInternalServerError
+					latency = time.Since(start)
+					if detector != nil {
+						detector.Report(server, !failed, latency)
 					}
-					if value, ok := proxyConfig.ProviderStore.Get(serviceName); ok {
-						if provider, ok = value.(*nacos.WRRServiceProvider); ok {
-							break
-						}
+					if failed {
+						upstreamErr = errors.Errorf("upstream responded %s", resp.Status)
 					}
-					provider = nacos.NewWRRServiceProvider(serviceName, nacos.WithNacosClusters([]string{cluster}), nacos.WithNacosGroupName(group))
-					proxyConfig.ProviderStore.Add(serviceName, provider)
-				case "etcd":
-					getResponse, err := etcd.EtcdCli.Get(r.Context(), serviceName+"/", clientv3.WithPrefix())
-					if err != nil || getResponse.Count == 0 {
-						continue
+					reported = true
+					if retryable && isRetryableStatus(resp.StatusCode) {
+						return errors.Errorf("upstream responded %s", resp.Status)
 					}
-					if value, ok := proxyConfig.ProviderStore.Get(serviceName); ok {
-						if provider, ok = value.(*etcd.SWRRServiceProvider); ok {
-							break
+					if proxyConfig.ModifyResponse != nil {
+						return proxyConfig.ModifyResponse(resp)
+					}
+					return nil
+				}
+				errorHandler := proxy.ErrorHandler
+				proxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+					if !reported && req.Context().Err() == nil {
+						latency, upstreamErr = time.Since(start), err
+						if detector != nil {
+							detector.Report(server, false, latency)
 						}
 					}
-					provider = etcd.NewSWRRServiceProvider(serviceName)
-					proxyConfig.ProviderStore.Add(serviceName, provider)
-				default:
+					if retryable {
+						proxyErr = err
+						return
+					}
+					errorHandler(w, req, err)
 				}
-				if provider != nil {
-					break
+				req := r
+				if attempt > 0 && r.GetBody != nil {
+					req = r.Clone(r.Context())
+					if req.Body, err = r.GetBody(); err != nil {
+						done(0, nil)
+						http.Error(w, fmt.Sprintf("replay request body error: %s", err), http.StatusBadGateway)
+						return
+					}
 				}
+				proxy.ServeHTTP(w, req)
+				done(latency, upstreamErr)
+				if proxyErr == nil {
+					return
+				}
+				if r.Context().Err() != nil {
+					http.Error(w, fmt.Sprintf("remote %s(%s) unreachable, could not forward: %v", serviceName, server, proxyErr), http.StatusBadGateway)
+					return
+				}
+				logger.Warn().Err(proxyErr).Msgf("[odin] remote %s(%s) unreachable, retry %d", serviceName, server, attempt+1)
 			}
-			if provider == nil {
-				http.Error(w, fmt.Sprintf("available server for service %s not found", serviceName), http.StatusBadGateway)
-				return
-			}
-			k := regexp.MustCompile(strings.Replace(fmt.Sprintf("/%s/*", serviceName), "*", "(\\S*)", -1))
-			replacer := captureTokens(k, getPath(r))
-			if replacer != nil {
-				r.URL.Path = replacer.Replace("/$1")
-			}
-			parsed, err := url.Parse(provider.SelectServer())
-			if err != nil {
-				http.Error(w, fmt.Sprintf("available server for service %s not found with error: %s", serviceName, err), http.StatusBadGateway)
-				return
-			}
-			tgt := &ProxyTarget{
-				Name: serviceName,
-				URL:  parsed,
-			}
-			proxyHTTP(tgt, proxyConfig).ServeHTTP(w, r)
 		})
 	}
 }
 
+// pickServer selects a server for a request with balance key, done is a no-op unless provider is a registry.IBalancedServiceProvider
+func pickServer(provider registry.IServiceProvider, key string) (string, loadbalance.DoneFunc) {
+	if balanced, ok := provider.(registry.IBalancedServiceProvider); ok {
+		return balanced.Pick(key)
+	}
+	return provider.SelectServer(), func(time.Duration, error) {}
+}
+
+// balancedProviders caches balanced providers by service name, so that balancer state such as
+// outstanding requests and latencies survives across requests
+type balancedProviders struct {
+	providers sync.Map
+}
+
+// get returns provider balanced by a balancer created by newBalancer, provider itself if it does not expose instances
+func (b *balancedProviders) get(service string, provider registry.IServiceProvider, newBalancer func(service string) loadbalance.Balancer) registry.IServiceProvider {
+	ip, ok := provider.(registry.IInstanceProvider)
+	if !ok {
+		return provider
+	}
+	if value, ok := b.providers.Load(service); ok && value.(*registry.BalancedProvider).Provider() == ip {
+		return value.(*registry.BalancedProvider)
+	}
+	balanced := registry.NewBalancedProvider(ip, newBalancer(service))
+	b.providers.Store(service, balanced)
+	return balanced
+}
+
+// isIdempotent reports whether requests with method can be safely retried on another instance
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func isRetryableStatus(code int) bool {
+	return code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+}
+
+// missingProviderTTL is how long a service not found is remembered, so that requests for unknown services don't
+// query all backends every time
+const missingProviderTTL = 5 * time.Second
+
+// maxMissingProviders bounds services not found remembered
+const maxMissingProviders = 1024
+
+type providerCall struct {
+	wg       sync.WaitGroup
+	provider registry.IServiceProvider
+}
+
+// providerLookup finds service providers from backends of registry.DefaultDiscovery. Concurrent lookups of
+// a service share one discovery, as providers keep watching their services.
+type providerLookup struct {
+	lock    sync.Mutex
+	calls   map[string]*providerCall
+	missing map[string]time.Time
+}
+
+func newProviderLookup() *providerLookup {
+	return &providerLookup{
+		calls:   make(map[string]*providerCall),
+		missing: make(map[string]time.Time),
+	}
+}
+
+// get returns provider of serviceName cached in store, or discovers it. Nil is returned if no instance is found.
+func (l *providerLookup) get(store cache.IStore, serviceName string) registry.IServiceProvider {
+	if value, ok := store.Get(serviceName); ok {
+		return value.(registry.IServiceProvider)
+	}
+	l.lock.Lock()
+	if expiry, ok := l.missing[serviceName]; ok && time.Now().Before(expiry) {
+		l.lock.Unlock()
+		return nil
+	}
+	if call, ok := l.calls[serviceName]; ok {
+		l.lock.Unlock()
+		call.wg.Wait()
+		return call.provider
+	}
+	call := &providerCall{}
+	call.wg.Add(1)
+	l.calls[serviceName] = call
+	l.lock.Unlock()
+
+	call.provider = discoverProvider(serviceName)
+
+	l.lock.Lock()
+	delete(l.calls, serviceName)
+	if call.provider != nil {
+		delete(l.missing, serviceName)
+		store.Add(serviceName, call.provider)
+	} else {
+		l.remember(serviceName)
+	}
+	l.lock.Unlock()
+	call.wg.Done()
+	return call.provider
+}
+
+// remember marks serviceName missing for missingProviderTTL
+func (l *providerLookup) remember(serviceName string) {
+	now := time.Now()
+	if len(l.missing) >= maxMissingProviders {
+		for name, expiry := range l.missing {
+			if !now.Before(expiry) {
+				delete(l.missing, name)
+			}
+		}
+	}
+	if len(l.missing) < maxMissingProviders {
+		l.missing[serviceName] = now.Add(missingProviderTTL)
+	}
+}
+
+// discoverProvider creates provider of serviceName, nil if no instance is found
+func discoverProvider(serviceName string) registry.IServiceProvider {
+	provider, err := registry.DefaultDiscovery().NewServiceProvider(serviceName)
+	if err != nil {
+		logger.Error().Err(err).Msgf("[odin] failed to discover service %s", serviceName)
+		return nil
+	}
+	if ip, ok := provider.(registry.IInstanceProvider); ok && len(ip.Instances()) == 0 {
+		onProviderEvicted(serviceName, provider)
+		return nil
+	}
+	return provider
+}
+
+// onProviderEvicted stops evicted providers from watching their services
+func onProviderEvicted(_ interface{}, value interface{}) {
+	if sp, ok := value.(interface{ Close() }); ok {
+		sp.Close()
+	}
+}
+
 func singleJoiningSlash(a, b string) string {
 	aslash := strings.HasSuffix(a, "/")
 	bslash := strings.HasPrefix(b, "/")
@@ -208,7 +437,7 @@ func singleJoiningSlash(a, b string) string {
 	return a + b
 }
 
-func proxyHTTP(tgt *ProxyTarget, config ProxyConfig) http.Handler {
+func proxyHTTP(tgt *ProxyTarget, config ProxyConfig) *httputil.ReverseProxy {
 	target := tgt.URL
 	targetQuery := target.RawQuery
 	director := func(req *http.Request) {
@@ -239,3 +468,90 @@ func proxyHTTP(tgt *ProxyTarget, config ProxyConfig) http.Handler {
 	proxy.ModifyResponse = config.ModifyResponse
 	return proxy
 }
+
+func isEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get(HeaderAccept), "text/event-stream")
+}
+
+// proxyRaw tunnels the connection to target after hijacking it, used for protocols upgraded from http such as websocket
+func proxyRaw(tgt *ProxyTarget, config ProxyConfig) http.Handler {
+	target := tgt.URL
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		desc := target.String()
+		if tgt.Name != "" {
+			desc = fmt.Sprintf("%s(%s)", tgt.Name, tgt.URL.String())
+		}
+		hj, ok := w.(http.Hijacker)
+		if !ok {
+			http.Error(w, fmt.Sprintf("proxy raw to %s failed: response writer does not support hijacking", desc), http.StatusBadGateway)
+			return
+		}
+		out, err := dialTarget(target, config.Transport)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("remote %s unreachable, could not forward: %v", desc, err), http.StatusBadGateway)
+			return
+		}
+		defer out.Close()
+		in, buf, err := hj.Hijack()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("proxy raw to %s failed, hijack error: %v", desc, err), http.StatusBadGateway)
+			return
+		}
+		defer in.Close()
+		r.URL.Path = singleJoiningSlash(target.Path, r.URL.Path)
+		if target.RawQuery != "" {
+			if r.URL.RawQuery == "" {
+				r.URL.RawQuery = target.RawQuery
+			} else {
+				r.URL.RawQuery = target.RawQuery + "&" + r.URL.RawQuery
+			}
+		}
+		r.Host = target.Host
+		if clientIP, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			if prior := r.Header.Get(HeaderXForwardedFor); prior != "" {
+				clientIP = prior + ", " + clientIP
+			}
+			r.Header.Set(HeaderXForwardedFor, clientIP)
+		}
+		if err = r.Write(out); err != nil {
+			return
+		}
+		errCh := make(chan error, 2)
+		cp := func(dst io.Writer, src io.Reader) {
+			_, err := io.Copy(dst, src)
+			errCh <- err
+		}
+		go cp(out, buf)
+		go cp(in, out)
+		<-errCh
+	})
+}
+
+func dialTarget(target *url.URL, transport http.RoundTripper) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	host := target.Host
+	switch target.Scheme {
+	case "https", "wss":
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, "443")
+		}
+		var tlsConfig *tls.Config
+		if t, ok := transport.(*http.Transport); ok && t.TLSClientConfig != nil {
+			tlsConfig = t.TLSClientConfig.Clone()
+		} else {
+			tlsConfig = &tls.Config{}
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = target.Hostname()
+		}
+		return tls.DialWithDialer(dialer, "tcp", host, tlsConfig)
+	default:
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, "80")
+		}
+		return dialer.Dial("tcp", host)
+	}
+}
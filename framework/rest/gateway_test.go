@@ -0,0 +1,201 @@
+package rest
+
+import (
+	"bufio"
+	"fmt"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/stretchr/testify/require"
+	"github.com/youminxue/odin/framework/cache"
+	"github.com/youminxue/odin/framework/internal/config"
+	"github.com/youminxue/odin/framework/registry"
+	"github.com/youminxue/odin/framework/registry/constants"
+	"github.com/youminxue/odin/toolkit/loadbalance"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_proxyRaw(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/ws" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		require.NoError(t, err)
+		defer conn.Close()
+		_, _ = buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		_ = buf.Flush()
+		_, _ = io.Copy(conn, buf)
+	}))
+	defer upstream.Close()
+	target, _ := url.Parse(upstream.URL + "/api")
+	gateway := httptest.NewServer(proxyRaw(&ProxyTarget{Name: "test", URL: target}, ProxyConfig{}))
+	defer gateway.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(gateway.URL, "http://"))
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = fmt.Fprint(conn, "GET /ws HTTP/1.1\r\nHost: gateway\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+	require.NoError(t, err)
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	msg := make([]byte, 4)
+	_, err = io.ReadFull(reader, msg)
+	require.NoError(t, err)
+	require.Equal(t, "ping", string(msg))
+}
+
+func Test_proxyRaw_unreachable(t *testing.T) {
+	target, _ := url.Parse("http://127.0.0.1:1")
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	r.Header.Set(HeaderUpgrade, "websocket")
+	proxyRaw(&ProxyTarget{URL: target}, ProxyConfig{}).ServeHTTP(w, r)
+	require.Equal(t, http.StatusBadGateway, w.Code)
+}
+
+func Test_proxyHTTP_eventStream(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HeaderContentType, "text/event-stream")
+		_, _ = fmt.Fprint(w, "data: 1\n\n")
+		w.(http.Flusher).Flush()
+		<-release
+		_, _ = fmt.Fprint(w, "data: 2\n\n")
+	}))
+	defer upstream.Close()
+	defer close(release)
+	target, _ := url.Parse(upstream.URL)
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxy := proxyHTTP(&ProxyTarget{URL: target}, ProxyConfig{Transport: http.DefaultTransport})
+		if isEventStream(r) {
+			proxy.FlushInterval = -1
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	defer gateway.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, gateway.URL+"/events", nil)
+	req.Header.Set(HeaderAccept, "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "data: 1\n", line)
+}
+
+// countingRegistry is a registry.Registry counting lookups of services
+type countingRegistry struct {
+	lock      sync.Mutex
+	lists     int
+	instances map[string][]loadbalance.Instance
+}
+
+func (c *countingRegistry) Name() string {
+	return "gatewayfake"
+}
+
+func (c *countingRegistry) Register(constants.ServiceType, ...map[string]interface{}) error {
+	return nil
+}
+
+func (c *countingRegistry) Deregister(constants.ServiceType) error {
+	return nil
+}
+
+func (c *countingRegistry) List(service string) ([]loadbalance.Instance, error) {
+	// slow lookup makes concurrent requests overlap
+	time.Sleep(20 * time.Millisecond)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.lists++
+	return c.instances[service], nil
+}
+
+func (c *countingRegistry) Watch(service string) (<-chan registry.Event, func(), error) {
+	return registry.WatchInstances(service, time.Hour, func() ([]loadbalance.Instance, error) {
+		return c.List(service)
+	}, nil)
+}
+
+func (c *countingRegistry) count() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.lists
+}
+
+func Test_providerLookup(t *testing.T) {
+	fake := &countingRegistry{instances: map[string][]loadbalance.Instance{
+		"usersvc": {{BaseUrl: "http://10.0.0.1:6060", Weight: 1}},
+	}}
+	registry.RegisterBackend("gatewayfake", func() registry.Registry {
+		return fake
+	})
+	defer os.Unsetenv(string(config.GddServiceDiscoveryMode))
+	_ = config.GddServiceDiscoveryMode.Write("gatewayfake")
+	store, _ := lru.NewWithEvict(128, onProviderEvicted)
+	providerStore := cache.NewLruCacheAdapter(store)
+	lookup := newProviderLookup()
+
+	var wg sync.WaitGroup
+	providers := make([]registry.IServiceProvider, 10)
+	for i := range providers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			providers[i] = lookup.get(providerStore, "usersvc")
+		}(i)
+	}
+	wg.Wait()
+	for _, provider := range providers {
+		require.NotNil(t, provider)
+		require.Same(t, providers[0], provider)
+	}
+	require.Equal(t, "http://10.0.0.1:6060", providers[0].SelectServer())
+	before := fake.count()
+
+	// services not found are remembered for a while
+	require.Nil(t, lookup.get(providerStore, "ordersvc"))
+	after := fake.count()
+	require.Greater(t, after, before)
+	require.Nil(t, lookup.get(providerStore, "ordersvc"))
+	require.Equal(t, after, fake.count())
+}
+
+func TestProxy_servicePrefix(t *testing.T) {
+	var path string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+	}))
+	defer upstream.Close()
+	fake := &countingRegistry{instances: map[string][]loadbalance.Instance{
+		"a(b": {{BaseUrl: upstream.URL, Weight: 1}},
+	}}
+	registry.RegisterBackend("gatewayprefix", func() registry.Registry {
+		return fake
+	})
+	defer os.Unsetenv(string(config.GddServiceDiscoveryMode))
+	_ = config.GddServiceDiscoveryMode.Write("gatewayprefix")
+
+	// service names are not patterns
+	gateway := Proxy(ProxyConfig{})(http.NotFoundHandler())
+	w := httptest.NewRecorder()
+	gateway.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/a(b/x", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "/x", path)
+}
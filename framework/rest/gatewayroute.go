@@ -0,0 +1,271 @@
+package rest
+
+import (
+	"github.com/pkg/errors"
+	"github.com/youminxue/odin/toolkit/cast"
+	"github.com/youminxue/odin/toolkit/stringutils"
+	logger "github.com/youminxue/odin/toolkit/zlogger"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gatewayRoutesPrefix is the prefix of environment variables describing gateway routes, e.g.
+//
+//	GDD_GATEWAY_ROUTES_0_PATH=/api/orders
+//	GDD_GATEWAY_ROUTES_0_SERVICE=ordersvc_rest
+//	GDD_GATEWAY_ROUTES_0_STRIPPREFIX=true
+//	GDD_GATEWAY_ROUTES_0_HEADERS_X_TENANT=acme
+//
+// the same table can be written in app.yml as a list under gdd.gateway.routes
+const gatewayRoutesPrefix = "GDD_GATEWAY_ROUTES_"
+
+// GatewayRoute maps requests matching Host and Path to upstream Service
+type GatewayRoute struct {
+	Name string `json:"name"`
+	// Host matches request host without port, supports leading wildcard like *.example.com. Empty matches any host
+	Host string `json:"host"`
+	// Path matches request path by prefix on segment boundary. Empty matches any path
+	Path string `json:"path"`
+	// Service is the upstream service name looked up from service discovery
+	Service string `json:"service"`
+	// StripPrefix removes Path from request path before forwarding
+	StripPrefix bool `json:"stripPrefix"`
+	// AddPrefix is prepended to request path before forwarding
+	AddPrefix string `json:"addPrefix"`
+	// Headers are set on the forwarded request
+	Headers map[string]string `json:"headers,omitempty"`
+	// Timeout limits the whole forwarding including retries. Zero means no limit
+	Timeout time.Duration `json:"timeout"`
+	// Retries is how many times to retry idempotent requests on another upstream instance
+	// when remote is unreachable or responds 502, 503 or 504
+	Retries int `json:"retries"`
+	// Methods are allowed http methods. Empty allows all
+	Methods []string `json:"methods,omitempty"`
+}
+
+func (r *GatewayRoute) matchHost(host string) bool {
+	if stringutils.IsEmpty(r.Host) {
+		return true
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	pattern := strings.ToLower(r.Host)
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(host, pattern[1:])
+	}
+	return host == pattern
+}
+
+func (r *GatewayRoute) matchPath(path string) bool {
+	prefix := strings.TrimSuffix(r.Path, "/")
+	if stringutils.IsEmpty(prefix) {
+		return true
+	}
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || path[len(prefix)] == '/'
+}
+
+// AllowMethod checks whether method is allowed by the route
+func (r *GatewayRoute) AllowMethod(method string) bool {
+	if len(r.Methods) == 0 {
+		return true
+	}
+	for _, item := range r.Methods {
+		if strings.EqualFold(item, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rewrite returns path to forward to upstream service
+func (r *GatewayRoute) Rewrite(path string) string {
+	if r.StripPrefix {
+		path = strings.TrimPrefix(path, strings.TrimSuffix(r.Path, "/"))
+	}
+	if stringutils.IsNotEmpty(r.AddPrefix) {
+		path = singleJoiningSlash(r.AddPrefix, path)
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+// GatewayRouteTable is a concurrency safe route table for Proxy, routes are matched in order and first match wins
+type GatewayRouteTable struct {
+	lock   sync.RWMutex
+	routes []GatewayRoute
+}
+
+// NewGatewayRouteTable creates a GatewayRouteTable instance with routes
+func NewGatewayRouteTable(routes ...GatewayRoute) *GatewayRouteTable {
+	return &GatewayRouteTable{
+		routes: routes,
+	}
+}
+
+// Routes returns a copy of all routes
+func (t *GatewayRouteTable) Routes() []GatewayRoute {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return append([]GatewayRoute(nil), t.routes...)
+}
+
+// Set replaces all routes
+func (t *GatewayRouteTable) Set(routes []GatewayRoute) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.routes = routes
+}
+
+// Reload replaces all routes with routes loaded from environment variables.
+// Routes are left untouched if there is any invalid route
+func (t *GatewayRouteTable) Reload() error {
+	routes, err := LoadGatewayRoutes()
+	if err != nil {
+		return err
+	}
+	t.Set(routes)
+	return nil
+}
+
+// Match returns the first route matching r, nil if not found
+func (t *GatewayRouteTable) Match(r *http.Request) *GatewayRoute {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	for i := range t.routes {
+		route := t.routes[i]
+		if route.matchHost(r.Host) && route.matchPath(r.URL.Path) {
+			return &route
+		}
+	}
+	return nil
+}
+
+// LoadGatewayRoutes parses routes from GDD_GATEWAY_ROUTES_<index>_<field> environment variables
+func LoadGatewayRoutes() ([]GatewayRoute, error) {
+	routeMap := make(map[int]*GatewayRoute)
+	for _, env := range os.Environ() {
+		kv := strings.SplitN(env, "=", 2)
+		if len(kv) != 2 || !strings.HasPrefix(kv[0], gatewayRoutesPrefix) {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(kv[0], gatewayRoutesPrefix), "_", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		index, err := strconv.Atoi(parts[0])
+		if err != nil {
+			continue
+		}
+		route, ok := routeMap[index]
+		if !ok {
+			route = &GatewayRoute{}
+			routeMap[index] = route
+		}
+		if err = setGatewayRouteField(route, parts[1], kv[1]); err != nil {
+			return nil, errors.Wrapf(err, "[odin] invalid gateway route config %s", kv[0])
+		}
+	}
+	indexes := make([]int, 0, len(routeMap))
+	for index := range routeMap {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	routes := make([]GatewayRoute, 0, len(indexes))
+	for _, index := range indexes {
+		route := routeMap[index]
+		if stringutils.IsEmpty(route.Service) {
+			return nil, errors.Errorf("[odin] service of gateway route %d is required", index)
+		}
+		if stringutils.IsEmpty(route.Name) {
+			route.Name = strconv.Itoa(index)
+		}
+		routes = append(routes, *route)
+	}
+	return routes, nil
+}
+
+func setGatewayRouteField(route *GatewayRoute, field, value string) error {
+	key := strings.ReplaceAll(field, "_", "")
+	switch {
+	case key == "NAME":
+		route.Name = value
+	case key == "HOST":
+		route.Host = value
+	case key == "PATH":
+		route.Path = value
+	case key == "SERVICE":
+		route.Service = value
+	case key == "STRIPPREFIX":
+		stripPrefix, err := cast.ToBoolE(value)
+		if err != nil {
+			return err
+		}
+		route.StripPrefix = stripPrefix
+	case key == "ADDPREFIX":
+		route.AddPrefix = value
+	case key == "TIMEOUT":
+		timeout, err := parseDuration(value)
+		if err != nil {
+			return err
+		}
+		route.Timeout = timeout
+	case key == "RETRIES":
+		retries, err := cast.ToIntE(value)
+		if err != nil {
+			return err
+		}
+		route.Retries = retries
+	case key == "METHODS":
+		for _, method := range strings.Split(value, ",") {
+			if method = strings.TrimSpace(method); stringutils.IsNotEmpty(method) {
+				route.Methods = append(route.Methods, strings.ToUpper(method))
+			}
+		}
+	case strings.HasPrefix(field, "HEADERS_"):
+		if route.Headers == nil {
+			route.Headers = make(map[string]string)
+		}
+		name := strings.ReplaceAll(strings.TrimPrefix(field, "HEADERS_"), "_", "-")
+		route.Headers[http.CanonicalHeaderKey(name)] = value
+	default:
+		return errors.Errorf("unknown field %s", field)
+	}
+	return nil
+}
+
+// parseDuration accepts both duration string like 500ms and integer seconds
+func parseDuration(value string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
+
+var defaultGatewayRoutes *GatewayRouteTable
+var defaultGatewayRoutesOnce sync.Once
+
+// DefaultGatewayRoutes returns the route table loaded from GDD_GATEWAY_ROUTES_* config,
+// it is reloaded on remote config changes
+func DefaultGatewayRoutes() *GatewayRouteTable {
+	defaultGatewayRoutesOnce.Do(func() {
+		defaultGatewayRoutes = NewGatewayRouteTable()
+		if err := defaultGatewayRoutes.Reload(); err != nil {
+			logger.Error().Err(err).Msg("[odin] failed to load gateway routes")
+		}
+		registerReloadConfigListener(newReloadConfigListener("gateway", "GDD_GATEWAY_", defaultGatewayRoutes.Reload))
+	})
+	return defaultGatewayRoutes
+}
@@ -0,0 +1,129 @@
+package rest
+
+import (
+	"github.com/apolloconfig/agollo/v4/storage"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLoadGatewayRoutes(t *testing.T) {
+	_ = os.Setenv("GDD_GATEWAY_ROUTES_1_PATH", "/api/users")
+	_ = os.Setenv("GDD_GATEWAY_ROUTES_1_SERVICE", "usersvc_rest")
+	_ = os.Setenv("GDD_GATEWAY_ROUTES_0_NAME", "orders")
+	_ = os.Setenv("GDD_GATEWAY_ROUTES_0_HOST", "*.example.com")
+	_ = os.Setenv("GDD_GATEWAY_ROUTES_0_PATH", "/api/orders")
+	_ = os.Setenv("GDD_GATEWAY_ROUTES_0_SERVICE", "ordersvc_rest")
+	_ = os.Setenv("GDD_GATEWAY_ROUTES_0_STRIPPREFIX", "true")
+	_ = os.Setenv("GDD_GATEWAY_ROUTES_0_ADD_PREFIX", "/v1")
+	_ = os.Setenv("GDD_GATEWAY_ROUTES_0_TIMEOUT", "3s")
+	_ = os.Setenv("GDD_GATEWAY_ROUTES_0_RETRIES", "2")
+	_ = os.Setenv("GDD_GATEWAY_ROUTES_0_METHODS", "get,post")
+	_ = os.Setenv("GDD_GATEWAY_ROUTES_0_HEADERS_X_TENANT", "acme")
+	defer func() {
+		for _, key := range []string{"1_PATH", "1_SERVICE", "0_NAME", "0_HOST", "0_PATH", "0_SERVICE", "0_STRIPPREFIX",
+			"0_ADD_PREFIX", "0_TIMEOUT", "0_RETRIES", "0_METHODS", "0_HEADERS_X_TENANT"} {
+			_ = os.Unsetenv(gatewayRoutesPrefix + key)
+		}
+	}()
+	routes, err := LoadGatewayRoutes()
+	require.NoError(t, err)
+	require.Len(t, routes, 2)
+	require.Equal(t, GatewayRoute{
+		Name:        "orders",
+		Host:        "*.example.com",
+		Path:        "/api/orders",
+		Service:     "ordersvc_rest",
+		StripPrefix: true,
+		AddPrefix:   "/v1",
+		Headers:     map[string]string{"X-Tenant": "acme"},
+		Timeout:     3 * time.Second,
+		Retries:     2,
+		Methods:     []string{"GET", "POST"},
+	}, routes[0])
+	require.Equal(t, "1", routes[1].Name)
+	require.Equal(t, "usersvc_rest", routes[1].Service)
+}
+
+func TestLoadGatewayRoutes_missingService(t *testing.T) {
+	_ = os.Setenv("GDD_GATEWAY_ROUTES_0_PATH", "/api/orders")
+	defer os.Unsetenv("GDD_GATEWAY_ROUTES_0_PATH")
+	_, err := LoadGatewayRoutes()
+	require.Error(t, err)
+}
+
+func TestLoadGatewayRoutes_unknownField(t *testing.T) {
+	_ = os.Setenv("GDD_GATEWAY_ROUTES_0_SERVICE", "ordersvc_rest")
+	_ = os.Setenv("GDD_GATEWAY_ROUTES_0_METHODSX", "get")
+	defer os.Unsetenv("GDD_GATEWAY_ROUTES_0_SERVICE")
+	defer os.Unsetenv("GDD_GATEWAY_ROUTES_0_METHODSX")
+	_, err := LoadGatewayRoutes()
+	require.Error(t, err)
+}
+
+func TestGatewayRouteTable_Match(t *testing.T) {
+	table := NewGatewayRouteTable(
+		GatewayRoute{Name: "admin", Host: "admin.example.com", Path: "/api", Service: "adminsvc_rest"},
+		GatewayRoute{Name: "orders", Host: "*.example.com", Path: "/api/orders/", Service: "ordersvc_rest"},
+		GatewayRoute{Name: "fallback", Service: "websvc_rest"},
+	)
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://admin.example.com:8080/api/orders", "admin"},
+		{"http://shop.example.com/api/orders", "orders"},
+		{"http://shop.example.com/api/orders/1", "orders"},
+		{"http://shop.example.com/api/ordersx", "fallback"},
+		{"http://other.com/api/orders", "fallback"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		route := table.Match(r)
+		require.NotNil(t, route)
+		require.Equal(t, tt.want, route.Name, tt.url)
+	}
+	table.Set(nil)
+	require.Nil(t, table.Match(httptest.NewRequest(http.MethodGet, "/api", nil)))
+}
+
+func TestGatewayRoute_Rewrite(t *testing.T) {
+	require.Equal(t, "/v1/1", (&GatewayRoute{Path: "/api/orders", StripPrefix: true, AddPrefix: "/v1"}).Rewrite("/api/orders/1"))
+	require.Equal(t, "/", (&GatewayRoute{Path: "/api/orders/", StripPrefix: true}).Rewrite("/api/orders"))
+	require.Equal(t, "/api/orders/1", (&GatewayRoute{Path: "/api/orders"}).Rewrite("/api/orders/1"))
+}
+
+func TestGatewayRoute_AllowMethod(t *testing.T) {
+	route := &GatewayRoute{Methods: []string{"GET"}}
+	require.True(t, route.AllowMethod("get"))
+	require.False(t, route.AllowMethod(http.MethodPost))
+	require.True(t, (&GatewayRoute{}).AllowMethod(http.MethodPost))
+}
+
+func Test_gatewayConfigListener_OnChange(t *testing.T) {
+	defer os.Unsetenv("GDD_GATEWAY_ROUTES_0_SERVICE")
+	table := NewGatewayRouteTable()
+	listener := newReloadConfigListener("gateway", "GDD_GATEWAY_", table.Reload)
+	listener.SkippedFirstEvent = true
+	listener.OnChange(&storage.ChangeEvent{
+		Changes: map[string]*storage.ConfigChange{
+			"gdd.gateway.routes.0.service": {
+				NewValue:   "ordersvc_rest",
+				ChangeType: storage.ADDED,
+			},
+		},
+	})
+	require.Len(t, table.Routes(), 1)
+	listener.OnChange(&storage.ChangeEvent{
+		Changes: map[string]*storage.ConfigChange{
+			"gdd.gateway.routes.0.service": {
+				OldValue:   "ordersvc_rest",
+				ChangeType: storage.DELETED,
+			},
+		},
+	})
+	require.Len(t, table.Routes(), 0)
+}
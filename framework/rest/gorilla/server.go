@@ -13,19 +13,22 @@ import (
 	"github.com/youminxue/odin/framework"
 	"github.com/youminxue/odin/framework/internal/banner"
 	"github.com/youminxue/odin/framework/internal/config"
+	"github.com/youminxue/odin/framework/lifecycle"
+	"github.com/youminxue/odin/framework/outlier"
 	register "github.com/youminxue/odin/framework/registry"
 	"github.com/youminxue/odin/framework/registry/constants"
 	"github.com/youminxue/odin/framework/rest"
 	"github.com/youminxue/odin/toolkit/cast"
 	"github.com/youminxue/odin/toolkit/stringutils"
 	logger "github.com/youminxue/odin/toolkit/zlogger"
+	"net"
 	"net/http"
 	"net/http/pprof"
 	"os"
 	"os/signal"
-	"path"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -134,12 +137,8 @@ func (srv *RestServer) AddRoute(route ...rest.Route) {
 	srv.bizRoutes = append(srv.bizRoutes, route...)
 }
 
-func (srv *common) printRoutes() {
-	if !framework.CheckDev() {
-		return
-	}
-	logger.Info().Msg("================ Registered Routes ================")
-	data := [][]string{}
+// routeTable returns infos of all registered routes
+func (srv *common) routeTable() []*rest.RouteInfo {
 	rr := config.DefaultGddRouteRootPath
 	if stringutils.IsNotEmpty(config.GddRouteRootPath.Load()) {
 		rr = config.GddRouteRootPath.Load()
@@ -148,19 +147,23 @@ func (srv *common) printRoutes() {
 	all = append(all, srv.bizRoutes...)
 	all = append(all, srv.gddRoutes...)
 	all = append(all, srv.debugRoutes...)
+	table := make([]*rest.RouteInfo, 0, len(all))
 	for _, r := range all {
-		if strings.HasPrefix(r.Pattern, gddPathPrefix) || strings.HasPrefix(r.Pattern, debugPathPrefix) {
-			data = append(data, []string{r.Name, r.Method, r.Pattern})
-		} else {
-			data = append(data, []string{r.Name, r.Method, path.Clean(rr + r.Pattern)})
-		}
+		table = append(table, rest.NewRouteInfo(r, rr))
 	}
+	return table
+}
 
+func (srv *common) printRoutes() {
+	if !framework.CheckDev() {
+		return
+	}
+	logger.Info().Msg("================ Registered Routes ================")
 	tableString := &strings.Builder{}
 	table := tablewriter.NewWriter(tableString)
-	table.SetHeader([]string{"Name", "Method", "Pattern"})
-	for _, v := range data {
-		table.Append(v)
+	table.SetHeader(rest.RouteTableHeader)
+	for _, v := range srv.routeTable() {
+		table.Append(v.Row())
 	}
 	table.Render() // Send output
 	rows := strings.Split(strings.TrimSpace(tableString.String()), "\n")
@@ -170,6 +173,11 @@ func (srv *common) printRoutes() {
 	logger.Info().Msg("===================================================")
 }
 
+// Group creates a RouteGroup whose routes are prefixed with prefix and wrapped by mwf inside the middlewares of srv
+func (srv *RestServer) Group(prefix string, mwf ...func(http.Handler) http.Handler) *rest.RouteGroup {
+	return rest.NewRouteGroup(srv.AddRoute, prefix, mwf...)
+}
+
 // AddMiddleware adds middlewares to the end of chain
 func (srv *RestServer) AddMiddleware(mwf ...func(http.Handler) http.Handler) {
 	for _, item := range mwf {
@@ -224,23 +232,46 @@ func (srv *RestServer) newHttpServer() *http.Server {
 		IdleTimeout:  idle,
 		Handler:      srv.rootRouter, // Pass our instance of gorilla/mux in.
 	}
+	if err = rest.ConfigureHttpServer(httpServer); err != nil {
+		logger.Panic().Err(err).Msg("[odin] failed to configure http server")
+	}
 
-	// Run our server in a goroutine so that it doesn't block.
+	return httpServer
+}
+
+// listenAndServe binds the address of httpServer and serves it in a goroutine, so that connections are accepted
+// as soon as it returns without error.
+func listenAndServe(httpServer *http.Server) error {
+	lis, err := net.Listen("tcp", httpServer.Addr)
+	if err != nil {
+		return err
+	}
+	logger.Info().Msgf("Http server is listening at %s://%v", config.GetScheme(), httpServer.Addr)
+	logger.Info().Msgf("Http server started in %s", time.Since(startAt))
 	go func() {
-		logger.Info().Msgf("Http server is listening at %v", httpServer.Addr)
-		logger.Info().Msgf("Http server started in %s", time.Since(startAt))
-		if err := httpServer.ListenAndServe(); err != nil {
+		if err := rest.Serve(httpServer, lis); err != nil && err != http.ErrServerClosed {
 			logger.Error().Err(err).Msg("")
 		}
 	}()
-
-	return httpServer
+	return nil
 }
 
 // Run runs http server
 func (srv *RestServer) Run() {
 	banner.Print()
+	if err := lifecycle.Start(context.Background()); err != nil {
+		logger.Panic().Err(err).Msg("[odin] failed to start lifecycle hooks")
+	}
 	register.NewRest(srv.data)
+	// health probes are served without basic auth, so they are registered ahead of the gdd subrouter
+	for _, item := range rest.HealthRoutes() {
+		srv.rootRouter.
+			Methods(item.Method).
+			Path(item.Pattern).
+			Name(item.Name).
+			Handler(item.Handler())
+		srv.gddRoutes = append(srv.gddRoutes, item)
+	}
 	manage := cast.ToBoolOrDefault(config.GddManage.Load(), config.DefaultGddManage)
 	if manage {
 		srv.Middlewares = append([]mux.MiddlewareFunc{rest.PrometheusMiddleware}, srv.Middlewares...)
@@ -273,6 +304,10 @@ func (srv *RestServer) Run() {
 		srv.gddRoutes = append(srv.gddRoutes, rest.DocRoutes()...)
 		srv.gddRoutes = append(srv.gddRoutes, rest.PromRoutes()...)
 		srv.gddRoutes = append(srv.gddRoutes, rest.ConfigRoutes()...)
+		srv.gddRoutes = append(srv.gddRoutes, rest.RouteTableRoutes(srv.routeTable)...)
+		if outlier.Enabled() {
+			srv.gddRoutes = append(srv.gddRoutes, rest.OutlierRoutes()...)
+		}
 		if _, ok := config.ServiceDiscoveryMap()[constants.SD_MEMBERLIST]; ok {
 			srv.gddRoutes = append(srv.gddRoutes, rest.MemberlistUIRoutes()...)
 		}
@@ -281,7 +316,7 @@ func (srv *RestServer) Run() {
 				Methods(item.Method, http.MethodOptions).
 				Path("/" + strings.TrimPrefix(item.Pattern, gddPathPrefix)).
 				Name(item.Name).
-				Handler(item.HandlerFunc)
+				Handler(item.Handler())
 		}
 		freq, err := time.ParseDuration(config.GddStatsFreq.Load())
 		if err != nil {
@@ -349,14 +384,29 @@ func (srv *RestServer) Run() {
 		debugRouter.Methods(http.MethodGet).PathPrefix("/pprof/").Name("GetDebugPprofIndex").HandlerFunc(pprof.Index)
 	}
 	srv.Middlewares = append(srv.Middlewares, rest.Recovery)
-	srv.Use(srv.Middlewares...)
+	rr := config.DefaultGddRouteRootPath
+	if stringutils.IsNotEmpty(config.GddRouteRootPath.Load()) {
+		rr = config.GddRouteRootPath.Load()
+	}
+	routeInfos := make(map[*mux.Route]*rest.RouteInfo)
 	for _, item := range srv.bizRoutes {
-		srv.
+		muxRoute := srv.
 			Methods(item.Method, http.MethodOptions).
 			Path(item.Pattern).
 			Name(item.Name).
-			Handler(item.HandlerFunc)
+			Handler(item.Handler())
+		routeInfos[muxRoute] = rest.NewRouteInfo(item, rr)
 	}
+	// route info goes into request context ahead of other middlewares, as mux applies them after matching
+	srv.Use(func(inner http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if info, ok := routeInfos[mux.CurrentRoute(r)]; ok {
+				r = r.WithContext(rest.ContextWithRoute(r.Context(), info))
+			}
+			inner.ServeHTTP(w, r)
+		})
+	})
+	srv.Use(srv.Middlewares...)
 	srv.rootRouter.NotFoundHandler = srv.rootRouter.NewRoute().BuildOnly().HandlerFunc(http.NotFound).GetHandler()
 	srv.rootRouter.MethodNotAllowedHandler = srv.rootRouter.NewRoute().BuildOnly().HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -368,7 +418,17 @@ func (srv *RestServer) Run() {
 	}
 	srv.printRoutes()
 	httpServer := srv.newHttpServer()
+	if err := listenAndServe(httpServer); err != nil {
+		logger.Error().Err(err).Msg("[odin] failed to start http server")
+		register.ShutdownRest()
+		if err := lifecycle.Stop(context.Background()); err != nil {
+			logger.Error().Err(err).Msg("[odin] failed to stop lifecycle hooks")
+		}
+		return
+	}
+	lifecycle.SetReady(true)
 	defer func() {
+		lifecycle.Drain(register.MarkUnhealthyRest)
 		register.ShutdownRest()
 		grace, err := time.ParseDuration(config.GddGraceTimeout.Load())
 		if err != nil {
@@ -383,12 +443,15 @@ func (srv *RestServer) Run() {
 		// Doesn't block if no connections, but will otherwise wait
 		// until the timeout deadline.
 		httpServer.Shutdown(ctx)
+		if err := lifecycle.Stop(context.Background()); err != nil {
+			logger.Error().Err(err).Msg("[odin] failed to stop lifecycle hooks")
+		}
 	}()
 
 	c := make(chan os.Signal, 1)
-	// We'll accept graceful shutdowns when quit via SIGINT (Ctrl+C)
-	// SIGKILL, SIGQUIT or SIGTERM (Ctrl+/) will not be caught.
-	signal.Notify(c, os.Interrupt)
+	// We'll accept graceful shutdowns when quit via SIGINT (Ctrl+C) or SIGTERM sent by orchestrators like kubernetes
+	// SIGKILL or SIGQUIT (Ctrl+/) will not be caught.
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
 	// Block until we receive our signal.
 	<-c
@@ -0,0 +1,39 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/youminxue/odin/framework/lifecycle"
+)
+
+var HealthRoutes = healthRoutes
+
+// healthRoutes returns liveness and readiness probes, which are served without basic auth
+// so that orchestrators like kubernetes can call them
+func healthRoutes() []Route {
+	return []Route{
+		{
+			Name:    "GetLivez",
+			Method:  http.MethodGet,
+			Pattern: gddPathPrefix + "livez",
+			HandlerFunc: func(_writer http.ResponseWriter, _req *http.Request) {
+				_writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				_writer.Write([]byte("ok"))
+			},
+		},
+		{
+			Name:    "GetReadyz",
+			Method:  http.MethodGet,
+			Pattern: gddPathPrefix + "readyz",
+			HandlerFunc: func(_writer http.ResponseWriter, _req *http.Request) {
+				_writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				if !lifecycle.Ready() {
+					_writer.WriteHeader(http.StatusServiceUnavailable)
+					_writer.Write([]byte("not ready"))
+					return
+				}
+				_writer.Write([]byte("ok"))
+			},
+		},
+	}
+}
@@ -0,0 +1,74 @@
+package rest
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/youminxue/odin/framework/internal/config"
+	"github.com/youminxue/odin/framework/lifecycle"
+)
+
+func TestHealthRoutes(t *testing.T) {
+	routes := healthRoutes()
+	require.Equal(t, "/odin/livez", routes[0].Pattern)
+	require.Equal(t, "/odin/readyz", routes[1].Pattern)
+
+	w := httptest.NewRecorder()
+	routes[0].HandlerFunc(w, httptest.NewRequest(http.MethodGet, routes[0].Pattern, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	lifecycle.SetReady(false)
+	w = httptest.NewRecorder()
+	routes[1].HandlerFunc(w, httptest.NewRequest(http.MethodGet, routes[1].Pattern, nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	lifecycle.SetReady(true)
+	defer lifecycle.SetReady(false)
+	w = httptest.NewRecorder()
+	routes[1].HandlerFunc(w, httptest.NewRequest(http.MethodGet, routes[1].Pattern, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "ok", w.Body.String())
+}
+
+func TestListenAndServe(t *testing.T) {
+	httpServer := &http.Server{Addr: "127.0.0.1:0", Handler: http.NotFoundHandler()}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	httpServer.Addr = lis.Addr().String()
+	require.Error(t, listenAndServe(httpServer))
+	lis.Close()
+
+	require.NoError(t, listenAndServe(httpServer))
+	defer httpServer.Close()
+	// connections are accepted as soon as listenAndServe returns
+	conn, err := net.Dial("tcp", httpServer.Addr)
+	require.NoError(t, err)
+	conn.Close()
+}
+
+func TestRun_listenFailed(t *testing.T) {
+	lis, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	defer lis.Close()
+	port := lis.Addr().(*net.TCPAddr).Port
+	config.GddPort.Write(strconv.Itoa(port))
+	defer config.GddPort.Write("")
+
+	lifecycle.SetReady(false)
+	done := make(chan struct{})
+	go func() {
+		NewRestServer().Run()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run should return if it failed to listen")
+	}
+	require.False(t, lifecycle.Ready())
+}
@@ -78,7 +78,6 @@ package httprouter
 
 import (
 	"context"
-	"github.com/ucarion/urlpath"
 	"net/http"
 	"strings"
 	"sync"
@@ -186,7 +185,8 @@ type Router struct {
 
 	registeredPaths map[string][]string
 	handlers        map[string]Handle
-	dynamicHandlers []map[*urlpath.Path]Handle
+	trees           []*node
+	maxParams       int
 }
 
 // Make sure the Router conforms with the http.Handler interface
@@ -204,13 +204,14 @@ func New() *Router {
 		HandleOPTIONS:          true,
 		registeredPaths:        make(map[string][]string),
 		handlers:               make(map[string]Handle),
-		dynamicHandlers:        make([]map[*urlpath.Path]Handle, len(httpMethods)),
+		trees:                  make([]*node, len(httpMethods)),
 	}
 	for i := range httpMethods {
-		r.dynamicHandlers[i] = make(map[*urlpath.Path]Handle)
+		r.trees[i] = &node{}
 	}
 	r.paramsPool.New = func() interface{} {
-		ps := make(Params, 0, 1)
+		// one more slot for MatchedRouteNameParam
+		ps := make(Params, 0, r.maxParams+1)
 		return &ps
 	}
 	return r
@@ -314,17 +315,6 @@ func path2key(method, path string) string {
 	return sb.String()
 }
 
-func countParams(path string) uint16 {
-	var n uint
-	for i := range []byte(path) {
-		switch path[i] {
-		case ':', '*':
-			n++
-		}
-	}
-	return uint16(n)
-}
-
 // Handle registers a new request handle with the given path and method.
 //
 // For GET, POST, PUT, PATCH and DELETE requests the respective shortcut
@@ -333,6 +323,9 @@ func countParams(path string) uint16 {
 // This function is intended for bulk loading and to allow the usage of less
 // frequently used, non-standardized or custom methods (e.g. for internal
 // communication with a proxy).
+//
+// It panics if a route of the same method and shape is already registered,
+// e.g. /books/:id conflicts with /books/:bookId but not with /books/latest.
 func (r *Router) Handle(method, path string, handle Handle, name ...string) {
 	switch {
 	case len(method) == 0:
@@ -346,23 +339,23 @@ func (r *Router) Handle(method, path string, handle Handle, name ...string) {
 	if idx < 0 {
 		panic("unknown http method")
 	}
-	_, f := r.registeredPaths[method]
-	r.registeredPaths[method] = append(r.registeredPaths[method], path)
-	if !f {
-		r.globalAllowed = r.allowed("*", "")
-	}
 	if r.SaveMatchedRoutePath {
 		if len(name) == 0 {
 			panic("route name must not be nil")
 		}
 		handle = r.saveMatchedRoutePath(name[0], handle)
 	}
-	if strings.Contains(path, "*") || strings.Contains(path, ":") {
-		pt := urlpath.New(path)
-		r.dynamicHandlers[idx][&pt] = handle
-	} else {
+	if n := r.trees[idx].addRoute(path, handle); n > r.maxParams {
+		r.maxParams = n
+	}
+	if !hasWildcard(path) {
 		r.handlers[path2key(method, path)] = handle
 	}
+	_, f := r.registeredPaths[method]
+	r.registeredPaths[method] = append(r.registeredPaths[method], path)
+	if !f {
+		r.globalAllowed = r.allowed("*", "")
+	}
 }
 
 // Handler is an adapter which allows the usage of an http.Handler as a
@@ -392,22 +385,27 @@ func (r *Router) recv(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// search looks up the handle of method for path in the radix tree. Values of path parameters are
+// appended to ps if it is not nil.
 func (r *Router) search(method, path string, ps *Params) Handle {
 	idx := r.methodIndexOf(method)
 	if idx < 0 {
 		return nil
 	}
-	for k := range r.dynamicHandlers[idx] {
-		match, ok := k.Match(path)
-		if !ok {
-			continue
-		}
-		for k1, v1 := range match.Params {
-			*ps = append(*ps, Param{Key: k1, Value: v1})
+	base := 0
+	if ps != nil {
+		base = len(*ps)
+	}
+	rt := r.trees[idx].getValue(path, ps)
+	if rt == nil {
+		return nil
+	}
+	if ps != nil {
+		for i, name := range rt.paramNames {
+			(*ps)[base+i].Key = name
 		}
-		return r.dynamicHandlers[idx][k]
 	}
-	return nil
+	return rt.handle
 }
 
 func (r *Router) allowed(path, reqMethod string) (allow string) {
@@ -482,10 +480,9 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		ret := func() bool {
 			psp := r.getParams()
 			defer r.putParams(psp)
-			ps := (*psp)[0:1]
-			handle = r.search(method, path, &ps)
+			handle = r.search(method, path, psp)
 			if handle != nil {
-				handle(w, req, ps)
+				handle(w, req, *psp)
 				return true
 			}
 			return false
@@ -0,0 +1,214 @@
+package httprouter
+
+import (
+	"strings"
+)
+
+type nodeType uint8
+
+const (
+	static nodeType = iota
+	param
+	catchAll
+)
+
+// route is a registered handle together with the names of its path parameters in order
+type route struct {
+	handle     Handle
+	pattern    string
+	paramNames []string
+	// catchAllName is the name of the trailing catch-all parameter, empty for bare * and routes without catch-all
+	catchAllName string
+}
+
+// node is a node of the compressed radix tree holding routes of one http method. Static nodes hold
+// a byte prefix of the path, param nodes match a whole non-empty path segment and catch-all nodes
+// match the rest of the path including the leading '/'. Parameter names live in routes rather
+// than nodes, so routes like /books/:id and /books/:bookId/reviews can share the param node.
+type node struct {
+	path     string
+	typ      nodeType
+	indices  string
+	children []*node
+
+	paramChild    *node
+	catchAllChild *node
+
+	route *route
+}
+
+type token struct {
+	typ  nodeType
+	text string
+}
+
+// tokenize splits path into static parts, named parameters and a trailing catch-all. Colons and
+// asterisks not starting a segment are literal characters.
+func tokenize(path string) []token {
+	var (
+		tokens []token
+		sb     strings.Builder
+	)
+	flush := func() {
+		if sb.Len() > 0 {
+			tokens = append(tokens, token{typ: static, text: sb.String()})
+			sb.Reset()
+		}
+	}
+	segments := strings.Split(path[1:], "/")
+	for i, seg := range segments {
+		switch {
+		case strings.HasPrefix(seg, ":"):
+			if len(seg) == 1 {
+				panic("wildcards must be named with a non-empty name in path '" + path + "'")
+			}
+			sb.WriteByte('/')
+			flush()
+			tokens = append(tokens, token{typ: param, text: seg[1:]})
+		case strings.HasPrefix(seg, "*"):
+			if i != len(segments)-1 {
+				panic("catch-all routes are only allowed at the end of the path in path '" + path + "'")
+			}
+			flush()
+			tokens = append(tokens, token{typ: catchAll, text: seg[1:]})
+		default:
+			sb.WriteByte('/')
+			sb.WriteString(seg)
+		}
+	}
+	flush()
+	return tokens
+}
+
+// hasWildcard reports whether path has any named parameter or catch-all segment
+func hasWildcard(path string) bool {
+	for _, tok := range tokenize(path) {
+		if tok.typ != static {
+			return true
+		}
+	}
+	return false
+}
+
+func longestCommonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// addRoute inserts handle for path. It panics if a route with the same shape, regardless of
+// parameter names, is already registered, so conflicts are detected at registration time.
+func (n *node) addRoute(path string, handle Handle) int {
+	rt := &route{
+		handle:  handle,
+		pattern: path,
+	}
+	current := n
+	for _, tok := range tokenize(path) {
+		switch tok.typ {
+		case static:
+			current = current.staticChild(tok.text)
+		case param:
+			if current.paramChild == nil {
+				current.paramChild = &node{typ: param}
+			}
+			current = current.paramChild
+			rt.paramNames = append(rt.paramNames, tok.text)
+		case catchAll:
+			if current.catchAllChild == nil {
+				current.catchAllChild = &node{typ: catchAll}
+			}
+			current = current.catchAllChild
+			if tok.text != "" {
+				rt.catchAllName = tok.text
+				rt.paramNames = append(rt.paramNames, tok.text)
+			}
+		}
+	}
+	if current.route != nil {
+		panic("path '" + path + "' conflicts with existing route '" + current.route.pattern + "'")
+	}
+	current.route = rt
+	return len(rt.paramNames)
+}
+
+// staticChild returns the static node reached by consuming s from the children of n, creating and splitting nodes as needed
+func (n *node) staticChild(s string) *node {
+	if idx := strings.IndexByte(n.indices, s[0]); idx >= 0 {
+		return n.children[idx].insertStatic(s)
+	}
+	child := &node{path: s, typ: static}
+	n.indices += string(s[0])
+	n.children = append(n.children, child)
+	return child
+}
+
+func (n *node) insertStatic(s string) *node {
+	i := longestCommonPrefix(s, n.path)
+	if i < len(n.path) {
+		child := &node{
+			path:          n.path[i:],
+			typ:           static,
+			indices:       n.indices,
+			children:      n.children,
+			paramChild:    n.paramChild,
+			catchAllChild: n.catchAllChild,
+			route:         n.route,
+		}
+		n.path = n.path[:i]
+		n.indices = string(child.path[0])
+		n.children = []*node{child}
+		n.paramChild = nil
+		n.catchAllChild = nil
+		n.route = nil
+	}
+	if i == len(s) {
+		return n
+	}
+	return n.staticChild(s[i:])
+}
+
+// getValue looks up the route for path below n with static over param over catch-all priority, backtracking
+// to lower priority branches when a higher one dead-ends. Parameter values are appended to ps without keys,
+// the caller names them after the route is found. ps may be nil when values are not needed.
+func (n *node) getValue(path string, ps *Params) *route {
+	if path == "" {
+		return n.route
+	}
+	if idx := strings.IndexByte(n.indices, path[0]); idx >= 0 {
+		child := n.children[idx]
+		if strings.HasPrefix(path, child.path) {
+			if rt := child.getValue(path[len(child.path):], ps); rt != nil {
+				return rt
+			}
+		}
+	}
+	if n.paramChild != nil {
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		if end > 0 {
+			if ps != nil {
+				*ps = append(*ps, Param{Value: path[:end]})
+			}
+			if rt := n.paramChild.getValue(path[end:], ps); rt != nil {
+				return rt
+			}
+			if ps != nil {
+				*ps = (*ps)[:len(*ps)-1]
+			}
+		}
+	}
+	if n.catchAllChild != nil && path[0] == '/' {
+		if rt := n.catchAllChild.route; rt != nil {
+			if ps != nil && rt.catchAllName != "" {
+				*ps = append(*ps, Param{Value: path})
+			}
+			return rt
+		}
+	}
+	return nil
+}
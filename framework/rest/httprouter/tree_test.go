@@ -0,0 +1,181 @@
+package httprouter
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"github.com/ucarion/urlpath"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouter_priority(t *testing.T) {
+	router := New()
+	router.SaveMatchedRoutePath = true
+	var matched string
+	var params Params
+	handle := func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		matched = ps.MatchedRouteName()
+		params = append(params[:0], ps...)
+	}
+	router.Handle(http.MethodGet, "/books/:id", handle, "GetBook")
+	router.Handle(http.MethodGet, "/books/latest", handle, "GetLatestBook")
+	router.Handle(http.MethodGet, "/books/latest/:chapter", handle, "GetLatestChapter")
+	router.Handle(http.MethodGet, "/books/:bookId/reviews", handle, "GetReviews")
+	router.Handle(http.MethodGet, "/books/:id/*", handle, "GetBookFile")
+	router.Handle(http.MethodGet, "/files/*filepath", handle, "GetFile")
+	router.Handle(http.MethodGet, "/users/:name/books/:id", handle, "GetUserBook")
+
+	tests := []struct {
+		path   string
+		route  string
+		params Params
+	}{
+		{"/books/latest", "GetLatestBook", nil},
+		{"/books/123", "GetBook", Params{{"id", "123"}}},
+		{"/books/latest/1", "GetLatestChapter", Params{{"chapter", "1"}}},
+		{"/books/latest/reviews", "GetLatestChapter", Params{{"chapter", "reviews"}}},
+		{"/books/123/reviews", "GetReviews", Params{{"bookId", "123"}}},
+		{"/books/latest/1/2", "GetBookFile", Params{{"id", "latest"}}},
+		{"/books/123/cover.png", "GetBookFile", Params{{"id", "123"}}},
+		{"/files/", "GetFile", Params{{"filepath", "/"}}},
+		{"/files/a/b.txt", "GetFile", Params{{"filepath", "/a/b.txt"}}},
+		{"/users/odin/books/1", "GetUserBook", Params{{"name", "odin"}, {"id", "1"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			for i := 0; i < 10; i++ {
+				matched, params = "", nil
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+				require.Equal(t, http.StatusOK, w.Code)
+				require.Equal(t, tt.route, matched)
+				require.Equal(t, append(tt.params, Param{MatchedRouteNameParam, tt.route}), params)
+			}
+		})
+	}
+
+	for _, path := range []string{"/books/", "/files", "/users/odin/books/", "/books//reviews"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusNotFound, w.Code, path)
+	}
+}
+
+func TestRouter_conflicts(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	tests := []struct {
+		existing string
+		path     string
+	}{
+		{"/books/:id", "/books/:bookId"},
+		{"/books/latest", "/books/latest"},
+		{"/files/*", "/files/*filepath"},
+		{"/books/:id/reviews", "/books/:bookId/reviews"},
+	}
+	for _, tt := range tests {
+		router := New()
+		router.GET(tt.existing, handle)
+		require.PanicsWithValue(t, "path '"+tt.path+"' conflicts with existing route '"+tt.existing+"'", func() {
+			router.GET(tt.path, handle)
+		})
+		require.NotPanics(t, func() {
+			router.POST(tt.path, handle)
+		})
+	}
+
+	router := New()
+	require.Panics(t, func() {
+		router.GET("/files/*/meta", handle)
+	})
+	require.Panics(t, func() {
+		router.GET("/books/:", handle)
+	})
+	require.NotPanics(t, func() {
+		router.GET("/books/:id", handle)
+		router.GET("/books/latest", handle)
+		router.GET("/books/*", handle)
+		router.GET("/a:b/c*", handle)
+	})
+}
+
+func TestRouter_searchAllocs(t *testing.T) {
+	router := New()
+	router.SaveMatchedRoutePath = true
+	router.Handle(http.MethodGet, "/users/:name/books/:id", func(_ http.ResponseWriter, _ *http.Request, _ Params) {}, "GetUserBook")
+	allocs := testing.AllocsPerRun(100, func() {
+		psp := router.getParams()
+		handle := router.search(http.MethodGet, "/users/odin/books/1", psp)
+		handle(nil, nil, *psp)
+		router.putParams(psp)
+	})
+	require.Zero(t, allocs)
+}
+
+var benchRoutes = func() []string {
+	var routes []string
+	for i := 0; i < 50; i++ {
+		routes = append(routes,
+			fmt.Sprintf("/api%d/users/:id", i),
+			fmt.Sprintf("/api%d/users/:id/orders/:orderId", i),
+			fmt.Sprintf("/api%d/files/*", i),
+		)
+	}
+	return routes
+}()
+
+// urlpathRouter replicates the previous matching of dynamic routes by looping over urlpath patterns
+type urlpathRouter map[*urlpath.Path]Handle
+
+func (u urlpathRouter) search(path string, ps *Params) Handle {
+	for k, handle := range u {
+		match, ok := k.Match(path)
+		if !ok {
+			continue
+		}
+		for k1, v1 := range match.Params {
+			*ps = append(*ps, Param{Key: k1, Value: v1})
+		}
+		return handle
+	}
+	return nil
+}
+
+func BenchmarkRouter_search(b *testing.B) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	paths := []string{"/api0/users/1", "/api25/users/1/orders/2", "/api49/files/a/b/c.txt"}
+
+	b.Run("RadixTree", func(b *testing.B) {
+		router := New()
+		for _, route := range benchRoutes {
+			router.GET(route, handle)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			psp := router.getParams()
+			if router.search(http.MethodGet, paths[i%len(paths)], psp) == nil {
+				b.Fatal("route not found")
+			}
+			router.putParams(psp)
+		}
+	})
+
+	b.Run("Urlpath", func(b *testing.B) {
+		router := New()
+		u := make(urlpathRouter)
+		for _, route := range benchRoutes {
+			pt := urlpath.New(route)
+			u[&pt] = handle
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			psp := router.getParams()
+			if u.search(paths[i%len(paths)], psp) == nil {
+				b.Fatal("route not found")
+			}
+			router.putParams(psp)
+		}
+	})
+}
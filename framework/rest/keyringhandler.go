@@ -0,0 +1,87 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+	registry "github.com/youminxue/odin/framework/registry/memberlist"
+)
+
+var (
+	listKeys   = registry.ListKeys
+	installKey = registry.InstallKey
+	useKey     = registry.UseKey
+	removeKey  = registry.RemoveKey
+)
+
+var KeyringRoutes = keyringRoutes
+
+// keyringRoutes manages gossip encryption keys of the memberlist cluster. Rotate a key by posting it to
+// /odin/keyring/install, then to /odin/keyring/use after GET /odin/keyring shows it on all nodes, at last post the
+// old key to /odin/keyring/remove.
+func keyringRoutes() []Route {
+	return []Route{
+		{
+			Name:    "GetKeyring",
+			Method:  "GET",
+			Pattern: "/odin/keyring",
+			HandlerFunc: func(_writer http.ResponseWriter, _req *http.Request) {
+				keys, err := listKeys()
+				if err != nil {
+					http.Error(_writer, err.Error(), keyringErrorStatus(err))
+					return
+				}
+				_writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+				if err = json.NewEncoder(_writer).Encode(keys); err != nil {
+					http.Error(_writer, err.Error(), http.StatusInternalServerError)
+				}
+			},
+		},
+		{
+			Name:        "InstallKey",
+			Method:      "POST",
+			Pattern:     "/odin/keyring/install",
+			HandlerFunc: keyOpHandler(installKey),
+		},
+		{
+			Name:        "UseKey",
+			Method:      "POST",
+			Pattern:     "/odin/keyring/use",
+			HandlerFunc: keyOpHandler(useKey),
+		},
+		{
+			Name:        "RemoveKey",
+			Method:      "POST",
+			Pattern:     "/odin/keyring/remove",
+			HandlerFunc: keyOpHandler(removeKey),
+		},
+	}
+}
+
+// keyOpHandler calls op with base64 encoded key from form field key
+func keyOpHandler(op func(key string) error) http.HandlerFunc {
+	return func(_writer http.ResponseWriter, _req *http.Request) {
+		key := _req.FormValue("key")
+		if key == "" {
+			http.Error(_writer, "missing parameter key", http.StatusBadRequest)
+			return
+		}
+		if err := op(key); err != nil {
+			http.Error(_writer, err.Error(), keyringErrorStatus(err))
+			return
+		}
+		_writer.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func keyringErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, registry.ErrInvalidKey):
+		return http.StatusBadRequest
+	case errors.Is(err, registry.ErrUnsafeKeyOp), errors.Is(err, registry.ErrKeyringDisabled):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,59 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	registry "github.com/youminxue/odin/framework/registry/memberlist"
+)
+
+func TestKeyringRoutes(t *testing.T) {
+	oldList, oldUse := listKeys, useKey
+	defer func() {
+		listKeys, useKey = oldList, oldUse
+	}()
+	listKeys = func() (map[string]registry.KeyringStatus, error) {
+		return map[string]registry.KeyringStatus{
+			"a": {PrimaryKey: "k1", Keys: []string{"k1"}},
+		}, nil
+	}
+	var used string
+	useKey = func(key string) error {
+		if key == "bad" {
+			return errors.Wrap(registry.ErrInvalidKey, "bad")
+		}
+		if key == "missing" {
+			return errors.Wrap(registry.ErrUnsafeKeyOp, "not installed")
+		}
+		used = key
+		return nil
+	}
+	routes := keyringRoutes()
+
+	w := httptest.NewRecorder()
+	routes[0].HandlerFunc(w, httptest.NewRequest(http.MethodGet, routes[0].Pattern, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"a":{"primaryKey":"k1","keys":["k1"]}}`, w.Body.String())
+
+	post := func(key string) int {
+		form := url.Values{}
+		if key != "" {
+			form.Set("key", key)
+		}
+		req := httptest.NewRequest(http.MethodPost, routes[2].Pattern, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		routes[2].HandlerFunc(w, req)
+		return w.Code
+	}
+	require.Equal(t, http.StatusNoContent, post("k2"))
+	require.Equal(t, "k2", used)
+	require.Equal(t, http.StatusBadRequest, post(""))
+	require.Equal(t, http.StatusBadRequest, post("bad"))
+	require.Equal(t, http.StatusConflict, post("missing"))
+}
@@ -5,7 +5,6 @@ import (
 	"crypto/subtle"
 	"fmt"
 	"github.com/apolloconfig/agollo/v4/storage"
-	"github.com/ascarter/requestid"
 	"github.com/felixge/httpsnoop"
 	"github.com/klauspost/compress/gzip"
 	"github.com/opentracing-contrib/go-stdlib/nethttp"
@@ -13,15 +12,11 @@ import (
 	"github.com/pkg/errors"
 	"github.com/slok/goresilience"
 	"github.com/slok/goresilience/bulkhead"
-	"github.com/uber/jaeger-client-go"
 	"github.com/youminxue/odin/framework/configmgr"
 	"github.com/youminxue/odin/framework/internal/config"
 	"github.com/youminxue/odin/toolkit/stringutils"
 	logger "github.com/youminxue/odin/toolkit/zlogger"
-	"io"
 	"net/http"
-	"net/http/httptest"
-	"net/url"
 	"os"
 	"runtime/debug"
 	"strings"
@@ -119,67 +114,6 @@ func metrics(inner http.Handler) http.Handler {
 	})
 }
 
-// log logs http request body and response body for debugging
-func log(inner http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var (
-			reqBodyCopy io.ReadCloser
-			err         error
-			traceId     string
-		)
-		if reqBodyCopy, r.Body, err = CopyReqBody(r.Body); err != nil {
-			logger.Error().Err(err).Msg("call copyReqBody(r.Body) error")
-		}
-
-		rec := httptest.NewRecorder()
-		start := time.Now()
-		inner.ServeHTTP(rec, r)
-		elapsed := time.Since(start)
-		reqBody := GetReqBody(reqBodyCopy, r)
-		rid, _ := requestid.FromContext(r.Context())
-		span := opentracing.SpanFromContext(r.Context())
-		if jspan, ok := span.(*jaeger.Span); ok {
-			traceId = jspan.SpanContext().TraceID().String()
-		}
-		respBody := GetRespBody(rec)
-		reqQuery := r.URL.RawQuery
-		if unescape, err := url.QueryUnescape(reqQuery); err == nil {
-			reqQuery = unescape
-		}
-		fields := map[string]interface{}{
-			"remoteAddr":        r.RemoteAddr,
-			"httpMethod":        r.Method,
-			"requestUrl":        r.URL.String(),
-			"proto":             r.Proto,
-			"host":              r.Host,
-			"reqContentLength":  r.ContentLength,
-			"reqHeader":         r.Header,
-			"requestId":         rid,
-			"reqQuery":          reqQuery,
-			"reqBody":           reqBody,
-			"respBody":          respBody,
-			"statusCode":        rec.Result().StatusCode,
-			"respHeader":        rec.Result().Header,
-			"respContentLength": rec.Body.Len(),
-			"elapsedTime":       elapsed.String(),
-			"elapsed":           elapsed.Milliseconds(),
-			"span":              span,
-			"traceId":           traceId,
-		}
-		var reqLog string
-		if reqLog, err = JsonMarshalIndent(fields, "", "    ", true); err != nil {
-			reqLog = fmt.Sprintf("call jsonMarshalIndent(fields, \"\", \"    \", true) error: %s", err)
-		}
-		logger.Info().Fields(fields).Msg(reqLog)
-		header := rec.Result().Header
-		for k, v := range header {
-			w.Header()[k] = v
-		}
-		w.WriteHeader(rec.Result().StatusCode)
-		rec.Body.WriteTo(w)
-	})
-}
-
 // rest set Content-Type to application/json
 func rest(inner http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -231,24 +165,15 @@ func recovery(inner http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if e := recover(); e != nil {
-				statusCode := http.StatusInternalServerError
-				respErr := fmt.Sprintf("%v", e)
-				if err, ok := e.(error); ok {
-					if errors.Is(err, context.Canceled) {
-						statusCode = http.StatusBadRequest
-					} else {
-						var bizErr BizError
-						if errors.As(err, &bizErr) {
-							statusCode = bizErr.StatusCode
-							if bizErr.Cause != nil {
-								e = bizErr.Cause
-							}
-							respErr = bizErr.Error()
-						}
-					}
+				err, ok := e.(error)
+				if !ok {
+					err = errors.Errorf("%v", e)
+				}
+				if bizErr, ok := AsBizError(err); ok && bizErr.Cause != nil {
+					e = bizErr.Cause
 				}
 				logger.Error().Msgf("panic: %+v\n\nstacktrace from panic: %s\n", e, string(debug.Stack()))
-				http.Error(w, respErr, statusCode)
+				HandleErr(w, r, err)
 			}
 		}()
 		inner.ServeHTTP(w, r)
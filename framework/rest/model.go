@@ -19,6 +19,12 @@ type Route struct {
 	Method      string
 	Pattern     string
 	HandlerFunc http.HandlerFunc
+	// Middlewares only wrap HandlerFunc of this route, inside the middlewares of RestServer. The first one is the outermost.
+	Middlewares []MiddlewareFunc
+	// Tags group routes in route table, e.g. the service or module a route belongs to
+	Tags []string
+	// Metadata is arbitrary route info such as auth scopes, rate limit or timeout, read it by RouteMetadata in middlewares
+	Metadata map[string]interface{}
 }
 
 // borrowed from httputil unexported function drainBody
@@ -0,0 +1,25 @@
+package rest
+
+import (
+	"encoding/json"
+	"github.com/youminxue/odin/framework/outlier"
+	"net/http"
+)
+
+var OutlierRoutes = outlierRoutes
+
+func outlierRoutes() []Route {
+	return []Route{
+		{
+			Name:    "GetOutlier",
+			Method:  "GET",
+			Pattern: "/odin/outlier",
+			HandlerFunc: func(_writer http.ResponseWriter, _req *http.Request) {
+				_writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+				if err := json.NewEncoder(_writer).Encode(outlier.DefaultDetector().Snapshot()); err != nil {
+					http.Error(_writer, err.Error(), http.StatusInternalServerError)
+				}
+			},
+		},
+	}
+}
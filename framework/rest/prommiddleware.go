@@ -30,6 +30,13 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Flush sends buffered data to client for streaming responses
+func (rw *responseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
 var countRequests = prometheus.NewCounterVec(
 	prometheus.CounterOpts{
 		Name: "go_doudou_http_request_count",
@@ -43,6 +50,34 @@ var httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
 	Help: "Duration of HTTP requests.",
 }, []string{"path", "method"})
 
+var rejectedRequests = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "go_doudou_http_rejected_request_count",
+		Help: "Number of http requests shed by adaptive concurrency limiter or rejected by open circuit breaker.",
+	},
+	[]string{"route", "method", "reason"},
+)
+
+var concurrencyLimit = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "go_doudou_http_concurrency_limit",
+	Help: "Current limit of adaptive concurrency limiter.",
+})
+
+var concurrencyInflight = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "go_doudou_http_concurrency_inflight",
+	Help: "Number of http requests running or waiting in adaptive concurrency limiter.",
+})
+
+var circuitBreakerState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "go_doudou_http_circuit_breaker_state",
+	Help: "Circuit breaker state of routes, 0 for closed, 1 for half open and 2 for open.",
+}, []string{"route"})
+
+var circuitBreakerTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "go_doudou_http_circuit_breaker_transition_count",
+	Help: "Number of circuit breaker state transitions of routes.",
+}, []string{"route", "state"})
+
 // PrometheusMiddleware returns http HandlerFunc for prometheus matrix
 func PrometheusMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -64,6 +99,11 @@ func PrometheusMiddleware(next http.Handler) http.Handler {
 func init() {
 	prometheus.Register(countRequests)
 	prometheus.Register(httpDuration)
+	prometheus.Register(rejectedRequests)
+	prometheus.Register(concurrencyLimit)
+	prometheus.Register(concurrencyInflight)
+	prometheus.Register(circuitBreakerState)
+	prometheus.Register(circuitBreakerTransitions)
 	buildTime := buildinfo.BuildTime
 	if stringutils.IsNotEmpty(buildinfo.BuildTime) {
 		if t, err := time.Parse(constants.FORMAT15, buildinfo.BuildTime); err == nil {
@@ -0,0 +1,151 @@
+package rest
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"sync"
+	"time"
+)
+
+var protoMessages sync.Map
+
+// RegisterProtoMessage registers the factory of protobuf message name, so that bodies of other types such as
+// structs of vo and dto package can be sent as the message. The transport/grpc package generated by odin svc grpc
+// registers all messages of the service in its init function.
+//
+// Such bodies are bridged by json: fields of the message are matched by json names, which are the same as json tags
+// of the structs unless the naming strategy of the protobuf generator differs from the one of the http handlers.
+func RegisterProtoMessage(name string, newMessage func() proto.Message) {
+	protoMessages.Store(name, newMessage)
+}
+
+func newProtoMessage(name string) (proto.Message, bool) {
+	if name == "" {
+		return nil, false
+	}
+	value, ok := protoMessages.Load(name)
+	if !ok {
+		return nil, false
+	}
+	return value.(func() proto.Message)(), true
+}
+
+type protobufCodec struct{}
+
+func (protobufCodec) ContentType() string {
+	return MediaTypeProtobuf
+}
+
+func (protobufCodec) Marshal(v interface{}, options BodyOptions) ([]byte, error) {
+	if m, ok := v.(proto.Message); ok {
+		data, err := proto.Marshal(m)
+		return data, errors.WithStack(err)
+	}
+	m, ok := newProtoMessage(options.ProtoMessage)
+	if !ok {
+		return nil, errors.Wrapf(errUnsupportedBody, "no protobuf message registered for %T", v)
+	}
+	if options.ProtoValue != nil {
+		v = options.ProtoValue
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if options.ProtoField != "" {
+		if data, err = json.Marshal(map[string]json.RawMessage{options.ProtoField: data}); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	if err = (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(data, m); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	data, err = proto.Marshal(m)
+	return data, errors.WithStack(err)
+}
+
+func (protobufCodec) Unmarshal(data []byte, v interface{}, options BodyOptions) error {
+	if m, ok := v.(proto.Message); ok {
+		return errors.WithStack(proto.Unmarshal(data, m))
+	}
+	m, ok := newProtoMessage(options.ProtoMessage)
+	if !ok {
+		return errors.Wrapf(errUnsupportedBody, "no protobuf message registered for %T", v)
+	}
+	if err := proto.Unmarshal(data, m); err != nil {
+		return errors.WithStack(err)
+	}
+	var value interface{} = protoMap(m.ProtoReflect())
+	if options.ProtoField != "" {
+		value = value.(map[string]interface{})[options.ProtoField]
+	}
+	if options.ProtoValue != nil {
+		v = options.ProtoValue
+	}
+	if value == nil {
+		return nil
+	}
+	bridged, err := json.Marshal(value)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(json.Unmarshal(bridged, v))
+}
+
+// protoMap converts m to a map keyed by json names of its populated fields. Unlike protojson, 64-bit integers
+// stay numbers and enums become their names, so that the result can be decoded into plain structs by encoding/json.
+func protoMap(m protoreflect.Message) map[string]interface{} {
+	result := make(map[string]interface{})
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.IsList():
+			list := v.List()
+			items := make([]interface{}, list.Len())
+			for i := 0; i < list.Len(); i++ {
+				items[i] = protoValue(fd, list.Get(i))
+			}
+			result[fd.JSONName()] = items
+		case fd.IsMap():
+			entries := make(map[string]interface{})
+			v.Map().Range(func(k protoreflect.MapKey, mv protoreflect.Value) bool {
+				entries[k.String()] = protoValue(fd.MapValue(), mv)
+				return true
+			})
+			result[fd.JSONName()] = entries
+		default:
+			result[fd.JSONName()] = protoValue(fd, v)
+		}
+		return true
+	})
+	return result
+}
+
+func protoValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) interface{} {
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+		return int32(v.Enum())
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		msg := v.Message()
+		switch msg.Descriptor().FullName() {
+		case "google.protobuf.Timestamp":
+			if ts, ok := msg.Interface().(*timestamppb.Timestamp); ok {
+				return ts.AsTime().Format(time.RFC3339Nano)
+			}
+		case "google.protobuf.Any", "google.protobuf.Struct", "google.protobuf.Value", "google.protobuf.ListValue":
+			data, err := protojson.Marshal(msg.Interface())
+			if err == nil {
+				return json.RawMessage(data)
+			}
+		}
+		return protoMap(msg)
+	default:
+		return v.Interface()
+	}
+}
@@ -0,0 +1,363 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/youminxue/odin/framework/internal/config"
+	"github.com/youminxue/odin/framework/ratelimit"
+	"github.com/youminxue/odin/framework/ratelimit/memrate"
+	"github.com/youminxue/odin/framework/ratelimit/redisrate"
+	"github.com/youminxue/odin/framework/rest/httprouter"
+	"github.com/youminxue/odin/toolkit/stringutils"
+	logger "github.com/youminxue/odin/toolkit/zlogger"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	HeaderRateLimitLimit     = "RateLimit-Limit"
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	HeaderRateLimitReset     = "RateLimit-Reset"
+	HeaderRetryAfter         = "Retry-After"
+)
+
+type userIdCtxKey struct{}
+
+type rateLimitCtxKey struct{}
+
+// ContextWithUserId returns a copy of ctx carrying id of the authenticated user
+func ContextWithUserId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, userIdCtxKey{}, id)
+}
+
+// UserIdFromContext returns id of the authenticated user stored by ContextWithUserId
+func UserIdFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(userIdCtxKey{}).(string)
+	return id
+}
+
+// RateLimitKeyFunc extracts the key requests are counted by
+type RateLimitKeyFunc func(r *http.Request) string
+
+// RateLimitByIP counts requests by client ip
+func RateLimitByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// RateLimitByRoute counts requests by matched route name
+func RateLimitByRoute(r *http.Request) string {
+	return httprouter.ParamsFromContext(r.Context()).MatchedRouteName()
+}
+
+// RateLimitByUser counts requests by user id stored by ContextWithUserId
+func RateLimitByUser(r *http.Request) string {
+	return UserIdFromContext(r.Context())
+}
+
+// RateLimitByHeader counts requests by value of request header name
+func RateLimitByHeader(name string) RateLimitKeyFunc {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// RateLimiter limits http requests per key, with a default limit and per-route limits
+type RateLimiter struct {
+	mu           sync.RWMutex
+	defaultLimit *ratelimit.Limit
+	routeLimits  map[string]ratelimit.Limit
+	keyFns       []RateLimitKeyFunc
+	mstore       *memrate.MemoryStore
+	rdb          redisrate.Rediser
+}
+
+type RateLimiterOption func(*RateLimiter)
+
+// WithRateLimitKey sets key extractors, keys returned by them are joined together. Default is RateLimitByIP
+func WithRateLimitKey(fns ...RateLimitKeyFunc) RateLimiterOption {
+	return func(rl *RateLimiter) {
+		rl.keyFns = fns
+	}
+}
+
+// WithDefaultRateLimit sets limit for routes without their own limit
+func WithDefaultRateLimit(limit ratelimit.Limit) RateLimiterOption {
+	return func(rl *RateLimiter) {
+		rl.defaultLimit = &limit
+	}
+}
+
+// WithRouteRateLimit sets limit for the route named route
+func WithRouteRateLimit(route string, limit ratelimit.Limit) RateLimiterOption {
+	return func(rl *RateLimiter) {
+		rl.routeLimits[route] = limit
+	}
+}
+
+// WithRateLimitRedis counts requests in redis by GCRA algorithm, so that limits are shared across instances
+func WithRateLimitRedis(rdb redisrate.Rediser) RateLimiterOption {
+	return func(rl *RateLimiter) {
+		rl.rdb = rdb
+	}
+}
+
+// WithRateLimitMemoryStore sets memory store counting requests when redis is not set
+func WithRateLimitMemoryStore(mstore *memrate.MemoryStore) RateLimiterOption {
+	return func(rl *RateLimiter) {
+		rl.mstore = mstore
+	}
+}
+
+// NewRateLimiter creates a RateLimiter counting requests in memory by client ip by default
+func NewRateLimiter(opts ...RateLimiterOption) *RateLimiter {
+	rl := &RateLimiter{
+		routeLimits: make(map[string]ratelimit.Limit),
+		keyFns:      []RateLimitKeyFunc{RateLimitByIP},
+	}
+	for _, fn := range opts {
+		fn(rl)
+	}
+	if rl.mstore == nil {
+		rl.mstore = memrate.NewMemoryStore(func(ctx context.Context, store *memrate.MemoryStore, key string) ratelimit.Limiter {
+			limit, _ := ctx.Value(rateLimitCtxKey{}).(ratelimit.Limit)
+			return memrate.NewLimiterLimit(limit, memrate.WithTimer(refillDuration(limit), func() {
+				store.DeleteKey(key)
+			}))
+		})
+	}
+	return rl
+}
+
+// NewRateLimiterFromConfig creates a RateLimiter from GDD_RATELIMIT_* environment variables
+func NewRateLimiterFromConfig(opts ...RateLimiterOption) (*RateLimiter, error) {
+	rl := NewRateLimiter(opts...)
+	if err := rl.Reload(); err != nil {
+		return nil, err
+	}
+	return rl, nil
+}
+
+// SetLimits replaces default limit and per-route limits, nil defaultLimit means no limit for other routes
+func (rl *RateLimiter) SetLimits(defaultLimit *ratelimit.Limit, routeLimits map[string]ratelimit.Limit) {
+	if routeLimits == nil {
+		routeLimits = make(map[string]ratelimit.Limit)
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.defaultLimit = defaultLimit
+	rl.routeLimits = routeLimits
+}
+
+// Reload reloads limits and key extractors from GDD_RATELIMIT_* environment variables,
+// old ones are kept if any of them is invalid. Key extractors are kept if GDD_RATELIMIT_KEY is not set.
+func (rl *RateLimiter) Reload() error {
+	var defaultLimit *ratelimit.Limit
+	if value := strings.TrimSpace(config.GddRatelimitDefault.LoadOrDefault(config.DefaultGddRatelimitDefault)); stringutils.IsNotEmpty(value) {
+		limit, err := ratelimit.Parse(value)
+		if err != nil {
+			return errors.Wrapf(err, "invalid %s", config.GddRatelimitDefault)
+		}
+		defaultLimit = &limit
+	}
+	routeLimits := make(map[string]ratelimit.Limit)
+	for _, item := range strings.Split(config.GddRatelimitRoutes.LoadOrDefault(config.DefaultGddRatelimitRoutes), ",") {
+		if item = strings.TrimSpace(item); stringutils.IsEmpty(item) {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return errors.Errorf("invalid %s: %s, should be like GetUser=10-S-20", config.GddRatelimitRoutes, item)
+		}
+		limit, err := ratelimit.Parse(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return errors.Wrapf(err, "invalid %s", config.GddRatelimitRoutes)
+		}
+		routeLimits[strings.TrimSpace(kv[0])] = limit
+	}
+	var keyFns []RateLimitKeyFunc
+	if value := config.GddRatelimitKey.Load(); stringutils.IsNotEmpty(value) {
+		var err error
+		if keyFns, err = parseRateLimitKey(value); err != nil {
+			return err
+		}
+	}
+	rl.SetLimits(defaultLimit, routeLimits)
+	if len(keyFns) > 0 {
+		rl.mu.Lock()
+		rl.keyFns = keyFns
+		rl.mu.Unlock()
+	}
+	return nil
+}
+
+func parseRateLimitKey(value string) ([]RateLimitKeyFunc, error) {
+	var keyFns []RateLimitKeyFunc
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		switch {
+		case stringutils.IsEmpty(item):
+			continue
+		case item == "ip":
+			keyFns = append(keyFns, RateLimitByIP)
+		case item == "route":
+			keyFns = append(keyFns, RateLimitByRoute)
+		case item == "user":
+			keyFns = append(keyFns, RateLimitByUser)
+		case strings.HasPrefix(item, "header:"):
+			keyFns = append(keyFns, RateLimitByHeader(strings.TrimPrefix(item, "header:")))
+		default:
+			return nil, errors.Errorf("invalid %s: unknown key %s", config.GddRatelimitKey, item)
+		}
+	}
+	if len(keyFns) == 0 {
+		keyFns = append(keyFns, RateLimitByIP)
+	}
+	return keyFns, nil
+}
+
+// Limit returns limit for the route named route
+func (rl *RateLimiter) Limit(route string) (ratelimit.Limit, bool) {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+	if limit, ok := rl.routeLimits[route]; ok {
+		return limit, true
+	}
+	if rl.defaultLimit != nil {
+		return *rl.defaultLimit, true
+	}
+	return ratelimit.Limit{}, false
+}
+
+func (rl *RateLimiter) key(r *http.Request) string {
+	rl.mu.RLock()
+	keyFns := rl.keyFns
+	rl.mu.RUnlock()
+	keys := make([]string, 0, len(keyFns))
+	for _, fn := range keyFns {
+		keys = append(keys, fn(r))
+	}
+	return strings.Join(keys, ":")
+}
+
+type rateLimitQuota struct {
+	allowed    bool
+	remaining  int
+	retryAfter time.Duration
+	resetAfter time.Duration
+}
+
+func (rl *RateLimiter) take(ctx context.Context, route, key string, limit ratelimit.Limit) (rateLimitQuota, error) {
+	if rl.rdb != nil {
+		limiter := redisrate.NewGcraLimiterLimit(rl.rdb, "http:"+route+":"+key, limit).(*redisrate.GcraLimiter)
+		res, err := limiter.AllowN(ctx, 1)
+		if err != nil {
+			return rateLimitQuota{}, err
+		}
+		return rateLimitQuota{
+			allowed:    res.Allowed > 0,
+			remaining:  res.Remaining,
+			retryAfter: res.RetryAfter,
+			resetAfter: res.ResetAfter,
+		}, nil
+	}
+	// limit is part of the key, so that limiters are recreated after limits are reloaded
+	mkey := fmt.Sprintf("%v/%v/%d|%s|%s", limit.Rate, limit.Period, limit.Burst, route, key)
+	limiter := rl.mstore.GetLimiterCtx(context.WithValue(ctx, rateLimitCtxKey{}, limit), mkey)
+	lim, ok := limiter.(*memrate.Limiter)
+	if !ok {
+		allowed, err := limiter.AllowECtx(ctx)
+		return rateLimitQuota{allowed: allowed}, err
+	}
+	now := time.Now()
+	quota := rateLimitQuota{
+		allowed: lim.AllowN(now, 1),
+	}
+	tokens := lim.TokensAt(now)
+	rate := float64(lim.Limit())
+	if tokens > 0 {
+		quota.remaining = int(tokens)
+	}
+	if rate > 0 {
+		if !quota.allowed {
+			quota.retryAfter = time.Duration((1 - tokens) / rate * float64(time.Second))
+		}
+		quota.resetAfter = time.Duration((float64(lim.Burst()) - tokens) / rate * float64(time.Second))
+	}
+	return quota, nil
+}
+
+// refillDuration returns how long an idle limiter takes to get all its tokens back
+func refillDuration(limit ratelimit.Limit) time.Duration {
+	ttl := time.Minute
+	if limit.Rate > 0 {
+		if d := time.Duration(float64(limit.Period) * float64(limit.Burst) / limit.Rate); d > ttl {
+			ttl = d
+		}
+	}
+	return ttl
+}
+
+func ceilSeconds(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// RateLimit creates a middleware rejecting requests exceeding limits of rl with 429 status code.
+// Requests are counted per route, so the default limit applies to each route separately.
+// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers are set for limited routes,
+// Retry-After header is set for rejected requests. Requests are let through if redis fails.
+func RateLimit(rl *RateLimiter) func(inner http.Handler) http.Handler {
+	return func(inner http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := RateLimitByRoute(r)
+			limit, ok := rl.Limit(route)
+			if !ok {
+				inner.ServeHTTP(w, r)
+				return
+			}
+			quota, err := rl.take(r.Context(), route, rl.key(r), limit)
+			if err != nil {
+				logger.Error().Err(err).Msg("[odin] rate limiter failed, let request through")
+				inner.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set(HeaderRateLimitLimit, strconv.Itoa(limit.Burst))
+			w.Header().Set(HeaderRateLimitRemaining, strconv.Itoa(quota.remaining))
+			w.Header().Set(HeaderRateLimitReset, ceilSeconds(quota.resetAfter))
+			if !quota.allowed {
+				w.Header().Set(HeaderRetryAfter, ceilSeconds(quota.retryAfter))
+				HandleErr(w, r, NewBizError(errors.New("too many requests"), WithStatusCode(http.StatusTooManyRequests)))
+				return
+			}
+			inner.ServeHTTP(w, r)
+		})
+	}
+}
+
+var defaultRateLimiter *RateLimiter
+var defaultRateLimiterOnce sync.Once
+
+// DefaultRateLimiter returns the RateLimiter used by rest server when GDD_RATELIMIT_ENABLE is true,
+// its limits are reloaded when GDD_RATELIMIT_* keys change in remote config
+func DefaultRateLimiter() *RateLimiter {
+	defaultRateLimiterOnce.Do(func() {
+		defaultRateLimiter = NewRateLimiter()
+		if err := defaultRateLimiter.Reload(); err != nil {
+			logger.Error().Err(err).Msg("[odin] failed to load rate limits")
+		}
+		registerReloadConfigListener(newReloadConfigListener("ratelimit", "GDD_RATELIMIT_", defaultRateLimiter.Reload))
+	})
+	return defaultRateLimiter
+}
@@ -0,0 +1,129 @@
+package rest
+
+import (
+	"context"
+	"github.com/apolloconfig/agollo/v4/storage"
+	"github.com/stretchr/testify/require"
+	"github.com/youminxue/odin/framework/ratelimit"
+	"github.com/youminxue/odin/framework/rest/httprouter"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func newRateLimitRouter(rl *RateLimiter) *httprouter.Router {
+	router := httprouter.New()
+	router.SaveMatchedRoutePath = true
+	handler := RateLimit(rl)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	router.Handler(http.MethodGet, "/users", handler, "GetUsers")
+	router.Handler(http.MethodGet, "/orders", handler, "GetOrders")
+	return router
+}
+
+func TestRateLimit(t *testing.T) {
+	rl := NewRateLimiter(WithRouteRateLimit("GetUsers", ratelimit.PerSecond(1)))
+	router := newRateLimitRouter(rl)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "1", w.Header().Get(HeaderRateLimitLimit))
+	require.Equal(t, "0", w.Header().Get(HeaderRateLimitRemaining))
+	require.Equal(t, "1", w.Header().Get(HeaderRateLimitReset))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users", nil))
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "1", w.Header().Get(HeaderRetryAfter))
+	require.Contains(t, w.Body.String(), "too many requests")
+
+	r := httptest.NewRequest(http.MethodGet, "/users", nil)
+	r.RemoteAddr = "192.0.2.2:1234"
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Empty(t, w.Header().Get(HeaderRateLimitLimit))
+}
+
+func TestRateLimit_defaultLimit(t *testing.T) {
+	rl := NewRateLimiter(WithDefaultRateLimit(ratelimit.PerMinuteBurst(1, 2)), WithRateLimitKey(RateLimitByHeader("X-Api-Key")))
+	router := newRateLimitRouter(rl)
+	for _, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		r.Header.Set("X-Api-Key", "key1")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		require.Equal(t, want, w.Code)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	r.Header.Set("X-Api-Key", "key2")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRateLimiter_Reload(t *testing.T) {
+	_ = os.Setenv("GDD_RATELIMIT_DEFAULT", "100-S-200")
+	_ = os.Setenv("GDD_RATELIMIT_ROUTES", "GetUsers=10-M, GetOrders=1-H-5")
+	_ = os.Setenv("GDD_RATELIMIT_KEY", "route,user,header:X-Api-Key")
+	defer os.Unsetenv("GDD_RATELIMIT_DEFAULT")
+	defer os.Unsetenv("GDD_RATELIMIT_ROUTES")
+	defer os.Unsetenv("GDD_RATELIMIT_KEY")
+	rl, err := NewRateLimiterFromConfig()
+	require.NoError(t, err)
+	limit, ok := rl.Limit("GetUsers")
+	require.True(t, ok)
+	require.Equal(t, ratelimit.Limit{Rate: 10, Burst: 1, Period: time.Minute}, limit)
+	limit, _ = rl.Limit("GetOrders")
+	require.Equal(t, ratelimit.Limit{Rate: 1, Burst: 5, Period: time.Hour}, limit)
+	limit, _ = rl.Limit("Other")
+	require.Equal(t, ratelimit.Limit{Rate: 100, Burst: 200, Period: time.Second}, limit)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Api-Key", "key1")
+	r = r.WithContext(ContextWithUserId(context.Background(), "u1"))
+	require.Equal(t, ":u1:key1", rl.key(r))
+
+	_ = os.Setenv("GDD_RATELIMIT_ROUTES", "GetUsers")
+	require.Error(t, rl.Reload())
+	limit, _ = rl.Limit("GetUsers")
+	require.Equal(t, 10.0, limit.Rate)
+
+	_ = os.Setenv("GDD_RATELIMIT_KEY", "cookie")
+	require.Error(t, rl.Reload())
+}
+
+func Test_rateLimitConfigListener_OnChange(t *testing.T) {
+	defer os.Unsetenv("GDD_RATELIMIT_ROUTES")
+	rl := NewRateLimiter()
+	listener := newReloadConfigListener("ratelimit", "GDD_RATELIMIT_", rl.Reload)
+	listener.SkippedFirstEvent = true
+	listener.OnChange(&storage.ChangeEvent{
+		Changes: map[string]*storage.ConfigChange{
+			"gdd.ratelimit.routes": {
+				NewValue:   "GetUsers=5-S",
+				ChangeType: storage.ADDED,
+			},
+		},
+	})
+	_, ok := rl.Limit("GetUsers")
+	require.True(t, ok)
+	listener.OnChange(&storage.ChangeEvent{
+		Changes: map[string]*storage.ConfigChange{
+			"gdd.ratelimit.routes": {
+				OldValue:   "GetUsers=5-S",
+				ChangeType: storage.DELETED,
+			},
+		},
+	})
+	_, ok = rl.Limit("GetUsers")
+	require.False(t, ok)
+}
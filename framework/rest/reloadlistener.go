@@ -0,0 +1,93 @@
+package rest
+
+import (
+	"fmt"
+	"github.com/apolloconfig/agollo/v4/storage"
+	"github.com/youminxue/odin/framework/configmgr"
+	"github.com/youminxue/odin/framework/internal/config"
+	logger "github.com/youminxue/odin/toolkit/zlogger"
+	"os"
+	"strings"
+)
+
+// reloadConfigListener copies remote config changes of keys with prefix to environment variables and then calls
+// reload, so that settings loaded from environment variables such as gateway routes follow remote config
+type reloadConfigListener struct {
+	configmgr.BaseApolloListener
+	// name identifies the listener in nacos listener data ids and in logs
+	name   string
+	prefix string
+	reload func() error
+}
+
+func newReloadConfigListener(name, prefix string, reload func() error) *reloadConfigListener {
+	return &reloadConfigListener{
+		name:   name,
+		prefix: prefix,
+		reload: reload,
+	}
+}
+
+func (c *reloadConfigListener) OnChange(event *storage.ChangeEvent) {
+	c.Lock.Lock()
+	defer c.Lock.Unlock()
+	if !c.SkippedFirstEvent {
+		c.SkippedFirstEvent = true
+		return
+	}
+	var changed bool
+	for key, value := range event.Changes {
+		upperKey := strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+		if strings.HasPrefix(upperKey, c.prefix) {
+			changed = true
+			if value.ChangeType == storage.DELETED {
+				_ = os.Unsetenv(upperKey)
+				continue
+			}
+			_ = os.Setenv(upperKey, fmt.Sprint(value.NewValue))
+		}
+	}
+	if !changed {
+		return
+	}
+	if err := c.reload(); err != nil {
+		logger.Error().Err(err).Msgf("[odin] failed to reload %s config, keep using old one", c.name)
+	}
+}
+
+func (c *reloadConfigListener) onNacosChange(event *configmgr.NacosChangeEvent) {
+	changes := make(map[string]*storage.ConfigChange)
+	for k, v := range event.Changes {
+		changes[k] = &storage.ConfigChange{
+			OldValue:   v.OldValue,
+			NewValue:   v.NewValue,
+			ChangeType: storage.ConfigChangeType(v.ChangeType),
+		}
+	}
+	c.OnChange(&storage.ChangeEvent{
+		Changes: changes,
+	})
+}
+
+// registerReloadConfigListener listens to changes of remote config by GDD_CONFIG_REMOTE_TYPE with listener
+func registerReloadConfigListener(listener *reloadConfigListener) {
+	configType := config.GddConfigRemoteType.LoadOrDefault(config.DefaultGddConfigRemoteType)
+	switch configType {
+	case "":
+		return
+	case config.NacosConfigType:
+		dataIdStr := config.GddNacosConfigDataid.LoadOrDefault(config.DefaultGddNacosConfigDataid)
+		dataIds := strings.Split(dataIdStr, ",")
+		listener.SkippedFirstEvent = true
+		for _, dataId := range dataIds {
+			configmgr.NacosClient.AddChangeListener(configmgr.NacosConfigListenerParam{
+				DataId:   "__" + dataId + "__" + listener.name,
+				OnChange: listener.onNacosChange,
+			})
+		}
+	case config.ApolloConfigType:
+		configmgr.ApolloClient.AddChangeListener(listener)
+	default:
+		logger.Warn().Msgf("[odin] unknown config type: %s\n", configType)
+	}
+}
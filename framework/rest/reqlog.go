@@ -0,0 +1,382 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/ascarter/requestid"
+	"github.com/felixge/httpsnoop"
+	"github.com/opentracing/opentracing-go"
+	"github.com/youminxue/odin/framework/internal/config"
+	"github.com/youminxue/odin/toolkit/cast"
+	"github.com/youminxue/odin/toolkit/stringutils"
+	logger "github.com/youminxue/odin/toolkit/zlogger"
+	"io"
+	"math/rand"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const redacted = "***"
+
+// LogOption configures request and response logging middleware created by LogWith
+type LogOption func(*logOptions)
+
+type logOptions struct {
+	maxBodySize      int
+	skipContentTypes []string
+	redactHeaders    []string
+	redactFields     [][]string
+	sampleRate       float64
+	redactRaw        *regexp.Regexp
+}
+
+// WithLogMaxBodySize caps how many bytes of request and response body are logged, 0 disables body logging
+func WithLogMaxBodySize(size int) LogOption {
+	return func(o *logOptions) {
+		o.maxBodySize = size
+	}
+}
+
+// WithLogSkipContentTypes sets content type prefixes whose body won't be logged, e.g. multipart/form-data or image/
+func WithLogSkipContentTypes(contentTypes ...string) LogOption {
+	return func(o *logOptions) {
+		o.skipContentTypes = nil
+		for _, item := range contentTypes {
+			if item = strings.ToLower(strings.TrimSpace(item)); stringutils.IsNotEmpty(item) {
+				o.skipContentTypes = append(o.skipContentTypes, item)
+			}
+		}
+	}
+}
+
+// WithLogRedactHeaders sets request and response headers whose values are replaced by ***
+func WithLogRedactHeaders(headers ...string) LogOption {
+	return func(o *logOptions) {
+		o.redactHeaders = nil
+		for _, item := range headers {
+			if item = strings.TrimSpace(item); stringutils.IsNotEmpty(item) {
+				o.redactHeaders = append(o.redactHeaders, http.CanonicalHeaderKey(item))
+			}
+		}
+	}
+}
+
+// WithLogRedactFields sets json fields and form fields whose values are replaced by ***.
+// A field without dot like password matches at any depth, a dot separated path like user.token
+// matches from the root object, * matches any key. Arrays are transparent to paths.
+func WithLogRedactFields(fields ...string) LogOption {
+	return func(o *logOptions) {
+		o.redactFields = nil
+		for _, item := range fields {
+			if item = strings.TrimSpace(item); stringutils.IsNotEmpty(item) {
+				o.redactFields = append(o.redactFields, strings.Split(item, "."))
+			}
+		}
+	}
+}
+
+// WithLogSampleRate sets the fraction of requests to be logged, from 0 to 1
+func WithLogSampleRate(rate float64) LogOption {
+	return func(o *logOptions) {
+		o.sampleRate = rate
+	}
+}
+
+func logOptionsFromConfig() []LogOption {
+	maxBodySize := config.DefaultGddLogReqMaxBodySize
+	if n, err := cast.ToIntE(config.GddLogReqMaxBodySize.Load()); err == nil {
+		maxBodySize = n
+	}
+	sampleRate := config.DefaultGddLogReqSampleRate
+	if rate, err := cast.ToFloat64E(config.GddLogReqSampleRate.Load()); err == nil {
+		sampleRate = rate
+	}
+	return []LogOption{
+		WithLogMaxBodySize(maxBodySize),
+		WithLogSkipContentTypes(strings.Split(config.GddLogReqSkipContentTypes.LoadOrDefault(config.DefaultGddLogReqSkipContentTypes), ",")...),
+		WithLogRedactHeaders(strings.Split(config.GddLogReqRedactHeaders.LoadOrDefault(config.DefaultGddLogReqRedactHeaders), ",")...),
+		WithLogRedactFields(strings.Split(config.GddLogReqRedactFields.LoadOrDefault(config.DefaultGddLogReqRedactFields), ",")...),
+		WithLogSampleRate(sampleRate),
+	}
+}
+
+// log logs http request and response for debugging, configured by GDD_LOG_REQ_* environment variables
+func log(inner http.Handler) http.Handler {
+	return LogWith(logOptionsFromConfig()...)(inner)
+}
+
+// LogWith creates a middleware logging http request and response. Bodies are teed into size capped buffers
+// while being read and written, so responses are written through to the client without buffering and
+// streaming responses like server-sent events and file downloads keep working.
+func LogWith(opts ...LogOption) func(inner http.Handler) http.Handler {
+	o := newLogOptions(opts...)
+	return func(inner http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if o.sampleRate < 1 && rand.Float64() >= o.sampleRate {
+				inner.ServeHTTP(w, r)
+				return
+			}
+			reqCapture := &bodyCapture{
+				max:     o.maxBodySize,
+				skipped: o.skip(r.Header.Get("Content-Type")),
+			}
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = &teeReadCloser{Reader: io.TeeReader(r.Body, reqCapture), Closer: r.Body}
+			}
+			respCapture := &bodyCapture{max: o.maxBodySize}
+			var statusCode int
+			begin := func(code int) {
+				if statusCode == 0 {
+					statusCode = code
+					respCapture.skipped = o.skip(w.Header().Get("Content-Type"))
+				}
+			}
+			ww := httpsnoop.Wrap(w, httpsnoop.Hooks{
+				WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+					return func(code int) {
+						begin(code)
+						next(code)
+					}
+				},
+				Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+					return func(b []byte) (int, error) {
+						begin(http.StatusOK)
+						n, err := next(b)
+						respCapture.Write(b[:n])
+						return n, err
+					}
+				},
+				ReadFrom: func(next httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+					return func(src io.Reader) (int64, error) {
+						begin(http.StatusOK)
+						return next(io.TeeReader(src, respCapture))
+					}
+				},
+			})
+
+			start := time.Now()
+			inner.ServeHTTP(ww, r)
+			elapsed := time.Since(start)
+			if statusCode == 0 {
+				statusCode = http.StatusOK
+			}
+
+			rid, _ := requestid.FromContext(r.Context())
+			reqQuery := r.URL.RawQuery
+			if unescape, err := url.QueryUnescape(reqQuery); err == nil {
+				reqQuery = unescape
+			}
+			fields := map[string]interface{}{
+				"remoteAddr":        r.RemoteAddr,
+				"httpMethod":        r.Method,
+				"requestUrl":        r.URL.String(),
+				"proto":             r.Proto,
+				"host":              r.Host,
+				"reqContentLength":  r.ContentLength,
+				"reqHeader":         o.header(r.Header),
+				"requestId":         rid,
+				"reqQuery":          reqQuery,
+				"reqBody":           o.body(reqCapture, r.Header.Get("Content-Type")),
+				"respBody":          o.body(respCapture, w.Header().Get("Content-Type")),
+				"statusCode":        statusCode,
+				"respHeader":        o.header(w.Header()),
+				"respContentLength": respCapture.total,
+				"elapsedTime":       elapsed.String(),
+				"elapsed":           elapsed.Milliseconds(),
+				"span":              opentracing.SpanFromContext(r.Context()),
+				"traceId":           traceIdFromContext(r.Context()),
+			}
+			reqLog, err := JsonMarshalIndent(fields, "", "    ", true)
+			if err != nil {
+				reqLog = fmt.Sprintf("call jsonMarshalIndent(fields, \"\", \"    \", true) error: %s", err)
+			}
+			logger.Info().Fields(fields).Msg(reqLog)
+		})
+	}
+}
+
+func newLogOptions(opts ...LogOption) *logOptions {
+	o := &logOptions{
+		maxBodySize: config.DefaultGddLogReqMaxBodySize,
+		sampleRate:  config.DefaultGddLogReqSampleRate,
+	}
+	for _, fn := range opts {
+		fn(o)
+	}
+	var names []string
+	for _, field := range o.redactFields {
+		if name := field[len(field)-1]; name != "*" {
+			names = append(names, regexp.QuoteMeta(name))
+		}
+	}
+	if len(names) > 0 {
+		o.redactRaw = regexp.MustCompile(`(?i)"(` + strings.Join(names, "|") + `)"\s*:\s*("(?:[^"\\]|\\.)*"?|[^,}\]\s]+)`)
+	}
+	return o
+}
+
+// bodyCapture keeps at most max bytes written to it and counts the total
+type bodyCapture struct {
+	buf     bytes.Buffer
+	max     int
+	total   int64
+	skipped bool
+}
+
+func (c *bodyCapture) Write(p []byte) (int, error) {
+	c.total += int64(len(p))
+	if c.skipped {
+		return len(p), nil
+	}
+	if remain := c.max - c.buf.Len(); remain > 0 {
+		if len(p) > remain {
+			c.buf.Write(p[:remain])
+		} else {
+			c.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func (c *bodyCapture) truncated() bool {
+	return c.total > int64(c.buf.Len())
+}
+
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func (o *logOptions) skip(contentType string) bool {
+	if o.maxBodySize <= 0 {
+		return true
+	}
+	contentType = strings.ToLower(contentType)
+	for _, item := range o.skipContentTypes {
+		if strings.HasPrefix(contentType, item) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *logOptions) header(header http.Header) http.Header {
+	result := header.Clone()
+	for _, key := range o.redactHeaders {
+		if _, ok := result[key]; ok {
+			result[key] = []string{redacted}
+		}
+	}
+	return result
+}
+
+func (o *logOptions) body(c *bodyCapture, contentType string) string {
+	if c.total == 0 {
+		return ""
+	}
+	if c.skipped {
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		return fmt.Sprintf("[%d bytes of %s body skipped]", c.total, mediaType)
+	}
+	text := strings.ToValidUTF8(c.buf.String(), "")
+	switch {
+	case strings.Contains(contentType, "json"):
+		if !c.truncated() {
+			decoder := json.NewDecoder(strings.NewReader(text))
+			decoder.UseNumber()
+			var data interface{}
+			if err := decoder.Decode(&data); err == nil {
+				o.redactJson(data, nil)
+				b, _ := json.MarshalIndent(data, "", "    ")
+				return string(b)
+			}
+		}
+		if o.redactRaw != nil {
+			text = o.redactRaw.ReplaceAllString(text, `"$1":"`+redacted+`"`)
+		}
+	case strings.Contains(contentType, "application/x-www-form-urlencoded"):
+		if values, err := url.ParseQuery(text); err == nil && !c.truncated() {
+			for key := range values {
+				if o.matchField([]string{key}) {
+					values[key] = []string{redacted}
+				}
+			}
+			text = values.Encode()
+		} else {
+			text = o.redactForm(text)
+		}
+		if unescape, err := url.QueryUnescape(text); err == nil {
+			text = unescape
+		}
+	}
+	if c.truncated() {
+		text += fmt.Sprintf("...(%d bytes truncated)", c.total-int64(c.buf.Len()))
+	}
+	return text
+}
+
+// redactForm redacts fields of a truncated or malformed form pair by pair, keeping the others as they are
+func (o *logOptions) redactForm(text string) string {
+	pairs := strings.Split(text, "&")
+	for i, pair := range pairs {
+		key := pair
+		if j := strings.Index(pair, "="); j >= 0 {
+			key = pair[:j]
+		}
+		if unescape, err := url.QueryUnescape(key); err == nil {
+			key = unescape
+		}
+		if o.matchField([]string{key}) {
+			pairs[i] = url.QueryEscape(key) + "=" + redacted
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func (o *logOptions) redactJson(data interface{}, path []string) {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			fieldPath := append(path[:len(path):len(path)], key)
+			if o.matchField(fieldPath) {
+				v[key] = redacted
+				continue
+			}
+			o.redactJson(value, fieldPath)
+		}
+	case []interface{}:
+		for _, item := range v {
+			o.redactJson(item, path)
+		}
+	}
+}
+
+func (o *logOptions) matchField(path []string) bool {
+	for _, field := range o.redactFields {
+		if len(field) == 1 {
+			if field[0] == "*" || strings.EqualFold(field[0], path[len(path)-1]) {
+				return true
+			}
+			continue
+		}
+		if len(field) != len(path) {
+			continue
+		}
+		matched := true
+		for i, seg := range field {
+			if seg != "*" && !strings.EqualFold(seg, path[i]) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
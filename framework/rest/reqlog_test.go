@@ -0,0 +1,121 @@
+package rest
+
+import (
+	"bufio"
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLogWith_streaming(t *testing.T) {
+	release := make(chan struct{})
+	handler := LogWith()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: first\n"))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("data: second\n"))
+	}))
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+	resp, err := http.Get(ts.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "data: first\n", line)
+	close(release)
+	line, err = reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "data: second\n", line)
+}
+
+func TestLogWith_requestBody(t *testing.T) {
+	handler := LogWith(WithLogMaxBodySize(4))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		w.Write(body)
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("hello world")))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "hello world", w.Body.String())
+}
+
+func TestLogWith_sampleRate(t *testing.T) {
+	var called bool
+	handler := LogWith(WithLogSampleRate(0))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, called = w.(*httptest.ResponseRecorder)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	require.True(t, called)
+}
+
+func Test_bodyCapture(t *testing.T) {
+	c := &bodyCapture{max: 5}
+	n, err := io.Copy(c, strings.NewReader("hello world"))
+	require.NoError(t, err)
+	require.Equal(t, int64(11), n)
+	require.Equal(t, "hello", c.buf.String())
+	require.True(t, c.truncated())
+}
+
+func Test_logOptions_body(t *testing.T) {
+	o := newLogOptions(
+		WithLogMaxBodySize(1024),
+		WithLogSkipContentTypes("multipart/form-data", "image/"),
+		WithLogRedactFields("password", "user.token", "items.secret"),
+	)
+
+	c := &bodyCapture{max: o.maxBodySize}
+	c.Write([]byte(`{"password":"p","user":{"token":"t","name":"odin","password":"p"},"token":"keep","items":[{"secret":"s","id":1}]}`))
+	body := o.body(c, "application/json")
+	require.NotContains(t, body, `"p"`)
+	require.NotContains(t, body, `"t"`)
+	require.NotContains(t, body, `"s"`)
+	require.Contains(t, body, `"keep"`)
+	require.Contains(t, body, `"odin"`)
+
+	c = &bodyCapture{max: 20}
+	c.Write([]byte(`{"name":"odin","password":"secret","age":1}`))
+	body = o.body(c, "application/json")
+	require.NotContains(t, body, "secret")
+	require.Contains(t, body, "bytes truncated")
+
+	c = &bodyCapture{max: o.maxBodySize}
+	c.Write([]byte("username=odin&password=secret"))
+	require.Equal(t, "password=***&username=odin", o.body(c, "application/x-www-form-urlencoded"))
+
+	c = &bodyCapture{max: 40}
+	c.Write([]byte("username=odin&password=secret&remark=" + strings.Repeat("x", 100)))
+	body = o.body(c, "application/x-www-form-urlencoded")
+	require.NotContains(t, body, "secret")
+	require.Contains(t, body, "username=odin&password=***&remark=")
+	require.Contains(t, body, "bytes truncated")
+
+	c = &bodyCapture{max: o.maxBodySize}
+	c.Write([]byte("password=secret%zz&username=odin"))
+	require.Equal(t, "password=***&username=odin", o.body(c, "application/x-www-form-urlencoded"))
+
+	c = &bodyCapture{max: o.maxBodySize, skipped: o.skip("image/png")}
+	c.Write([]byte("binary"))
+	require.Equal(t, "[6 bytes of image/png body skipped]", o.body(c, "image/png"))
+	require.True(t, o.skip("multipart/form-data; boundary=xyz"))
+	require.False(t, o.skip("application/json"))
+}
+
+func Test_logOptions_header(t *testing.T) {
+	o := newLogOptions(WithLogRedactHeaders("authorization", "Cookie"))
+	header := http.Header{}
+	header.Set("Authorization", "Bearer token")
+	header.Set("Accept", "application/json")
+	result := o.header(header)
+	require.Equal(t, "***", result.Get("Authorization"))
+	require.Equal(t, "application/json", result.Get("Accept"))
+	require.Equal(t, "Bearer token", header.Get("Authorization"))
+}
@@ -0,0 +1,147 @@
+package rest
+
+import (
+	"context"
+	"github.com/felixge/httpsnoop"
+	"github.com/pkg/errors"
+	"github.com/slok/goresilience"
+	"github.com/slok/goresilience/circuitbreaker"
+	"github.com/slok/goresilience/concurrencylimit"
+	"github.com/slok/goresilience/concurrencylimit/execute"
+	"github.com/slok/goresilience/concurrencylimit/limit"
+	gerrors "github.com/slok/goresilience/errors"
+	gmetrics "github.com/slok/goresilience/metrics"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	rejectReasonConcurrency = "concurrency_limit"
+	rejectReasonCircuitOpen = "circuit_open"
+	// routeUnmatched is the route of requests which don't match any named route
+	routeUnmatched = "unmatched"
+)
+
+var errServerError = errors.New("server error")
+
+// resilienceRoute returns the matched route name of r, or routeUnmatched for requests not matching any named route,
+// so that paths of 404 requests don't add circuit breakers or metric label values. It keys circuit breakers and
+// labels rejected requests.
+func resilienceRoute(r *http.Request) string {
+	if route := RateLimitByRoute(r); route != "" {
+		return route
+	}
+	return routeUnmatched
+}
+
+// AdaptiveConcurrency sheds load by limiting concurrent requests with AIMD algorithm. The limit starts from
+// cfg.MinimumLimit, increases while requests succeed in time and decreases by cfg.BackoffRatio when a request
+// takes longer than cfg.RTTTimeout or is rejected. Requests waiting longer than maxWaitTime for a free slot
+// are rejected with 503 status code and Retry-After header.
+func AdaptiveConcurrency(cfg limit.AIMDConfig, maxWaitTime time.Duration) func(inner http.Handler) http.Handler {
+	runner := RunnerChain(
+		concurrencylimit.NewMiddleware(concurrencylimit.Config{
+			Limiter: &observedLimiter{Limiter: limit.NewAIMD(cfg)},
+			Executor: execute.NewFIFO(execute.FIFOConfig{
+				MaxWaitTime: maxWaitTime,
+			}),
+			ExecutionResultPolicy: concurrencylimit.FailureOnRejectedPolicy,
+		}),
+	)
+	return func(inner http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			concurrencyInflight.Inc()
+			defer concurrencyInflight.Dec()
+			err := runner.Run(r.Context(), func(_ context.Context) error {
+				inner.ServeHTTP(w, r)
+				return nil
+			})
+			if err != nil {
+				rejectedRequests.WithLabelValues(resilienceRoute(r), r.Method, rejectReasonConcurrency).Inc()
+				w.Header().Set(HeaderRetryAfter, "1")
+				HandleErr(w, r, NewBizError(errors.New("server is overloaded"), WithStatusCode(http.StatusServiceUnavailable)))
+			}
+		})
+	}
+}
+
+// observedLimiter exports the current concurrency limit to prometheus
+type observedLimiter struct {
+	limit.Limiter
+}
+
+func (l *observedLimiter) MeasureSample(startTime time.Time, inflight int, result limit.Result) int {
+	current := l.Limiter.MeasureSample(startTime, inflight, result)
+	concurrencyLimit.Set(float64(current))
+	return current
+}
+
+// CircuitBreaker creates a middleware holding a circuit breaker for each route, requests not matching any named
+// route share one. Responses with 5xx status code
+// count as failures, when the circuit of a route is open its requests are rejected with 503 status code and
+// Retry-After header until cfg.WaitDurationInOpenState passes. Circuit state changes are exported to prometheus.
+func CircuitBreaker(cfg circuitbreaker.Config) func(inner http.Handler) http.Handler {
+	var breakers sync.Map
+	retryAfter := cfg.WaitDurationInOpenState
+	if retryAfter <= 0 {
+		retryAfter = 5 * time.Second
+	}
+	return func(inner http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := resilienceRoute(r)
+			runner, ok := breakers.Load(route)
+			if !ok {
+				runner, _ = breakers.LoadOrStore(route, RunnerChain(
+					gmetrics.NewMiddleware(route, &circuitStateRecorder{Recorder: gmetrics.Dummy}),
+					circuitbreaker.NewMiddleware(cfg),
+				))
+			}
+			err := runner.(goresilience.Runner).Run(r.Context(), func(_ context.Context) error {
+				var statusCode int
+				ww := httpsnoop.Wrap(w, httpsnoop.Hooks{
+					WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+						return func(code int) {
+							if statusCode == 0 {
+								statusCode = code
+							}
+							next(code)
+						}
+					},
+				})
+				inner.ServeHTTP(ww, r)
+				if statusCode >= http.StatusInternalServerError {
+					return errServerError
+				}
+				return nil
+			})
+			if errors.Is(err, gerrors.ErrCircuitOpen) {
+				rejectedRequests.WithLabelValues(route, r.Method, rejectReasonCircuitOpen).Inc()
+				w.Header().Set(HeaderRetryAfter, ceilSeconds(retryAfter))
+				HandleErr(w, r, NewBizError(errors.New("service unavailable"), WithStatusCode(http.StatusServiceUnavailable)))
+			}
+		})
+	}
+}
+
+// circuitStateRecorder exports circuit breaker state of a route to prometheus
+type circuitStateRecorder struct {
+	gmetrics.Recorder
+	route string
+}
+
+func (c *circuitStateRecorder) WithID(id string) gmetrics.Recorder {
+	return &circuitStateRecorder{Recorder: c.Recorder, route: id}
+}
+
+func (c *circuitStateRecorder) IncCircuitbreakerState(state string) {
+	value := 0
+	switch state {
+	case "halfopen":
+		value = 1
+	case "open":
+		value = 2
+	}
+	circuitBreakerState.WithLabelValues(c.route).Set(float64(value))
+	circuitBreakerTransitions.WithLabelValues(c.route, state).Inc()
+}
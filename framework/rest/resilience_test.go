@@ -0,0 +1,93 @@
+package rest
+
+import (
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/slok/goresilience/circuitbreaker"
+	"github.com/slok/goresilience/concurrencylimit/limit"
+	"github.com/stretchr/testify/require"
+	"github.com/youminxue/odin/framework/rest/httprouter"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var healthy int32
+	router := httprouter.New()
+	router.SaveMatchedRoutePath = true
+	router.Handler(http.MethodGet, "/flaky", CircuitBreaker(circuitbreaker.Config{
+		MinimumRequestToOpen:    3,
+		WaitDurationInOpenState: 100 * time.Millisecond,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})), "GetFlaky")
+
+	rejected := testutil.ToFloat64(rejectedRequests.WithLabelValues("GetFlaky", http.MethodGet, rejectReasonCircuitOpen))
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/flaky", nil))
+		require.Equal(t, http.StatusInternalServerError, w.Code)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/flaky", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Equal(t, "1", w.Header().Get(HeaderRetryAfter))
+	require.Equal(t, float64(2), testutil.ToFloat64(circuitBreakerState.WithLabelValues("GetFlaky")))
+	require.Equal(t, rejected+1, testutil.ToFloat64(rejectedRequests.WithLabelValues("GetFlaky", http.MethodGet, rejectReasonCircuitOpen)))
+
+	atomic.StoreInt32(&healthy, 1)
+	time.Sleep(150 * time.Millisecond)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/flaky", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, float64(0), testutil.ToFloat64(circuitBreakerState.WithLabelValues("GetFlaky")))
+}
+
+func TestAdaptiveConcurrency(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	mw := AdaptiveConcurrency(limit.AIMDConfig{MinimumLimit: 1}, 10*time.Millisecond)
+	handler := httprouter.New()
+	handler.SaveMatchedRoutePath = true
+	handler.Handler(http.MethodGet, "/slow", mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})), "GetSlow")
+	handler.Handler(http.MethodGet, "/fast", mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})), "GetFast")
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+	}()
+	<-started
+	rejected := testutil.ToFloat64(rejectedRequests.WithLabelValues("GetFast", http.MethodGet, rejectReasonConcurrency))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Equal(t, "1", w.Header().Get(HeaderRetryAfter))
+	require.Equal(t, rejected+1, testutil.ToFloat64(rejectedRequests.WithLabelValues("GetFast", http.MethodGet, rejectReasonConcurrency)))
+	close(release)
+	wg.Wait()
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestResilienceRoute(t *testing.T) {
+	router := httprouter.New()
+	router.SaveMatchedRoutePath = true
+	var route string
+	router.Handler(http.MethodGet, "/orders/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route = resilienceRoute(r)
+	}), "GetOrder")
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders/1", nil))
+	require.Equal(t, "GetOrder", route)
+	require.Equal(t, routeUnmatched, resilienceRoute(httptest.NewRequest(http.MethodGet, "/a(b/x", nil)))
+}
@@ -0,0 +1,200 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RouteInfo describes a registered route. It is printed in the route table on startup, served on /odin/routes
+// and stored into request context so that middlewares can read route metadata such as auth scopes or timeout.
+type RouteInfo struct {
+	Name        string                 `json:"name"`
+	Method      string                 `json:"method"`
+	Pattern     string                 `json:"pattern"`
+	Tags        []string               `json:"tags,omitempty"`
+	Middlewares int                    `json:"middlewares,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// NewRouteInfo creates RouteInfo from route, business route patterns are prefixed with rootPath
+func NewRouteInfo(route Route, rootPath string) *RouteInfo {
+	pattern := route.Pattern
+	if !strings.HasPrefix(pattern, gddPathPrefix) && !strings.HasPrefix(pattern, debugPathPrefix) {
+		pattern = path.Clean(rootPath + pattern)
+	}
+	return &RouteInfo{
+		Name:        route.Name,
+		Method:      route.Method,
+		Pattern:     pattern,
+		Tags:        route.Tags,
+		Middlewares: len(route.Middlewares),
+		Metadata:    route.Metadata,
+	}
+}
+
+// Row returns columns of the route table printed on startup
+func (info *RouteInfo) Row() []string {
+	var middlewares string
+	if info.Middlewares > 0 {
+		middlewares = strconv.Itoa(info.Middlewares)
+	}
+	keys := make([]string, 0, len(info.Metadata))
+	for k := range info.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	metadata := make([]string, 0, len(keys))
+	for _, k := range keys {
+		metadata = append(metadata, fmt.Sprintf("%s=%v", k, info.Metadata[k]))
+	}
+	return []string{info.Name, info.Method, info.Pattern, strings.Join(info.Tags, ","), middlewares, strings.Join(metadata, " ")}
+}
+
+// RouteTableHeader is the header of the route table printed on startup
+var RouteTableHeader = []string{"Name", "Method", "Pattern", "Tags", "Middlewares", "Metadata"}
+
+type routeInfoCtxKey struct{}
+
+// ContextWithRoute stores info into ctx
+func ContextWithRoute(ctx context.Context, info *RouteInfo) context.Context {
+	return context.WithValue(ctx, routeInfoCtxKey{}, info)
+}
+
+// RouteFromContext returns info of the matched route or nil
+func RouteFromContext(ctx context.Context) *RouteInfo {
+	info, _ := ctx.Value(routeInfoCtxKey{}).(*RouteInfo)
+	return info
+}
+
+// RouteMetadata returns metadata value of the matched route by key
+func RouteMetadata(ctx context.Context, key string) (interface{}, bool) {
+	info := RouteFromContext(ctx)
+	if info == nil {
+		return nil, false
+	}
+	value, ok := info.Metadata[key]
+	return value, ok
+}
+
+func withRoute(info *RouteInfo, inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inner.ServeHTTP(w, r.WithContext(ContextWithRoute(r.Context(), info)))
+	})
+}
+
+// Handler returns HandlerFunc wrapped by route middlewares, the first one is the outermost
+func (route Route) Handler() http.Handler {
+	h := http.Handler(route.HandlerFunc)
+	for i := len(route.Middlewares) - 1; i >= 0; i-- {
+		h = route.Middlewares[i].Middleware(h)
+	}
+	return h
+}
+
+// RouteGroup registers routes sharing a pattern prefix, middlewares, tags and metadata. Settings of a group
+// are copied into routes when they are added, so call Use, Tag and Meta before AddRoute.
+type RouteGroup struct {
+	add         func(route ...Route)
+	prefix      string
+	middlewares []MiddlewareFunc
+	tags        []string
+	metadata    map[string]interface{}
+}
+
+// NewRouteGroup creates a RouteGroup adding routes by add, such as AddRoute method of a RestServer
+func NewRouteGroup(add func(route ...Route), prefix string, mwf ...func(http.Handler) http.Handler) *RouteGroup {
+	g := &RouteGroup{
+		add:    add,
+		prefix: strings.TrimSuffix(prefix, "/"),
+	}
+	return g.Use(mwf...)
+}
+
+// Group creates a sub group inheriting prefix, middlewares, tags and metadata of g
+func (g *RouteGroup) Group(prefix string, mwf ...func(http.Handler) http.Handler) *RouteGroup {
+	sub := &RouteGroup{
+		add:         g.add,
+		prefix:      g.prefix + strings.TrimSuffix(prefix, "/"),
+		middlewares: append([]MiddlewareFunc(nil), g.middlewares...),
+		tags:        append([]string(nil), g.tags...),
+		metadata:    make(map[string]interface{}, len(g.metadata)),
+	}
+	for k, v := range g.metadata {
+		sub.metadata[k] = v
+	}
+	return sub.Use(mwf...)
+}
+
+// Use adds middlewares to the end of group middleware chain
+func (g *RouteGroup) Use(mwf ...func(http.Handler) http.Handler) *RouteGroup {
+	for _, item := range mwf {
+		g.middlewares = append(g.middlewares, item)
+	}
+	return g
+}
+
+// Tag adds tags to routes of the group
+func (g *RouteGroup) Tag(tags ...string) *RouteGroup {
+	g.tags = append(g.tags, tags...)
+	return g
+}
+
+// Meta sets metadata of routes of the group, route's own metadata takes precedence
+func (g *RouteGroup) Meta(key string, value interface{}) *RouteGroup {
+	if g.metadata == nil {
+		g.metadata = make(map[string]interface{})
+	}
+	g.metadata[key] = value
+	return g
+}
+
+// AddRoute adds routes with group prefix, middlewares, tags and metadata. Group middlewares wrap route's own middlewares.
+func (g *RouteGroup) AddRoute(route ...Route) {
+	routes := make([]Route, 0, len(route))
+	for _, item := range route {
+		item.Pattern = g.prefix + item.Pattern
+		if len(g.middlewares) > 0 {
+			item.Middlewares = append(append([]MiddlewareFunc(nil), g.middlewares...), item.Middlewares...)
+		}
+		if len(g.tags) > 0 {
+			item.Tags = append(append([]string(nil), g.tags...), item.Tags...)
+		}
+		if len(g.metadata) > 0 {
+			metadata := make(map[string]interface{}, len(g.metadata)+len(item.Metadata))
+			for k, v := range g.metadata {
+				metadata[k] = v
+			}
+			for k, v := range item.Metadata {
+				metadata[k] = v
+			}
+			item.Metadata = metadata
+		}
+		routes = append(routes, item)
+	}
+	g.add(routes...)
+}
+
+var RouteTableRoutes = routeTableRoutes
+
+// routeTableRoutes serves route table returned by table
+func routeTableRoutes(table func() []*RouteInfo) []Route {
+	return []Route{
+		{
+			Name:    "GetRoutes",
+			Method:  "GET",
+			Pattern: "/odin/routes",
+			HandlerFunc: func(_writer http.ResponseWriter, _req *http.Request) {
+				_writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+				if err := json.NewEncoder(_writer).Encode(table()); err != nil {
+					http.Error(_writer, err.Error(), http.StatusInternalServerError)
+				}
+			},
+		},
+	}
+}
@@ -0,0 +1,83 @@
+package rest
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func trace(name string, calls *[]string) func(http.Handler) http.Handler {
+	return func(inner http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*calls = append(*calls, name)
+			inner.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestRouteGroup(t *testing.T) {
+	var calls []string
+	srv := NewRestServer()
+	api := srv.Group("/api/", trace("api", &calls)).Tag("api").Meta("timeout", "1s").Meta("scope", "read")
+	admin := api.Group("/admin", trace("admin", &calls)).Tag("admin").Meta("scope", "admin")
+	admin.AddRoute(Route{
+		Name:    "DeleteUser",
+		Method:  http.MethodDelete,
+		Pattern: "/user",
+		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+			scope, _ := RouteMetadata(r.Context(), "scope")
+			w.Write([]byte(scope.(string)))
+		},
+		Middlewares: []MiddlewareFunc{trace("route", &calls)},
+		Metadata:    map[string]interface{}{"timeout": "5s"},
+	})
+	api.AddRoute(Route{
+		Name:        "GetUser",
+		Method:      http.MethodGet,
+		Pattern:     "/user",
+		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {},
+	})
+
+	require.Len(t, srv.bizRoutes, 2)
+	deleteUser, getUser := srv.bizRoutes[0], srv.bizRoutes[1]
+	require.Equal(t, "/api/admin/user", deleteUser.Pattern)
+	require.Equal(t, []string{"api", "admin"}, deleteUser.Tags)
+	require.Equal(t, map[string]interface{}{"timeout": "5s", "scope": "admin"}, deleteUser.Metadata)
+	require.Equal(t, "/api/user", getUser.Pattern)
+	require.Len(t, getUser.Middlewares, 1)
+	require.Equal(t, map[string]interface{}{"timeout": "1s", "scope": "read"}, getUser.Metadata)
+
+	info := NewRouteInfo(deleteUser, "/v1")
+	require.Equal(t, "/v1/api/admin/user", info.Pattern)
+	require.Equal(t, []string{"DeleteUser", http.MethodDelete, "/v1/api/admin/user", "api,admin", "3", "scope=admin timeout=5s"}, info.Row())
+
+	w := httptest.NewRecorder()
+	withRoute(info, deleteUser.Handler()).ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/v1/api/admin/user", nil))
+	require.Equal(t, []string{"api", "admin", "route"}, calls)
+	require.Equal(t, "admin", w.Body.String())
+	require.Same(t, info, RouteFromContext(ContextWithRoute(httptest.NewRequest(http.MethodGet, "/", nil).Context(), info)))
+}
+
+func TestRouteTableRoutes(t *testing.T) {
+	srv := NewRestServer()
+	srv.AddRoute(Route{
+		Name:     "GetUser",
+		Method:   http.MethodGet,
+		Pattern:  "/user",
+		Tags:     []string{"user"},
+		Metadata: map[string]interface{}{"rate": 10},
+	})
+	srv.gddRoutes = append(srv.gddRoutes, routeTableRoutes(srv.routeTable)...)
+	w := httptest.NewRecorder()
+	srv.gddRoutes[0].HandlerFunc(w, httptest.NewRequest(http.MethodGet, "/odin/routes", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var table []RouteInfo
+	require.NoError(t, json.NewDecoder(strings.NewReader(w.Body.String())).Decode(&table))
+	require.Equal(t, []RouteInfo{
+		{Name: "GetUser", Method: http.MethodGet, Pattern: "/user", Tags: []string{"user"}, Metadata: map[string]interface{}{"rate": float64(10)}},
+		{Name: "GetRoutes", Method: http.MethodGet, Pattern: "/odin/routes"},
+	}, table)
+}
@@ -12,19 +12,22 @@ import (
 	"github.com/youminxue/odin/framework"
 	"github.com/youminxue/odin/framework/internal/banner"
 	"github.com/youminxue/odin/framework/internal/config"
+	"github.com/youminxue/odin/framework/lifecycle"
+	"github.com/youminxue/odin/framework/outlier"
 	register "github.com/youminxue/odin/framework/registry"
 	"github.com/youminxue/odin/framework/registry/constants"
 	"github.com/youminxue/odin/framework/rest/httprouter"
 	"github.com/youminxue/odin/toolkit/cast"
 	"github.com/youminxue/odin/toolkit/stringutils"
 	logger "github.com/youminxue/odin/toolkit/zlogger"
+	"net"
 	"net/http"
 	"net/http/pprof"
 	"os"
 	"os/signal"
-	"path"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -96,12 +99,8 @@ type RestServer struct {
 	panicHandler func(inner http.Handler) http.Handler
 }
 
-func (srv *RestServer) printRoutes() {
-	if !framework.CheckDev() {
-		return
-	}
-	logger.Info().Msg("================ Registered Routes ================")
-	data := [][]string{}
+// routeTable returns infos of all registered routes
+func (srv *RestServer) routeTable() []*RouteInfo {
 	rr := config.DefaultGddRouteRootPath
 	if stringutils.IsNotEmpty(config.GddRouteRootPath.Load()) {
 		rr = config.GddRouteRootPath.Load()
@@ -110,19 +109,23 @@ func (srv *RestServer) printRoutes() {
 	all = append(all, srv.bizRoutes...)
 	all = append(all, srv.gddRoutes...)
 	all = append(all, srv.debugRoutes...)
+	table := make([]*RouteInfo, 0, len(all))
 	for _, r := range all {
-		if strings.HasPrefix(r.Pattern, gddPathPrefix) || strings.HasPrefix(r.Pattern, debugPathPrefix) {
-			data = append(data, []string{r.Name, r.Method, r.Pattern})
-		} else {
-			data = append(data, []string{r.Name, r.Method, path.Clean(rr + r.Pattern)})
-		}
+		table = append(table, NewRouteInfo(r, rr))
 	}
+	return table
+}
 
+func (srv *RestServer) printRoutes() {
+	if !framework.CheckDev() {
+		return
+	}
+	logger.Info().Msg("================ Registered Routes ================")
 	tableString := &strings.Builder{}
 	table := tablewriter.NewWriter(tableString)
-	table.SetHeader([]string{"Name", "Method", "Pattern"})
-	for _, v := range data {
-		table.Append(v)
+	table.SetHeader(RouteTableHeader)
+	for _, v := range srv.routeTable() {
+		table.Append(v.Row())
 	}
 	table.Render() // Send output
 	rows := strings.Split(strings.TrimSpace(tableString.String()), "\n")
@@ -168,6 +171,9 @@ func NewRestServer(data ...map[string]interface{}) *RestServer {
 		handlers.ProxyHeaders,
 		fallbackContentType(config.GddFallbackContentType.LoadOrDefault(config.DefaultGddFallbackContentType)),
 	)
+	if cast.ToBoolOrDefault(config.GddRatelimitEnable.Load(), config.DefaultGddRatelimitEnable) {
+		srv.middlewares = append(srv.middlewares, RateLimit(DefaultRateLimiter()))
+	}
 	if len(data) > 0 {
 		srv.data = data[0]
 	}
@@ -227,6 +233,9 @@ func NewRestServerWithOptions(options ...ServerOption) *RestServer {
 		handlers.ProxyHeaders,
 		fallbackContentType(config.GddFallbackContentType.LoadOrDefault(config.DefaultGddFallbackContentType)),
 	)
+	if cast.ToBoolOrDefault(config.GddRatelimitEnable.Load(), config.DefaultGddRatelimitEnable) {
+		srv.middlewares = append(srv.middlewares, RateLimit(DefaultRateLimiter()))
+	}
 	return srv
 }
 
@@ -235,6 +244,11 @@ func (srv *RestServer) AddRoute(route ...Route) {
 	srv.bizRoutes = append(srv.bizRoutes, route...)
 }
 
+// Group creates a RouteGroup whose routes are prefixed with prefix and wrapped by mwf inside the middlewares of srv
+func (srv *RestServer) Group(prefix string, mwf ...func(http.Handler) http.Handler) *RouteGroup {
+	return NewRouteGroup(srv.AddRoute, prefix, mwf...)
+}
+
 // AddMiddleware adds middlewares to the end of chain
 func (srv *RestServer) AddMiddleware(mwf ...func(http.Handler) http.Handler) {
 	for _, item := range mwf {
@@ -289,22 +303,94 @@ func (srv *RestServer) newHttpServer() *http.Server {
 		IdleTimeout:  idle,
 		Handler:      srv.rootRouter, // Pass our instance of httprouter.Router in.
 	}
+	if err = ConfigureHttpServer(httpServer); err != nil {
+		logger.Panic().Err(err).Msg("[odin] failed to configure http server")
+	}
+	return httpServer
+}
 
-	// Run our server in a goroutine so that it doesn't block.
+// listenAndServe binds the address of httpServer and serves it in a goroutine, so that connections are accepted
+// as soon as it returns without error.
+func listenAndServe(httpServer *http.Server) error {
+	lis, err := net.Listen("tcp", httpServer.Addr)
+	if err != nil {
+		return err
+	}
+	logger.Info().Msgf("Http server is listening at %s://%v", config.GetScheme(), httpServer.Addr)
+	logger.Info().Msgf("Http server started in %s", time.Since(startAt))
 	go func() {
-		logger.Info().Msgf("Http server is listening at %v", httpServer.Addr)
-		logger.Info().Msgf("Http server started in %s", time.Since(startAt))
-		if err := httpServer.ListenAndServe(); err != nil {
+		if err := Serve(httpServer, lis); err != nil && err != http.ErrServerClosed {
 			logger.Error().Err(err).Msg("")
 		}
 	}()
+	return nil
+}
 
-	return httpServer
+// abortStart stops lifecycle hooks and deregisters the service when the server failed to start
+func abortStart(err error) {
+	logger.Error().Err(err).Msg("[odin] failed to start http server")
+	register.ShutdownRest()
+	if err := lifecycle.Stop(context.Background()); err != nil {
+		logger.Error().Err(err).Msg("[odin] failed to stop lifecycle hooks")
+	}
+}
+
+// graceTimeout returns GDD_GRACE_TIMEOUT
+func graceTimeout() time.Duration {
+	grace, err := time.ParseDuration(config.GddGraceTimeout.Load())
+	if err != nil {
+		logger.Debug().Msgf("Parse %s %s as time.Duration failed: %s, use default %s instead.\n", string(config.GddGraceTimeout),
+			config.GddGraceTimeout.Load(), err.Error(), config.DefaultGddGraceTimeout)
+		grace, _ = time.ParseDuration(config.DefaultGddGraceTimeout)
+	}
+	return grace
+}
+
+// waitForSignal blocks until the process receives a signal to shut down
+func waitForSignal() {
+	c := make(chan os.Signal, 1)
+	// We'll accept graceful shutdowns when quit via SIGINT (Ctrl+C) or SIGTERM sent by orchestrators like kubernetes
+	// SIGKILL or SIGQUIT (Ctrl+/) will not be caught.
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+
+	// Block until we receive our signal.
+	<-c
 }
 
 // Run runs http server
 func (srv *RestServer) Run() {
 	banner.Print()
+	if err := lifecycle.Start(context.Background()); err != nil {
+		logger.Panic().Err(err).Msg("[odin] failed to start lifecycle hooks")
+	}
+	srv.setup()
+	httpServer := srv.newHttpServer()
+	if err := listenAndServe(httpServer); err != nil {
+		abortStart(err)
+		return
+	}
+	lifecycle.SetReady(true)
+	defer func() {
+		lifecycle.Drain(register.MarkUnhealthyRest)
+		register.ShutdownRest()
+		grace := graceTimeout()
+		logger.Info().Msgf("Http server is gracefully shutting down in %s", grace)
+
+		ctx, cancel := context.WithTimeout(context.Background(), grace)
+		defer cancel()
+		// Doesn't block if no connections, but will otherwise wait
+		// until the timeout deadline.
+		httpServer.Shutdown(ctx)
+		if err := lifecycle.Stop(context.Background()); err != nil {
+			logger.Error().Err(err).Msg("[odin] failed to stop lifecycle hooks")
+		}
+	}()
+
+	waitForSignal()
+}
+
+// setup registers srv to service registries and builds routes with middlewares
+func (srv *RestServer) setup() {
 	register.NewRest(srv.data)
 	manage := cast.ToBoolOrDefault(config.GddManage.Load(), config.DefaultGddManage)
 	if manage {
@@ -337,8 +423,13 @@ func (srv *RestServer) Run() {
 		srv.gddRoutes = append(srv.gddRoutes, docRoutes()...)
 		srv.gddRoutes = append(srv.gddRoutes, promRoutes()...)
 		srv.gddRoutes = append(srv.gddRoutes, configRoutes()...)
+		srv.gddRoutes = append(srv.gddRoutes, routeTableRoutes(srv.routeTable)...)
+		if outlier.Enabled() {
+			srv.gddRoutes = append(srv.gddRoutes, outlierRoutes()...)
+		}
 		if _, ok := config.ServiceDiscoveryMap()[constants.SD_MEMBERLIST]; ok {
 			srv.gddRoutes = append(srv.gddRoutes, MemberlistUIRoutes()...)
+			srv.gddRoutes = append(srv.gddRoutes, keyringRoutes()...)
 		}
 		freq, err := time.ParseDuration(config.GddStatsFreq.Load())
 		if err != nil {
@@ -370,7 +461,7 @@ func (srv *RestServer) Run() {
 			if item.HandlerFunc == nil {
 				continue
 			}
-			h := http.Handler(item.HandlerFunc)
+			h := item.Handler()
 			for i := len(gddmiddlewares) - 1; i >= 0; i-- {
 				h = gddmiddlewares[i].Middleware(h)
 			}
@@ -426,20 +517,29 @@ func (srv *RestServer) Run() {
 			if item.HandlerFunc == nil {
 				continue
 			}
-			h := http.Handler(item.HandlerFunc)
+			h := item.Handler()
 			for i := len(gddmiddlewares) - 1; i >= 0; i-- {
 				h = gddmiddlewares[i].Middleware(h)
 			}
 			debugRouter.Handler(item.Method, "/"+strings.TrimPrefix(item.Pattern, debugPathPrefix), h, item.Name)
 		}
 	}
+	healthRouter := srv.rootRouter.NewGroup(gddPathPrefix)
+	for _, item := range healthRoutes() {
+		healthRouter.Handler(item.Method, "/"+strings.TrimPrefix(item.Pattern, gddPathPrefix), item.Handler(), item.Name)
+		srv.gddRoutes = append(srv.gddRoutes, item)
+	}
 	srv.middlewares = append(srv.middlewares, srv.panicHandler)
+	rr := config.DefaultGddRouteRootPath
+	if stringutils.IsNotEmpty(config.GddRouteRootPath.Load()) {
+		rr = config.GddRouteRootPath.Load()
+	}
 	for _, item := range srv.bizRoutes {
-		h := http.Handler(item.HandlerFunc)
+		h := item.Handler()
 		for i := len(srv.middlewares) - 1; i >= 0; i-- {
 			h = srv.middlewares[i].Middleware(h)
 		}
-		srv.bizRouter.Handler(item.Method, item.Pattern, h, item.Name)
+		srv.bizRouter.Handler(item.Method, item.Pattern, withRoute(NewRouteInfo(item, rr), h), item.Name)
 	}
 	srv.rootRouter.NotFound = http.HandlerFunc(http.NotFound)
 	srv.rootRouter.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -451,29 +551,4 @@ func (srv *RestServer) Run() {
 		srv.rootRouter.MethodNotAllowed = srv.middlewares[i].Middleware(srv.rootRouter.MethodNotAllowed)
 	}
 	srv.printRoutes()
-	httpServer := srv.newHttpServer()
-	defer func() {
-		register.ShutdownRest()
-		grace, err := time.ParseDuration(config.GddGraceTimeout.Load())
-		if err != nil {
-			logger.Debug().Msgf("Parse %s %s as time.Duration failed: %s, use default %s instead.\n", string(config.GddGraceTimeout),
-				config.GddGraceTimeout.Load(), err.Error(), config.DefaultGddGraceTimeout)
-			grace, _ = time.ParseDuration(config.DefaultGddGraceTimeout)
-		}
-		logger.Info().Msgf("Http server is gracefully shutting down in %s", grace)
-
-		ctx, cancel := context.WithTimeout(context.Background(), grace)
-		defer cancel()
-		// Doesn't block if no connections, but will otherwise wait
-		// until the timeout deadline.
-		httpServer.Shutdown(ctx)
-	}()
-
-	c := make(chan os.Signal, 1)
-	// We'll accept graceful shutdowns when quit via SIGINT (Ctrl+C)
-	// SIGKILL, SIGQUIT or SIGTERM (Ctrl+/) will not be caught.
-	signal.Notify(c, os.Interrupt)
-
-	// Block until we receive our signal.
-	<-c
 }
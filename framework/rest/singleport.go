@@ -0,0 +1,108 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/youminxue/odin/framework/grpcx"
+	"github.com/youminxue/odin/framework/internal/banner"
+	"github.com/youminxue/odin/framework/internal/config"
+	"github.com/youminxue/odin/framework/lifecycle"
+	register "github.com/youminxue/odin/framework/registry"
+	"github.com/youminxue/odin/framework/registry/utils"
+	"github.com/youminxue/odin/toolkit/cast"
+	"github.com/youminxue/odin/toolkit/cmux"
+	logger "github.com/youminxue/odin/toolkit/zlogger"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// RunWithGrpc runs http server together with grpcServer, which share lifecycle hooks, readiness, service registries
+// and graceful shutdown. If GDD_SINGLE_PORT_ENABLE is true, both are served on GDD_PORT: gRPC requests go to
+// grpcServer, HTTP/1.1 and h2c requests go to http server. Otherwise grpcServer listens on GDD_GRPC_PORT.
+func (srv *RestServer) RunWithGrpc(grpcServer *grpcx.GrpcServer) {
+	banner.Print()
+	if err := lifecycle.Start(context.Background()); err != nil {
+		logger.Panic().Err(err).Msg("[odin] failed to start lifecycle hooks")
+	}
+	srv.setup()
+	httpServer := srv.newHttpServer()
+	var mux *cmux.Mux
+	if config.SinglePortEnabled() {
+		mux = newSinglePortMux(httpServer)
+		// grpc service is registered with GDD_PORT, while GDD_GRPC_PORT is kept for grpc servers run alone
+		utils.SetGrpcRegisterPort(config.GetPort())
+		grpcServer.Start(mux.Match(cmux.GRPC()))
+		go serve(httpServer, mux.Match(cmux.Any()))
+		go func() {
+			if err := mux.Serve(); err != nil {
+				logger.Error().Err(err).Msg("[odin] failed to serve http and grpc on one port")
+			}
+		}()
+	} else {
+		if err := listenAndServe(httpServer); err != nil {
+			abortStart(err)
+			return
+		}
+		lis, err := net.Listen("tcp", fmt.Sprintf(":%d", config.GetGrpcPort()))
+		if err != nil {
+			logger.Panic().Msgf("failed to listen: %v", err)
+		}
+		grpcServer.Start(lis)
+	}
+	lifecycle.SetReady(true)
+	defer func() {
+		lifecycle.Drain(func() {
+			register.MarkUnhealthyRest()
+			register.MarkUnhealthyGrpc()
+		})
+		register.ShutdownRest()
+		grace := graceTimeout()
+		logger.Info().Msgf("Http and grpc servers are gracefully shutting down in %s", grace)
+
+		ctx, cancel := context.WithTimeout(context.Background(), grace)
+		defer cancel()
+		grpcServer.Shutdown(ctx)
+		httpServer.Shutdown(ctx)
+		if mux != nil {
+			mux.Close()
+		}
+		if err := lifecycle.Stop(context.Background()); err != nil {
+			logger.Error().Err(err).Msg("[odin] failed to stop lifecycle hooks")
+		}
+	}()
+
+	waitForSignal()
+}
+
+// newSinglePortMux listens on the address of httpServer and enables h2c on it, so that HTTP/2 requests other than
+// gRPC can be served as well. TLS is not supported, it should be terminated in front of the service.
+func newSinglePortMux(httpServer *http.Server) *cmux.Mux {
+	if httpServer.TLSConfig != nil {
+		logger.Panic().Msgf("[odin] %s doesn't support TLS, terminate TLS in front of the service instead", string(config.GddSinglePortEnable))
+	}
+	if !cast.ToBoolOrDefault(config.GddH2cEnable.Load(), config.DefaultGddH2cEnable) {
+		httpServer.Handler = h2c.NewHandler(httpServer.Handler, &http2.Server{
+			IdleTimeout: httpServer.IdleTimeout,
+		})
+	}
+	lis, err := net.Listen("tcp", httpServer.Addr)
+	if err != nil {
+		logger.Panic().Msgf("failed to listen: %v", err)
+	}
+	mux := cmux.New(lis)
+	mux.ReadTimeout = httpServer.ReadTimeout
+	return mux
+}
+
+// serve serves httpServer on lis, run it in a goroutine so that it doesn't block.
+func serve(httpServer *http.Server, lis net.Listener) {
+	logger.Info().Msgf("Http and grpc servers are listening at %s://%v", config.GetScheme(), httpServer.Addr)
+	logger.Info().Msgf("Http server started in %s", time.Since(startAt))
+	if err := httpServer.Serve(lis); err != nil && err != http.ErrServerClosed {
+		logger.Error().Err(err).Msg("")
+	}
+}
@@ -0,0 +1,139 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	v3 "github.com/youminxue/odin/toolkit/openapi/v3"
+	logger "github.com/youminxue/odin/toolkit/zlogger"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type connCtxKey struct{}
+
+// contextWithConn keeps the connection of requests in their context, so that handlers of long running responses
+// can lift the write deadline set by http.Server.WriteTimeout
+func contextWithConn(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, connCtxKey{}, conn)
+}
+
+// clearWriteDeadline lifts the write deadline of the connection of r if the server is configured by
+// ConfigureHttpServer, it doesn't affect HTTP/2 connections which are shared by many requests
+func clearWriteDeadline(r *http.Request) {
+	if r.ProtoMajor != 1 {
+		return
+	}
+	if conn, ok := r.Context().Value(connCtxKey{}).(net.Conn); ok {
+		conn.SetWriteDeadline(time.Time{})
+	}
+}
+
+// WriteStream writes stream to w as chunked NDJSON, or as server-sent events if the client accepts text/event-stream.
+// Every item is flushed to the client immediately. Streams created from a reader are copied as is.
+// If the producer finishes the stream with an error, it is sent as X-Stream-Error trailer for NDJSON
+// and as an event named error for server-sent events. The stream is closed when the client goes away.
+// Streams served over HTTP/1.1 are not cut off by GDD_WRITE_TIMEOUT, which only applies to other responses.
+func WriteStream(w http.ResponseWriter, r *http.Request, stream *v3.Stream) {
+	if stream == nil {
+		HandleErr(w, r, errors.New("no stream returned"))
+		return
+	}
+	clearWriteDeadline(r)
+	defer stream.Close()
+	go func() {
+		select {
+		case <-r.Context().Done():
+			stream.Close()
+		case <-stream.Done():
+		}
+	}()
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	if stream.IsRaw() {
+		w.Header().Set("Content-Type", stream.ContentType())
+		if _, err := io.Copy(flushWriter{w, flush}, stream.Reader()); err != nil && r.Context().Err() == nil {
+			logger.Error().Err(err).Msg("[odin] write stream failed")
+		}
+		return
+	}
+	sse := strings.Contains(r.Header.Get(HeaderAccept), v3.EventStreamMediaType)
+	if sse {
+		w.Header().Set("Content-Type", v3.EventStreamMediaType)
+	} else {
+		w.Header().Set("Content-Type", v3.NDJSONMediaType)
+	}
+	w.WriteHeader(http.StatusOK)
+	flush()
+	enc := json.NewEncoder(w)
+	for {
+		var item interface{}
+		err := stream.Next(&item)
+		if err == io.EOF || err == v3.ErrStreamClosed {
+			return
+		}
+		if err != nil {
+			if sse {
+				fmt.Fprintf(w, "event: error\ndata: %s\n\n", strings.ReplaceAll(err.Error(), "\n", " "))
+			} else {
+				w.Header().Set(http.TrailerPrefix+v3.StreamErrorTrailer, err.Error())
+			}
+			return
+		}
+		if sse {
+			err = writeEvent(w, item)
+		} else {
+			err = enc.Encode(item)
+		}
+		if err != nil {
+			if r.Context().Err() == nil {
+				logger.Error().Err(err).Msg("[odin] write stream failed")
+			}
+			return
+		}
+		flush()
+	}
+}
+
+func writeEvent(w io.Writer, item interface{}) error {
+	event, ok := item.(v3.Event)
+	if p, isPtr := item.(*v3.Event); isPtr && p != nil {
+		event, ok = *p, true
+	}
+	if !ok {
+		event = v3.Event{Data: item}
+	}
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if event.ID != "" {
+		fmt.Fprintf(w, "id: %s\n", event.ID)
+	}
+	if event.Event != "" {
+		fmt.Fprintf(w, "event: %s\n", event.Event)
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	return err
+}
+
+type flushWriter struct {
+	w     io.Writer
+	flush func()
+}
+
+func (fw flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	fw.flush()
+	return n, err
+}
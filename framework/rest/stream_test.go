@@ -0,0 +1,99 @@
+package rest
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	v3 "github.com/youminxue/odin/toolkit/openapi/v3"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newStreamServer(err error) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stream := v3.NewStream(0)
+		go func() {
+			for i := 0; i < 3; i++ {
+				if stream.Send(context.Background(), map[string]int{"seq": i}) != nil {
+					return
+				}
+			}
+			stream.Finish(err)
+		}()
+		WriteStream(w, r, stream)
+	}))
+}
+
+func readStream(t *testing.T, url, accept string) ([]int, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	req.Header.Set(HeaderAccept, accept)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Contains(t, resp.Header.Get("Content-Type"), accept)
+	stream := v3.NewResponseStream(resp)
+	defer stream.Close()
+	var seqs []int
+	for {
+		var item struct {
+			Seq int `json:"seq"`
+		}
+		if err = stream.Next(&item); err != nil {
+			break
+		}
+		seqs = append(seqs, item.Seq)
+	}
+	return seqs, err
+}
+
+func TestWriteStream(t *testing.T) {
+	srv := newStreamServer(nil)
+	defer srv.Close()
+	for _, accept := range []string{v3.NDJSONMediaType, v3.EventStreamMediaType} {
+		seqs, err := readStream(t, srv.URL, accept)
+		require.Equal(t, io.EOF, err)
+		require.Equal(t, []int{0, 1, 2}, seqs)
+	}
+}
+
+func TestWriteStream_Error(t *testing.T) {
+	srv := newStreamServer(errors.New("mock error"))
+	defer srv.Close()
+	for _, accept := range []string{v3.NDJSONMediaType, v3.EventStreamMediaType} {
+		seqs, err := readStream(t, srv.URL, accept)
+		require.EqualError(t, err, "mock error")
+		require.Equal(t, []int{0, 1, 2}, seqs)
+	}
+}
+
+func TestWriteStream_Nil(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteStream(w, httptest.NewRequest(http.MethodGet, "/", nil), nil)
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestWriteStream_WriteTimeout(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stream := v3.NewStream(0)
+		go func() {
+			for i := 0; i < 3; i++ {
+				time.Sleep(100 * time.Millisecond)
+				if stream.Send(context.Background(), map[string]int{"seq": i}) != nil {
+					return
+				}
+			}
+			stream.Finish(nil)
+		}()
+		WriteStream(w, r, stream)
+	}))
+	srv.Config.WriteTimeout = 150 * time.Millisecond
+	require.NoError(t, ConfigureHttpServer(srv.Config))
+	srv.Start()
+	defer srv.Close()
+	seqs, err := readStream(t, srv.URL, v3.NDJSONMediaType)
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, []int{0, 1, 2}, seqs)
+}
@@ -0,0 +1,240 @@
+package rest
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/pkg/errors"
+	"github.com/youminxue/odin/framework/internal/config"
+	"github.com/youminxue/odin/toolkit/cast"
+	"github.com/youminxue/odin/toolkit/stringutils"
+	logger "github.com/youminxue/odin/toolkit/zlogger"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// CertReloader serves the certificate loaded from certFile and keyFile. The files are checked every reload
+// interval and the certificate is replaced when either of them changes, so certificates can be rotated
+// without restarting the server. A broken update is logged and the previous certificate keeps being served.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+// NewCertReloader creates a CertReloader and loads the certificate
+func NewCertReloader(certFile, keyFile string, interval time.Duration) (*CertReloader, error) {
+	c := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		interval: interval,
+	}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload loads the certificate if either file changed since last load
+func (c *CertReloader) Reload() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reload()
+}
+
+func (c *CertReloader) reload() error {
+	c.checkedAt = time.Now()
+	var modTime time.Time
+	for _, file := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	if c.cert != nil && modTime.Equal(c.modTime) {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to load certificate")
+	}
+	c.cert = &cert
+	c.modTime = modTime
+	return nil
+}
+
+// GetCertificate can be used as tls.Config.GetCertificate
+func (c *CertReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	cert := c.cert
+	expired := time.Since(c.checkedAt) >= c.interval
+	c.mu.RUnlock()
+	if !expired {
+		return cert, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.checkedAt) >= c.interval {
+		if err := c.reload(); err != nil {
+			logger.Error().Err(err).Msg("[odin] failed to reload certificate, keep using old one")
+		}
+	}
+	return c.cert, nil
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"none":               tls.NoClientCert,
+	"request":            tls.RequestClientCert,
+	"require":            tls.RequireAnyClientCert,
+	"verify_if_given":    tls.VerifyClientCertIfGiven,
+	"require_and_verify": tls.RequireAndVerifyClientCert,
+}
+
+// NewTLSConfigFromConfig creates tls.Config from GDD_TLS_* environment variables. It returns nil
+// if GDD_TLS_CERT_FILE is not set.
+func NewTLSConfigFromConfig() (*tls.Config, error) {
+	certFile := config.GddTlsCertFile.LoadOrDefault(config.DefaultGddTlsCertFile)
+	if stringutils.IsEmpty(certFile) {
+		return nil, nil
+	}
+	keyFile := config.GddTlsKeyFile.LoadOrDefault(config.DefaultGddTlsKeyFile)
+	if stringutils.IsEmpty(keyFile) {
+		return nil, errors.Errorf("%s is required when %s is set", config.GddTlsKeyFile, config.GddTlsCertFile)
+	}
+	interval, err := time.ParseDuration(config.GddTlsReloadInterval.LoadOrDefault(config.DefaultGddTlsReloadInterval))
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid %s", config.GddTlsReloadInterval)
+	}
+	reloader, err := NewCertReloader(certFile, keyFile, interval)
+	if err != nil {
+		return nil, err
+	}
+	minVersion, ok := tlsVersions[config.GddTlsMinVersion.LoadOrDefault(config.DefaultGddTlsMinVersion)]
+	if !ok {
+		return nil, errors.Errorf("invalid %s: %s", config.GddTlsMinVersion, config.GddTlsMinVersion.Load())
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: reloader.GetCertificate,
+	}
+	clientAuth := config.GddTlsClientAuth.LoadOrDefault(config.DefaultGddTlsClientAuth)
+	if caFile := config.GddTlsClientCaFile.LoadOrDefault(config.DefaultGddTlsClientCaFile); stringutils.IsNotEmpty(caFile) {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		tlsConfig.ClientCAs = x509.NewCertPool()
+		if !tlsConfig.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificate found in %s", caFile)
+		}
+		if stringutils.IsEmpty(clientAuth) {
+			clientAuth = "require_and_verify"
+		}
+	}
+	if stringutils.IsNotEmpty(clientAuth) {
+		if tlsConfig.ClientAuth, ok = clientAuthTypes[clientAuth]; !ok {
+			return nil, errors.Errorf("invalid %s: %s", config.GddTlsClientAuth, clientAuth)
+		}
+	}
+	return tlsConfig, nil
+}
+
+// PeerIdentity is the identity from the verified client certificate of a mutual TLS connection
+type PeerIdentity struct {
+	// CommonName is the common name of certificate subject
+	CommonName string
+	// DNSNames are DNS subject alternative names
+	DNSNames []string
+	// URIs are URI subject alternative names, such as SPIFFE ids
+	URIs []*url.URL
+	// Certificate is the leaf client certificate
+	Certificate *x509.Certificate
+}
+
+type peerIdentityCtxKey struct{}
+
+// PeerIdentityFromContext returns the client identity of a mutual TLS request or nil
+func PeerIdentityFromContext(ctx context.Context) *PeerIdentity {
+	identity, _ := ctx.Value(peerIdentityCtxKey{}).(*PeerIdentity)
+	return identity
+}
+
+// peerIdentity stores identity from verified client certificate into request context, unverified
+// certificates accepted by request or require policy are ignored
+func peerIdentity(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			cert := r.TLS.VerifiedChains[0][0]
+			r = r.WithContext(context.WithValue(r.Context(), peerIdentityCtxKey{}, &PeerIdentity{
+				CommonName:  cert.Subject.CommonName,
+				DNSNames:    cert.DNSNames,
+				URIs:        cert.URIs,
+				Certificate: cert,
+			}))
+		}
+		inner.ServeHTTP(w, r)
+	})
+}
+
+// ConfigureHttpServer enables TLS, mutual TLS or h2c on httpServer by GDD_TLS_* and GDD_H2C_ENABLE environment
+// variables. It is used by both RestServer implementations, start the server by ListenAndServe afterwards.
+func ConfigureHttpServer(httpServer *http.Server) error {
+	if httpServer.ConnContext == nil {
+		httpServer.ConnContext = contextWithConn
+	}
+	tlsConfig, err := NewTLSConfigFromConfig()
+	if err != nil {
+		return err
+	}
+	if tlsConfig != nil {
+		httpServer.TLSConfig = tlsConfig
+		if tlsConfig.ClientAuth != tls.NoClientCert {
+			httpServer.Handler = peerIdentity(httpServer.Handler)
+		}
+		return http2.ConfigureServer(httpServer, nil)
+	}
+	if cast.ToBoolOrDefault(config.GddH2cEnable.Load(), config.DefaultGddH2cEnable) {
+		httpServer.Handler = h2c.NewHandler(httpServer.Handler, &http2.Server{
+			IdleTimeout: httpServer.IdleTimeout,
+		})
+	}
+	return nil
+}
+
+// ListenAndServe starts httpServer with TLS if it has TLSConfig
+func ListenAndServe(httpServer *http.Server) error {
+	if httpServer.TLSConfig != nil {
+		return httpServer.ListenAndServeTLS("", "")
+	}
+	return httpServer.ListenAndServe()
+}
+
+// Serve serves httpServer on lis with TLS if it has TLSConfig
+func Serve(httpServer *http.Server, lis net.Listener) error {
+	if httpServer.TLSConfig != nil {
+		return httpServer.ServeTLS(lis, "", "")
+	}
+	return httpServer.Serve(lis)
+}
@@ -0,0 +1,237 @@
+package rest
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/youminxue/odin/framework/rest/httprouter"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// TranscodeBodyAll maps the whole request body onto the request message, the same as body: "*" of google.api.http
+// option. With empty body rule, fields of the request message are read from query parameters instead.
+const TranscodeBodyAll = "*"
+
+// UnaryCall calls a unary rpc with req, it is usually a method of the gRPC service implementation
+type UnaryCall func(ctx context.Context, req proto.Message) (proto.Message, error)
+
+// Transcode returns http handler func serving a unary rpc as REST api, in the way of google.api.http option.
+// The request message is decoded from request body by Content-Type if body is TranscodeBodyAll, otherwise from query
+// parameters, then path variables are set to fields of the same names, dotted names like book.id set nested fields.
+// Request headers are passed to call as incoming gRPC metadata, and gRPC status errors returned by call are
+// responded with the corresponding http status code.
+func Transcode(body string, newRequest func() proto.Message, call UnaryCall) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := newRequest()
+		if body == TranscodeBodyAll {
+			if err := DecodeBody(r, req); err != nil && err != io.EOF {
+				HandleBadRequestErr(w, r, err)
+				return
+			}
+		} else if err := setProtoFields(req.ProtoReflect(), r.URL.Query()); err != nil {
+			HandleBadRequestErr(w, r, err)
+			return
+		}
+		for _, param := range httprouter.ParamsFromContext(r.Context()) {
+			if err := setProtoField(req.ProtoReflect(), param.Key, []string{param.Value}); err != nil {
+				HandleBadRequestErr(w, r, err)
+				return
+			}
+		}
+		ctx := metadata.NewIncomingContext(r.Context(), headerMetadata(r.Header))
+		resp, err := call(ctx, req)
+		if err != nil {
+			HandleErr(w, r, transcodingError(err))
+			return
+		}
+		if err = WriteBody(w, r, resp); err != nil {
+			HandleErr(w, r, err)
+		}
+	}
+}
+
+func headerMetadata(header http.Header) metadata.MD {
+	md := make(metadata.MD, len(header))
+	for key, values := range header {
+		md[strings.ToLower(key)] = values
+	}
+	return md
+}
+
+// transcodingError converts gRPC status error to BizError, whose ErrCode is the gRPC status code
+func transcodingError(err error) error {
+	if _, ok := AsBizError(err); ok {
+		return err
+	}
+	s, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	return NewBizError(errors.New(s.Message()), WithStatusCode(httpStatusOf(s.Code())), WithErrCode(int(s.Code())), WithCause(err))
+}
+
+// httpStatusOf maps gRPC status code to http status code, the same as grpc-gateway does
+func httpStatusOf(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		// client closed request, nginx convention
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// setProtoFields sets values to fields of m by names, values of unknown names are ignored
+func setProtoFields(m protoreflect.Message, values url.Values) error {
+	for name, items := range values {
+		if err := setProtoField(m, name, items); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setProtoField sets items to the field of m named name, which is either proto name or json name and
+// matched case-insensitively. Repeated fields take all items, singular fields take the last one.
+func setProtoField(m protoreflect.Message, name string, items []string) error {
+	if len(items) == 0 {
+		return nil
+	}
+	path := strings.Split(name, ".")
+	for i, part := range path {
+		fd := protoFieldOf(m.Descriptor(), part)
+		if fd == nil {
+			return nil
+		}
+		if i < len(path)-1 {
+			if fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() {
+				return nil
+			}
+			m = m.Mutable(fd).Message()
+			continue
+		}
+		if fd.IsMap() {
+			return errors.Errorf("map field %s is not supported in path or query", name)
+		}
+		if fd.IsList() {
+			list := m.Mutable(fd).List()
+			for _, item := range items {
+				v, err := protoScalarOf(fd, item)
+				if err != nil {
+					return errors.Wrapf(err, "invalid value of field %s", name)
+				}
+				list.Append(v)
+			}
+			return nil
+		}
+		v, err := protoScalarOf(fd, items[len(items)-1])
+		if err != nil {
+			return errors.Wrapf(err, "invalid value of field %s", name)
+		}
+		m.Set(fd, v)
+	}
+	return nil
+}
+
+func protoFieldOf(md protoreflect.MessageDescriptor, name string) protoreflect.FieldDescriptor {
+	fields := md.Fields()
+	if fd := fields.ByName(protoreflect.Name(name)); fd != nil {
+		return fd
+	}
+	if fd := fields.ByJSONName(name); fd != nil {
+		return fd
+	}
+	// path variables derived from method names are lower case, e.g. :userid for field userId
+	normalized := strings.ToLower(strings.ReplaceAll(name, "_", ""))
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if strings.ToLower(strings.ReplaceAll(string(fd.Name()), "_", "")) == normalized {
+			return fd
+		}
+	}
+	return nil
+}
+
+func protoScalarOf(fd protoreflect.FieldDescriptor, item string) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(item), nil
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(item)
+		return protoreflect.ValueOfBool(b), errors.WithStack(err)
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		n, err := strconv.ParseInt(item, 10, 32)
+		return protoreflect.ValueOfInt32(int32(n)), errors.WithStack(err)
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		n, err := strconv.ParseInt(item, 10, 64)
+		return protoreflect.ValueOfInt64(n), errors.WithStack(err)
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		n, err := strconv.ParseUint(item, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(n)), errors.WithStack(err)
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		n, err := strconv.ParseUint(item, 10, 64)
+		return protoreflect.ValueOfUint64(n), errors.WithStack(err)
+	case protoreflect.FloatKind:
+		f, err := strconv.ParseFloat(item, 32)
+		return protoreflect.ValueOfFloat32(float32(f)), errors.WithStack(err)
+	case protoreflect.DoubleKind:
+		f, err := strconv.ParseFloat(item, 64)
+		return protoreflect.ValueOfFloat64(f), errors.WithStack(err)
+	case protoreflect.BytesKind:
+		b, err := base64.StdEncoding.DecodeString(item)
+		if err != nil {
+			b, err = base64.URLEncoding.DecodeString(item)
+		}
+		return protoreflect.ValueOfBytes(b), errors.WithStack(err)
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByName(protoreflect.Name(item)); ev != nil {
+			return protoreflect.ValueOfEnum(ev.Number()), nil
+		}
+		n, err := strconv.ParseInt(item, 10, 32)
+		if err != nil {
+			return protoreflect.Value{}, errors.Errorf("unknown enum value %s", item)
+		}
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(n)), nil
+	case protoreflect.MessageKind:
+		if fd.Message().FullName() == "google.protobuf.Timestamp" {
+			t, err := time.Parse(time.RFC3339Nano, item)
+			if err != nil {
+				return protoreflect.Value{}, errors.WithStack(err)
+			}
+			return protoreflect.ValueOfMessage(timestamppb.New(t).ProtoReflect()), nil
+		}
+	}
+	return protoreflect.Value{}, errors.Errorf("unsupported field kind %s", fd.Kind())
+}
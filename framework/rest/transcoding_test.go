@@ -0,0 +1,123 @@
+package rest
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/youminxue/odin/framework/rest/httprouter"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/typepb"
+)
+
+func newTranscodingServer() *httptest.Server {
+	call := func(ctx context.Context, req proto.Message) (proto.Message, error) {
+		field := req.(*typepb.Field)
+		if field.Number < 0 {
+			return nil, status.Error(codes.NotFound, "field not found")
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		if values := md.Get("x-type-url"); len(values) > 0 {
+			field.TypeUrl = values[0]
+		}
+		return field, nil
+	}
+	newRequest := func() proto.Message {
+		return new(typepb.Field)
+	}
+	router := httprouter.New()
+	router.HandlerFunc(http.MethodGet, "/fields/:name", Transcode("", newRequest, call))
+	router.HandlerFunc(http.MethodPost, "/fields/:name", Transcode(TranscodeBodyAll, newRequest, call))
+	return httptest.NewServer(router)
+}
+
+func TestTranscode(t *testing.T) {
+	ts := newTranscodingServer()
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/fields/id?number=1&kind=TYPE_INT64&packed=true&json_name=ID", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Type-Url", "type.googleapis.com/Book")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	field := readField(t, resp)
+	require.Equal(t, "id", field.Name)
+	require.Equal(t, int32(1), field.Number)
+	require.Equal(t, typepb.Field_TYPE_INT64, field.Kind)
+	require.True(t, field.Packed)
+	require.Equal(t, "ID", field.JsonName)
+	require.Equal(t, "type.googleapis.com/Book", field.TypeUrl)
+
+	resp, err = http.Post(ts.URL+"/fields/title", MediaTypeJSON, strings.NewReader(`{"name":"ignored","number":2,"jsonName":"title"}`))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	field = readField(t, resp)
+	require.Equal(t, "title", field.Name)
+	require.Equal(t, int32(2), field.Number)
+	require.Equal(t, "title", field.JsonName)
+
+	resp, err = http.Post(ts.URL+"/fields/price", MediaTypeForm, strings.NewReader("number=3&kind=TYPE_DOUBLE"))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	field = readField(t, resp)
+	require.Equal(t, typepb.Field_TYPE_DOUBLE, field.Kind)
+
+	resp, err = http.Get(ts.URL + "/fields/id?number=abc")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = http.Get(ts.URL + "/fields/id?number=-1")
+	require.NoError(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	require.Contains(t, string(body), "field not found")
+}
+
+func TestTranscodeProtobuf(t *testing.T) {
+	ts := newTranscodingServer()
+	defer ts.Close()
+
+	data, err := proto.Marshal(&typepb.Field{Number: 5})
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/fields/isbn", strings.NewReader(string(data)))
+	require.NoError(t, err)
+	req.Header.Set(HeaderContentType, MediaTypeProtobuf)
+	req.Header.Set(HeaderAccept, MediaTypeProtobuf)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, MediaTypeProtobuf, resp.Header.Get(HeaderContentType))
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	var field typepb.Field
+	require.NoError(t, proto.Unmarshal(body, &field))
+	require.Equal(t, "isbn", field.Name)
+	require.Equal(t, int32(5), field.Number)
+}
+
+func readField(t *testing.T, resp *http.Response) *typepb.Field {
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	var field typepb.Field
+	require.NoError(t, protojson.Unmarshal(body, &field))
+	return &field
+}
+
+func TestHttpStatusOf(t *testing.T) {
+	require.Equal(t, http.StatusOK, httpStatusOf(codes.OK))
+	require.Equal(t, http.StatusConflict, httpStatusOf(codes.AlreadyExists))
+	require.Equal(t, http.StatusServiceUnavailable, httpStatusOf(codes.Unavailable))
+	require.Equal(t, http.StatusInternalServerError, httpStatusOf(codes.DataLoss))
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/go-playground/validator/v10"
 	"github.com/pkg/errors"
 	"github.com/youminxue/odin/toolkit/stringutils"
+	"net/http"
 	"strings"
 )
 
@@ -36,7 +37,7 @@ func handleValidationErr(err error) error {
 	for _, v := range translations {
 		errmsgs = append(errmsgs, v)
 	}
-	return errors.New(strings.Join(errmsgs, ", "))
+	return NewBizError(errors.New(strings.Join(errmsgs, ", ")), WithStatusCode(http.StatusBadRequest))
 }
 
 func ValidateStruct(value interface{}) error {
@@ -44,8 +45,13 @@ func ValidateStruct(value interface{}) error {
 }
 
 func ValidateVar(value interface{}, tag, param string) error {
-	if stringutils.IsNotEmpty(param) {
-		return errors.Wrap(handleValidationErr(validate.Var(value, tag)), param)
+	err := handleValidationErr(validate.Var(value, tag))
+	if err == nil || stringutils.IsEmpty(param) {
+		return err
+	}
+	if bizErr, ok := err.(BizError); ok {
+		bizErr.ErrMsg = param + ": " + bizErr.ErrMsg
+		return bizErr
 	}
-	return handleValidationErr(validate.Var(value, tag))
+	return errors.Wrap(err, param)
 }
@@ -0,0 +1,62 @@
+package restclient
+
+import (
+	"github.com/go-resty/resty/v2"
+	"github.com/pkg/errors"
+	"github.com/youminxue/odin/framework/registry"
+	"github.com/youminxue/odin/toolkit/loadbalance"
+	"net/http"
+	"time"
+)
+
+// WithBalancedProvider sets a service provider picking instances of provider by balancer,
+// such as loadbalance.NewP2C or loadbalance.NewConsistentHash
+func WithBalancedProvider(provider registry.IInstanceProvider, balancer loadbalance.Balancer) RestClientOption {
+	return WithProvider(registry.NewBalancedProvider(provider, balancer))
+}
+
+var errResent = errors.New("request resent")
+
+type pickCtxKey struct{}
+
+// pick is the server picked for a request sent by Call
+type pick struct {
+	key   string
+	done  loadbalance.DoneFunc
+	start time.Time
+}
+
+// finish tells the balancer the result of the request
+func (p *pick) finish(resp *resty.Response, err error) {
+	if p.done == nil {
+		return
+	}
+	latency := time.Since(p.start)
+	if resp != nil && resp.RawResponse != nil {
+		latency = resp.Time()
+		if err == nil && resp.StatusCode() >= http.StatusInternalServerError {
+			err = errors.Errorf("server responded %s", resp.Status())
+		}
+	}
+	p.done(latency, err)
+	p.done = nil
+}
+
+// SelectServer selects a server from provider for req, it is called by generated clients before sending
+// every request. registry.IBalancedServiceProvider picks by the balance key of the call and is told the result
+// of the request if req is sent by Call, other providers and requests fall back to SelectServer.
+func SelectServer(req *resty.Request, provider registry.IServiceProvider) string {
+	balanced, ok := provider.(registry.IBalancedServiceProvider)
+	if !ok {
+		return provider.SelectServer()
+	}
+	p, ok := req.Context().Value(pickCtxKey{}).(*pick)
+	if !ok {
+		return provider.SelectServer()
+	}
+	// resty retries by calling request middlewares again
+	p.finish(nil, errResent)
+	server, done := balanced.Pick(p.key)
+	p.done, p.start = done, time.Now()
+	return server
+}
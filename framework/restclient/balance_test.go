@@ -0,0 +1,64 @@
+package restclient
+
+import (
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/youminxue/odin/framework/registry"
+	"github.com/youminxue/odin/toolkit/loadbalance"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type staticInstances []loadbalance.Instance
+
+func (s staticInstances) Instances() []loadbalance.Instance {
+	return s
+}
+
+type recordBalancer struct {
+	keys []string
+	errs []error
+}
+
+func (b *recordBalancer) Pick(instances []loadbalance.Instance, key string) (loadbalance.Instance, loadbalance.DoneFunc, error) {
+	b.keys = append(b.keys, key)
+	return instances[0], func(latency time.Duration, err error) {
+		b.errs = append(b.errs, err)
+	}, nil
+}
+
+func TestSelectServer(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/unavailable" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+	balancer := &recordBalancer{}
+	provider := registry.NewBalancedProvider(staticInstances{{BaseUrl: ts.URL}}, balancer)
+	client := resty.New()
+	client.OnBeforeRequest(func(_ *resty.Client, request *resty.Request) error {
+		request.URL = SelectServer(request, provider) + request.URL
+		return nil
+	})
+
+	resp, err := Call{Service: "balancesvc", Method: http.MethodGet, Path: "/ok"}.Execute(client.R(), NewOptions(WithBalanceKey("u1")))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode())
+	resp, err = Call{Service: "balancesvc", Method: http.MethodGet, Path: "/unavailable"}.Execute(client.R(), NewOptions(WithRetry(RetryPolicy{})))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode())
+	require.Equal(t, []string{"u1", ""}, balancer.keys)
+	require.Len(t, balancer.errs, 2)
+	require.NoError(t, balancer.errs[0])
+	require.Error(t, balancer.errs[1])
+
+	// requests not sent by Call are not tracked
+	_, err = client.R().Get("/ok")
+	require.NoError(t, err)
+	require.Len(t, balancer.keys, 3)
+	require.Len(t, balancer.errs, 3)
+	require.NoError(t, balancer.errs[2])
+}
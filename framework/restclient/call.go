@@ -0,0 +1,279 @@
+package restclient
+
+import (
+	"context"
+	"github.com/go-resty/resty/v2"
+	"github.com/youminxue/odin/toolkit/stringutils"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Call is a request from generated http clients to an api of a downstream service
+type Call struct {
+	// Service is the downstream service name for looking up call policy and latencies
+	Service string
+	// Method is http method
+	Method string
+	// Path is request path relative to service root path
+	Path string
+	// RawBody is true if response body is not parsed but read by caller, such calls are not hedged
+	RawBody bool
+	// Stream is true if response body is a stream of items, the timeout of such calls only applies until
+	// the response arrives. It implies RawBody.
+	Stream bool
+}
+
+// Execute sends req applying options over the policy of the service. A request whose body is a stream,
+// e.g. multipart files or gzipped json, is sent once as it cannot be replayed.
+func (c Call) Execute(req *resty.Request, options Options) (*resty.Response, error) {
+	options = PolicyOf(c.Service).merge(options)
+	if stringutils.IsNotEmpty(options.IdempotencyKey) {
+		req.SetHeader(HeaderIdempotencyKey, options.IdempotencyKey)
+	}
+	ctx := req.Context()
+	if options.Timeout > 0 {
+		var cancel context.CancelFunc
+		if c.Stream {
+			// items are read long after the response arrives, so the timeout only applies until then
+			ctx, cancel = context.WithCancel(ctx)
+			timer := time.AfterFunc(options.Timeout, cancel)
+			req.SetContext(ctx)
+			resp, err := c.executeWithRetry(req, ctx, options)
+			timer.Stop()
+			if err != nil || resp == nil || resp.RawResponse == nil {
+				cancel()
+				return resp, err
+			}
+			resp.RawResponse.Body = &cancelOnClose{ReadCloser: resp.RawResponse.Body, cancel: cancel}
+			return resp, err
+		}
+		ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+		if c.RawBody {
+			// the caller keeps reading response body after return, so release the context at deadline
+			time.AfterFunc(options.Timeout, cancel)
+		} else {
+			defer cancel()
+		}
+		req.SetContext(ctx)
+	}
+	return c.executeWithRetry(req, ctx, options)
+}
+
+// executeWithRetry sends req and retries it by options.Retry until ctx is done
+func (c Call) executeWithRetry(req *resty.Request, ctx context.Context, options Options) (*resty.Response, error) {
+	if isReader(req.Body) || !c.replayable(options) {
+		return c.send(req, options)
+	}
+	var (
+		resp *resty.Response
+		err  error
+	)
+	for retry := 0; ; retry++ {
+		resp, err = c.send(cloneRequest(req, ctx), options)
+		if options.Retry == nil || retry >= options.Retry.Retries || ctx.Err() != nil {
+			return resp, err
+		}
+		if err == nil && !options.Retry.retryableStatus(resp.StatusCode()) {
+			return resp, err
+		}
+		timer := time.NewTimer(options.Retry.backoff(retry))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return resp, err
+		case <-timer.C:
+		}
+		if c.RawBody && resp != nil && resp.RawResponse != nil {
+			// the response is dropped for a retry, release its connection as nobody else will read the body
+			resp.RawBody().Close()
+		}
+	}
+}
+
+// cancelOnClose releases the context of a stream call when the caller closes response body
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// replayable reports whether the call can be sent more than once
+func (c Call) replayable(options Options) bool {
+	switch c.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return stringutils.IsNotEmpty(options.IdempotencyKey)
+}
+
+func (c Call) send(req *resty.Request, options Options) (*resty.Response, error) {
+	tracker := latencyOf(c.Service)
+	if options.Hedge == nil || c.RawBody || c.Stream || isReader(req.Body) || !c.replayable(options) {
+		return tracker.observe(c.execute(req, options))
+	}
+	delay, ok := tracker.hedgeDelay(options.Hedge)
+	if !ok {
+		return tracker.observe(c.execute(req, options))
+	}
+	return c.hedge(req, options, delay, tracker)
+}
+
+// execute sends req once, the server picked for it by SelectServer is told the result
+func (c Call) execute(req *resty.Request, options Options) (*resty.Response, error) {
+	p := &pick{key: options.BalanceKey}
+	req.SetContext(context.WithValue(req.Context(), pickCtxKey{}, p))
+	resp, err := req.Execute(c.Method, c.Path)
+	p.finish(resp, err)
+	return resp, err
+}
+
+type hedgeResult struct {
+	resp *resty.Response
+	err  error
+}
+
+// hedge sends req and then another copy of it every delay up to MaxHedged copies, the first successful
+// response wins and in-flight requests are cancelled
+func (c Call) hedge(req *resty.Request, options Options, delay time.Duration, tracker *latencyTracker) (*resty.Response, error) {
+	hedge := options.Hedge
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	maxRequests := 1 + hedge.MaxHedged
+	if hedge.MaxHedged <= 0 {
+		maxRequests = 2
+	}
+	results := make(chan hedgeResult, maxRequests)
+	launch := func() {
+		r := cloneRequest(req, ctx)
+		go func() {
+			resp, err := tracker.observe(c.execute(r, options))
+			results <- hedgeResult{resp, err}
+		}()
+	}
+	launch()
+	inflight, launched := 1, 1
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	var last hedgeResult
+	for {
+		select {
+		case last = <-results:
+			inflight--
+			if last.err == nil && last.resp.StatusCode() < http.StatusInternalServerError {
+				return last.resp, last.err
+			}
+			if inflight == 0 {
+				// failures are left to retry policy
+				return last.resp, last.err
+			}
+		case <-timer.C:
+			if launched < maxRequests {
+				launch()
+				inflight++
+				launched++
+				timer.Reset(delay)
+			}
+		}
+	}
+}
+
+func isReader(body interface{}) bool {
+	_, ok := body.(io.Reader)
+	return ok
+}
+
+// cloneRequest copies req for sending it again, req itself is never sent so that every copy starts from
+// the same state
+func cloneRequest(req *resty.Request, ctx context.Context) *resty.Request {
+	r := *req
+	r.Header = req.Header.Clone()
+	r.QueryParam = cloneValues(req.QueryParam)
+	r.FormData = cloneValues(req.FormData)
+	r.PathParams = make(map[string]string, len(req.PathParams))
+	for k, v := range req.PathParams {
+		r.PathParams[k] = v
+	}
+	r.SetContext(ctx)
+	return &r
+}
+
+func cloneValues(values url.Values) url.Values {
+	ret := make(url.Values, len(values))
+	for k, v := range values {
+		ret[k] = append([]string(nil), v...)
+	}
+	return ret
+}
+
+const (
+	latencyWindow     = 256
+	minLatencySamples = 20
+)
+
+// latencyTracker keeps recent latencies of successful requests to a service
+type latencyTracker struct {
+	mu      sync.Mutex
+	samples [latencyWindow]time.Duration
+	n       int
+}
+
+var latencies sync.Map
+
+func latencyOf(service string) *latencyTracker {
+	if tracker, ok := latencies.Load(service); ok {
+		return tracker.(*latencyTracker)
+	}
+	tracker, _ := latencies.LoadOrStore(service, &latencyTracker{})
+	return tracker.(*latencyTracker)
+}
+
+func (t *latencyTracker) observe(resp *resty.Response, err error) (*resty.Response, error) {
+	if err == nil && resp.StatusCode() < http.StatusInternalServerError {
+		t.mu.Lock()
+		t.samples[t.n%latencyWindow] = resp.Time()
+		t.n++
+		t.mu.Unlock()
+	}
+	return resp, err
+}
+
+// percentile returns the p-th percentile of recent latencies, false if there are not enough samples
+func (t *latencyTracker) percentile(p float64) (time.Duration, bool) {
+	t.mu.Lock()
+	n := t.n
+	if n > latencyWindow {
+		n = latencyWindow
+	}
+	sorted := make([]time.Duration, n)
+	copy(sorted, t.samples[:n])
+	t.mu.Unlock()
+	if n < minLatencySamples {
+		return 0, false
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	idx := int(p / 100 * float64(n))
+	if idx >= n {
+		idx = n - 1
+	}
+	return sorted[idx], true
+}
+
+// hedgeDelay returns how long to wait before hedging, false if hedging should not happen yet
+func (t *latencyTracker) hedgeDelay(hedge *HedgePolicy) (time.Duration, bool) {
+	delay, ok := t.percentile(hedge.Percentile)
+	if !ok {
+		return hedge.MinDelay, hedge.MinDelay > 0
+	}
+	if delay < hedge.MinDelay {
+		delay = hedge.MinDelay
+	}
+	return delay, true
+}
@@ -0,0 +1,209 @@
+package restclient
+
+import (
+	"context"
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParsePolicy(t *testing.T) {
+	base, err := ParsePolicy("timeout:3s;retries:2;backoff:100ms;hedge:p95", Options{})
+	require.NoError(t, err)
+	require.Equal(t, 3*time.Second, base.Timeout)
+	require.Equal(t, 2, base.Retry.Retries)
+	require.Equal(t, 100*time.Millisecond, base.Retry.Backoff)
+	require.Equal(t, 95.0, base.Hedge.Percentile)
+	require.True(t, base.Retry.retryableStatus(http.StatusServiceUnavailable))
+
+	policy, err := ParsePolicy("retries:5;max_backoff:1s;retry_status:500|502", base)
+	require.NoError(t, err)
+	require.Equal(t, 3*time.Second, policy.Timeout)
+	require.Equal(t, 5, policy.Retry.Retries)
+	require.Equal(t, 100*time.Millisecond, policy.Retry.Backoff)
+	require.True(t, policy.Retry.retryableStatus(http.StatusInternalServerError))
+	require.False(t, policy.Retry.retryableStatus(http.StatusServiceUnavailable))
+	require.Equal(t, 2, base.Retry.Retries)
+	require.Equal(t, time.Second, policy.Retry.backoff(10))
+
+	policy, err = ParsePolicy("encoding:msgpack", base)
+	require.NoError(t, err)
+	require.Equal(t, "application/msgpack", policy.Encoding)
+	require.Equal(t, "application/msgpack", base.merge(NewOptions(WithEncoding("application/msgpack"))).Encoding)
+
+	_, err = ParsePolicy("timeout", Options{})
+	require.Error(t, err)
+	_, err = ParsePolicy("jitter:1s", Options{})
+	require.Error(t, err)
+}
+
+func TestPolicyOf_default(t *testing.T) {
+	policy := PolicyOf("usersvc")
+	require.Equal(t, 3*time.Minute, policy.Timeout)
+	require.Equal(t, 3, policy.Retry.Retries)
+}
+
+func TestPolicyOf(t *testing.T) {
+	_ = os.Setenv("GDD_CLIENT_POLICY", "timeout:3s")
+	_ = os.Setenv("GDD_CLIENT_POLICIES", "usersvc=retries:2,broken")
+	defer os.Unsetenv("GDD_CLIENT_POLICY")
+	defer os.Unsetenv("GDD_CLIENT_POLICIES")
+	require.Equal(t, 3*time.Second, PolicyOf("Usersvc").Timeout)
+	require.Equal(t, 2, PolicyOf("Usersvc").Retry.Retries)
+	require.Nil(t, PolicyOf("ordersvc").Retry)
+
+	_ = os.Setenv("GDD_CLIENT_POLICIES", "ordersvc=timeout:1s")
+	require.Equal(t, time.Second, PolicyOf("ordersvc").Timeout)
+	require.Nil(t, PolicyOf("usersvc").Retry)
+
+	policy := PolicyOf("ordersvc").merge(NewOptions(WithTimeout(time.Minute), WithIdempotencyKey("k1")))
+	require.Equal(t, time.Minute, policy.Timeout)
+	require.Equal(t, "k1", policy.IdempotencyKey)
+}
+
+func TestCall_Execute_retry(t *testing.T) {
+	var hits int32
+	var keys []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get(HeaderIdempotencyKey))
+		if atomic.AddInt32(&hits, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(r.Method))
+	}))
+	defer ts.Close()
+	client := resty.New().SetBaseURL(ts.URL)
+	retry := WithRetry(RetryPolicy{Retries: 2, Backoff: time.Millisecond})
+
+	resp, err := Call{Service: "retrysvc", Method: http.MethodPost, Path: "/orders"}.Execute(client.R().SetBody(map[string]string{"a": "b"}), NewOptions(retry))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode())
+	require.Equal(t, int32(1), hits)
+
+	resp, err = Call{Service: "retrysvc", Method: http.MethodPost, Path: "/orders"}.Execute(client.R().SetBody(map[string]string{"a": "b"}), NewOptions(retry, WithIdempotencyKey("k1")))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode())
+	require.Equal(t, "POST", resp.String())
+	require.Equal(t, int32(3), hits)
+	require.Equal(t, []string{"", "k1", "k1"}, keys)
+}
+
+type closeCounter struct {
+	io.ReadCloser
+	closed *int32
+}
+
+func (c closeCounter) Close() error {
+	atomic.AddInt32(c.closed, 1)
+	return c.ReadCloser.Close()
+}
+
+type closeCountingTransport struct {
+	closed int32
+}
+
+func (c *closeCountingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err == nil {
+		resp.Body = closeCounter{ReadCloser: resp.Body, closed: &c.closed}
+	}
+	return resp, err
+}
+
+func TestCall_Execute_retryRawBody(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("file"))
+	}))
+	defer ts.Close()
+	transport := &closeCountingTransport{}
+	client := resty.New().SetBaseURL(ts.URL).SetTransport(transport)
+	retry := WithRetry(RetryPolicy{Retries: 2, Backoff: time.Millisecond})
+
+	resp, err := Call{Service: "retrysvc", Method: http.MethodGet, Path: "/file", RawBody: true}.Execute(client.R().SetDoNotParseResponse(true), NewOptions(retry))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode())
+	// bodies of retried responses are closed, the last one is left to the caller
+	require.Equal(t, int32(2), atomic.LoadInt32(&transport.closed))
+	resp.RawBody().Close()
+}
+
+func TestCall_Execute_timeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer ts.Close()
+	client := resty.New().SetBaseURL(ts.URL)
+	start := time.Now()
+	_, err := Call{Service: "timeoutsvc", Method: http.MethodGet, Path: "/"}.Execute(client.R().SetContext(context.Background()), NewOptions(WithTimeout(50*time.Millisecond)))
+	require.Error(t, err)
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
+func TestCall_Execute_streamTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 3; i++ {
+			w.Write([]byte("{}\n"))
+			w.(http.Flusher).Flush()
+			time.Sleep(50 * time.Millisecond)
+		}
+	}))
+	defer ts.Close()
+	client := resty.New().SetBaseURL(ts.URL)
+	resp, err := Call{Service: "streamsvc", Method: http.MethodGet, Path: "/", RawBody: true, Stream: true}.Execute(
+		client.R().SetContext(context.Background()).SetDoNotParseResponse(true), NewOptions(WithTimeout(50*time.Millisecond)))
+	require.NoError(t, err)
+	defer resp.RawBody().Close()
+	// the stream is read after the timeout
+	body, err := ioutil.ReadAll(resp.RawBody())
+	require.NoError(t, err)
+	require.Equal(t, "{}\n{}\n{}\n", string(body))
+}
+
+func TestCall_Execute_hedge(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(time.Second):
+			}
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+	client := resty.New().SetBaseURL(ts.URL)
+	start := time.Now()
+	resp, err := Call{Service: "hedgesvc", Method: http.MethodGet, Path: "/"}.Execute(client.R(), NewOptions(WithHedge(HedgePolicy{Percentile: 95, MinDelay: 20 * time.Millisecond})))
+	require.NoError(t, err)
+	require.Equal(t, "ok", resp.String())
+	require.Equal(t, int32(2), atomic.LoadInt32(&hits))
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+
+	tracker := latencyOf("percentilesvc")
+	for i := 1; i <= 100; i++ {
+		tracker.samples[i-1] = time.Duration(i) * time.Millisecond
+	}
+	tracker.n = 100
+	delay, ok := tracker.hedgeDelay(&HedgePolicy{Percentile: 95})
+	require.True(t, ok)
+	require.Equal(t, 96*time.Millisecond, delay)
+	_, ok = latencyOf("coldsvc").hedgeDelay(&HedgePolicy{Percentile: 95})
+	require.False(t, ok)
+}
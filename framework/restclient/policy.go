@@ -0,0 +1,319 @@
+package restclient
+
+import (
+	"github.com/pkg/errors"
+	"github.com/youminxue/odin/framework/internal/config"
+	"github.com/youminxue/odin/toolkit/stringutils"
+	logger "github.com/youminxue/odin/toolkit/zlogger"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HeaderIdempotencyKey is the header carrying idempotency key
+const HeaderIdempotencyKey = "Idempotency-Key"
+
+// RetryPolicy decides how failed calls are retried. Calls with non-idempotent http method such as POST
+// and PATCH are only retried if they carry an idempotency key.
+type RetryPolicy struct {
+	// Retries is the max number of retries after the first attempt
+	Retries int
+	// Backoff is the wait time before the first retry, it doubles for each retry
+	Backoff time.Duration
+	// MaxBackoff caps the wait time between retries, zero means no cap
+	MaxBackoff time.Duration
+	// RetryableStatus reports whether a response with status code should be retried, DefaultRetryableStatus if nil
+	RetryableStatus func(statusCode int) bool
+}
+
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	wait := p.Backoff << uint(retry)
+	if wait < p.Backoff || p.MaxBackoff > 0 && wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+	return wait
+}
+
+func (p *RetryPolicy) retryableStatus(statusCode int) bool {
+	if p.RetryableStatus != nil {
+		return p.RetryableStatus(statusCode)
+	}
+	return DefaultRetryableStatus(statusCode)
+}
+
+// DefaultRetryableStatus retries 429, 502, 503 and 504
+func DefaultRetryableStatus(statusCode int) bool {
+	switch statusCode {
+	case 429, 502, 503, 504:
+		return true
+	}
+	return false
+}
+
+// HedgePolicy sends another request to the downstream service if the previous one has not completed
+// after the given percentile of recent latencies, and takes the first successful response.
+// Only idempotent calls and calls carrying an idempotency key are hedged.
+type HedgePolicy struct {
+	// Percentile of recent latencies of the service to wait before hedging, e.g. 95
+	Percentile float64
+	// MaxHedged is the max number of extra requests, 1 if zero
+	MaxHedged int
+	// MinDelay is the least time to wait before hedging, it is also used before enough latencies are observed
+	MinDelay time.Duration
+}
+
+// Options is per-call options of generated http clients, zero values fall back to the policy of the
+// downstream service configured by GDD_CLIENT_POLICIES and GDD_CLIENT_POLICY
+type Options struct {
+	// GzipReqBody compresses json request body
+	GzipReqBody bool
+	// Timeout is the deadline of the whole call including retries and hedged requests
+	Timeout time.Duration
+	// Retry policy of the call
+	Retry *RetryPolicy
+	// IdempotencyKey is sent in Idempotency-Key header, it makes non-idempotent calls retryable
+	IdempotencyKey string
+	// Hedge policy of the call
+	Hedge *HedgePolicy
+	// BalanceKey is the affinity key for balancers such as consistent hash, see registry.BalancedProvider
+	BalanceKey string
+	// Encoding is the media type of request and response bodies such as application/msgpack, json if empty.
+	// Servers which cannot encode a response in it fall back to json.
+	Encoding string
+}
+
+// CallOption configures Options
+type CallOption func(*Options)
+
+// NewOptions creates Options from opts
+func NewOptions(opts ...CallOption) Options {
+	var options Options
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// WithGzipReqBody compresses json request body
+func WithGzipReqBody() CallOption {
+	return func(options *Options) {
+		options.GzipReqBody = true
+	}
+}
+
+// WithTimeout sets deadline of the call
+func WithTimeout(timeout time.Duration) CallOption {
+	return func(options *Options) {
+		options.Timeout = timeout
+	}
+}
+
+// WithRetry sets retry policy of the call
+func WithRetry(retry RetryPolicy) CallOption {
+	return func(options *Options) {
+		options.Retry = &retry
+	}
+}
+
+// WithIdempotencyKey sets idempotency key of the call
+func WithIdempotencyKey(key string) CallOption {
+	return func(options *Options) {
+		options.IdempotencyKey = key
+	}
+}
+
+// WithHedge sets hedge policy of the call
+func WithHedge(hedge HedgePolicy) CallOption {
+	return func(options *Options) {
+		options.Hedge = &hedge
+	}
+}
+
+// WithBalanceKey sets affinity key of the call, such as user id, so that calls with the same key
+// are sent to the same instance by consistent hash balancer
+func WithBalanceKey(key string) CallOption {
+	return func(options *Options) {
+		options.BalanceKey = key
+	}
+}
+
+// WithEncoding sets media type of request and response bodies of the call, see rest.RegisterCodec
+func WithEncoding(mediaType string) CallOption {
+	return func(options *Options) {
+		options.Encoding = mediaType
+	}
+}
+
+// merge returns policy overridden by non-zero fields of options
+func (policy Options) merge(options Options) Options {
+	if options.GzipReqBody {
+		policy.GzipReqBody = true
+	}
+	if options.Timeout > 0 {
+		policy.Timeout = options.Timeout
+	}
+	if options.Retry != nil {
+		policy.Retry = options.Retry
+	}
+	if stringutils.IsNotEmpty(options.IdempotencyKey) {
+		policy.IdempotencyKey = options.IdempotencyKey
+	}
+	if options.Hedge != nil {
+		policy.Hedge = options.Hedge
+	}
+	if stringutils.IsNotEmpty(options.BalanceKey) {
+		policy.BalanceKey = options.BalanceKey
+	}
+	if stringutils.IsNotEmpty(options.Encoding) {
+		policy.Encoding = options.Encoding
+	}
+	return policy
+}
+
+// EncodingOf returns media type of bodies of calls to service with options, empty means json
+func EncodingOf(service string, options Options) string {
+	return PolicyOf(service).merge(options).Encoding
+}
+
+// encodings are short names of media types accepted by encoding policy item
+var encodings = map[string]string{
+	"json":     "application/json",
+	"msgpack":  "application/msgpack",
+	"protobuf": "application/x-protobuf",
+}
+
+// ParsePolicy parses call policy such as timeout:3s;retries:2;backoff:100ms;retry_status:502|503|504;hedge:95;encoding:msgpack
+// on top of base
+func ParsePolicy(value string, base Options) (Options, error) {
+	policy := base
+	if policy.Retry != nil {
+		retry := *policy.Retry
+		policy.Retry = &retry
+	}
+	if policy.Hedge != nil {
+		hedge := *policy.Hedge
+		policy.Hedge = &hedge
+	}
+	retry := func() *RetryPolicy {
+		if policy.Retry == nil {
+			policy.Retry = &RetryPolicy{}
+		}
+		return policy.Retry
+	}
+	hedge := func() *HedgePolicy {
+		if policy.Hedge == nil {
+			policy.Hedge = &HedgePolicy{}
+		}
+		return policy.Hedge
+	}
+	for _, item := range strings.Split(value, ";") {
+		if item = strings.TrimSpace(item); stringutils.IsEmpty(item) {
+			continue
+		}
+		kv := strings.SplitN(item, ":", 2)
+		if len(kv) != 2 {
+			return Options{}, errors.Errorf("invalid policy item %s, should be like timeout:3s", item)
+		}
+		key, val := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		var err error
+		switch key {
+		case "timeout":
+			policy.Timeout, err = time.ParseDuration(val)
+		case "retries":
+			retry().Retries, err = strconv.Atoi(val)
+		case "backoff":
+			retry().Backoff, err = time.ParseDuration(val)
+		case "max_backoff":
+			retry().MaxBackoff, err = time.ParseDuration(val)
+		case "retry_status":
+			statuses := make(map[int]struct{})
+			for _, code := range strings.Split(val, "|") {
+				var status int
+				if status, err = strconv.Atoi(strings.TrimSpace(code)); err != nil {
+					break
+				}
+				statuses[status] = struct{}{}
+			}
+			retry().RetryableStatus = func(statusCode int) bool {
+				_, ok := statuses[statusCode]
+				return ok
+			}
+		case "hedge":
+			hedge().Percentile, err = strconv.ParseFloat(strings.TrimPrefix(val, "p"), 64)
+		case "hedge_max":
+			hedge().MaxHedged, err = strconv.Atoi(val)
+		case "hedge_min_delay":
+			hedge().MinDelay, err = time.ParseDuration(val)
+		case "encoding":
+			policy.Encoding = val
+			if mediaType, ok := encodings[val]; ok {
+				policy.Encoding = mediaType
+			}
+		default:
+			err = errors.New("unknown key")
+		}
+		if err != nil {
+			return Options{}, errors.Wrapf(err, "invalid policy item %s", item)
+		}
+	}
+	return policy, nil
+}
+
+type policies struct {
+	raw      string
+	rawByKey string
+	fallback Options
+	services map[string]Options
+}
+
+var (
+	policyMu sync.Mutex
+	policyOf policies
+)
+
+// PolicyOf returns call policy of service configured by GDD_CLIENT_POLICIES and GDD_CLIENT_POLICY. The environment
+// variables are parsed again when changed, so policies can be updated by remote config. Invalid policies are
+// logged and ignored.
+func PolicyOf(service string) Options {
+	raw := config.GddClientPolicy.LoadOrDefault(config.DefaultGddClientPolicy)
+	rawByKey := config.GddClientPolicies.LoadOrDefault(config.DefaultGddClientPolicies)
+	policyMu.Lock()
+	defer policyMu.Unlock()
+	if policyOf.services == nil || raw != policyOf.raw || rawByKey != policyOf.rawByKey {
+		policyOf = parsePolicies(raw, rawByKey)
+	}
+	if policy, ok := policyOf.services[strings.ToLower(service)]; ok {
+		return policy
+	}
+	return policyOf.fallback
+}
+
+func parsePolicies(raw, rawByKey string) policies {
+	ret := policies{
+		raw:      raw,
+		rawByKey: rawByKey,
+		services: make(map[string]Options),
+	}
+	var err error
+	if ret.fallback, err = ParsePolicy(raw, Options{}); err != nil {
+		logger.Error().Err(err).Msgf("[odin] invalid %s, ignored", config.GddClientPolicy)
+	}
+	for _, item := range strings.Split(rawByKey, ",") {
+		if item = strings.TrimSpace(item); stringutils.IsEmpty(item) {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			logger.Error().Msgf("[odin] invalid %s: %s, should be like usersvc=timeout:2s, ignored", config.GddClientPolicies, item)
+			continue
+		}
+		policy, err := ParsePolicy(kv[1], ret.fallback)
+		if err != nil {
+			logger.Error().Err(err).Msgf("[odin] invalid %s, ignored", config.GddClientPolicies)
+			continue
+		}
+		ret.services[strings.ToLower(strings.TrimSpace(kv[0]))] = policy
+	}
+	return ret
+}
@@ -5,8 +5,10 @@ import (
 	"github.com/klauspost/compress/gzhttp"
 	"github.com/opentracing-contrib/go-stdlib/nethttp"
 	"github.com/youminxue/odin/framework/internal/config"
+	"github.com/youminxue/odin/framework/outlier"
 	"github.com/youminxue/odin/framework/registry"
 	"github.com/youminxue/odin/toolkit/cast"
+	logger "github.com/youminxue/odin/toolkit/zlogger"
 	"net"
 	"net/http"
 	"os"
@@ -24,13 +26,26 @@ type RestClient interface {
 // RestClientOption defines configure function type
 type RestClientOption func(RestClient)
 
-// WithProvider sets service provider
+// WithProvider sets service provider, ejected instances are skipped if GDD_OUTLIER_ENABLE is true
 func WithProvider(provider registry.IServiceProvider) RestClientOption {
 	return func(c RestClient) {
+		if outlier.Enabled() {
+			provider = outlier.DefaultDetector().Wrap(provider)
+		}
 		c.SetProvider(provider)
 	}
 }
 
+// WithDiscovery sets a provider of service over backends in GDD_SERVICE_DISCOVERY_MODE, so that the client works
+// with any of nacos, etcd, memberlist, static and dns modes
+func WithDiscovery(service string) RestClientOption {
+	provider, err := registry.DefaultDiscovery().NewServiceProvider(service)
+	if err != nil {
+		logger.Panic().Err(err).Msgf("[odin] failed to discover service %s", service)
+	}
+	return WithProvider(provider)
+}
+
 // WithClient sets http client
 func WithClient(client *resty.Client) RestClientOption {
 	return func(c RestClient) {
@@ -71,18 +86,22 @@ func NewClient() *resty.Client {
 		KeepAlive: 30 * time.Second,
 		DualStack: true,
 	}
+	var transport http.RoundTripper = &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		MaxIdleConnsPerHost:   runtime.GOMAXPROCS(0) + 1,
+		MaxConnsPerHost:       10000,
+	}
+	if outlier.Enabled() {
+		transport = outlier.DefaultDetector().Transport(transport)
+	}
 	client.SetTransport(gzhttp.Transport(&nethttp.Transport{
-		RoundTripper: &http.Transport{
-			Proxy:                 http.ProxyFromEnvironment,
-			DialContext:           dialer.DialContext,
-			ForceAttemptHTTP2:     true,
-			MaxIdleConns:          100,
-			IdleConnTimeout:       90 * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-			MaxIdleConnsPerHost:   runtime.GOMAXPROCS(0) + 1,
-			MaxConnsPerHost:       10000,
-		},
+		RoundTripper: transport,
 	}))
 	retryCnt := config.DefaultGddRetryCount
 	if cnt, err := cast.ToIntE(config.GddRetryCount.Load()); err == nil {
@@ -375,8 +375,10 @@ type MethodMeta struct {
 	// Comments of the method
 	Comments []string
 	// Path api path
-	// not support when generate client code from service interface in svc.go file
+	// when generate code from service interface in svc.go file, Path is the pattern from @route annotation, such as /orders/:id/status
 	Path string
+	// HttpMethod is the http method from @route annotation when generate code from service interface in svc.go file
+	HttpMethod string
 	// QueryParams not support when generate client code from service interface in svc.go file
 	// when generate client code from openapi3 spec json file, QueryParams is parameters in url as query string.
 	QueryParams *FieldMeta
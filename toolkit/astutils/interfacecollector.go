@@ -56,10 +56,15 @@ func (ic *InterfaceCollector) Collect(n ast.Node) ast.Visitor {
 	return nil
 }
 
+// HttpMethods are http methods recognised as method name prefix and in @route annotation
+var HttpMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
+
+// AnnotationRoute overrides http method and pattern derived from method name, e.g. @route(PATCH, /orders/:id/status)
+const AnnotationRoute = "@route"
+
 // GetShelves_ShelfBooks_Book
 // shelves/:shelf/books/:book
 func Pattern(method string) string {
-	httpMethods := []string{"GET", "POST", "PUT", "DELETE"}
 	re1, err := regexp.Compile("_?[A-Z]")
 	if err != nil {
 		panic(err)
@@ -73,14 +78,51 @@ func Pattern(method string) string {
 	})
 	splits := strings.Split(method, "/")[1:]
 	head := strings.ToUpper(splits[0])
-	if sliceutils.StringContains(httpMethods, head) {
+	if sliceutils.StringContains(HttpMethods, head) {
 		splits = splits[1:]
 	}
 	return strings.Join(splits, "/")
 }
 
+// routeOf returns http method and pattern from @route annotation of method, both are empty if there is no such annotation.
+// Each :variable of the pattern must be one of params.
+func routeOf(method string, annotations []Annotation, params []FieldMeta) (httpMethod, pattern string) {
+	for _, item := range annotations {
+		if item.Name != AnnotationRoute {
+			continue
+		}
+		if len(item.Params) != 2 {
+			panic(fmt.Sprintf("invalid %s annotation on method %s: want %s(METHOD, /pattern)", AnnotationRoute, method, AnnotationRoute))
+		}
+		httpMethod = strings.ToUpper(strings.TrimSpace(item.Params[0]))
+		pattern = strings.TrimSpace(item.Params[1])
+		if !sliceutils.StringContains(HttpMethods, httpMethod) {
+			panic(fmt.Sprintf("invalid %s annotation on method %s: unsupported http method %s", AnnotationRoute, method, httpMethod))
+		}
+		if !strings.HasPrefix(pattern, "/") {
+			panic(fmt.Sprintf("invalid %s annotation on method %s: pattern must start with /", AnnotationRoute, method))
+		}
+		for _, pv := range patternVariables(pattern) {
+			var found bool
+			for _, p := range params {
+				if p.Name == pv {
+					found = true
+					break
+				}
+			}
+			if !found {
+				panic(fmt.Sprintf("invalid %s annotation on method %s: no parameter named %s for path variable :%s", AnnotationRoute, method, pv, pv))
+			}
+		}
+	}
+	return
+}
+
 func pathVariables(method string) (ret []string) {
-	endpoint := Pattern(method)
+	return patternVariables(Pattern(method))
+}
+
+func patternVariables(endpoint string) (ret []string) {
 	splits := strings.Split(endpoint, "/")
 	pvs := sliceutils.StringFilter(splits, func(item string) bool {
 		return stringutils.IsNotEmpty(item) && strings.HasPrefix(item, ":")
@@ -114,7 +156,13 @@ func (ic *InterfaceCollector) field2Methods(list []*ast.Field) []MethodMeta {
 			params = ic.field2Params(ft.Params.List)
 		}
 
-		pvs := pathVariables(mn)
+		httpMethod, pattern := routeOf(mn, annotations, params)
+		var pvs []string
+		if stringutils.IsNotEmpty(pattern) {
+			pvs = patternVariables(pattern)
+		} else {
+			pvs = pathVariables(mn)
+		}
 		for i := range params {
 			if sliceutils.StringContains(pvs, params[i].Name) {
 				params[i].IsPathVariable = true
@@ -132,6 +180,8 @@ func (ic *InterfaceCollector) field2Methods(list []*ast.Field) []MethodMeta {
 			Comments:        mComments,
 			Annotations:     annotations,
 			HasPathVariable: len(pvs) > 0,
+			HttpMethod:      httpMethod,
+			Path:            pattern,
 		})
 	}
 	return methods
@@ -53,6 +53,13 @@ func Test_pattern(t *testing.T) {
 			},
 			want: "page/users",
 		},
+		{
+			name: "3",
+			args: args{
+				method: "PatchOrders_Id",
+			},
+			want: "orders/:id",
+		},
 		{
 			name: "",
 			args: args{
@@ -102,3 +109,45 @@ func Test_pattern(t *testing.T) {
 		})
 	}
 }
+
+func TestInterfaceCollector_route(t *testing.T) {
+	src := `package service
+
+type Order interface {
+	// UpdateStatus updates order status
+	// @route(PATCH, /orders/:id/status)
+	UpdateStatus(ctx context.Context, id int, status string) error
+	HeadOrders_Id(ctx context.Context, id int) error
+}
+`
+	fset := token.NewFileSet()
+	root, err := parser.ParseFile(fset, "svc.go", src, parser.ParseComments)
+	assert.NoError(t, err)
+	ic := NewInterfaceCollector(ExprString)
+	ic.cmap = ast.NewCommentMap(fset, root, root.Comments)
+	ast.Walk(ic, root)
+	methods := ic.Interfaces[0].Methods
+
+	assert.Equal(t, "PATCH", methods[0].HttpMethod)
+	assert.Equal(t, "/orders/:id/status", methods[0].Path)
+	assert.True(t, methods[0].HasPathVariable)
+	assert.True(t, methods[0].Params[1].IsPathVariable)
+	assert.False(t, methods[0].Params[2].IsPathVariable)
+
+	assert.Empty(t, methods[1].HttpMethod)
+	assert.Empty(t, methods[1].Path)
+	assert.True(t, methods[1].Params[1].IsPathVariable)
+
+	assert.Panics(t, func() {
+		routeOf("UpdateStatus", GetAnnotations("// @route(TRACE, /orders)"), nil)
+	})
+	assert.Panics(t, func() {
+		routeOf("UpdateStatus", GetAnnotations("// @route(/orders)"), nil)
+	})
+	assert.Panics(t, func() {
+		routeOf("UpdateStatus", GetAnnotations("// @route(PATCH, /orders/:orderId/status)"), methods[0].Params)
+	})
+	assert.NotPanics(t, func() {
+		routeOf("UpdateStatus", GetAnnotations("// @route(PATCH, /orders/:id/status)"), methods[0].Params)
+	})
+}
@@ -0,0 +1,212 @@
+// Package cmux serves different protocols on one listener by sniffing the first bytes of each connection,
+// in the way of github.com/soheilhy/cmux.
+package cmux
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Matcher reports whether the connection read from r speaks the protocol. Bytes read by matchers are replayed
+// to the server accepting the connection. w writes to the connection, matchers write as little as needed.
+type Matcher func(w io.Writer, r io.Reader) bool
+
+// ErrListenerClosed is returned by Accept of listeners after the listener or the Mux is closed
+var ErrListenerClosed = errors.New("cmux: listener closed")
+
+// Mux dispatches connections accepted from root listener to listeners created by Match
+type Mux struct {
+	root net.Listener
+	// ReadTimeout bounds how long matching a connection can take, zero means no timeout
+	ReadTimeout time.Duration
+	listeners   []*muxListener
+	done        chan struct{}
+	closeOnce   sync.Once
+	wg          sync.WaitGroup
+}
+
+// New creates a Mux on l
+func New(l net.Listener) *Mux {
+	return &Mux{
+		root: l,
+		done: make(chan struct{}),
+	}
+}
+
+// Match returns a listener accepting connections matched by any of matchers. Listeners are tried in the order
+// they were created, so put the most specific ones first and Any last.
+func (m *Mux) Match(matchers ...Matcher) net.Listener {
+	l := &muxListener{
+		Listener: m.root,
+		matchers: matchers,
+		conns:    make(chan net.Conn),
+		done:     make(chan struct{}),
+	}
+	m.listeners = append(m.listeners, l)
+	return l
+}
+
+// Serve accepts connections from root listener until it is closed
+func (m *Mux) Serve() error {
+	defer func() {
+		m.wg.Wait()
+		for _, l := range m.listeners {
+			l.close()
+		}
+	}()
+	for {
+		c, err := m.root.Accept()
+		if err != nil {
+			select {
+			case <-m.done:
+				return nil
+			default:
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return errors.WithStack(err)
+		}
+		m.wg.Add(1)
+		go m.serve(c)
+	}
+}
+
+func (m *Mux) serve(c net.Conn) {
+	defer m.wg.Done()
+	mc := newMuxConn(c)
+	if m.ReadTimeout > 0 {
+		_ = c.SetReadDeadline(time.Now().Add(m.ReadTimeout))
+	}
+	for _, l := range m.listeners {
+		for _, matcher := range l.matchers {
+			mc.sniff()
+			matched := matcher(mc.writer(), mc)
+			mc.replay()
+			if !matched {
+				continue
+			}
+			if m.ReadTimeout > 0 {
+				_ = c.SetReadDeadline(time.Time{})
+			}
+			select {
+			case l.conns <- mc:
+			case <-l.done:
+				_ = c.Close()
+			case <-m.done:
+				_ = c.Close()
+			}
+			return
+		}
+	}
+	_ = c.Close()
+}
+
+// Close closes root listener and all listeners created by Match
+func (m *Mux) Close() error {
+	var err error
+	m.closeOnce.Do(func() {
+		close(m.done)
+		err = m.root.Close()
+	})
+	return err
+}
+
+type muxListener struct {
+	net.Listener
+	matchers  []Matcher
+	conns     chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *muxListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, ErrListenerClosed
+	}
+}
+
+// Close stops accepting connections on l only, the root listener is closed by Mux.Close
+func (l *muxListener) Close() error {
+	l.close()
+	return nil
+}
+
+func (l *muxListener) close() {
+	l.closeOnce.Do(func() {
+		close(l.done)
+	})
+}
+
+// muxConn replays bytes read by matchers before reading from the connection
+type muxConn struct {
+	net.Conn
+	buffer   bytes.Buffer
+	read     int
+	size     int
+	sniffing bool
+	// settingsSent is set if a matcher sent an HTTP/2 SETTINGS frame, whose acknowledgement is swallowed later
+	settingsSent bool
+	filter       io.Reader
+}
+
+func newMuxConn(c net.Conn) *muxConn {
+	return &muxConn{Conn: c}
+}
+
+func (c *muxConn) sniff() {
+	c.sniffing = true
+	c.read = 0
+	c.size = c.buffer.Len()
+}
+
+func (c *muxConn) replay() {
+	c.sniffing = false
+	c.read = 0
+	c.size = c.buffer.Len()
+}
+
+func (c *muxConn) writer() io.Writer {
+	return &settingsWriter{c}
+}
+
+func (c *muxConn) Read(p []byte) (int, error) {
+	if !c.sniffing && c.settingsSent {
+		if c.filter == nil {
+			c.filter = newSettingsAckFilter(readerFunc(c.readBuffered))
+		}
+		return c.filter.Read(p)
+	}
+	return c.readBuffered(p)
+}
+
+func (c *muxConn) readBuffered(p []byte) (int, error) {
+	if c.read < c.size {
+		n := copy(p, c.buffer.Bytes()[c.read:c.size])
+		c.read += n
+		return n, nil
+	}
+	if !c.sniffing && c.buffer.Cap() > 0 {
+		c.buffer = bytes.Buffer{}
+		c.read, c.size = 0, 0
+	}
+	n, err := c.Conn.Read(p)
+	if c.sniffing && n > 0 {
+		c.buffer.Write(p[:n])
+	}
+	return n, err
+}
+
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
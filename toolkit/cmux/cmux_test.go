@@ -0,0 +1,93 @@
+package cmux
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestMux(t *testing.T) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	m := New(lis)
+	m.ReadTimeout = 5 * time.Second
+	grpcL := m.Match(GRPC())
+	httpL := m.Match(Any())
+
+	grpcServer := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(grpcServer, health.NewServer())
+	go grpcServer.Serve(grpcL)
+	httpServer := &http.Server{
+		Handler: h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Proto))
+		}), &http2.Server{}),
+	}
+	go httpServer.Serve(httpL)
+	served := make(chan error, 1)
+	go func() {
+		served <- m.Serve()
+	}()
+	addr := lis.Addr().String()
+
+	resp, err := http.Get("http://" + addr)
+	require.NoError(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Equal(t, "HTTP/1.1", string(body))
+
+	// shorter than the HTTP/2 preface
+	c, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	_, err = c.Write([]byte("GET / HTTP/1.0\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err = http.ReadResponse(bufio.NewReader(c), nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	c.Close()
+
+	h2cClient := &http.Client{
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		},
+	}
+	for i := 0; i < 2; i++ {
+		resp, err = h2cClient.Get("http://" + addr)
+		require.NoError(t, err)
+		body, _ = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.Equal(t, "HTTP/2.0", string(body))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, addr, grpc.WithInsecure(), grpc.WithBlock())
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		result, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		require.NoError(t, err)
+		require.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, result.Status)
+	}
+	conn.Close()
+
+	grpcServer.Stop()
+	require.NoError(t, httpServer.Shutdown(ctx))
+	require.NoError(t, m.Close())
+	require.NoError(t, <-served)
+	_, err = grpcL.Accept()
+	require.Equal(t, ErrListenerClosed, err)
+}
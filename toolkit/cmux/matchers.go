@@ -0,0 +1,163 @@
+package cmux
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// Any matches all connections
+func Any() Matcher {
+	return func(w io.Writer, r io.Reader) bool {
+		return true
+	}
+}
+
+// HTTP2 matches connections starting with the HTTP/2 client preface, which are h2c or gRPC without TLS
+func HTTP2() Matcher {
+	return func(w io.Writer, r io.Reader) bool {
+		return hasHTTP2Preface(r)
+	}
+}
+
+// GRPC matches HTTP/2 connections whose first request has application/grpc content type
+func GRPC() Matcher {
+	return HTTP2HeaderFieldPrefix("content-type", "application/grpc")
+}
+
+// HTTP2HeaderFieldPrefix matches HTTP/2 connections whose first request has header field name with value
+// starting with prefix. As gRPC clients wait for server settings before sending requests, an empty SETTINGS frame
+// is sent when the client settings arrive, its acknowledgement from the client is swallowed after matching.
+func HTTP2HeaderFieldPrefix(name, prefix string) Matcher {
+	return func(w io.Writer, r io.Reader) bool {
+		if !hasHTTP2Preface(r) {
+			return false
+		}
+		var done, matched bool
+		framer := http2.NewFramer(w, r)
+		decoder := hpack.NewDecoder(4096, func(hf hpack.HeaderField) {
+			if hf.Name == name && !done {
+				done = true
+				matched = strings.HasPrefix(hf.Value, prefix)
+			}
+		})
+		for {
+			f, err := framer.ReadFrame()
+			if err != nil {
+				return false
+			}
+			switch f := f.(type) {
+			case *http2.SettingsFrame:
+				if !f.IsAck() {
+					if err = framer.WriteSettings(); err != nil {
+						return false
+					}
+				}
+			case *http2.HeadersFrame:
+				if _, err = decoder.Write(f.HeaderBlockFragment()); err != nil {
+					return false
+				}
+				done = done || f.HeadersEnded()
+			case *http2.ContinuationFrame:
+				if _, err = decoder.Write(f.HeaderBlockFragment()); err != nil {
+					return false
+				}
+				done = done || f.HeadersEnded()
+			case *http2.GoAwayFrame:
+				return false
+			}
+			if done {
+				return matched
+			}
+		}
+	}
+}
+
+// hasHTTP2Preface reads r until it differs from the HTTP/2 client preface, so that short HTTP/1 requests
+// don't block matching
+func hasHTTP2Preface(r io.Reader) bool {
+	preface := []byte(http2.ClientPreface)
+	buf := make([]byte, len(preface))
+	read := 0
+	for read < len(preface) {
+		n, err := r.Read(buf[read:])
+		read += n
+		if !bytes.Equal(buf[:read], preface[:read]) {
+			return false
+		}
+		if err != nil && read < len(preface) {
+			return false
+		}
+	}
+	return true
+}
+
+// settingsWriter writes frames sent by matchers to the connection and marks the connection if any of them is
+// a SETTINGS frame
+type settingsWriter struct {
+	c *muxConn
+}
+
+func (w *settingsWriter) Write(p []byte) (int, error) {
+	if isSettings(p) {
+		w.c.settingsSent = true
+	}
+	return w.c.Conn.Write(p)
+}
+
+func isSettings(frame []byte) bool {
+	return len(frame) >= 9 && http2.FrameType(frame[3]) == http2.FrameSettings && http2.Flags(frame[4])&http2.FlagSettingsAck == 0
+}
+
+// settingsAckFilter passes the client preface and frames through, except the first SETTINGS acknowledgement,
+// which acknowledges the SETTINGS frame sent by the matcher rather than the server behind the Mux
+type settingsAckFilter struct {
+	r           io.Reader
+	prefaceLeft int
+	pending     []byte
+	done        bool
+}
+
+func newSettingsAckFilter(r io.Reader) *settingsAckFilter {
+	return &settingsAckFilter{
+		r:           r,
+		prefaceLeft: len(http2.ClientPreface),
+	}
+}
+
+func (f *settingsAckFilter) Read(p []byte) (int, error) {
+	for len(f.pending) == 0 {
+		if f.done {
+			return f.r.Read(p)
+		}
+		if f.prefaceLeft > 0 {
+			if len(p) > f.prefaceLeft {
+				p = p[:f.prefaceLeft]
+			}
+			n, err := f.r.Read(p)
+			f.prefaceLeft -= n
+			return n, err
+		}
+		header := make([]byte, 9)
+		if _, err := io.ReadFull(f.r, header); err != nil {
+			return 0, err
+		}
+		length := int(header[0])<<16 | int(header[1])<<8 | int(header[2])
+		if http2.FrameType(header[3]) == http2.FrameSettings && http2.Flags(header[4])&http2.FlagSettingsAck != 0 {
+			f.done = true
+			continue
+		}
+		frame := make([]byte, 9+length)
+		copy(frame, header)
+		if _, err := io.ReadFull(f.r, frame[9:]); err != nil {
+			return 0, err
+		}
+		f.pending = frame
+	}
+	n := copy(p, f.pending)
+	f.pending = f.pending[n:]
+	return n, nil
+}
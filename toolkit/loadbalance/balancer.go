@@ -0,0 +1,173 @@
+package loadbalance
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNoInstance is returned by Balancer when there is no instance to pick
+var ErrNoInstance = errors.New("no instance available")
+
+// Instance is an instance of a service
+type Instance struct {
+	// BaseUrl is scheme, address and root path of the instance, such as http://10.0.0.1:6060/api
+	BaseUrl string
+	// Weight of the instance, instances without positive weight count as weight 1
+	Weight int
+	// Metadata registered with the instance, such as zone
+	Metadata map[string]string
+}
+
+// DoneFunc reports the result of a request sent to a picked instance. Zero latency means the latency is
+// unknown, e.g. the instance is only selected but the request is sent elsewhere.
+type DoneFunc func(latency time.Duration, err error)
+
+func noopDone(time.Duration, error) {}
+
+// Balancer picks an instance for every request. Round robin, least request and P2C balancers send requests
+// in proportion to weights of instances, consistent hash ignores them as keys stick to instances anyway.
+type Balancer interface {
+	// Pick selects one of instances for a request. key is the affinity key of the request, such as user id,
+	// it can be empty. done must be called once the request completes.
+	Pick(instances []Instance, key string) (Instance, DoneFunc, error)
+}
+
+type roundRobin struct {
+	current uint64
+
+	mu sync.Mutex
+	fp fingerprint
+	// weights are current weights of smooth weighted round robin by base url
+	weights map[string]int
+}
+
+// NewRoundRobin creates a Balancer picking instances in turn. If instances have different weights, they are
+// picked by smooth weighted round robin, so that an instance of weight 2 is picked twice as often as one of
+// weight 1 and picks of an instance are spread out.
+func NewRoundRobin() Balancer {
+	return &roundRobin{}
+}
+
+func (b *roundRobin) Pick(instances []Instance, _ string) (Instance, DoneFunc, error) {
+	if len(instances) == 0 {
+		return Instance{}, noopDone, ErrNoInstance
+	}
+	if !weighted(instances) {
+		next := atomic.AddUint64(&b.current, 1) % uint64(len(instances))
+		return instances[next], noopDone, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if fp := fingerprintOf(instances); fp != b.fp || b.weights == nil {
+		b.fp, b.weights = fp, make(map[string]int, len(instances))
+	}
+	selected, total := 0, 0
+	for i, item := range instances {
+		weight := weightOf(item)
+		total += weight
+		b.weights[item.BaseUrl] += weight
+		if b.weights[item.BaseUrl] > b.weights[instances[selected].BaseUrl] {
+			selected = i
+		}
+	}
+	b.weights[instances[selected].BaseUrl] -= total
+	return instances[selected], noopDone, nil
+}
+
+// weightOf returns weight of instance, 1 if it isn't positive
+func weightOf(instance Instance) int {
+	if instance.Weight <= 0 {
+		return 1
+	}
+	return instance.Weight
+}
+
+// weighted reports whether instances have different weights
+func weighted(instances []Instance) bool {
+	for _, item := range instances[1:] {
+		if weightOf(item) != weightOf(instances[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+// fingerprint identifies a set of instances with their weights regardless of order. It is cheap enough to be
+// computed on every Pick, so that results derived from instances are cached until they change.
+type fingerprint struct {
+	n        int
+	xor, sum uint64
+}
+
+func fingerprintOf(instances []Instance) fingerprint {
+	fp := fingerprint{n: len(instances)}
+	for _, item := range instances {
+		// fnv-1a of base url and weight
+		h := uint64(14695981039346656037)
+		for i := 0; i < len(item.BaseUrl); i++ {
+			h ^= uint64(item.BaseUrl[i])
+			h *= 1099511628211
+		}
+		h ^= uint64(item.Weight)
+		h *= 1099511628211
+		fp.xor ^= h
+		fp.sum += h
+	}
+	return fp
+}
+
+// signature identifies a set of instances regardless of order, it is the sorted base urls joined by comma
+func signature(instances []Instance) string {
+	urls := make([]string, len(instances))
+	for i, item := range instances {
+		urls[i] = item.BaseUrl
+	}
+	sort.Strings(urls)
+	return strings.Join(urls, ",")
+}
+
+// instanceStats keeps outstanding requests and latency of instances by base url
+type instanceStats struct {
+	mu    sync.Mutex
+	stats map[string]*stat
+}
+
+type stat struct {
+	outstanding int64
+	// ewma is peak exponentially weighted moving average of latency in nanoseconds
+	ewma       float64
+	observedAt time.Time
+}
+
+// get returns stat of baseUrl, callers must hold mu
+func (s *instanceStats) get(baseUrl string) *stat {
+	if s.stats == nil {
+		s.stats = make(map[string]*stat)
+	}
+	st, ok := s.stats[baseUrl]
+	if !ok {
+		st = &stat{}
+		s.stats[baseUrl] = st
+	}
+	return st
+}
+
+// prune drops stats of instances no longer present and without outstanding requests, callers must hold mu
+func (s *instanceStats) prune(instances []Instance) {
+	if len(s.stats) <= 2*len(instances) {
+		return
+	}
+	present := make(map[string]struct{}, len(instances))
+	for _, item := range instances {
+		present[item.BaseUrl] = struct{}{}
+	}
+	for k, st := range s.stats {
+		if _, ok := present[k]; !ok && st.outstanding == 0 {
+			delete(s.stats, k)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package loadbalance
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func instancesOf(n int) []Instance {
+	ret := make([]Instance, n)
+	for i := range ret {
+		ret[i] = Instance{BaseUrl: fmt.Sprintf("http://10.0.0.%d:6060", i)}
+	}
+	return ret
+}
+
+func TestRoundRobin(t *testing.T) {
+	b := NewRoundRobin()
+	instances := instancesOf(3)
+	var picked []string
+	for i := 0; i < 3; i++ {
+		instance, _, err := b.Pick(instances, "")
+		require.NoError(t, err)
+		picked = append(picked, instance.BaseUrl)
+	}
+	require.ElementsMatch(t, []string{instances[0].BaseUrl, instances[1].BaseUrl, instances[2].BaseUrl}, picked)
+	_, _, err := b.Pick(nil, "")
+	require.Equal(t, ErrNoInstance, err)
+}
+
+func TestRoundRobin_weighted(t *testing.T) {
+	b := NewRoundRobin()
+	instances := instancesOf(2)
+	instances[0].Weight = 3
+	picked := make(map[string]int)
+	var last string
+	for i := 0; i < 8; i++ {
+		instance, _, err := b.Pick(instances, "")
+		require.NoError(t, err)
+		picked[instance.BaseUrl]++
+		if instance.BaseUrl == instances[1].BaseUrl {
+			require.NotEqual(t, last, instance.BaseUrl)
+		}
+		last = instance.BaseUrl
+	}
+	require.Equal(t, 6, picked[instances[0].BaseUrl])
+	require.Equal(t, 2, picked[instances[1].BaseUrl])
+}
+
+func TestLeastRequest_weighted(t *testing.T) {
+	b := NewLeastRequest()
+	instances := instancesOf(2)
+	instances[1].Weight = 2
+	picked := make(map[string]int)
+	for i := 0; i < 3; i++ {
+		instance, _, err := b.Pick(instances, "")
+		require.NoError(t, err)
+		picked[instance.BaseUrl]++
+	}
+	require.Equal(t, 1, picked[instances[0].BaseUrl])
+	require.Equal(t, 2, picked[instances[1].BaseUrl])
+}
+
+func TestP2C_weighted(t *testing.T) {
+	now := time.Now()
+	b := NewP2C(time.Second).(*p2c)
+	b.now = func() time.Time { return now }
+	instances := instancesOf(2)
+	instances[1].Weight = 10
+	for i := 0; i < 10; i++ {
+		instance, done, err := b.Pick(instances, "")
+		require.NoError(t, err)
+		require.Equal(t, instances[1].BaseUrl, instance.BaseUrl)
+		done(0, nil)
+	}
+}
+
+func TestFingerprintOf(t *testing.T) {
+	instances := instancesOf(3)
+	reversed := []Instance{instances[2], instances[1], instances[0]}
+	require.Equal(t, fingerprintOf(instances), fingerprintOf(reversed))
+	require.NotEqual(t, fingerprintOf(instances), fingerprintOf(instances[:2]))
+	reversed[0].Weight = 2
+	require.NotEqual(t, fingerprintOf(instances), fingerprintOf(reversed))
+}
+
+func TestLeastRequest(t *testing.T) {
+	b := NewLeastRequest()
+	instances := instancesOf(3)
+	picked := make(map[string]DoneFunc)
+	for i := 0; i < 3; i++ {
+		instance, done, err := b.Pick(instances, "")
+		require.NoError(t, err)
+		picked[instance.BaseUrl] = done
+	}
+	require.Len(t, picked, 3)
+	picked[instances[1].BaseUrl](time.Millisecond, nil)
+	picked[instances[1].BaseUrl](time.Millisecond, nil)
+	instance, _, _ := b.Pick(instances, "")
+	require.Equal(t, instances[1].BaseUrl, instance.BaseUrl)
+}
+
+func TestP2C(t *testing.T) {
+	now := time.Now()
+	b := NewP2C(time.Second).(*p2c)
+	b.now = func() time.Time { return now }
+	instances := instancesOf(2)
+	for i := 0; i < 10; i++ {
+		instance, done, err := b.Pick(instances, "")
+		require.NoError(t, err)
+		if instance.BaseUrl == instances[0].BaseUrl {
+			done(500*time.Millisecond, nil)
+		} else {
+			done(time.Millisecond, nil)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		instance, done, _ := b.Pick(instances, "")
+		require.Equal(t, instances[1].BaseUrl, instance.BaseUrl)
+		done(0, nil)
+	}
+
+	// failures are penalized, and the penalty decays over time
+	instance, done, _ := b.Pick(instances, "")
+	done(time.Millisecond, errors.New("connection refused"))
+	now = now.Add(time.Second)
+	instance, done, _ = b.Pick(instances, "")
+	require.Equal(t, instances[0].BaseUrl, instance.BaseUrl)
+	done(0, nil)
+	now = now.Add(10 * time.Second)
+	require.Less(t, b.cost(instances[1]), float64(time.Millisecond))
+}
+
+func TestConsistentHash(t *testing.T) {
+	b := NewConsistentHash(0, nil)
+	instances := instancesOf(5)
+	owners := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("user%d", i)
+		instance, _, err := b.Pick(instances, key)
+		require.NoError(t, err)
+		again, _, _ := b.Pick([]Instance{instances[4], instances[3], instances[2], instances[1], instances[0]}, key)
+		require.Equal(t, instance.BaseUrl, again.BaseUrl)
+		owners[key] = instance.BaseUrl
+	}
+	require.Len(t, distinct(owners), 5)
+
+	// only keys owned by the removed instance move
+	for key, owner := range owners {
+		instance, _, _ := b.Pick(instances[:4], key)
+		if owner != instances[4].BaseUrl {
+			require.Equal(t, owner, instance.BaseUrl)
+		}
+	}
+
+	instance, _, _ := b.Pick(instances, "")
+	next, _, _ := b.Pick(instances, "")
+	require.NotEqual(t, instance.BaseUrl, next.BaseUrl)
+}
+
+func distinct(m map[string]string) map[string]struct{} {
+	ret := make(map[string]struct{})
+	for _, v := range m {
+		ret[v] = struct{}{}
+	}
+	return ret
+}
+
+func TestZoneAware(t *testing.T) {
+	instances := instancesOf(4)
+	instances[1].Metadata = map[string]string{MetaZone: "az1"}
+	instances[3].Metadata = map[string]string{MetaZone: "az1", "version": "v2"}
+	b := NewZoneAware("az1", nil)
+	for i := 0; i < 4; i++ {
+		instance, _, _ := b.Pick(instances, "")
+		require.Contains(t, []string{instances[1].BaseUrl, instances[3].BaseUrl}, instance.BaseUrl)
+	}
+	instance, _, _ := NewMetadataAware(map[string]string{MetaZone: "az1", "version": "v2"}, nil).Pick(instances, "")
+	require.Equal(t, instances[3].BaseUrl, instance.BaseUrl)
+	_, _, err := NewZoneAware("az2", nil).Pick(instances, "")
+	require.NoError(t, err)
+}
+
+func TestNewSubset(t *testing.T) {
+	instances := instancesOf(10)
+	b := NewSubset(3, 3, NewLeastRequest())
+	picked := make(map[string]struct{})
+	for i := 0; i < 9; i++ {
+		instance, _, err := b.Pick(instances, "")
+		require.NoError(t, err)
+		picked[instance.BaseUrl] = struct{}{}
+	}
+	require.Len(t, picked, 1)
+
+	b = NewSubset(1, 3, NewLeastRequest())
+	picked = make(map[string]struct{})
+	for i := 0; i < 9; i++ {
+		instance, _, _ := b.Pick(instances, "")
+		picked[instance.BaseUrl] = struct{}{}
+	}
+	require.Len(t, picked, 3)
+}
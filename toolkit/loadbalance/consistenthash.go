@@ -0,0 +1,86 @@
+package loadbalance
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// DefaultReplicas is the default number of virtual nodes of an instance on the hash ring of NewConsistentHash
+const DefaultReplicas = 160
+
+type consistentHash struct {
+	replicas int
+	fallback Balancer
+
+	mu     sync.Mutex
+	fp     fingerprint
+	hashes []uint32
+	owners map[uint32]string
+}
+
+// NewConsistentHash creates a Balancer mapping requests with the same key to the same instance, so that
+// instance local caches are hit as much as possible. Only about 1/n of keys move when an instance joins or leaves.
+// replicas is the number of virtual nodes of each instance, DefaultReplicas if not positive.
+// Requests without key are sent by fallback, round robin if nil.
+func NewConsistentHash(replicas int, fallback Balancer) Balancer {
+	if replicas <= 0 {
+		replicas = DefaultReplicas
+	}
+	if fallback == nil {
+		fallback = NewRoundRobin()
+	}
+	return &consistentHash{
+		replicas: replicas,
+		fallback: fallback,
+	}
+}
+
+func (b *consistentHash) Pick(instances []Instance, key string) (Instance, DoneFunc, error) {
+	if len(instances) == 0 || key == "" {
+		return b.fallback.Pick(instances, key)
+	}
+	hashes, owners := b.ring(instances)
+	h := crc32.ChecksumIEEE([]byte(key))
+	idx := sort.Search(len(hashes), func(i int) bool { return hashes[i] >= h })
+	if idx == len(hashes) {
+		idx = 0
+	}
+	owner := owners[hashes[idx]]
+	for _, item := range instances {
+		if item.BaseUrl == owner {
+			return item, noopDone, nil
+		}
+	}
+	return b.fallback.Pick(instances, key)
+}
+
+// ring returns the hash ring of instances, it is rebuilt only when instances change
+func (b *consistentHash) ring(instances []Instance) ([]uint32, map[uint32]string) {
+	fp := fingerprintOf(instances)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if fp == b.fp && b.owners != nil {
+		return b.hashes, b.owners
+	}
+	hashes := make([]uint32, 0, len(instances)*b.replicas)
+	owners := make(map[uint32]string, len(instances)*b.replicas)
+	for _, item := range instances {
+		for i := 0; i < b.replicas; i++ {
+			h := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + item.BaseUrl))
+			if owner, ok := owners[h]; ok {
+				// resolve collisions regardless of the order of instances
+				if item.BaseUrl < owner {
+					owners[h] = item.BaseUrl
+				}
+				continue
+			}
+			owners[h] = item.BaseUrl
+			hashes = append(hashes, h)
+		}
+	}
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i] < hashes[j] })
+	b.fp, b.hashes, b.owners = fp, hashes, owners
+	return hashes, owners
+}
@@ -0,0 +1,55 @@
+package loadbalance
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+type leastRequest struct {
+	instanceStats
+	current uint64
+}
+
+// NewLeastRequest creates a Balancer picking the instance with the least outstanding requests per weight,
+// ties are broken in turn
+func NewLeastRequest() Balancer {
+	return &leastRequest{}
+}
+
+func (b *leastRequest) Pick(instances []Instance, _ string) (Instance, DoneFunc, error) {
+	if len(instances) == 0 {
+		return Instance{}, noopDone, ErrNoInstance
+	}
+	start := int(atomic.AddUint64(&b.current, 1) % uint64(len(instances)))
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.prune(instances)
+	var (
+		selected Instance
+		least    *stat
+		min      = math.MaxFloat64
+	)
+	for i := 0; i < len(instances); i++ {
+		item := instances[(start+i)%len(instances)]
+		st := b.get(item.BaseUrl)
+		// the request being picked counts, so that heavier instances are preferred when all are idle
+		if load := float64(st.outstanding+1) / float64(weightOf(item)); load < min {
+			selected, least, min = item, st, load
+		}
+	}
+	least.outstanding++
+	return selected, b.done(least), nil
+}
+
+func (b *leastRequest) done(st *stat) DoneFunc {
+	var once int32
+	return func(time.Duration, error) {
+		if !atomic.CompareAndSwapInt32(&once, 0, 1) {
+			return
+		}
+		b.mu.Lock()
+		st.outstanding--
+		b.mu.Unlock()
+	}
+}
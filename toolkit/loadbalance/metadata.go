@@ -0,0 +1,55 @@
+package loadbalance
+
+// MetaZone is the metadata key of the zone an instance is deployed in
+const MetaZone = "zone"
+
+type metadataAware struct {
+	selector map[string]string
+	next     Balancer
+}
+
+// NewMetadataAware creates a Balancer preferring instances whose metadata contains all entries of selector,
+// such as the same zone or version as the caller. If no instance matches, next picks from all instances.
+// next is round robin if nil.
+func NewMetadataAware(selector map[string]string, next Balancer) Balancer {
+	if next == nil {
+		next = NewRoundRobin()
+	}
+	if len(selector) == 0 {
+		return next
+	}
+	return &metadataAware{
+		selector: selector,
+		next:     next,
+	}
+}
+
+// NewZoneAware creates a Balancer preferring instances in zone, see NewMetadataAware
+func NewZoneAware(zone string, next Balancer) Balancer {
+	if zone == "" {
+		return NewMetadataAware(nil, next)
+	}
+	return NewMetadataAware(map[string]string{MetaZone: zone}, next)
+}
+
+func (b *metadataAware) Pick(instances []Instance, key string) (Instance, DoneFunc, error) {
+	matched := make([]Instance, 0, len(instances))
+	for _, item := range instances {
+		if b.match(item) {
+			matched = append(matched, item)
+		}
+	}
+	if len(matched) == 0 {
+		return b.next.Pick(instances, key)
+	}
+	return b.next.Pick(matched, key)
+}
+
+func (b *metadataAware) match(instance Instance) bool {
+	for k, v := range b.selector {
+		if instance.Metadata[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+package loadbalance
+
+import (
+	"math"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultDecay is the default time window of latency moving average of NewP2C
+const DefaultDecay = 10 * time.Second
+
+type p2c struct {
+	instanceStats
+	decay time.Duration
+	now   func() time.Time
+}
+
+// NewP2C creates a power of two choices Balancer. It picks two random instances and sends the request
+// to the one with lower cost, which is peak EWMA latency multiplied by outstanding requests plus one, divided by
+// weight of the instance.
+// decay is the time window of the moving average, DefaultDecay if not positive. Failed requests are observed
+// as taking at least decay so that instances failing fast are not preferred.
+func NewP2C(decay time.Duration) Balancer {
+	if decay <= 0 {
+		decay = DefaultDecay
+	}
+	return &p2c{
+		decay: decay,
+		now:   time.Now,
+	}
+}
+
+func (b *p2c) Pick(instances []Instance, _ string) (Instance, DoneFunc, error) {
+	if len(instances) == 0 {
+		return Instance{}, noopDone, ErrNoInstance
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.prune(instances)
+	selected := instances[0]
+	if len(instances) > 1 {
+		i := rand.Intn(len(instances))
+		j := rand.Intn(len(instances) - 1)
+		if j >= i {
+			j++
+		}
+		selected = instances[i]
+		if b.cost(instances[j]) < b.cost(selected) {
+			selected = instances[j]
+		}
+	}
+	st := b.get(selected.BaseUrl)
+	st.outstanding++
+	return selected, b.done(st), nil
+}
+
+// cost of instance, callers must hold mu
+func (b *p2c) cost(instance Instance) float64 {
+	st := b.get(instance.BaseUrl)
+	return (b.decayed(st, b.now()) + 1) * float64(st.outstanding+1) / float64(weightOf(instance))
+}
+
+// decayed returns the moving average decayed to now as if zero latency were observed
+func (b *p2c) decayed(st *stat, now time.Time) float64 {
+	elapsed := now.Sub(st.observedAt)
+	if elapsed <= 0 {
+		return st.ewma
+	}
+	return st.ewma * math.Exp(-float64(elapsed)/float64(b.decay))
+}
+
+func (b *p2c) done(st *stat) DoneFunc {
+	var once int32
+	return func(latency time.Duration, err error) {
+		if !atomic.CompareAndSwapInt32(&once, 0, 1) {
+			return
+		}
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		st.outstanding--
+		if err != nil && latency < b.decay {
+			latency = b.decay
+		}
+		if latency <= 0 {
+			return
+		}
+		now := b.now()
+		rtt := float64(latency)
+		if rtt > st.ewma {
+			st.ewma = rtt
+		} else {
+			w := math.Exp(-float64(now.Sub(st.observedAt)) / float64(b.decay))
+			st.ewma = st.ewma*w + rtt*(1-w)
+		}
+		st.observedAt = now
+	}
+}
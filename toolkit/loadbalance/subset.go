@@ -3,16 +3,77 @@ package loadbalance
 import (
 	"math"
 	"math/rand"
+	"strings"
+	"sync"
 )
 
 func Subset(backends []string, clientId int, subsetSize int) []string {
 	subsetCount := int(math.Ceil(float64(len(backends)) / float64(subsetSize)))
 	round := int64(clientId / subsetCount)
-	rand.Seed(round)
-	rand.Shuffle(len(backends), func(i, j int) {
+	// a private source keeps the shuffle deterministic without reseeding the global one
+	rand.New(rand.NewSource(round)).Shuffle(len(backends), func(i, j int) {
 		backends[i], backends[j] = backends[j], backends[i]
 	})
 	subsetId := clientId % subsetCount
 	start := subsetId * subsetSize
-	return backends[start : start+subsetSize]
+	end := start + subsetSize
+	if end > len(backends) {
+		end = len(backends)
+	}
+	return backends[start:end]
+}
+
+type subset struct {
+	clientId   int
+	subsetSize int
+	next       Balancer
+
+	mu      sync.Mutex
+	fp      fingerprint
+	members map[string]struct{}
+}
+
+// NewSubset creates a Balancer letting next pick only from a deterministic subset of subsetSize instances
+// computed by Subset, so that connections of large fleets are spread evenly without every client connecting
+// to every instance. next is round robin if nil.
+func NewSubset(clientId int, subsetSize int, next Balancer) Balancer {
+	if next == nil {
+		next = NewRoundRobin()
+	}
+	return &subset{
+		clientId:   clientId,
+		subsetSize: subsetSize,
+		next:       next,
+	}
+}
+
+func (b *subset) Pick(instances []Instance, key string) (Instance, DoneFunc, error) {
+	if b.subsetSize <= 0 || len(instances) <= b.subsetSize {
+		return b.next.Pick(instances, key)
+	}
+	members := b.subset(instances)
+	picked := make([]Instance, 0, len(members))
+	for _, item := range instances {
+		if _, ok := members[item.BaseUrl]; ok {
+			picked = append(picked, item)
+		}
+	}
+	return b.next.Pick(picked, key)
+}
+
+// subset returns base urls of the subset, it is computed again only when instances change
+func (b *subset) subset(instances []Instance) map[string]struct{} {
+	fp := fingerprintOf(instances)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if fp == b.fp && b.members != nil {
+		return b.members
+	}
+	backends := strings.Split(signature(instances), ",")
+	members := make(map[string]struct{}, b.subsetSize)
+	for _, item := range Subset(backends, b.clientId, b.subsetSize) {
+		members[item] = struct{}{}
+	}
+	b.fp, b.members = fp, members
+	return members
 }
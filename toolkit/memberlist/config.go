@@ -116,6 +116,14 @@ type Config struct {
 	ProbeInterval time.Duration
 	ProbeTimeout  time.Duration
 
+	// DynamicProbeTimeout derives the timeout to wait for an ack from a
+	// probed node from high percentile of RTTs measured by recent probes,
+	// which detects failures faster on a fast network. ProbeTimeout is used
+	// until enough RTTs are measured, and caps the derived timeout.
+	// ProbeTimeoutMin is the lower bound of the derived timeout.
+	DynamicProbeTimeout bool
+	ProbeTimeoutMin     time.Duration
+
 	// DisableTcpPings will turn off the fallback TCP pings that are attempted
 	// if the direct UDP ping fails. These get pipelined along with the
 	// indirect UDP pings.
@@ -235,6 +243,20 @@ type Config struct {
 	// called PacketBufferSize now that we have generalized the transport.
 	UDPBufferSize int
 
+	// DynamicPacketSize discovers the largest packet which can be delivered
+	// to other nodes, up to UDPBufferSize, by sending padded pings. Packets
+	// are limited to a size safe from fragmentation until larger sizes are
+	// confirmed, so that gossip isn't lost on networks with a small MTU.
+	DynamicPacketSize bool
+
+	// EnableCoordinates maintains vivaldi network coordinates, which are
+	// piggybacked on acks and updated with RTTs of probes, so that RTT to
+	// any node can be estimated by EstimateRTT. It should be enabled on all
+	// nodes in the cluster. CoordinateConfig tunes the algorithm, it is
+	// DefaultCoordinateConfig() if nil.
+	EnableCoordinates bool
+	CoordinateConfig  *CoordinateConfig
+
 	// DeadNodeReclaimTime controls the time before a dead node's name can be
 	// reclaimed by one with a different address or port. By default, this is 0,
 	// meaning nodes cannot be reclaimed this way.
@@ -297,6 +319,7 @@ func DefaultLANConfig() *Config {
 		PushPullInterval:        30 * time.Second,       // Low frequency
 		ProbeTimeout:            500 * time.Millisecond, // Reasonable RTT time for LAN
 		ProbeInterval:           1 * time.Second,        // Failure check every second
+		ProbeTimeoutMin:         50 * time.Millisecond,  // Lower bound of timeout derived from RTTs
 		DisableTcpPings:         false,                  // TCP pings are safe, even with mixed versions
 		AwarenessMaxMultiplier:  8,                      // Probe interval backs off to 8 seconds
 
@@ -329,6 +352,7 @@ func DefaultWANConfig() *Config {
 	conf.PushPullInterval = 60 * time.Second
 	conf.ProbeTimeout = 3 * time.Second
 	conf.ProbeInterval = 5 * time.Second
+	conf.ProbeTimeoutMin = 200 * time.Millisecond
 	conf.GossipNodes = 4 // Gossip less frequently, but to an additional node
 	conf.GossipInterval = 500 * time.Millisecond
 	conf.GossipToTheDeadTime = 60 * time.Second
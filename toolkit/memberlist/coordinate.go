@@ -0,0 +1,319 @@
+package memberlist
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// secondsToNanoseconds converts coordinate distances in seconds to time.Duration
+	secondsToNanoseconds = 1.0e9
+
+	// zeroThreshold is used to treat tiny distances as zero
+	zeroThreshold = 1.0e-6
+
+	// maxCoordinateRTT is the max RTT accepted as a valid sample to update coordinates
+	maxCoordinateRTT = 10 * time.Second
+)
+
+// CoordinateConfig tunes the vivaldi algorithm which computes network coordinates,
+// see https://www.cs.cornell.edu/people/egs/615/vivaldi.pdf for details.
+type CoordinateConfig struct {
+	// Dimensionality is the number of dimensions of the euclidean part of coordinates
+	Dimensionality uint
+
+	// VivaldiErrorMax is the max error of a coordinate, also the initial error of a new coordinate
+	VivaldiErrorMax float64
+
+	// VivaldiCE is a tuning factor controlling how much error of a coordinate changes with each sample
+	VivaldiCE float64
+
+	// VivaldiCC is a tuning factor controlling how much a coordinate moves with each sample
+	VivaldiCC float64
+
+	// AdjustmentWindowSize is the number of samples used to compute the adjustment term, which
+	// compensates the difference between euclidean distances and observed RTTs. Zero disables it.
+	AdjustmentWindowSize uint
+
+	// HeightMin is the min height of a coordinate, height models the access link of a node to the core network
+	HeightMin float64
+
+	// LatencyFilterSize is the number of recent RTT samples per node whose median is used to update coordinates,
+	// so that a single outlier doesn't move coordinates too much
+	LatencyFilterSize uint
+
+	// GravityRho is a tuning factor pulling coordinates back to the origin, so that they don't drift away
+	GravityRho float64
+}
+
+// DefaultCoordinateConfig returns a config which works well for most networks
+func DefaultCoordinateConfig() *CoordinateConfig {
+	return &CoordinateConfig{
+		Dimensionality:       8,
+		VivaldiErrorMax:      1.5,
+		VivaldiCE:            0.25,
+		VivaldiCC:            0.25,
+		AdjustmentWindowSize: 20,
+		HeightMin:            10.0e-6,
+		LatencyFilterSize:    3,
+		GravityRho:           150.0,
+	}
+}
+
+// Coordinate is a network coordinate of a node, distance between coordinates of two nodes estimates RTT between them
+type Coordinate struct {
+	// Vec is the euclidean part of the coordinate in seconds
+	Vec []float64
+	// Error reflects how confident the coordinate is
+	Error float64
+	// Adjustment is added to distances to compensate non-euclidean effects
+	Adjustment float64
+	// Height is the distance from the node to the core network
+	Height float64
+}
+
+// NewCoordinate creates a coordinate at the origin
+func NewCoordinate(config *CoordinateConfig) *Coordinate {
+	return &Coordinate{
+		Vec:    make([]float64, config.Dimensionality),
+		Error:  config.VivaldiErrorMax,
+		Height: config.HeightMin,
+	}
+}
+
+// Clone returns a deep copy of c
+func (c *Coordinate) Clone() *Coordinate {
+	vec := make([]float64, len(c.Vec))
+	copy(vec, c.Vec)
+	return &Coordinate{
+		Vec:        vec,
+		Error:      c.Error,
+		Adjustment: c.Adjustment,
+		Height:     c.Height,
+	}
+}
+
+func componentIsValid(f float64) bool {
+	return !math.IsInf(f, 0) && !math.IsNaN(f)
+}
+
+// IsValid returns false if any component of c is NaN or infinite
+func (c *Coordinate) IsValid() bool {
+	for _, v := range c.Vec {
+		if !componentIsValid(v) {
+			return false
+		}
+	}
+	return componentIsValid(c.Error) && componentIsValid(c.Adjustment) && componentIsValid(c.Height)
+}
+
+// IsCompatibleWith returns true if c and other have the same dimensionality
+func (c *Coordinate) IsCompatibleWith(other *Coordinate) bool {
+	return len(c.Vec) == len(other.Vec)
+}
+
+// DistanceTo returns estimated RTT from c to other
+func (c *Coordinate) DistanceTo(other *Coordinate) time.Duration {
+	dist := c.rawDistanceTo(other)
+	adjustedDist := dist + c.Adjustment + other.Adjustment
+	if adjustedDist > 0.0 {
+		dist = adjustedDist
+	}
+	return time.Duration(dist * secondsToNanoseconds)
+}
+
+// rawDistanceTo returns distance in seconds without adjustment
+func (c *Coordinate) rawDistanceTo(other *Coordinate) float64 {
+	return magnitude(diff(c.Vec, other.Vec)) + c.Height + other.Height
+}
+
+// applyForce returns a new coordinate moved from c by force, positive force moves it away from other
+func (c *Coordinate) applyForce(config *CoordinateConfig, force float64, other *Coordinate) *Coordinate {
+	ret := c.Clone()
+	unit, mag := unitVectorAt(c.Vec, other.Vec)
+	ret.Vec = add(ret.Vec, mul(unit, force))
+	if mag > zeroThreshold {
+		ret.Height = (ret.Height+other.Height)*force/mag + ret.Height
+		ret.Height = math.Max(ret.Height, config.HeightMin)
+	}
+	return ret
+}
+
+func add(vec1 []float64, vec2 []float64) []float64 {
+	ret := make([]float64, len(vec1))
+	for i := range ret {
+		ret[i] = vec1[i] + vec2[i]
+	}
+	return ret
+}
+
+func diff(vec1 []float64, vec2 []float64) []float64 {
+	ret := make([]float64, len(vec1))
+	for i := range ret {
+		ret[i] = vec1[i] - vec2[i]
+	}
+	return ret
+}
+
+func mul(vec []float64, factor float64) []float64 {
+	ret := make([]float64, len(vec))
+	for i := range vec {
+		ret[i] = vec[i] * factor
+	}
+	return ret
+}
+
+func magnitude(vec []float64) float64 {
+	sum := 0.0
+	for i := range vec {
+		sum += vec[i] * vec[i]
+	}
+	return math.Sqrt(sum)
+}
+
+// unitVectorAt returns the unit vector pointing at vec1 from vec2 and the distance between them,
+// a random unit vector is returned if they are at the same position
+func unitVectorAt(vec1, vec2 []float64) ([]float64, float64) {
+	ret := diff(vec1, vec2)
+	if mag := magnitude(ret); mag > zeroThreshold {
+		return mul(ret, 1.0/mag), mag
+	}
+	for i := range ret {
+		ret[i] = rand.Float64() - 0.5
+	}
+	if mag := magnitude(ret); mag > zeroThreshold {
+		return mul(ret, 1.0/mag), 0.0
+	}
+	ret = make([]float64, len(ret))
+	ret[0] = 1.0
+	return ret, 0.0
+}
+
+// coordinateClient maintains the network coordinate of local node from RTT samples to other nodes
+type coordinateClient struct {
+	lock   sync.RWMutex
+	coord  *Coordinate
+	origin *Coordinate
+	config *CoordinateConfig
+	// adjustmentSamples is a ring buffer indexed by adjustmentIndex
+	adjustmentIndex   uint
+	adjustmentSamples []float64
+	// latencyFilterSamples stores recent RTTs in seconds by node name
+	latencyFilterSamples map[string][]float64
+}
+
+func newCoordinateClient(config *CoordinateConfig) (*coordinateClient, error) {
+	if config.Dimensionality == 0 {
+		return nil, fmt.Errorf("dimensionality must be >0")
+	}
+	return &coordinateClient{
+		coord:                NewCoordinate(config),
+		origin:               NewCoordinate(config),
+		config:               config,
+		adjustmentSamples:    make([]float64, config.AdjustmentWindowSize),
+		latencyFilterSamples: make(map[string][]float64),
+	}, nil
+}
+
+// GetCoordinate returns a copy of the coordinate of local node
+func (c *coordinateClient) GetCoordinate() *Coordinate {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.coord.Clone()
+}
+
+// ForgetNode removes RTT samples of node, which has left the cluster
+func (c *coordinateClient) ForgetNode(node string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.latencyFilterSamples, node)
+}
+
+// latencyFilter records rttSeconds and returns the median of recent samples of node
+func (c *coordinateClient) latencyFilter(node string, rttSeconds float64) float64 {
+	samples := append(c.latencyFilterSamples[node], rttSeconds)
+	if len(samples) > int(c.config.LatencyFilterSize) {
+		samples = samples[1:]
+	}
+	c.latencyFilterSamples[node] = samples
+
+	sorted := make([]float64, len(samples))
+	copy(sorted, samples)
+	sort.Float64s(sorted)
+	return sorted[len(sorted)/2]
+}
+
+func (c *coordinateClient) updateVivaldi(other *Coordinate, rttSeconds float64) {
+	dist := c.coord.DistanceTo(other).Seconds()
+	if rttSeconds < zeroThreshold {
+		rttSeconds = zeroThreshold
+	}
+	wrongness := math.Abs(dist-rttSeconds) / rttSeconds
+
+	totalError := c.coord.Error + other.Error
+	if totalError < zeroThreshold {
+		totalError = zeroThreshold
+	}
+	weight := c.coord.Error / totalError
+
+	c.coord.Error = c.config.VivaldiCE*weight*wrongness + c.coord.Error*(1.0-c.config.VivaldiCE*weight)
+	if c.coord.Error > c.config.VivaldiErrorMax {
+		c.coord.Error = c.config.VivaldiErrorMax
+	}
+
+	delta := c.config.VivaldiCC * weight
+	force := delta * (rttSeconds - dist)
+	c.coord = c.coord.applyForce(c.config, force, other)
+}
+
+func (c *coordinateClient) updateAdjustment(other *Coordinate, rttSeconds float64) {
+	if c.config.AdjustmentWindowSize == 0 {
+		return
+	}
+	dist := c.coord.rawDistanceTo(other)
+	c.adjustmentSamples[c.adjustmentIndex] = rttSeconds - dist
+	c.adjustmentIndex = (c.adjustmentIndex + 1) % c.config.AdjustmentWindowSize
+
+	sum := 0.0
+	for _, sample := range c.adjustmentSamples {
+		sum += sample
+	}
+	c.coord.Adjustment = sum / (2.0 * float64(c.config.AdjustmentWindowSize))
+}
+
+func (c *coordinateClient) updateGravity() {
+	dist := c.origin.DistanceTo(c.coord).Seconds()
+	force := -1.0 * math.Pow(dist/c.config.GravityRho, 2.0)
+	c.coord = c.coord.applyForce(c.config, force, c.origin)
+}
+
+// Update moves the coordinate of local node with rtt observed to node whose coordinate is other,
+// and returns the updated coordinate
+func (c *coordinateClient) Update(node string, other *Coordinate, rtt time.Duration) (*Coordinate, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !c.coord.IsCompatibleWith(other) {
+		return nil, fmt.Errorf("dimensions aren't compatible")
+	}
+	if !other.IsValid() {
+		return nil, fmt.Errorf("coordinate of %s is invalid", node)
+	}
+	if rtt < 0 || rtt > maxCoordinateRTT {
+		return nil, fmt.Errorf("round trip time not in valid range, duration %v is not a positive value less than %v", rtt, maxCoordinateRTT)
+	}
+
+	rttSeconds := c.latencyFilter(node, rtt.Seconds())
+	c.updateVivaldi(other, rttSeconds)
+	c.updateAdjustment(other, rttSeconds)
+	c.updateGravity()
+	if !c.coord.IsValid() {
+		c.coord = NewCoordinate(c.config)
+		return nil, fmt.Errorf("coordinate became invalid after update with %s, reset to origin", node)
+	}
+	return c.coord.Clone(), nil
+}
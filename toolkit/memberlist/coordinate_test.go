@@ -0,0 +1,78 @@
+package memberlist
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoordinate_DistanceTo(t *testing.T) {
+	config := DefaultCoordinateConfig()
+	config.Dimensionality = 3
+
+	c1, c2 := NewCoordinate(config), NewCoordinate(config)
+	c1.Vec = []float64{-0.5, 1.3, 2.4}
+	c2.Vec = []float64{1.2, -2.3, 3.4}
+	require.InDelta(t, 4.104875150354758, c1.DistanceTo(c2).Seconds(), 1e-4)
+
+	c1.Height, c2.Height = 0.7, 0.1
+	require.InDelta(t, 4.104875150354758+0.8, c1.DistanceTo(c2).Seconds(), 1e-4)
+
+	// negative adjustment which makes distance non-positive is ignored
+	c1.Adjustment = -10
+	require.InDelta(t, 4.104875150354758+0.8, c1.DistanceTo(c2).Seconds(), 1e-4)
+}
+
+func TestCoordinate_IsValid(t *testing.T) {
+	c := NewCoordinate(DefaultCoordinateConfig())
+	require.True(t, c.IsValid())
+	c.Vec[0] = math.NaN()
+	require.False(t, c.IsValid())
+	c = NewCoordinate(DefaultCoordinateConfig())
+	c.Height = math.Inf(1)
+	require.False(t, c.IsValid())
+}
+
+func TestCoordinateClient_Update(t *testing.T) {
+	config := DefaultCoordinateConfig()
+	config.Dimensionality = 3
+	client, err := newCoordinateClient(config)
+	require.NoError(t, err)
+
+	other := NewCoordinate(config)
+	other.Vec[2] = 0.001
+	rtt := 10 * time.Millisecond
+	for i := 0; i < 100; i++ {
+		_, err = client.Update("node", other, rtt)
+		require.NoError(t, err)
+	}
+	require.InDelta(t, rtt.Seconds(), client.GetCoordinate().DistanceTo(other).Seconds(), 0.001)
+
+	_, err = client.Update("node", NewCoordinate(DefaultCoordinateConfig()), rtt)
+	require.Error(t, err)
+	_, err = client.Update("node", other, -time.Second)
+	require.Error(t, err)
+
+	client.ForgetNode("node")
+	require.Empty(t, client.latencyFilterSamples)
+
+	_, err = newCoordinateClient(&CoordinateConfig{})
+	require.Error(t, err)
+}
+
+func TestCoordinateClient_latencyFilter(t *testing.T) {
+	config := DefaultCoordinateConfig()
+	config.LatencyFilterSize = 3
+	client, err := newCoordinateClient(config)
+	require.NoError(t, err)
+
+	require.Equal(t, 0.201, client.latencyFilter("a", 0.201))
+	require.Equal(t, 0.201, client.latencyFilter("a", 0.200))
+	require.Equal(t, 0.201, client.latencyFilter("a", 0.207))
+	// outlier is filtered out
+	require.Equal(t, 0.207, client.latencyFilter("a", 1.9))
+	require.Equal(t, 0.207, client.latencyFilter("a", 0.203))
+	require.Equal(t, 0.5, client.latencyFilter("b", 0.5))
+}
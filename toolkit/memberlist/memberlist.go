@@ -75,6 +75,12 @@ type Memberlist struct {
 
 	broadcasts *TransmitLimitedQueue
 
+	rtt         *rttTracker
+	coordClient *coordinateClient
+	coordLock   sync.RWMutex
+	coordCache  map[string]*Coordinate // Maps Node.Name -> latest network coordinate
+	packetSize  *packetSizeProber
+
 	logger *log.Logger
 }
 
@@ -153,6 +159,18 @@ func NewMemberlist(conf *Config) (*Memberlist, error) {
 		logger = log.New(logDest, "", log.LstdFlags)
 	}
 
+	var coordClient *coordinateClient
+	if conf.EnableCoordinates {
+		coordConf := conf.CoordinateConfig
+		if coordConf == nil {
+			coordConf = DefaultCoordinateConfig()
+		}
+		var err error
+		if coordClient, err = newCoordinateClient(coordConf); err != nil {
+			return nil, fmt.Errorf("Invalid coordinate config: %v", err)
+		}
+	}
+
 	// Set up a network transport by default if a custom one wasn't given
 	// by the config.
 	transport := conf.Transport
@@ -225,7 +243,13 @@ func NewMemberlist(conf *Config) (*Memberlist, error) {
 		broadcasts: &TransmitLimitedQueue{RetransmitMultGetter: func() int {
 			return conf.RetransmitMult
 		}},
-		logger: logger,
+		rtt:         newRTTTracker(),
+		coordClient: coordClient,
+		coordCache:  make(map[string]*Coordinate),
+		logger:      logger,
+	}
+	if conf.DynamicPacketSize {
+		m.packetSize = newPacketSizeProber(conf.UDPBufferSize)
 	}
 	m.broadcasts.NumNodes = func() int {
 		return m.estNumNodes()
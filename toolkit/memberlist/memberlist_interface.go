@@ -23,4 +23,5 @@ type IMemberlist interface {
 	Shutdown() error
 	Config() *Config
 	AdvertiseAddr() string
+	EstimateRTT(node string) (time.Duration, bool)
 }
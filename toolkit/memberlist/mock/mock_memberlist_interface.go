@@ -64,6 +64,21 @@ func (mr *MockIMemberlistMockRecorder) Config() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Config", reflect.TypeOf((*MockIMemberlist)(nil).Config))
 }
 
+// EstimateRTT mocks base method.
+func (m *MockIMemberlist) EstimateRTT(node string) (time.Duration, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EstimateRTT", node)
+	ret0, _ := ret[0].(time.Duration)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// EstimateRTT indicates an expected call of EstimateRTT.
+func (mr *MockIMemberlistMockRecorder) EstimateRTT(node interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EstimateRTT", reflect.TypeOf((*MockIMemberlist)(nil).EstimateRTT), node)
+}
+
 // GetHealthScore mocks base method.
 func (m *MockIMemberlist) GetHealthScore() int {
 	m.ctrl.T.Helper()
@@ -91,6 +91,9 @@ type ping struct {
 	SourceAddr string `codec:",omitempty"` // Source address, used for a direct reply
 	SourcePort uint16 `codec:",omitempty"` // Source port, used for a direct reply
 	SourceNode string `codec:",omitempty"` // Source name, used for a direct reply
+
+	// Padding is random bytes to probe whether packets of a size can be delivered
+	Padding []byte `codec:",omitempty"`
 }
 
 // indirect ping sent to an indirect node
@@ -300,7 +303,7 @@ func (m *Memberlist) handleConn(conn net.Conn) {
 			return
 		}
 
-		if join {
+		if join && len(remoteNodes) > 0 {
 			remote := remoteNodes[0]
 			if m.config.IPMustBeChecked() {
 				if stringutils.IsNotEmpty(remote.Addr) {
@@ -567,9 +570,7 @@ func (m *Memberlist) handlePing(buf []byte, from net.Addr) {
 
 	var ack ackResp
 	ack.SeqNo = p.SeqNo
-	if m.config.Ping != nil {
-		ack.Payload = m.config.Ping.AckPayload()
-	}
+	ack.Payload = m.ackPayload()
 
 	addr := ""
 	if len(p.SourceAddr) > 0 && p.SourcePort > 0 {
@@ -646,7 +647,7 @@ func (m *Memberlist) handleIndirectPing(buf []byte, from net.Addr) {
 			m.logger.Printf("[ERR] memberlist: Failed to forward ack: %s %s", err, LogStringAddress(indAddr))
 		}
 	}
-	m.setAckHandler(localSeqNo, respHandler, m.config.ProbeTimeout)
+	m.setAckHandler(localSeqNo, respHandler, m.probeTimeout())
 
 	// Send the ping.
 	addr := joinHostPort(ind.Target, ind.Port)
@@ -664,7 +665,7 @@ func (m *Memberlist) handleIndirectPing(buf []byte, from net.Addr) {
 			select {
 			case <-cancelCh:
 				return
-			case <-time.After(m.config.ProbeTimeout):
+			case <-time.After(m.probeTimeout()):
 				nack := nackResp{ind.SeqNo}
 				a := Address{
 					Addr: indAddr,
@@ -805,7 +806,7 @@ func (m *Memberlist) encodeAndSendMsg(a Address, msgType messageType, msg interf
 // opportunistically create a compoundMsg and piggy back other broadcasts.
 func (m *Memberlist) sendMsg(a Address, msg []byte) error {
 	// Check if we can piggy back any messages
-	bytesAvail := m.config.UDPBufferSize - len(msg) - compoundHeaderOverhead
+	bytesAvail := m.PacketSize() - len(msg) - compoundHeaderOverhead
 	if m.config.EncryptionEnabled() && m.config.GossipVerifyOutgoing {
 		bytesAvail -= encryptOverhead(m.encryptionVersion())
 	}
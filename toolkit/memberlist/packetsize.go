@@ -0,0 +1,268 @@
+package memberlist
+
+import (
+	"crypto/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// minPacketSize is the max UDP payload which is safe from fragmentation on any IPv4 path
+	minPacketSize = 508
+	// packetSizeMaxFailures is the number of lost probes after which a packet size is considered too large
+	packetSizeMaxFailures = 3
+	// packetSizeReprobeInterval is how long a confirmed packet size is trusted before it is probed again, so that
+	// paths which changed since are noticed
+	packetSizeReprobeInterval = 5 * time.Minute
+)
+
+// packetSizeSearch binary searches the largest packet size which can be delivered to a node, a packet size is
+// confirmed when a ping padded to that size is acked
+type packetSizeSearch struct {
+	// lo is the largest confirmed size, hi is the largest size not ruled out
+	lo, hi   int
+	failures int
+	// doneAt is when the search finished, zero while searching
+	doneAt time.Time
+	// verifying is set while the confirmed size is probed again after packetSizeReprobeInterval
+	verifying bool
+}
+
+// packetSizeProber keeps a packetSizeSearch per node, packets are limited to the smallest size confirmed among
+// nodes, as any of them may be the target of gossip
+type packetSizeProber struct {
+	lock     sync.Mutex
+	max      int
+	searches map[string]*packetSizeSearch
+	now      func() time.Time
+}
+
+func newPacketSizeProber(max int) *packetSizeProber {
+	return &packetSizeProber{
+		max:      max,
+		searches: make(map[string]*packetSizeSearch),
+		now:      time.Now,
+	}
+}
+
+func (p *packetSizeProber) floor() int {
+	if minPacketSize > p.max {
+		return p.max
+	}
+	return minPacketSize
+}
+
+func (p *packetSizeProber) search(node string) *packetSizeSearch {
+	s, ok := p.searches[node]
+	if !ok {
+		s = &packetSizeSearch{
+			lo: p.floor(),
+			hi: p.max,
+		}
+		p.searches[node] = s
+	}
+	return s
+}
+
+// size returns the smallest packet size confirmed among nodes
+func (p *packetSizeProber) size() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if len(p.searches) == 0 {
+		return p.floor()
+	}
+	size := p.max
+	for _, s := range p.searches {
+		if s.lo < size {
+			size = s.lo
+		}
+	}
+	return size
+}
+
+// retain forgets searches of nodes other than the given ones, and starts searches for the new ones
+func (p *packetSizeProber) retain(nodes []string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	keep := make(map[string]struct{}, len(nodes))
+	for _, node := range nodes {
+		keep[node] = struct{}{}
+		p.search(node)
+	}
+	for node := range p.searches {
+		if _, ok := keep[node]; !ok {
+			delete(p.searches, node)
+		}
+	}
+}
+
+// next returns the packet size to probe for node, false if the search is done and its result is still trusted
+func (p *packetSizeProber) next(node string) (int, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	s := p.search(node)
+	if s.verifying {
+		return s.lo, true
+	}
+	if s.lo < s.hi {
+		return (s.lo + s.hi + 1) / 2, true
+	}
+	if s.doneAt.IsZero() || p.now().Sub(s.doneAt) < packetSizeReprobeInterval {
+		return 0, false
+	}
+	s.verifying = true
+	return s.lo, true
+}
+
+func (p *packetSizeProber) result(node string, size int, acked bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	s, ok := p.searches[node]
+	if !ok {
+		return
+	}
+	defer func() {
+		if s.lo >= s.hi && !s.verifying && s.doneAt.IsZero() {
+			s.doneAt = p.now()
+		}
+	}()
+	if s.verifying && size == s.lo {
+		if acked {
+			// the confirmed size still works, look for a larger one in case the path got better
+			s.verifying = false
+			s.failures = 0
+			s.hi = p.max
+			s.doneAt = time.Time{}
+			return
+		}
+		s.failures++
+		if s.failures >= packetSizeMaxFailures {
+			// the path got worse, fall back to the safe size and search again below the lost one
+			s.verifying = false
+			s.failures = 0
+			s.lo = p.floor()
+			s.hi = size - 1
+			if s.hi < s.lo {
+				s.hi = s.lo
+			}
+			s.doneAt = time.Time{}
+		}
+		return
+	}
+	if acked {
+		if size > s.lo {
+			s.lo = size
+		}
+		s.failures = 0
+		return
+	}
+	s.failures++
+	if s.failures >= packetSizeMaxFailures {
+		if size-1 < s.hi {
+			s.hi = size - 1
+		}
+		s.failures = 0
+	}
+}
+
+// PacketSize returns the max bytes of messages put in a packet, which is UDPBufferSize unless DynamicPacketSize
+// is enabled, then it is the smallest of the largest sizes confirmed by probes to each alive node.
+func (m *Memberlist) PacketSize() int {
+	if m.packetSize == nil {
+		return m.config.UDPBufferSize
+	}
+	return m.packetSize.size()
+}
+
+// paddedPing encodes p padded with random bytes, so that the message is size bytes and not compressible
+func paddedPing(p ping, size int) ([]byte, error) {
+	buf, err := encode(pingMsg, &p)
+	if err != nil {
+		return nil, err
+	}
+	pad := size - buf.Len()
+	// correct for headers of the padding field, which vary with its length
+	for i := 0; i < 3 && pad > 0 && buf.Len() != size; i++ {
+		p.Padding = make([]byte, pad)
+		if _, err = rand.Read(p.Padding); err != nil {
+			return nil, err
+		}
+		if buf, err = encode(pingMsg, &p); err != nil {
+			return nil, err
+		}
+		pad -= buf.Len() - size
+	}
+	return buf.Bytes(), nil
+}
+
+// probePacketSize sends a padded ping to a random alive node whose packet size isn't settled, to check whether
+// packets of the next size to probe for it can be delivered. Failed probes don't affect failure detection.
+func (m *Memberlist) probePacketSize() {
+	m.nodeLock.RLock()
+	alive := make([]string, 0, len(m.nodes))
+	for _, n := range m.nodes {
+		if n.Name != m.config.Name && n.State == StateAlive {
+			alive = append(alive, n.Name)
+		}
+	}
+	m.packetSize.retain(alive)
+	sizes := make(map[string]int)
+	kNodes := kRandomNodes(1, m.nodes, func(n *nodeState) bool {
+		if n.Name == m.config.Name || n.State != StateAlive {
+			return true
+		}
+		if _, ok := sizes[n.Name]; ok {
+			return false
+		}
+		size, ok := m.packetSize.next(n.Name)
+		if ok {
+			sizes[n.Name] = size
+		}
+		return !ok
+	})
+	m.nodeLock.RUnlock()
+	if len(kNodes) == 0 {
+		return
+	}
+	node := kNodes[0]
+	size := sizes[node.Name]
+
+	target := size
+	if m.config.EncryptionEnabled() && m.config.GossipVerifyOutgoing {
+		target -= encryptOverhead(m.encryptionVersion())
+	}
+	selfAddr, selfPort := m.getAdvertise()
+	p := ping{
+		SeqNo:      m.nextSeqNo(),
+		Node:       node.Name,
+		SourceAddr: selfAddr,
+		SourcePort: selfPort,
+		SourceNode: m.config.Name,
+	}
+	msg, err := paddedPing(p, target)
+	if err != nil {
+		m.logger.Printf("[ERR] memberlist: Failed to encode padded ping: %s", err)
+		return
+	}
+
+	timeout := m.probeTimeout()
+	ackCh := make(chan struct{}, 1)
+	m.setAckHandler(p.SeqNo, func([]byte, time.Time) {
+		ackCh <- struct{}{}
+	}, timeout)
+	if err = m.rawSendMsgPacket(node.FullAddress(), &node, msg); err != nil {
+		m.logger.Printf("[DEBUG] memberlist: Failed to send padded ping of %d bytes to %s: %s", size, node.Name, err)
+		m.packetSize.result(node.Name, size, false)
+		return
+	}
+
+	select {
+	case <-ackCh:
+		m.packetSize.result(node.Name, size, true)
+		m.logger.Printf("[DEBUG] memberlist: Packet of %d bytes delivered to %s", size, node.Name)
+	case <-time.After(timeout):
+		m.packetSize.result(node.Name, size, false)
+		m.logger.Printf("[DEBUG] memberlist: Packet of %d bytes not acked by %s", size, node.Name)
+	case <-m.shutdownCh:
+	}
+}
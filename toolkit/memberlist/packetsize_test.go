@@ -0,0 +1,107 @@
+package memberlist
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func probeAll(p *packetSizeProber, node string, limit int) {
+	for i := 0; i < 100; i++ {
+		size, ok := p.next(node)
+		if !ok {
+			return
+		}
+		p.result(node, size, size <= limit)
+	}
+}
+
+func TestPacketSizeProber(t *testing.T) {
+	p := newPacketSizeProber(1400)
+	require.Equal(t, minPacketSize, p.size())
+
+	// packets larger than 1000 bytes are lost on the path to n1, larger than 1200 bytes on the path to n2
+	p.retain([]string{"n1", "n2"})
+	probeAll(p, "n1", 1000)
+	_, ok := p.next("n1")
+	require.False(t, ok)
+	require.Equal(t, minPacketSize, p.size())
+	probeAll(p, "n2", 1200)
+	require.Equal(t, 1000, p.size())
+
+	// a node joining is limited to the safe size until probed
+	p.retain([]string{"n1", "n2", "n3"})
+	require.Equal(t, minPacketSize, p.size())
+	p.retain([]string{"n2"})
+	require.Equal(t, 1200, p.size())
+
+	p = newPacketSizeProber(300)
+	require.Equal(t, 300, p.size())
+	p.retain([]string{"n1"})
+	_, ok = p.next("n1")
+	require.False(t, ok)
+	require.Equal(t, 300, p.size())
+}
+
+func TestPacketSizeProber_reprobe(t *testing.T) {
+	now := time.Now()
+	p := newPacketSizeProber(1400)
+	p.now = func() time.Time { return now }
+	p.retain([]string{"n1"})
+	probeAll(p, "n1", 1000)
+	require.Equal(t, 1000, p.size())
+
+	// the path got better
+	now = now.Add(packetSizeReprobeInterval)
+	size, ok := p.next("n1")
+	require.True(t, ok)
+	require.Equal(t, 1000, size)
+	probeAll(p, "n1", 1400)
+	require.Equal(t, 1400, p.size())
+	_, ok = p.next("n1")
+	require.False(t, ok)
+
+	// the path got worse
+	now = now.Add(packetSizeReprobeInterval)
+	probeAll(p, "n1", 900)
+	require.Equal(t, 900, p.size())
+}
+
+func TestPaddedPing(t *testing.T) {
+	for _, size := range []int{100, 255, 256, 300, 1400, 9000} {
+		msg, err := paddedPing(ping{SeqNo: 1, Node: "node", SourceNode: "source"}, size)
+		require.NoError(t, err)
+		require.Len(t, msg, size)
+		var p ping
+		require.NoError(t, decode(msg[1:], &p))
+		require.Equal(t, "node", p.Node)
+	}
+}
+
+func TestMemberlist_probePacketSize(t *testing.T) {
+	addr1 := getBindAddr()
+	addr2 := getBindAddr()
+
+	m1 := HostMemberlist(addr1.String(), t, func(c *Config) {
+		c.Name = "p1"
+		c.DynamicPacketSize = true
+	})
+	defer m1.Shutdown()
+	m2 := HostMemberlist(addr2.String(), t, func(c *Config) {
+		c.Name = "p2"
+	})
+	defer m2.Shutdown()
+	require.Equal(t, minPacketSize, m1.PacketSize())
+	require.Equal(t, m2.config.UDPBufferSize, m2.PacketSize())
+
+	a1 := alive{Node: m1.config.Name, Addr: addr1.String(), Port: uint16(m1.config.BindPort), Incarnation: 1, Vsn: m1.config.BuildVsnArray()}
+	m1.aliveNode(&a1, nil, true)
+	a2 := alive{Node: m2.config.Name, Addr: addr2.String(), Port: uint16(m2.config.BindPort), Incarnation: 1, Vsn: m2.config.BuildVsnArray()}
+	m1.aliveNode(&a2, nil, false)
+
+	for i := 0; i < 20; i++ {
+		m1.probePacketSize()
+	}
+	require.Equal(t, m1.config.UDPBufferSize, m1.PacketSize())
+}
@@ -0,0 +1,209 @@
+package memberlist
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// rttSampleSize is the number of recent RTTs kept to compute the percentile for probe timeout
+	rttSampleSize = 256
+	// rttMinSamples is the number of RTTs required before probe timeout is derived from them
+	rttMinSamples = 16
+	// rttPercentile is the percentile of RTTs used to derive probe timeout
+	rttPercentile = 0.99
+	// rttTimeoutMult leaves room for jitter above the percentile RTT
+	rttTimeoutMult = 2
+	// rttSmoothing is the weight of a new sample in the smoothed per node RTT
+	rttSmoothing = 0.2
+)
+
+// coordinateAckPrefix marks ack payloads carrying the network coordinate of the acking node
+var coordinateAckPrefix = []byte{0xff, 'v', 'c'}
+
+// coordinateAck wraps network coordinate of the acking node and payload from PingDelegate
+type coordinateAck struct {
+	Coord   *Coordinate
+	Payload []byte `codec:",omitempty"`
+}
+
+// rttTracker keeps RTTs of direct probes
+type rttTracker struct {
+	lock sync.Mutex
+	// samples is a ring buffer indexed by next
+	samples []time.Duration
+	next    int
+	// nodes stores smoothed RTT by node name
+	nodes map[string]time.Duration
+}
+
+func newRTTTracker() *rttTracker {
+	return &rttTracker{
+		samples: make([]time.Duration, 0, rttSampleSize),
+		nodes:   make(map[string]time.Duration),
+	}
+}
+
+func (t *rttTracker) record(node string, rtt time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if len(t.samples) < rttSampleSize {
+		t.samples = append(t.samples, rtt)
+	} else {
+		t.samples[t.next] = rtt
+	}
+	t.next = (t.next + 1) % rttSampleSize
+
+	if old, ok := t.nodes[node]; ok {
+		rtt = time.Duration(rttSmoothing*float64(rtt) + (1-rttSmoothing)*float64(old))
+	}
+	t.nodes[node] = rtt
+}
+
+// percentile returns the p percentile of recent RTTs, false if there are not enough samples
+func (t *rttTracker) percentile(p float64) (time.Duration, bool) {
+	t.lock.Lock()
+	if len(t.samples) < rttMinSamples {
+		t.lock.Unlock()
+		return 0, false
+	}
+	sorted := make([]time.Duration, len(t.samples))
+	copy(sorted, t.samples)
+	t.lock.Unlock()
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	idx := int(p * float64(len(sorted)))
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx], true
+}
+
+func (t *rttTracker) estimate(node string) (time.Duration, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	rtt, ok := t.nodes[node]
+	return rtt, ok
+}
+
+func (t *rttTracker) forget(node string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.nodes, node)
+}
+
+// probeTimeout returns the time to wait for an ack of a direct ping. If DynamicProbeTimeout is enabled, it is
+// derived from high percentile of measured RTTs, bounded by ProbeTimeoutMin and ProbeTimeout.
+func (m *Memberlist) probeTimeout() time.Duration {
+	if !m.config.DynamicProbeTimeout {
+		return m.config.ProbeTimeout
+	}
+	rtt, ok := m.rtt.percentile(rttPercentile)
+	if !ok {
+		return m.config.ProbeTimeout
+	}
+	timeout := rtt * rttTimeoutMult
+	if timeout < m.config.ProbeTimeoutMin {
+		timeout = m.config.ProbeTimeoutMin
+	}
+	if timeout > m.config.ProbeTimeout {
+		timeout = m.config.ProbeTimeout
+	}
+	return timeout
+}
+
+// ackPayload returns payload of acks sent by local node, with network coordinate if enabled
+func (m *Memberlist) ackPayload() []byte {
+	var payload []byte
+	if m.config.Ping != nil {
+		payload = m.config.Ping.AckPayload()
+	}
+	if m.coordClient == nil {
+		return payload
+	}
+	buf, err := encode(messageType(0), &coordinateAck{
+		Coord:   m.coordClient.GetCoordinate(),
+		Payload: payload,
+	})
+	if err != nil {
+		m.logger.Printf("[ERR] memberlist: Failed to encode coordinate: %s", err)
+		return payload
+	}
+	// replace the message type byte written by encode with the prefix
+	return append(append([]byte(nil), coordinateAckPrefix...), buf.Bytes()[1:]...)
+}
+
+// observeAck records rtt of a direct ping to node and updates network coordinates from payload of the ack.
+// It returns the payload from PingDelegate of the remote node.
+func (m *Memberlist) observeAck(node string, rtt time.Duration, payload []byte) []byte {
+	m.rtt.record(node, rtt)
+	if !bytes.HasPrefix(payload, coordinateAckPrefix) {
+		return payload
+	}
+	var ack coordinateAck
+	if err := decode(payload[len(coordinateAckPrefix):], &ack); err != nil {
+		return payload
+	}
+	if m.coordClient != nil && ack.Coord != nil {
+		if _, err := m.coordClient.Update(node, ack.Coord, rtt); err != nil {
+			m.logger.Printf("[DEBUG] memberlist: Rejected coordinate from %s: %s", node, err)
+		} else {
+			m.coordLock.Lock()
+			m.coordCache[node] = ack.Coord
+			m.coordLock.Unlock()
+		}
+	}
+	return ack.Payload
+}
+
+// forgetNode drops RTTs and coordinate of node which is reaped
+func (m *Memberlist) forgetNode(node string) {
+	m.rtt.forget(node)
+	if m.coordClient != nil {
+		m.coordClient.ForgetNode(node)
+		m.coordLock.Lock()
+		delete(m.coordCache, node)
+		m.coordLock.Unlock()
+	}
+}
+
+// GetCoordinate returns network coordinate of local node, nil if EnableCoordinates is false
+func (m *Memberlist) GetCoordinate() *Coordinate {
+	if m.coordClient == nil {
+		return nil
+	}
+	return m.coordClient.GetCoordinate()
+}
+
+// GetNodeCoordinate returns the latest network coordinate received from node
+func (m *Memberlist) GetNodeCoordinate(node string) (*Coordinate, bool) {
+	m.coordLock.RLock()
+	defer m.coordLock.RUnlock()
+	coord, ok := m.coordCache[node]
+	if !ok {
+		return nil, false
+	}
+	return coord.Clone(), true
+}
+
+// EstimateRTT estimates round-trip time from local node to node. It uses network coordinates if enabled,
+// which works for nodes not probed yet by local node, otherwise smoothed RTT measured by direct probes.
+// It returns false if nothing is known about node yet.
+func (m *Memberlist) EstimateRTT(node string) (time.Duration, bool) {
+	if node == m.config.Name {
+		return 0, true
+	}
+	if m.coordClient != nil {
+		if other, ok := m.GetNodeCoordinate(node); ok {
+			local := m.coordClient.GetCoordinate()
+			if local.IsCompatibleWith(other) {
+				return local.DistanceTo(other), true
+			}
+		}
+	}
+	return m.rtt.estimate(node)
+}
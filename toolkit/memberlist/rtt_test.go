@@ -0,0 +1,165 @@
+package memberlist
+
+import (
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRTTTracker(t *testing.T) {
+	tracker := newRTTTracker()
+	_, ok := tracker.percentile(rttPercentile)
+	require.False(t, ok)
+
+	for i := 1; i <= 100; i++ {
+		tracker.record("a", time.Duration(i)*time.Millisecond)
+	}
+	rtt, ok := tracker.percentile(rttPercentile)
+	require.True(t, ok)
+	require.Equal(t, 100*time.Millisecond, rtt)
+	rtt, _ = tracker.percentile(0.5)
+	require.Equal(t, 51*time.Millisecond, rtt)
+
+	// old samples are dropped from the ring buffer
+	for i := 0; i < rttSampleSize; i++ {
+		tracker.record("b", time.Millisecond)
+	}
+	rtt, _ = tracker.percentile(rttPercentile)
+	require.Equal(t, time.Millisecond, rtt)
+
+	smoothed, ok := tracker.estimate("a")
+	require.True(t, ok)
+	require.True(t, smoothed > 80*time.Millisecond && smoothed < 100*time.Millisecond)
+	tracker.forget("a")
+	_, ok = tracker.estimate("a")
+	require.False(t, ok)
+}
+
+func TestMemberlist_probeTimeout(t *testing.T) {
+	m := &Memberlist{
+		config: &Config{
+			ProbeTimeout:        time.Second,
+			ProbeTimeoutMin:     50 * time.Millisecond,
+			DynamicProbeTimeout: true,
+		},
+		rtt: newRTTTracker(),
+	}
+	require.Equal(t, time.Second, m.probeTimeout())
+
+	for i := 0; i < rttMinSamples; i++ {
+		m.rtt.record("a", 100*time.Millisecond)
+	}
+	require.Equal(t, 200*time.Millisecond, m.probeTimeout())
+
+	for i := 0; i < rttSampleSize; i++ {
+		m.rtt.record("a", time.Millisecond)
+	}
+	require.Equal(t, 50*time.Millisecond, m.probeTimeout())
+
+	for i := 0; i < rttSampleSize; i++ {
+		m.rtt.record("a", 2*time.Second)
+	}
+	require.Equal(t, time.Second, m.probeTimeout())
+
+	m.config.DynamicProbeTimeout = false
+	require.Equal(t, time.Second, m.probeTimeout())
+}
+
+type testPingDelegate struct {
+	payload []byte
+	got     chan []byte
+}
+
+func (d *testPingDelegate) AckPayload() []byte {
+	return d.payload
+}
+
+func (d *testPingDelegate) NotifyPingComplete(other *Node, rtt time.Duration, payload []byte) {
+	d.got <- payload
+}
+
+func TestMemberlist_observeAck(t *testing.T) {
+	newMemberlist := func(enable bool, ping PingDelegate) *Memberlist {
+		m := &Memberlist{
+			config: &Config{
+				Name:              "a",
+				EnableCoordinates: enable,
+				Ping:              ping,
+			},
+			rtt:        newRTTTracker(),
+			coordCache: make(map[string]*Coordinate),
+			logger:     log.New(os.Stderr, "", log.LstdFlags),
+		}
+		if enable {
+			m.coordClient, _ = newCoordinateClient(DefaultCoordinateConfig())
+		}
+		return m
+	}
+
+	remote := newMemberlist(true, &testPingDelegate{payload: []byte("hello")})
+	local := newMemberlist(true, nil)
+	require.Equal(t, []byte("hello"), local.observeAck("b", 5*time.Millisecond, remote.ackPayload()))
+	_, ok := local.GetNodeCoordinate("b")
+	require.True(t, ok)
+	rtt, ok := local.EstimateRTT("b")
+	require.True(t, ok)
+	require.True(t, rtt > 0)
+	rtt, ok = local.EstimateRTT("a")
+	require.True(t, ok)
+	require.Equal(t, time.Duration(0), rtt)
+
+	local.forgetNode("b")
+	_, ok = local.GetNodeCoordinate("b")
+	require.False(t, ok)
+	_, ok = local.EstimateRTT("b")
+	require.False(t, ok)
+
+	// payload of nodes without coordinates is passed through
+	disabled := newMemberlist(false, nil)
+	require.Equal(t, []byte("hello"), disabled.observeAck("b", 5*time.Millisecond, []byte("hello")))
+	require.Nil(t, disabled.GetCoordinate())
+	rtt, ok = disabled.EstimateRTT("b")
+	require.True(t, ok)
+	require.Equal(t, 5*time.Millisecond, rtt)
+}
+
+func TestMemberList_ProbeNode_Coordinates(t *testing.T) {
+	addr1 := getBindAddr()
+	addr2 := getBindAddr()
+	ping := &testPingDelegate{payload: []byte("hello"), got: make(chan []byte, 1)}
+
+	m1 := HostMemberlist(addr1.String(), t, func(c *Config) {
+		c.Name = "c1"
+		c.EnableCoordinates = true
+		c.DynamicProbeTimeout = true
+		c.Ping = ping
+	})
+	defer m1.Shutdown()
+	m2 := HostMemberlist(addr2.String(), t, func(c *Config) {
+		c.Name = "c2"
+		c.EnableCoordinates = true
+		c.Ping = ping
+	})
+	defer m2.Shutdown()
+
+	a1 := alive{Node: m1.config.Name, Addr: addr1.String(), Port: uint16(m1.config.BindPort), Incarnation: 1, Vsn: m1.config.BuildVsnArray()}
+	m1.aliveNode(&a1, nil, true)
+	a2 := alive{Node: m2.config.Name, Addr: addr2.String(), Port: uint16(m2.config.BindPort), Incarnation: 1, Vsn: m2.config.BuildVsnArray()}
+	m1.aliveNode(&a2, nil, false)
+
+	m1.probeNode(m1.nodeMap[m2.config.Name])
+	require.Equal(t, StateAlive, m1.nodeMap[m2.config.Name].State)
+	select {
+	case payload := <-ping.got:
+		require.Equal(t, []byte("hello"), payload)
+	case <-time.After(time.Second):
+		t.Fatal("ping delegate not notified")
+	}
+	_, ok := m1.GetNodeCoordinate(m2.config.Name)
+	require.True(t, ok)
+	_, ok = m1.EstimateRTT(m2.config.Name)
+	require.True(t, ok)
+}
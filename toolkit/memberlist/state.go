@@ -146,6 +146,13 @@ func (m *Memberlist) schedule() {
 		m.tickers = append(m.tickers, t)
 	}
 
+	// Create packet size probe ticker if needed
+	if m.packetSize != nil && m.config.ProbeInterval > 0 {
+		t := time.NewTicker(m.config.ProbeInterval)
+		go m.triggerFunc(m.config.ProbeInterval, t.C, stopCh, m.probePacketSize)
+		m.tickers = append(m.tickers, t)
+	}
+
 	// Create node weight ticker if needed
 	if m.config.WeightInterval > 0 {
 		t := time.NewTicker(m.config.WeightInterval)
@@ -421,8 +428,9 @@ func (m *Memberlist) probeNode(node *nodeState) {
 		if v.Complete == true {
 			rtt := v.Timestamp.Sub(sent)
 			m.logger.Printf("[DEBUG] memberlist: ping remote node %s success in %s", node.Node.Name, rtt.String())
+			payload := m.observeAck(node.Name, rtt, v.Payload)
 			if m.config.Ping != nil {
-				m.config.Ping.NotifyPingComplete(&node.Node, rtt, v.Payload)
+				m.config.Ping.NotifyPingComplete(&node.Node, rtt, payload)
 			}
 			return
 		}
@@ -432,7 +440,7 @@ func (m *Memberlist) probeNode(node *nodeState) {
 		if v.Complete == false {
 			ackCh <- v
 		}
-	case <-time.After(m.config.ProbeTimeout):
+	case <-time.After(m.probeTimeout()):
 		// Note that we don't scale this timeout based on awareness and
 		// the health score. That's because we don't really expect waiting
 		// longer to help get UDP through. Since health does extend the
@@ -576,9 +584,11 @@ func (m *Memberlist) Ping(node string, addr net.Addr) (time.Duration, error) {
 	select {
 	case v := <-ackCh:
 		if v.Complete == true {
-			return v.Timestamp.Sub(sent), nil
+			rtt := v.Timestamp.Sub(sent)
+			m.observeAck(node, rtt, v.Payload)
+			return rtt, nil
 		}
-	case <-time.After(m.config.ProbeTimeout):
+	case <-time.After(m.probeTimeout()):
 		// Timeout, return an error below.
 	}
 
@@ -598,6 +608,7 @@ func (m *Memberlist) resetNodes() {
 	// Deregister the dead nodes
 	for i := deadIdx; i < len(m.nodes); i++ {
 		delete(m.nodeMap, m.nodes[i].Name)
+		m.forgetNode(m.nodes[i].Name)
 		m.nodes[i] = nil
 	}
 
@@ -637,7 +648,7 @@ func (m *Memberlist) gossip() {
 	m.nodeLock.RUnlock()
 
 	// Compute the bytes available
-	bytesAvail := m.config.UDPBufferSize - compoundHeaderOverhead
+	bytesAvail := m.PacketSize() - compoundHeaderOverhead
 	if m.config.EncryptionEnabled() {
 		bytesAvail -= encryptOverhead(m.encryptionVersion())
 	}
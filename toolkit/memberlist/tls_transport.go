@@ -0,0 +1,105 @@
+package memberlist
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"time"
+)
+
+// TLSTransport is a NetTransport whose stream connections are wrapped with TLS. Streams carry push/pull state
+// syncs, TCP fallback pings and reliable user messages. Packets are not affected, set SecretKey or Keyring to
+// encrypt them as well. tlsConfig is used both as server and client, so it should contain the certificate of
+// local node, and CAs to verify other nodes in both RootCAs and ClientCAs for mutual TLS. Certificates of nodes
+// are verified against the dialed address, unless ServerName is set to a name shared by all nodes.
+type TLSTransport struct {
+	*NetTransport
+	tlsConfig  *tls.Config
+	streamCh   chan net.Conn
+	shutdownCh chan struct{}
+}
+
+var _ NodeAwareTransport = (*TLSTransport)(nil)
+
+// NewTLSTransport returns a TLS transport with the given configuration. On success all the network listeners
+// will be created and listening.
+func NewTLSTransport(config *NetTransportConfig, tlsConfig *tls.Config) (*TLSTransport, error) {
+	if tlsConfig == nil {
+		return nil, fmt.Errorf("TLS config is required")
+	}
+	nt, err := NewNetTransport(config)
+	if err != nil {
+		return nil, err
+	}
+	t := &TLSTransport{
+		NetTransport: nt,
+		tlsConfig:    tlsConfig,
+		streamCh:     make(chan net.Conn),
+		shutdownCh:   make(chan struct{}),
+	}
+	go t.wrapStreams()
+	return t, nil
+}
+
+// wrapStreams wraps accepted connections with TLS server side, the handshake is done on first read or write
+func (t *TLSTransport) wrapStreams() {
+	for {
+		select {
+		case conn := <-t.NetTransport.StreamCh():
+			select {
+			case t.streamCh <- tls.Server(conn, t.tlsConfig):
+			case <-t.shutdownCh:
+				conn.Close()
+				return
+			}
+		case <-t.shutdownCh:
+			return
+		}
+	}
+}
+
+// See Transport.
+func (t *TLSTransport) DialTimeout(addr string, timeout time.Duration) (net.Conn, error) {
+	a := Address{Addr: addr, Name: ""}
+	return t.DialAddressTimeout(a, timeout)
+}
+
+// See NodeAwareTransport.
+func (t *TLSTransport) DialAddressTimeout(a Address, timeout time.Duration) (net.Conn, error) {
+	conn, err := t.NetTransport.DialAddressTimeout(a, timeout)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := t.tlsConfig
+	if tlsConfig.ServerName == "" {
+		// verify the certificate of the node against the address dialed, like tls.Dial
+		host, _, err := net.SplitHostPort(a.Addr)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName = host
+	}
+	tlsConn := tls.Client(conn, tlsConfig)
+	if timeout > 0 {
+		_ = tlsConn.SetDeadline(time.Now().Add(timeout))
+	}
+	if err = tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake with %s failed: %v", a.Addr, err)
+	}
+	_ = tlsConn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
+
+// See Transport.
+func (t *TLSTransport) StreamCh() <-chan net.Conn {
+	return t.streamCh
+}
+
+// See Transport.
+func (t *TLSTransport) Shutdown() error {
+	close(t.shutdownCh)
+	return t.NetTransport.Shutdown()
+}
@@ -0,0 +1,100 @@
+package memberlist
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTLSConfig(t *testing.T) *tls.Config {
+	newCert := func(cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		tpl := &x509.Certificate{
+			SerialNumber: big.NewInt(time.Now().UnixNano()),
+			Subject:      pkix.Name{CommonName: cn},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		}
+		if parent == nil {
+			tpl.IsCA = true
+			tpl.BasicConstraintsValid = true
+			parent, parentKey = tpl, key
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tpl, parent, &key.PublicKey, parentKey)
+		require.NoError(t, err)
+		cert, err := x509.ParseCertificate(der)
+		require.NoError(t, err)
+		return cert, key, der
+	}
+	ca, caKey, _ := newCert("ca", nil, nil)
+	_, key, der := newCert("node", ca, caKey)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+}
+
+func TestTLSTransport_Join(t *testing.T) {
+	tlsConfig := newTestTLSConfig(t)
+	newTLSMemberlist := func(name string, tlsConfig *tls.Config) *Memberlist {
+		addr := getBindAddr().String()
+		c := DefaultLANConfig()
+		c.Name = name
+		c.BindAddr = addr
+		c.BindPort = 0
+		c.Logger = log.New(os.Stderr, name, log.LstdFlags)
+		if tlsConfig != nil {
+			transport, err := NewTLSTransport(&NetTransportConfig{
+				BindAddrs: []string{addr},
+				Logger:    c.Logger,
+			}, tlsConfig)
+			require.NoError(t, err)
+			c.Transport = transport
+			c.BindPort = transport.GetAutoBindPort()
+			c.AdvertisePort = c.BindPort
+		}
+		m, err := Create(c)
+		require.NoError(t, err)
+		return m
+	}
+
+	m1 := newTLSMemberlist("tls1", tlsConfig)
+	defer m1.Shutdown()
+	m2 := newTLSMemberlist("tls2", tlsConfig)
+	defer m2.Shutdown()
+
+	joinUrl := fmt.Sprintf("%s/%s:%d", m1.config.Name, m1.AdvertiseAddr(), m1.AdvertisePort())
+	num, err := m2.Join([]string{joinUrl})
+	require.NoError(t, err)
+	require.Equal(t, 1, num)
+	require.Len(t, m2.Members(), 2)
+
+	// nodes without the certificate can't sync state
+	m3 := newTLSMemberlist("plain", nil)
+	defer m3.Shutdown()
+	_, err = m3.Join([]string{joinUrl})
+	require.Error(t, err)
+
+	_, err = NewTLSTransport(&NetTransportConfig{BindAddrs: []string{"127.0.0.1"}}, nil)
+	require.Error(t, err)
+}
@@ -193,6 +193,11 @@ func IsVarargs(t string) bool {
 	return strings.HasPrefix(t, "...")
 }
 
+// IsStream reports whether t is the Stream type of this package
+func IsStream(t string) bool {
+	return t == "*v3.Stream"
+}
+
 func ToSlice(t string) string {
 	return "[]" + strings.TrimPrefix(t, "...")
 }
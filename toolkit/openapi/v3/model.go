@@ -79,12 +79,16 @@ type MediaType struct {
 // and the value describes it. For requests that match multiple keys, only the most specific key is applicable.
 // e.g. text/plain overrides text/*
 type Content struct {
-	TextPlain *MediaType `json:"text/plain,omitempty"`
-	JSON      *MediaType `json:"application/json,omitempty"`
-	FormURL   *MediaType `json:"application/x-www-form-urlencoded,omitempty"`
-	Stream    *MediaType `json:"application/octet-stream,omitempty"`
-	FormData  *MediaType `json:"multipart/form-data,omitempty"`
-	Default   *MediaType `json:"*/*,omitempty"`
+	TextPlain   *MediaType `json:"text/plain,omitempty"`
+	JSON        *MediaType `json:"application/json,omitempty"`
+	FormURL     *MediaType `json:"application/x-www-form-urlencoded,omitempty"`
+	Stream      *MediaType `json:"application/octet-stream,omitempty"`
+	FormData    *MediaType `json:"multipart/form-data,omitempty"`
+	NDJSON      *MediaType `json:"application/x-ndjson,omitempty"`
+	EventStream *MediaType `json:"text/event-stream,omitempty"`
+	MsgPack     *MediaType `json:"application/msgpack,omitempty"`
+	Protobuf    *MediaType `json:"application/x-protobuf,omitempty"`
+	Default     *MediaType `json:"*/*,omitempty"`
 }
 
 // Parameter https://spec.openapis.org/oas/v3.0.3#parameter-object
@@ -175,10 +179,13 @@ type Operation struct {
 
 // Path https://spec.openapis.org/oas/v3.0.3#path-item-object
 type Path struct {
-	Get    *Operation `json:"get,omitempty"`
-	Post   *Operation `json:"post,omitempty"`
-	Put    *Operation `json:"put,omitempty"`
-	Delete *Operation `json:"delete,omitempty"`
+	Get     *Operation `json:"get,omitempty"`
+	Post    *Operation `json:"post,omitempty"`
+	Put     *Operation `json:"put,omitempty"`
+	Delete  *Operation `json:"delete,omitempty"`
+	Patch   *Operation `json:"patch,omitempty"`
+	Head    *Operation `json:"head,omitempty"`
+	Options *Operation `json:"options,omitempty"`
 	// TODO
 	Parameters []Parameter `json:"parameters,omitempty"`
 }
@@ -0,0 +1,283 @@
+package v3
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+const (
+	// NDJSONMediaType is the media type of newline delimited json streams
+	NDJSONMediaType = "application/x-ndjson"
+	// EventStreamMediaType is the media type of server-sent events
+	EventStreamMediaType = "text/event-stream"
+	// StreamErrorTrailer is the http trailer carrying the error stopped a NDJSON stream
+	StreamErrorTrailer = "X-Stream-Error"
+)
+
+// ErrStreamClosed is returned by Send after the consumer closed the stream
+var ErrStreamClosed = errors.New("stream closed")
+
+// Event is a server-sent event. Items of a stream are sent as data of unnamed events
+// unless they are Event or *Event.
+type Event struct {
+	ID    string      `json:"id,omitempty"`
+	Event string      `json:"event,omitempty"`
+	Data  interface{} `json:"data,omitempty"`
+}
+
+// Stream is a sequence of items transferred chunk by chunk, such as large exports, NDJSON feeds or progress events.
+// Service methods return *v3.Stream to stream response body and take a *v3.Stream parameter to stream request body.
+// Generated http handlers write items as NDJSON, or as server-sent events if the client accepts text/event-stream,
+// and generated clients read them by Next.
+//
+// A producer creates a Stream by NewStream, sends items by Send in another goroutine and calls Finish at the end.
+// A consumer calls Next until io.EOF and calls Close if it stops early.
+type Stream struct {
+	items     chan interface{}
+	done      chan struct{}
+	closeOnce sync.Once
+	finish    sync.Once
+	err       error
+
+	contentType string
+	body        io.ReadCloser
+	decode      func(v interface{}) error
+}
+
+// NewStream creates a Stream of items, buffer is the number of items sent ahead of the consumer
+func NewStream(buffer int) *Stream {
+	return &Stream{
+		items: make(chan interface{}, buffer),
+		done:  make(chan struct{}),
+	}
+}
+
+// NewReaderStream creates a Stream reading body of contentType. NDJSON and server-sent events are decoded by Next,
+// other bodies such as csv exports are copied as is and read by Reader.
+func NewReaderStream(contentType string, body io.ReadCloser) *Stream {
+	s := &Stream{
+		done:        make(chan struct{}),
+		contentType: contentType,
+		body:        body,
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case NDJSONMediaType, "application/json", "":
+		dec := json.NewDecoder(body)
+		s.decode = dec.Decode
+	case EventStreamMediaType:
+		s.decode = eventDecoder(bufio.NewReader(body))
+	default:
+		s.decode = func(interface{}) error {
+			return errors.Errorf("v3: cannot decode items of %s stream, read it by Reader", contentType)
+		}
+	}
+	return s
+}
+
+// NewResponseStream creates a Stream reading body of resp, the error sent by StreamErrorTrailer is returned by Next
+func NewResponseStream(resp *http.Response) *Stream {
+	s := NewReaderStream(resp.Header.Get("Content-Type"), resp.Body)
+	decode := s.decode
+	s.decode = func(v interface{}) error {
+		err := decode(v)
+		if err == io.EOF {
+			if msg := resp.Trailer.Get(StreamErrorTrailer); msg != "" {
+				return errors.New(msg)
+			}
+		}
+		return err
+	}
+	return s
+}
+
+// ContentType returns media type of the stream, NDJSONMediaType for streams created by NewStream
+func (s *Stream) ContentType() string {
+	if s.contentType == "" {
+		return NDJSONMediaType
+	}
+	return s.contentType
+}
+
+// IsRaw reports whether the stream is created from a reader
+func (s *Stream) IsRaw() bool {
+	return s.body != nil
+}
+
+// Send sends item to the consumer. It blocks until the item is buffered or taken, and returns ErrStreamClosed
+// if the consumer has closed the stream, e.g. the http client went away. Send must not be called after Finish.
+func (s *Stream) Send(ctx context.Context, item interface{}) error {
+	select {
+	case <-s.done:
+		return ErrStreamClosed
+	default:
+	}
+	select {
+	case s.items <- item:
+		return nil
+	case <-s.done:
+		return ErrStreamClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Finish ends the stream, err is returned to the consumer after all sent items if not nil
+func (s *Stream) Finish(err error) {
+	s.finish.Do(func() {
+		s.err = err
+		close(s.items)
+	})
+}
+
+// Done is closed when the consumer closed the stream, producers can stop producing items then
+func (s *Stream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Next reads the next item into v, which must be a non-nil pointer. It returns io.EOF at the end of stream,
+// or the error the producer finished the stream with.
+func (s *Stream) Next(v interface{}) error {
+	if s.items == nil {
+		return s.decode(v)
+	}
+	select {
+	case item, ok := <-s.items:
+		if !ok {
+			if s.err != nil {
+				return s.err
+			}
+			return io.EOF
+		}
+		return assign(v, item)
+	case <-s.done:
+		return ErrStreamClosed
+	}
+}
+
+// Close stops consuming the stream and releases the underlying body
+func (s *Stream) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+		if s.body != nil {
+			err = s.body.Close()
+		}
+	})
+	return err
+}
+
+// Reader returns the stream as a reader, items are encoded as NDJSON for streams created by NewStream.
+// It is used by generated clients to send the stream as request body.
+func (s *Stream) Reader() io.Reader {
+	if s.body != nil {
+		return s.body
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		enc := json.NewEncoder(pw)
+		for {
+			var item interface{}
+			err := s.Next(&item)
+			if err == io.EOF {
+				pw.Close()
+				return
+			}
+			if err == nil {
+				err = enc.Encode(item)
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				s.Close()
+				return
+			}
+		}
+	}()
+	return pr
+}
+
+func assign(v interface{}, item interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("v3: Next requires a non-nil pointer")
+	}
+	if item == nil {
+		rv.Elem().Set(reflect.Zero(rv.Elem().Type()))
+		return nil
+	}
+	if iv := reflect.ValueOf(item); iv.Type().AssignableTo(rv.Elem().Type()) {
+		rv.Elem().Set(iv)
+		return nil
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(json.Unmarshal(data, v))
+}
+
+// eventDecoder decodes server-sent events from r, data of events is decoded into v unless v is *Event.
+// An event named error stops the stream with its data as error message.
+func eventDecoder(r *bufio.Reader) func(v interface{}) error {
+	return func(v interface{}) error {
+		var (
+			event Event
+			data  bytes.Buffer
+			seen  bool
+		)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil && (err != io.EOF || line == "") {
+				if err == io.EOF && seen {
+					break
+				}
+				return err
+			}
+			line = strings.TrimRight(line, "\r\n")
+			if line == "" {
+				if seen {
+					break
+				}
+				continue
+			}
+			if strings.HasPrefix(line, ":") {
+				// comment such as heartbeat
+				continue
+			}
+			seen = true
+			field, value := line, ""
+			if i := strings.Index(line, ":"); i >= 0 {
+				field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+			}
+			switch field {
+			case "id":
+				event.ID = value
+			case "event":
+				event.Event = value
+			case "data":
+				if data.Len() > 0 {
+					data.WriteByte('\n')
+				}
+				data.WriteString(value)
+			}
+		}
+		if event.Event == "error" {
+			return errors.New(data.String())
+		}
+		if e, ok := v.(*Event); ok {
+			event.Data = json.RawMessage(data.Bytes())
+			*e = event
+			return nil
+		}
+		return errors.WithStack(json.Unmarshal(data.Bytes(), v))
+	}
+}
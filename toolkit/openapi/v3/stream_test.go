@@ -0,0 +1,86 @@
+package v3
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+type streamRow struct {
+	Name string `json:"name"`
+}
+
+func TestStream_SendNext(t *testing.T) {
+	s := NewStream(1)
+	go func() {
+		for _, name := range []string{"a", "b"} {
+			if err := s.Send(context.Background(), streamRow{Name: name}); err != nil {
+				return
+			}
+		}
+		s.Finish(errors.New("mock error"))
+	}()
+	var row streamRow
+	require.NoError(t, s.Next(&row))
+	require.Equal(t, "a", row.Name)
+	var m map[string]interface{}
+	require.NoError(t, s.Next(&m))
+	require.Equal(t, "b", m["name"])
+	require.EqualError(t, s.Next(&row), "mock error")
+}
+
+func TestStream_Close(t *testing.T) {
+	s := NewStream(0)
+	require.NoError(t, s.Close())
+	require.Equal(t, ErrStreamClosed, s.Send(context.Background(), 1))
+	require.NoError(t, s.Close())
+}
+
+func TestStream_Reader(t *testing.T) {
+	s := NewStream(2)
+	go func() {
+		s.Send(context.Background(), streamRow{Name: "a"})
+		s.Send(context.Background(), streamRow{Name: "b"})
+		s.Finish(nil)
+	}()
+	data, err := ioutil.ReadAll(s.Reader())
+	require.NoError(t, err)
+	require.Equal(t, "{\"name\":\"a\"}\n{\"name\":\"b\"}\n", string(data))
+
+	rs := NewReaderStream(NDJSONMediaType, ioutil.NopCloser(strings.NewReader(string(data))))
+	var row streamRow
+	require.NoError(t, rs.Next(&row))
+	require.Equal(t, "a", row.Name)
+	require.NoError(t, rs.Next(&row))
+	require.Equal(t, "b", row.Name)
+	require.Equal(t, io.EOF, rs.Next(&row))
+}
+
+func TestNewReaderStream_EventStream(t *testing.T) {
+	body := ": heartbeat\n\nid: 1\ndata: {\"name\":\"a\"}\n\nid: 2\nevent: progress\ndata: 50\n\nevent: error\ndata: mock error\n\n"
+	s := NewReaderStream(EventStreamMediaType, ioutil.NopCloser(strings.NewReader(body)))
+	var row streamRow
+	require.NoError(t, s.Next(&row))
+	require.Equal(t, "a", row.Name)
+	var event Event
+	require.NoError(t, s.Next(&event))
+	require.Equal(t, "2", event.ID)
+	require.Equal(t, "progress", event.Event)
+	require.EqualValues(t, "50", event.Data)
+	require.EqualError(t, s.Next(&row), "mock error")
+}
+
+func TestNewReaderStream_Raw(t *testing.T) {
+	s := NewReaderStream("text/csv", ioutil.NopCloser(strings.NewReader("a,b\n")))
+	require.True(t, s.IsRaw())
+	require.Equal(t, "text/csv", s.ContentType())
+	var row streamRow
+	require.Error(t, s.Next(&row))
+	data, err := ioutil.ReadAll(s.Reader())
+	require.NoError(t, err)
+	require.Equal(t, "a,b\n", string(data))
+}